@@ -36,24 +36,16 @@ func main() {
 		Args:    os.Args[1:],
 	}
 	var (
-		helperImage string
-		image       string
+		image string
 	)
-	o.FlagSet.StringVar(&helperImage, "helper-image", "", "cbipluginhelper image")
 	o.FlagSet.StringVar(&image, "buildah-image", "", "image with /docker-build-push.sh, used for running buildah job")
-	o.CreateBackend = func() (base.Backend, error) {
-		if helperImage == "" {
-			glog.Fatal("no helper-image provided")
-		}
+	o.CreateBackend = func(helper cbipluginhelper.Helper) (base.Backend, error) {
 		if image == "" {
 			glog.Fatal("no buildah-image provided")
 		}
 		b := &buildah.Buildah{
-			Helper: cbipluginhelper.Helper{
-				Image:   helperImage,
-				HomeDir: "/root",
-			},
-			Image: image,
+			Helper: helper,
+			Image:  image,
 		}
 		return b, nil
 	}
@@ -36,17 +36,12 @@ func main() {
 		Args:    os.Args[1:],
 	}
 	var (
-		helperImage   string
 		buildctlImage string
 		buildkitdAddr string
 	)
-	o.FlagSet.StringVar(&helperImage, "helper-image", "", "cbipluginhelper image")
 	o.FlagSet.StringVar(&buildctlImage, "buildctl-image", "", "image used for running buildctl job")
 	o.FlagSet.StringVar(&buildkitdAddr, "buildkitd-addr", "", "buildkitd address (e.g. tcp://service:1234)")
-	o.CreateBackend = func() (base.Backend, error) {
-		if helperImage == "" {
-			glog.Fatal("no helper-image provided")
-		}
+	o.CreateBackend = func(helper cbipluginhelper.Helper) (base.Backend, error) {
 		if buildctlImage == "" {
 			glog.Fatal("no buildctl-image provided")
 		}
@@ -54,10 +49,7 @@ func main() {
 			glog.Fatal("no buildkitd-addr provided")
 		}
 		b := &buildkit.BuildKit{
-			Helper: cbipluginhelper.Helper{
-				Image:   helperImage,
-				HomeDir: "/root",
-			},
+			Helper:        helper,
 			BuildctlImage: buildctlImage,
 			BuildkitdAddr: buildkitdAddr,
 		}
@@ -36,24 +36,16 @@ func main() {
 		Args:    os.Args[1:],
 	}
 	var (
-		helperImage string
-		image       string
+		image string
 	)
-	o.FlagSet.StringVar(&helperImage, "helper-image", "", "cbipluginhelper image")
 	o.FlagSet.StringVar(&image, "gcloud-image", "", "gcloud image")
-	o.CreateBackend = func() (base.Backend, error) {
-		if helperImage == "" {
-			glog.Fatal("no helper-image provided")
-		}
+	o.CreateBackend = func(helper cbipluginhelper.Helper) (base.Backend, error) {
 		if image == "" {
 			glog.Fatal("no gcloud-image provided")
 		}
 		b := &gcb.GCB{
-			Helper: cbipluginhelper.Helper{
-				Image:   helperImage,
-				HomeDir: "/root",
-			},
-			Image: image,
+			Helper: helper,
+			Image:  image,
 		}
 		return b, nil
 	}
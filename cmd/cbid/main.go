@@ -22,10 +22,13 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"io/ioutil"
+	"net/http"
 	"strings"
 	"time"
 	"unicode"
 
+	"github.com/ghodss/yaml"
 	"github.com/golang/glog"
 	"google.golang.org/grpc"
 	kubeinformers "k8s.io/client-go/informers"
@@ -34,6 +37,7 @@ import (
 	// Uncomment the following line to load the gcp plugin (only required to authenticate against GKE clusters).
 	// _ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
 
+	crd "github.com/containerbuilding/cbi/pkg/apis/cbi/v1alpha1"
 	"github.com/containerbuilding/cbi/pkg/cbid/controller"
 	"github.com/containerbuilding/cbi/pkg/cbid/pluginselector"
 	"github.com/containerbuilding/cbi/pkg/cbid/pluginselector/generic"
@@ -41,12 +45,32 @@ import (
 	informers "github.com/containerbuilding/cbi/pkg/client/informers/externalversions"
 	"github.com/containerbuilding/cbi/pkg/plugin"
 	"github.com/containerbuilding/cbi/pkg/signals"
+	"github.com/containerbuilding/cbi/pkg/trigger"
+	"github.com/containerbuilding/cbi/pkg/webhook"
 )
 
 var (
 	masterURL  string
 	kubeconfig string
 	pluginsStr string
+
+	webhookAddr        string
+	webhookTLSCertFile string
+	webhookTLSKeyFile  string
+
+	triggerAddr         string
+	triggerTemplateFile string
+	triggerSecretFile   string
+
+	metricsAddr string
+
+	logsRcloneRemote string
+
+	allowExtraArgs     bool
+	extraArgsAllowlist string
+
+	pluginWaitMaxBackoff time.Duration
+	pluginWaitDeadline   time.Duration
 )
 
 func main() {
@@ -69,9 +93,10 @@ func main() {
 		cbiPluginConns = append(cbiPluginConns, c)
 	}
 	ps := pluginselector.NewPluginSelector(generic.SelectPlugin, cbiPluginConns...)
-	// FIXME: keep them latest
+	// the info is updated again by the controller when no plugin supports a BuildJob,
+	// so that the plugins that are not ready yet (e.g. at cluster bootstrap) are used later.
 	if err := ps.UpdateCachedInfo(context.TODO()); err != nil {
-		glog.Fatal(err)
+		glog.Warningf("failed to fetch the info of some plugins: %v", err)
 	}
 
 	// set up signals so we handle the first shutdown signal gracefully
@@ -95,6 +120,20 @@ func main() {
 	kubeInformerFactory := kubeinformers.NewSharedInformerFactory(kubeClient, time.Second*30)
 	cbiInformerFactory := informers.NewSharedInformerFactory(cbiClient, time.Second*30)
 
+	var logsStore controller.LogsStore
+	if logsRcloneRemote != "" {
+		logsStore = &controller.RcloneLogsStore{Remote: logsRcloneRemote}
+	}
+	extraArgsPolicy := controller.ExtraArgsPolicy{
+		Enabled:   allowExtraArgs,
+		Allowlist: strings.FieldsFunc(extraArgsAllowlist, func(c rune) bool { return c == ',' || unicode.IsSpace(c) }),
+	}
+	pluginWaitPolicy := controller.PluginWaitPolicy{
+		InitialBackoff: controller.DefaultPluginWaitPolicy.InitialBackoff,
+		MaxBackoff:     pluginWaitMaxBackoff,
+		Deadline:       pluginWaitDeadline,
+	}
+
 	controller := controller.New(
 		kubeClient,
 		cbiClient,
@@ -102,6 +141,29 @@ func main() {
 		cbiInformerFactory,
 		ps)
 
+	controller.SetLogsStore(logsStore)
+	controller.SetExtraArgsPolicy(extraArgsPolicy)
+	controller.SetPluginWaitPolicy(pluginWaitPolicy)
+
+	if webhookAddr != "" {
+		if webhookTLSCertFile == "" || webhookTLSKeyFile == "" {
+			glog.Fatalf("--webhook-tls-cert-file and --webhook-tls-key-file are required for --webhook-addr")
+		}
+		go serveWebhook()
+	}
+
+	if triggerAddr != "" {
+		h, err := newTriggerHandler(cbiClient)
+		if err != nil {
+			glog.Fatal(err)
+		}
+		go serveTrigger(h)
+	}
+
+	if metricsAddr != "" {
+		go serveMetrics(controller.MetricsHandler())
+	}
+
 	go kubeInformerFactory.Start(stopCh)
 	go cbiInformerFactory.Start(stopCh)
 
@@ -115,6 +177,60 @@ func main() {
 	}
 }
 
+func serveWebhook() {
+	mux := http.NewServeMux()
+	mux.Handle("/validate", &webhook.Handler{})
+	glog.Infof("Serving the admission webhook on %s", webhookAddr)
+	if err := http.ListenAndServeTLS(webhookAddr, webhookTLSCertFile, webhookTLSKeyFile, mux); err != nil {
+		glog.Fatalf("Error serving the admission webhook: %s", err.Error())
+	}
+}
+
+func newTriggerHandler(cbiClient clientset.Interface) (*trigger.Handler, error) {
+	if triggerTemplateFile == "" || triggerSecretFile == "" {
+		return nil, fmt.Errorf("--trigger-template-file and --trigger-secret-file are required for --trigger-addr")
+	}
+	b, err := ioutil.ReadFile(triggerTemplateFile)
+	if err != nil {
+		return nil, err
+	}
+	var tmpl crd.BuildJob
+	if err := yaml.Unmarshal(b, &tmpl); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", triggerTemplateFile, err)
+	}
+	secret, err := ioutil.ReadFile(triggerSecretFile)
+	if err != nil {
+		return nil, err
+	}
+	secret = []byte(strings.TrimSpace(string(secret)))
+	if len(secret) == 0 {
+		return nil, fmt.Errorf("%s is empty", triggerSecretFile)
+	}
+	return &trigger.Handler{
+		Client:   cbiClient,
+		Template: &tmpl,
+		Secret:   secret,
+	}, nil
+}
+
+func serveTrigger(h *trigger.Handler) {
+	mux := http.NewServeMux()
+	mux.Handle("/push", h)
+	glog.Infof("Serving the push event webhook on %s", triggerAddr)
+	if err := http.ListenAndServe(triggerAddr, mux); err != nil {
+		glog.Fatalf("Error serving the push event webhook: %s", err.Error())
+	}
+}
+
+func serveMetrics(h http.Handler) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", h)
+	glog.Infof("Serving the metrics on %s", metricsAddr)
+	if err := http.ListenAndServe(metricsAddr, mux); err != nil {
+		glog.Fatalf("Error serving the metrics: %s", err.Error())
+	}
+}
+
 func parsePluginsStr(s string) ([]string, error) {
 	fields := strings.FieldsFunc(s, func(c rune) bool { return c == ',' || unicode.IsSpace(c) })
 	var res []string
@@ -134,4 +250,16 @@ func init() {
 	flag.StringVar(&kubeconfig, "kubeconfig", "", "Path to a kubeconfig. Only required if out-of-cluster.")
 	flag.StringVar(&masterURL, "master", "", "The address of the Kubernetes API server. Overrides any value in kubeconfig. Only required if out-of-cluster.")
 	flag.StringVar(&pluginsStr, "cbi-plugins", "", "Comma-separated list of CBI plugin hostname[:port]")
+	flag.StringVar(&webhookAddr, "webhook-addr", "", "The address to serve the validating admission webhook on (e.g. \":8443\"). Disabled if empty.")
+	flag.StringVar(&webhookTLSCertFile, "webhook-tls-cert-file", "", "Path to the TLS certificate for the admission webhook.")
+	flag.StringVar(&webhookTLSKeyFile, "webhook-tls-key-file", "", "Path to the TLS key for the admission webhook.")
+	flag.StringVar(&triggerAddr, "trigger-addr", "", "The address to serve the GitHub/GitLab push event webhook on (e.g. \":8080\"). Disabled if empty.")
+	flag.StringVar(&triggerTemplateFile, "trigger-template-file", "", "Path to the BuildJob template (YAML) for the push event webhook.")
+	flag.StringVar(&triggerSecretFile, "trigger-secret-file", "", "Path to the secret for verifying the push event webhook requests.")
+	flag.StringVar(&metricsAddr, "metrics-addr", "", "The address to serve the Prometheus metrics on /metrics (e.g. \":9090\"). Disabled if empty.")
+	flag.StringVar(&logsRcloneRemote, "logs-rclone-remote", "", "rclone REMOTE:PATH for storing the logs of the BuildJobs with spec.persistLogs. Requires rclone to be installed and configured.")
+	flag.BoolVar(&allowExtraArgs, "allow-extra-args", false, "Allow spec.extraArgs, the raw flags passed to the builders. Rejected if false.")
+	flag.DurationVar(&pluginWaitMaxBackoff, "plugin-wait-max-backoff", controller.DefaultPluginWaitPolicy.MaxBackoff, "The maximum delay between the retries of the plugin selection for BuildJobs that no plugin supports yet.")
+	flag.DurationVar(&pluginWaitDeadline, "plugin-wait-deadline", controller.DefaultPluginWaitPolicy.Deadline, "The duration after which BuildJobs that no plugin supports are marked as failed. 0 for retrying forever.")
+	flag.StringVar(&extraArgsAllowlist, "extra-args-allowlist", "", "Comma-separated list of the flag names allowed in spec.extraArgs (e.g. \"--network,--squash\"). All the flags are allowed if empty.")
 }
@@ -269,7 +269,7 @@ func GenerateServiceAccount(namespace string) (*Manifest, error) {
 	}, nil
 }
 
-func GenerateClusterRole(roCRDs []*aev1.CustomResourceDefinition) (*Manifest, error) {
+func GenerateClusterRole(crds []*aev1.CustomResourceDefinition) (*Manifest, error) {
 	o := rbacv1.ClusterRole{
 		TypeMeta: metav1.TypeMeta{
 			APIVersion: rbacv1.SchemeGroupVersion.String(),
@@ -284,13 +284,31 @@ func GenerateClusterRole(roCRDs []*aev1.CustomResourceDefinition) (*Manifest, er
 				Resources: []string{"jobs"},
 				Verbs:     []string{rbacv1.VerbAll},
 			},
+			{
+				APIGroups: []string{corev1.GroupName},
+				Resources: []string{"pods"},
+				Verbs:     []string{"get", "list", "watch"},
+			},
+			{
+				// for ContextFetchStallThreshold and PersistLogs
+				APIGroups: []string{corev1.GroupName},
+				Resources: []string{"pods/log"},
+				Verbs:     []string{"get"},
+			},
+			{
+				// for the resource versions of the ConfigMap contexts with ContextCacheClaimRef
+				APIGroups: []string{corev1.GroupName},
+				Resources: []string{"configmaps"},
+				Verbs:     []string{"get"},
+			},
 		},
 	}
-	for _, x := range roCRDs {
+	for _, x := range crds {
+		// update is needed for the status and the finalizer
 		rule := rbacv1.PolicyRule{
 			APIGroups: []string{x.Spec.Group},
 			Resources: []string{x.Spec.Names.Plural},
-			Verbs:     []string{"get", "list", "watch"},
+			Verbs:     []string{"get", "list", "watch", "update"},
 		}
 		o.Rules = append(o.Rules, rule)
 	}
@@ -337,6 +355,8 @@ func GeneratePluginDeployment(namespace, pluginName, registry, tag string, args
 		"-logtostderr",
 		"-v=4",
 		fmt.Sprintf("-helper-image=%s/cbipluginhelper:%s", registry, tag),
+		// the controller parses the progress of fetching the context from the json logs
+		"-helper-log-format=json",
 	}, args...)
 	o := appsv1.Deployment{
 		TypeMeta: metav1.TypeMeta{
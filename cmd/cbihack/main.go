@@ -28,7 +28,7 @@ func main() {
 	debug := false
 	app := &cli.App{}
 	app.Name = "cbihack"
-	app.Usage = "Used by `make`. Not designed to be called manually."
+	app.Usage = "Used by `make`, and for debugging the plugins (`render-context`)."
 	app.Flags = []cli.Flag{
 		&cli.BoolFlag{
 			Name:        "debug",
@@ -38,6 +38,7 @@ func main() {
 	}
 	app.Commands = []*cli.Command{
 		generateManifests,
+		renderContext,
 	}
 	app.Before = func(context *cli.Context) error {
 		if debug {
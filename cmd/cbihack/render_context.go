@@ -0,0 +1,132 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+	"gopkg.in/urfave/cli.v2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	crd "github.com/containerbuilding/cbi/pkg/apis/cbi/v1alpha1"
+	"github.com/containerbuilding/cbi/pkg/plugin/base/cbipluginhelper"
+)
+
+var renderContext = &cli.Command{
+	Name:      "render-context",
+	Usage:     "Render the pod spec injected by cbipluginhelper for the context of a BuildJob, without accessing the cluster.",
+	ArgsUsage: "[flags] BUILDJOB-YAML (\"-\" for stdin)",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "helper-image",
+			Usage: "cbipluginhelper image",
+			Value: "cbipluginhelper",
+		},
+		&cli.StringFlag{
+			Name:  "home-dir",
+			Usage: "home directory of the user of the build container",
+			Value: "/root",
+		},
+		&cli.BoolFlag{
+			Name:  "allow-local-context",
+			Usage: "enable Local context",
+		},
+		&cli.StringFlag{
+			Name:  "max-context-size",
+			Usage: "maximum size of the contexts (e.g. 1Gi)",
+		},
+		&cli.BoolFlag{
+			Name:  "skip-configmap-copy",
+			Usage: "mount ConfigMap contexts directly",
+		},
+	},
+	Action: renderContextAction,
+}
+
+func renderContextAction(clicontext *cli.Context) error {
+	file := clicontext.Args().Get(0)
+	if file == "" {
+		return errors.New("BUILDJOB-YAML missing")
+	}
+	var (
+		b   []byte
+		err error
+	)
+	if file == "-" {
+		b, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		b, err = ioutil.ReadFile(file)
+	}
+	if err != nil {
+		return err
+	}
+	var buildJob crd.BuildJob
+	if err := yaml.Unmarshal(b, &buildJob); err != nil {
+		return errors.Wrapf(err, "failed to parse %s", file)
+	}
+	h := cbipluginhelper.Helper{
+		Image:             clicontext.String("helper-image"),
+		HomeDir:           clicontext.String("home-dir"),
+		AllowLocalContext: clicontext.Bool("allow-local-context"),
+	}
+	if s := clicontext.String("max-context-size"); s != "" {
+		if h.MaxContextSize, err = resource.ParseQuantity(s); err != nil {
+			return errors.Wrap(err, "invalid --max-context-size")
+		}
+	}
+	podSpec, contextPath, err := renderContextPodSpec(h, buildJob.Spec.Context, clicontext.Bool("skip-configmap-copy"))
+	if err != nil {
+		return err
+	}
+	out, err := yaml.Marshal(podSpec)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(clicontext.App.Writer, "# context: %s\n%s", contextPath, out)
+	return nil
+}
+
+// renderContextPodSpec injects the context into a pod spec with a placeholder build container,
+// and returns the pod spec and the context path in the build container.
+func renderContextPodSpec(h cbipluginhelper.Helper, c crd.Context, skipConfigMapCopy bool) (*corev1.PodSpec, string, error) {
+	podSpec := &corev1.PodSpec{
+		RestartPolicy: corev1.RestartPolicyNever,
+		Containers: []corev1.Container{
+			{
+				Name:  "build",
+				Image: "build",
+			},
+		},
+	}
+	ci := cbipluginhelper.ContextInjector{
+		Injector: cbipluginhelper.Injector{
+			Helper:        h,
+			TargetPodSpec: podSpec,
+		},
+		SkipConfigMapCopy: skipConfigMapCopy,
+	}
+	contextPath, err := ci.Inject(c)
+	if err != nil {
+		return nil, "", err
+	}
+	return podSpec, contextPath, nil
+}
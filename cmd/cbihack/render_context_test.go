@@ -0,0 +1,131 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"testing"
+
+	"github.com/ghodss/yaml"
+	corev1 "k8s.io/api/core/v1"
+
+	crd "github.com/containerbuilding/cbi/pkg/apis/cbi/v1alpha1"
+	"github.com/containerbuilding/cbi/pkg/plugin/base/cbipluginhelper"
+)
+
+func TestRenderContextPodSpec(t *testing.T) {
+	h := cbipluginhelper.Helper{
+		Image:   "cbipluginhelper",
+		HomeDir: "/root",
+	}
+	cases := []struct {
+		context           string
+		skipConfigMapCopy bool
+		expectedPath      string
+		expectedInit      []string
+	}{
+		{
+			context: `
+kind: Git
+git:
+  url: https://github.com/example/foo.git
+  revision: v1.0.0`,
+			expectedPath: "/cbi-gitcontext/context",
+			expectedInit: []string{"cbi-gitcontext-init"},
+		},
+		{
+			context: `
+kind: ConfigMap
+configMapRef:
+  name: foo`,
+			expectedPath: "/cbi-cmcontext/context",
+			expectedInit: []string{"cbi-cmcontext-init"},
+		},
+		{
+			context: `
+kind: ConfigMap
+configMapRef:
+  name: foo`,
+			skipConfigMapCopy: true,
+			expectedPath:      "/cbi-cmcontext",
+		},
+		{
+			context: `
+kind: HTTP
+http:
+  url: https://example.com/foo.tar.gz`,
+			expectedPath: "/cbi-httpcontext/context",
+			expectedInit: []string{"cbi-httpcontext-init"},
+		},
+		{
+			context: `
+kind: Rclone
+rclone:
+  remote: remote
+  path: foo
+  secretRef:
+    name: rclone-secret`,
+			expectedPath: "/cbi-rclonecontext/context",
+			expectedInit: []string{"cbi-rclonecontext-init"},
+		},
+	}
+	for _, c := range cases {
+		var ctx crd.Context
+		if err := yaml.Unmarshal([]byte(c.context), &ctx); err != nil {
+			t.Fatal(err)
+		}
+		podSpec, contextPath, err := renderContextPodSpec(h, ctx, c.skipConfigMapCopy)
+		if err != nil {
+			t.Fatalf("%s: %v", c.context, err)
+		}
+		if contextPath != c.expectedPath {
+			t.Fatalf("%s: expected %q, got %q", c.context, c.expectedPath, contextPath)
+		}
+		var initNames []string
+		for _, ic := range podSpec.InitContainers {
+			initNames = append(initNames, ic.Name)
+		}
+		if len(initNames) != len(c.expectedInit) || (len(initNames) > 0 && initNames[0] != c.expectedInit[0]) {
+			t.Fatalf("%s: expected init containers %v, got %v", c.context, c.expectedInit, initNames)
+		}
+		if !hasVolumeMountFor(podSpec.Containers[0], contextPath) {
+			t.Fatalf("%s: %q is not mounted: %+v", c.context, contextPath, podSpec.Containers[0].VolumeMounts)
+		}
+		if _, err := yaml.Marshal(podSpec); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRenderContextPodSpecInvalid(t *testing.T) {
+	h := cbipluginhelper.Helper{
+		Image:   "cbipluginhelper",
+		HomeDir: "/root",
+	}
+	// Local context is disabled by default
+	if _, _, err := renderContextPodSpec(h, crd.Context{Kind: crd.ContextKindLocal, Local: crd.Local{Path: "/foo"}}, false); err == nil {
+		t.Fatal("error is expected")
+	}
+}
+
+func hasVolumeMountFor(c corev1.Container, p string) bool {
+	for _, m := range c.VolumeMounts {
+		if p == m.MountPath || len(p) > len(m.MountPath) && p[:len(m.MountPath)+1] == m.MountPath+"/" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,165 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/cyphar/filepath-securejoin"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// maxSymlinkTarget is the maximum length of the symlink targets in zip archives (PATH_MAX of Linux).
+const maxSymlinkTarget = 4096
+
+// untar extracts a tar stream into dir.
+// Entries are confined within dir.
+func untar(r io.Reader, dir string) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		target, err := securejoin.SecureJoin(dir, hdr.Name)
+		if err != nil {
+			return err
+		}
+		logrus.Debugf("extracting %q", hdr.Name)
+		mode := os.FileMode(hdr.Mode).Perm()
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(target, mode|0700)
+		case tar.TypeReg, tar.TypeRegA:
+			err = writeFile(target, tr, mode)
+		case tar.TypeSymlink:
+			err = symlink(hdr.Linkname, target)
+		case tar.TypeLink:
+			var oldname string
+			oldname, err = securejoin.SecureJoin(dir, hdr.Linkname)
+			if err == nil {
+				err = os.Link(oldname, target)
+			}
+		default:
+			logrus.Warnf("ignoring %q (type %q)", hdr.Name, hdr.Typeflag)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// untarZstd extracts a zstd-compressed tar stream into dir, using the zstd command.
+// Entries are confined within dir.
+func untarZstd(ctx context.Context, r io.Reader, dir string) error {
+	cmd := exec.CommandContext(ctx, "zstd", "-dc")
+	cmd.Stdin = r
+	cmd.Stderr = os.Stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	if err := untar(stdout, dir); err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return err
+	}
+	return cmd.Wait()
+}
+
+// unzip extracts a zip archive into dir.
+// Entries are confined within dir.
+func unzip(r io.ReaderAt, size int64, dir string) error {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return err
+	}
+	for _, f := range zr.File {
+		if err := unzipFile(f, dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func unzipFile(f *zip.File, dir string) error {
+	target, err := securejoin.SecureJoin(dir, f.Name)
+	if err != nil {
+		return err
+	}
+	logrus.Debugf("extracting %q", f.Name)
+	mode := f.Mode()
+	if mode.IsDir() {
+		return os.MkdirAll(target, mode.Perm()|0700)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	if mode&os.ModeSymlink != 0 {
+		// the content of a symlink entry is the link target.
+		// UncompressedSize64 is not trusted, as the header is controlled by the archive.
+		b, err := ioutil.ReadAll(io.LimitReader(rc, maxSymlinkTarget+1))
+		if err != nil {
+			return err
+		}
+		if len(b) > maxSymlinkTarget {
+			return errors.Errorf("the symlink target of %q exceeds %d bytes", f.Name, maxSymlinkTarget)
+		}
+		return symlink(string(b), target)
+	}
+	return writeFile(target, rc, mode.Perm())
+}
+
+func writeFile(target string, r io.Reader, mode os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// symlink creates a symlink as-is. The link target is not resolved here,
+// as subsequent entries are confined within the directory by SecureJoin.
+func symlink(oldname, target string) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	return os.Symlink(oldname, target)
+}
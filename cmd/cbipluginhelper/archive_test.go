@@ -0,0 +1,211 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var testArchiveFiles = map[string]string{
+	"Dockerfile":   "FROM scratch\n",
+	"foo/bar":      "bar\n",
+	"../../escape": "escape\n",
+}
+
+// expected paths of testArchiveFiles after extraction
+var testArchiveExpected = map[string]string{
+	"Dockerfile": "FROM scratch\n",
+	"foo/bar":    "bar\n",
+	"escape":     "escape\n",
+}
+
+func checkExtracted(t *testing.T, dir string) {
+	for name, content := range testArchiveExpected {
+		b, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != content {
+			t.Fatalf("%s: expected %q, got %q", name, content, string(b))
+		}
+	}
+}
+
+func TestUntar(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for name, content := range testArchiveFiles {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	tmp, err := ioutil.TempDir("", "test-untar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	if err := untar(&buf, filepath.Join(tmp, "ctx")); err != nil {
+		t.Fatal(err)
+	}
+	checkExtracted(t, filepath.Join(tmp, "ctx"))
+}
+
+func TestUnzip(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range testArchiveFiles {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	tmp, err := ioutil.TempDir("", "test-unzip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	if err := unzip(bytes.NewReader(buf.Bytes()), int64(buf.Len()), filepath.Join(tmp, "ctx")); err != nil {
+		t.Fatal(err)
+	}
+	checkExtracted(t, filepath.Join(tmp, "ctx"))
+}
+
+func TestUnzipSymlink(t *testing.T) {
+	testCases := []struct {
+		target  string
+		invalid bool
+	}{
+		{target: "foo/bar"},
+		{target: strings.Repeat("x", maxSymlinkTarget+1), invalid: true},
+	}
+	for _, tc := range testCases {
+		var buf bytes.Buffer
+		zw := zip.NewWriter(&buf)
+		hdr := &zip.FileHeader{Name: "link"}
+		hdr.SetMode(os.ModeSymlink | 0777)
+		w, err := zw.CreateHeader(hdr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(tc.target)); err != nil {
+			t.Fatal(err)
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		tmp, err := ioutil.TempDir("", "test-unzip-symlink")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(tmp)
+		err = unzip(bytes.NewReader(buf.Bytes()), int64(buf.Len()), tmp)
+		if tc.invalid {
+			if err == nil {
+				t.Fatalf("%d bytes: error is expected", len(tc.target))
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		actual, err := os.Readlink(filepath.Join(tmp, "link"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if actual != tc.target {
+			t.Fatalf("expected %q, got %q", tc.target, actual)
+		}
+	}
+}
+
+// testCleanTar returns a tar archive of testArchiveExpected, without the escaping entry
+// that bsdtar refuses.
+func testCleanTar(t *testing.T) []byte {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for name, content := range testArchiveExpected {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestUntarZstd(t *testing.T) {
+	if _, err := exec.LookPath("zstd"); err != nil {
+		t.Skip("zstd not installed")
+	}
+	cmd := exec.Command("zstd", "-c")
+	cmd.Stdin = bytes.NewReader(testCleanTar(t))
+	compressed, err := cmd.Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	tmp, err := ioutil.TempDir("", "test-untar-zstd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	if err := untarZstd(ctx, bytes.NewReader(compressed), filepath.Join(tmp, "explicit")); err != nil {
+		t.Fatal(err)
+	}
+	checkExtracted(t, filepath.Join(tmp, "explicit"))
+	if err := untarZstd(ctx, bytes.NewReader([]byte("not zstd")), filepath.Join(tmp, "invalid")); err == nil {
+		t.Fatal("error is expected for invalid zstd stream")
+	}
+
+	// auto-detection (e.g. for S3 context)
+	if _, err := exec.LookPath("bsdtar"); err != nil {
+		t.Skip("bsdtar not installed")
+	}
+	dir := filepath.Join(tmp, "auto")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := extractArchive(ctx, bytes.NewReader(compressed), dir); err != nil {
+		t.Fatal(err)
+	}
+	checkExtracted(t, dir)
+}
@@ -0,0 +1,165 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/urfave/cli.v2"
+)
+
+// maxContextSize is the value of the global --max-context-size flag.
+var maxContextSize int64
+
+// contextSizeInterval is the interval of checking the size while populating the context.
+var contextSizeInterval = time.Second
+
+// contextAction is the action of a populate-* command.
+// ctx is canceled when DIRECTORY (the last argument) exceeds maxContextSize.
+type contextAction func(ctx context.Context, clicontext *cli.Context) error
+
+// limitContextSize wraps the action of a populate-* command, so that the command fails
+// when DIRECTORY (the last argument) exceeds maxContextSize.
+// The size is checked every contextSizeInterval while fetching, and once again after the action.
+// The files staged next to DIRECTORY (see stagingPrefix) are counted as well.
+func limitContextSize(action contextAction) cli.ActionFunc {
+	return func(clicontext *cli.Context) error {
+		if maxContextSize <= 0 {
+			return action(context.Background(), clicontext)
+		}
+		dir := clicontext.Args().Get(clicontext.Args().Len() - 1)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		exceeded := make(chan struct{})
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			if watchContextSize(ctx, dir, maxContextSize, contextSizeInterval) {
+				close(exceeded)
+				cancel()
+			}
+		}()
+		err := action(ctx, clicontext)
+		cancel()
+		<-done
+		select {
+		case <-exceeded:
+			return errors.Errorf("the context exceeds the maximum size (%d bytes)", maxContextSize)
+		default:
+		}
+		if err != nil {
+			return err
+		}
+		return checkContextSize(dir, maxContextSize)
+	}
+}
+
+// stagingPrefix returns the prefix of the temporary files and directories staged next to dir,
+// e.g. the downloaded archives, so that they are stored in the same volume as dir.
+func stagingPrefix(dir string) string {
+	return "." + filepath.Base(dir) + ".tmp-"
+}
+
+// dirSize returns the total size of the regular files in dir, ignoring the errors.
+// Symlinks are not followed.
+func dirSize(dir string) int64 {
+	var size int64
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
+
+// stagedSize returns the total size of dir and the files staged next to dir.
+func stagedSize(dir string) int64 {
+	size := dirSize(dir)
+	tmps, _ := filepath.Glob(filepath.Join(filepath.Dir(dir), stagingPrefix(dir)+"*"))
+	for _, tmp := range tmps {
+		size += dirSize(tmp)
+	}
+	return size
+}
+
+// watchContextSize returns true when dir and the staged files exceed max bytes, and false when ctx is done.
+func watchContextSize(ctx context.Context, dir string, max int64, interval time.Duration) bool {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-ticker.C:
+			if stagedSize(dir) > max {
+				return true
+			}
+		}
+	}
+}
+
+// contextReader fails once ctx is done, so that the extraction in the process stops
+// when the context exceeds maxContextSize.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
+// contextReaderAt is contextReader for io.ReaderAt.
+type contextReaderAt struct {
+	ctx context.Context
+	r   io.ReaderAt
+}
+
+func (r *contextReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.ReadAt(p, off)
+}
+
+// checkContextSize returns an error if the total size of the files in dir exceeds max bytes.
+// Symlinks are not followed.
+func checkContextSize(dir string, max int64) error {
+	var size int64
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		if size > max {
+			return errors.Errorf("the context exceeds the maximum size (%d bytes)", max)
+		}
+		return nil
+	})
+	return err
+}
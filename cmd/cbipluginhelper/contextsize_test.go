@@ -0,0 +1,101 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/urfave/cli.v2"
+)
+
+func TestCheckContextSize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-check-context-size")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.MkdirAll(filepath.Join(dir, "foo"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, size := range map[string]int{"bar": 600, "foo/baz": 400} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(strings.Repeat("x", size)), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// symlinks are not followed
+	if err := os.Symlink("bar", filepath.Join(dir, "foo/qux")); err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		max      int64
+		exceeded bool
+	}{
+		{max: 1000},
+		{max: 4096},
+		{max: 999, exceeded: true},
+	}
+	for _, c := range cases {
+		err := checkContextSize(dir, c.max)
+		if exceeded := err != nil; exceeded != c.exceeded {
+			t.Fatalf("%+v: unexpected error: %v", c, err)
+		}
+	}
+}
+
+func TestLimitContextSizeWhileFetching(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-limit-context-size")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	oldMax, oldInterval := maxContextSize, contextSizeInterval
+	defer func() { maxContextSize, contextSizeInterval = oldMax, oldInterval }()
+	maxContextSize, contextSizeInterval = 1000, 10*time.Millisecond
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	if err := fs.Parse([]string{dir}); err != nil {
+		t.Fatal(err)
+	}
+	clicontext := cli.NewContext(&cli.App{}, fs, nil)
+	// the action keeps fetching until ctx is canceled
+	action := limitContextSize(func(ctx context.Context, clicontext *cli.Context) error {
+		if err := ioutil.WriteFile(filepath.Join(dir, "foo"), []byte(strings.Repeat("x", 1001)), 0644); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(10 * time.Second):
+			return nil
+		}
+	})
+	begin := time.Now()
+	err = action(clicontext)
+	if err == nil || !strings.Contains(err.Error(), "exceeds the maximum size") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if elapsed := time.Since(begin); elapsed > 5*time.Second {
+		t.Fatalf("the action was not canceled (%v)", elapsed)
+	}
+}
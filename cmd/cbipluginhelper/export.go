@@ -0,0 +1,125 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/urfave/cli.v2"
+
+	pluginapi "github.com/containerbuilding/cbi/pkg/plugin/api"
+)
+
+var terminationMessagePathFlag = &cli.StringFlag{
+	Name:  "termination-message-path",
+	Usage: "Report the location of the exported archive as the Kubernetes termination message. e.g. /dev/termination-log",
+}
+
+var exportRcloneCommand = &cli.Command{
+	Name:      "export-rclone",
+	Usage:     "export an archive via rclone. Requires rclone to be installed.",
+	ArgsUsage: "[flags] FILE REMOTE:PATH",
+	Flags: []cli.Flag{
+		&cli.StringSliceFlag{
+			Name:  "rclone-flag",
+			Usage: "Pass the flag (e.g. --bwlimit=10M) to rclone copyto (can be specified multiple times)",
+		},
+		terminationMessagePathFlag,
+	},
+	Action: exportRcloneAction,
+}
+
+func exportRcloneAction(clicontext *cli.Context) error {
+	file := clicontext.Args().Get(0)
+	if file == "" {
+		return errors.New("FILE missing")
+	}
+	dst := clicontext.Args().Get(1)
+	if dst == "" {
+		return errors.New("REMOTE:PATH missing")
+	}
+	args, err := rcloneArgs("copyto", clicontext.StringSlice("rclone-flag"), file, dst)
+	if err != nil {
+		return err
+	}
+	return exportArchive(context.Background(), file, args, dst, clicontext.String("termination-message-path"))
+}
+
+var exportS3Command = &cli.Command{
+	Name:      "export-s3",
+	Usage:     "export an archive via S3. Requires rclone to be installed. Credentials are read from AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY.",
+	ArgsUsage: "[flags] FILE BUCKET KEY",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "endpoint",
+			Usage: "Endpoint for S3-compatible object stores. Empty for AWS.",
+		},
+		&cli.StringFlag{
+			Name:  "region",
+			Usage: "Region. e.g. us-east-1",
+		},
+		terminationMessagePathFlag,
+	},
+	Action: exportS3Action,
+}
+
+func exportS3Action(clicontext *cli.Context) error {
+	file := clicontext.Args().Get(0)
+	if file == "" {
+		return errors.New("FILE missing")
+	}
+	bucket := clicontext.Args().Get(1)
+	if bucket == "" {
+		return errors.New("BUCKET missing")
+	}
+	key := clicontext.Args().Get(2)
+	if key == "" {
+		return errors.New("KEY missing")
+	}
+	if err := configureS3Remote(clicontext.String("endpoint"), clicontext.String("region")); err != nil {
+		return err
+	}
+	args, err := rcloneArgs("copyto", nil, file, s3Remote+":"+bucket+"/"+key)
+	if err != nil {
+		return err
+	}
+	return exportArchive(context.Background(), file, args, "s3://"+bucket+"/"+key, clicontext.String("termination-message-path"))
+}
+
+// exportArchive runs rclone with args for uploading file, and reports location as
+// the termination message.
+func exportArchive(ctx context.Context, file string, args []string, location, terminationMessagePath string) error {
+	// fail early with a clear message when the build container did not write the archive
+	if _, err := os.Stat(file); err != nil {
+		return errors.Wrap(err, "archive not found")
+	}
+	if err := run(ctx, "rclone", args...); err != nil {
+		return err
+	}
+	logrus.Infof("exported archive: %s", location)
+	if terminationMessagePath == "" {
+		return nil
+	}
+	msg := pluginapi.FormatTerminationMessage(map[string]string{
+		pluginapi.TExportedArchive: location,
+	})
+	return ioutil.WriteFile(terminationMessagePath, []byte(msg), 0644)
+}
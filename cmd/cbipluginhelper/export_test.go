@@ -0,0 +1,72 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	pluginapi "github.com/containerbuilding/cbi/pkg/plugin/api"
+)
+
+func TestExportArchive(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "cbi-test-export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	// fake rclone that records the args
+	argsFile := filepath.Join(tmp, "args")
+	fakeRclone := "#!/bin/sh\necho \"$@\" > " + argsFile + "\n"
+	if err := ioutil.WriteFile(filepath.Join(tmp, "rclone"), []byte(fakeRclone), 0755); err != nil {
+		t.Fatal(err)
+	}
+	oldPath := os.Getenv("PATH")
+	defer os.Setenv("PATH", oldPath)
+	os.Setenv("PATH", tmp+string(os.PathListSeparator)+oldPath)
+
+	archive := filepath.Join(tmp, "image.tar")
+	terminationMessagePath := filepath.Join(tmp, "termination-log")
+	ctx := context.Background()
+	args := []string{"copyto", archive, "remote:foo/image.tar"}
+	if err := exportArchive(ctx, archive, args, "remote:foo/image.tar", terminationMessagePath); err == nil {
+		t.Fatal("error is expected for missing archive")
+	}
+	if err := ioutil.WriteFile(archive, []byte("dummy"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := exportArchive(ctx, archive, args, "remote:foo/image.tar", terminationMessagePath); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(argsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "copyto " + archive + " remote:foo/image.tar\n"; string(b) != expected {
+		t.Fatalf("expected %q, got %q", expected, string(b))
+	}
+	b, err = ioutil.ReadFile(terminationMessagePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := pluginapi.ParseTerminationMessage(string(b))[pluginapi.TExportedArchive]; v != "remote:foo/image.tar" {
+		t.Fatalf("unexpected termination message %q", string(b))
+	}
+}
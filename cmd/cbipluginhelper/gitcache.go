@@ -0,0 +1,78 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/sirupsen/logrus"
+)
+
+// gitCacheKey returns the directory name of the mirror of repoURL in the cache.
+func gitCacheKey(repoURL string) string {
+	h := sha256.Sum256([]byte(repoURL))
+	return hex.EncodeToString(h[:]) + ".git"
+}
+
+// prepareGitCache creates or updates the mirror of repoURL in cacheDir, and returns the path of the mirror.
+// The mirror is locked exclusively until unlock is called, as concurrent BuildJobs may share the cache.
+//
+// prepareGitCache never fails; errors are logged and an empty path is returned so that the caller
+// falls back to a fresh clone. A mirror that cannot be updated (e.g. corrupted) is removed.
+func prepareGitCache(ctx context.Context, cacheDir, repoURL string) (string, func()) {
+	nop := func() {}
+	mirror := filepath.Join(cacheDir, gitCacheKey(repoURL))
+	lockFile, err := os.OpenFile(mirror+".lock", os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		logrus.WithError(err).Warn("failed to open the lock file of the git cache, not using the cache")
+		return "", nop
+	}
+	logrus.Infof("locking the git cache %s", mirror)
+	if err := syscall.Flock(int(lockFile.Fd()), syscall.LOCK_EX); err != nil {
+		lockFile.Close()
+		logrus.WithError(err).Warn("failed to lock the git cache, not using the cache")
+		return "", nop
+	}
+	unlock := func() {
+		syscall.Flock(int(lockFile.Fd()), syscall.LOCK_UN)
+		lockFile.Close()
+	}
+	if _, err := os.Stat(mirror); err == nil {
+		logrus.Infof("updating the git cache %s", mirror)
+		err := run(ctx, "git", "-C", mirror, "remote", "update", "--prune")
+		if err == nil {
+			return mirror, unlock
+		}
+		logrus.WithError(err).Warn("failed to update the git cache, recreating the cache")
+	}
+	if err := os.RemoveAll(mirror); err != nil {
+		logrus.WithError(err).Warn("failed to remove the git cache, not using the cache")
+		return "", unlock
+	}
+	logrus.Infof("creating the git cache %s", mirror)
+	if err := run(ctx, "git", "clone", "--mirror", repoURL, mirror); err != nil {
+		logrus.WithError(err).Warn("failed to create the git cache, not using the cache")
+		os.RemoveAll(mirror)
+		return "", unlock
+	}
+	return mirror, unlock
+}
@@ -0,0 +1,83 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestPrepareGitCache(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	tmp, err := ioutil.TempDir("", "cbi-test-gitcache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	ctx := context.Background()
+	src := filepath.Join(tmp, "src")
+	if err := run(ctx, "git", "init", src); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(src, "Dockerfile"), []byte("FROM scratch\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := run(ctx, "git", "-C", src, "add", "Dockerfile"); err != nil {
+		t.Fatal(err)
+	}
+	if err := run(ctx, "git", "-C", src, "-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-m", "init"); err != nil {
+		t.Fatal(err)
+	}
+	repoURL := "file://" + src
+	cacheDir := filepath.Join(tmp, "cache")
+	if err := os.MkdirAll(cacheDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	// empty cache, valid cache, and corrupted cache
+	for i := 0; i < 3; i++ {
+		if i == 2 {
+			if err := os.RemoveAll(filepath.Join(cacheDir, gitCacheKey(repoURL), "objects")); err != nil {
+				t.Fatal(err)
+			}
+		}
+		mirror, unlock := prepareGitCache(ctx, cacheDir, repoURL)
+		if mirror == "" {
+			unlock()
+			t.Fatalf("attempt %d: cache is not available", i)
+		}
+		dir := filepath.Join(tmp, "clone", strconv.Itoa(i))
+		err := cloneGit(ctx, repoURL, dir, "", mirror, nil)
+		unlock()
+		if err != nil {
+			t.Fatalf("attempt %d: %v", i, err)
+		}
+		if _, err := os.Stat(filepath.Join(dir, "Dockerfile")); err != nil {
+			t.Fatalf("attempt %d: %v", i, err)
+		}
+		// --dissociate removes the dependency on the cache
+		if _, err := os.Stat(filepath.Join(dir, ".git", "objects", "info", "alternates")); !os.IsNotExist(err) {
+			t.Fatalf("attempt %d: the clone should not depend on the cache: %v", i, err)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/urfave/cli.v2"
+)
+
+// The keys of the HTTPS authentication secret, i.e. the file names in --https-auth-dir.
+const (
+	gitHTTPSAuthUsernameKey = "username"
+	gitHTTPSAuthPasswordKey = "password"
+	gitHTTPSAuthTokenKey    = "token"
+)
+
+// gitHTTPSAuthDefaultUsername is used when the secret contains only the token.
+// GitHub (and GitHub-compatible servers) accept any username for tokens.
+const gitHTTPSAuthDefaultUsername = "x-access-token"
+
+// gitCredentialTokenEnv holds the token minted by populate-git (e.g. the GitHub App installation token),
+// so that the token is not written to the disk.
+const gitCredentialTokenEnv = "CBI_GIT_CREDENTIAL_TOKEN"
+
+var gitCredentialCommand = &cli.Command{
+	Name:      "git-credential",
+	Usage:     "git credential helper for populate-git --https-auth-dir and --github-app-dir. Don't call this manually.",
+	ArgsUsage: "[AUTH-DIR] OPERATION",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "token-env",
+			Usage: "Read the token from the environment variable instead of AUTH-DIR",
+		},
+	},
+	Action: gitCredentialAction,
+}
+
+func gitCredentialAction(clicontext *cli.Context) error {
+	tokenEnv := clicontext.String("token-env")
+	args := clicontext.Args().Slice()
+	if tokenEnv == "" {
+		if len(args) == 0 {
+			return errors.New("AUTH-DIR missing")
+		}
+		args = args[1:]
+	}
+	// "store" and "erase" are no-op
+	if len(args) == 0 || args[0] != "get" {
+		return nil
+	}
+	// consume the request (protocol, host, ...), as the credentials are the same for all the hosts
+	if _, err := io.Copy(ioutil.Discard, os.Stdin); err != nil {
+		return err
+	}
+	if tokenEnv != "" {
+		token := os.Getenv(tokenEnv)
+		if token == "" {
+			return errors.Errorf("$%s is not set", tokenEnv)
+		}
+		return formatGitCredentials(os.Stdout, gitHTTPSAuthDefaultUsername, token)
+	}
+	return writeGitCredentials(os.Stdout, clicontext.Args().First())
+}
+
+// readGitHTTPSCredentials reads the username and the password (or the token) from dir.
+// The username defaults to gitHTTPSAuthDefaultUsername when only the token is present.
+func readGitHTTPSCredentials(dir string) (string, string, error) {
+	read := func(key string) (string, error) {
+		b, err := ioutil.ReadFile(filepath.Join(dir, key))
+		if err != nil {
+			if os.IsNotExist(err) {
+				return "", nil
+			}
+			return "", err
+		}
+		return strings.TrimRight(string(b), "\r\n"), nil
+	}
+	var values [3]string
+	for i, key := range []string{gitHTTPSAuthUsernameKey, gitHTTPSAuthPasswordKey, gitHTTPSAuthTokenKey} {
+		v, err := read(key)
+		if err != nil {
+			return "", "", err
+		}
+		values[i] = v
+	}
+	username, password, token := values[0], values[1], values[2]
+	switch {
+	case password != "" && token != "":
+		return "", "", errors.Errorf("%s may not contain both %q and %q", dir, gitHTTPSAuthPasswordKey, gitHTTPSAuthTokenKey)
+	case password != "":
+		if username == "" {
+			return "", "", errors.Errorf("%s needs to contain %q for %q", dir, gitHTTPSAuthUsernameKey, gitHTTPSAuthPasswordKey)
+		}
+		return username, password, nil
+	case token != "":
+		if username == "" {
+			username = gitHTTPSAuthDefaultUsername
+		}
+		return username, token, nil
+	default:
+		return "", "", errors.Errorf("%s needs to contain either %q or %q", dir, gitHTTPSAuthPasswordKey, gitHTTPSAuthTokenKey)
+	}
+}
+
+// writeGitCredentials writes the credentials in dir in the format of git-credential(1).
+func writeGitCredentials(w io.Writer, dir string) error {
+	username, password, err := readGitHTTPSCredentials(dir)
+	if err != nil {
+		return err
+	}
+	return formatGitCredentials(w, username, password)
+}
+
+func formatGitCredentials(w io.Writer, username, password string) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "username=%s\npassword=%s\n", username, password)
+	return bw.Flush()
+}
+
+// configureGitCredentialHelper configures git to use the git-credential command with authDir.
+func configureGitCredentialHelper(authDir string) error {
+	// fail early, rather than on the first request of git
+	if _, _, err := readGitHTTPSCredentials(authDir); err != nil {
+		return err
+	}
+	logrus.Infof("using the HTTPS credentials in %s", authDir)
+	return installGitCredentialHelper(authDir)
+}
+
+// configureGitCredentialHelperToken configures git to use the git-credential command with token,
+// which is passed via the environment rather than the disk.
+func configureGitCredentialHelperToken(token string) error {
+	if err := os.Setenv(gitCredentialTokenEnv, token); err != nil {
+		return err
+	}
+	return installGitCredentialHelper("--token-env", gitCredentialTokenEnv)
+}
+
+// installGitCredentialHelper configures git to use the git-credential command with args,
+// via a temporary global config in $XDG_CONFIG_HOME, so that ~/.gitconfig (which may be read-only)
+// is left untouched. The helper also applies to the submodules and git-lfs.
+func installGitCredentialHelper(args ...string) error {
+	self, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	xdgConfigHome, err := ioutil.TempDir("", "cbi-gitconfig")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Join(xdgConfigHome, "git"), 0700); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(xdgConfigHome, "git", "config"), gitCredentialConfig(self, args...), 0600); err != nil {
+		return err
+	}
+	return os.Setenv("XDG_CONFIG_HOME", xdgConfigHome)
+}
+
+// gitCredentialConfig returns the git config that uses the git-credential command of self with args.
+func gitCredentialConfig(self string, args ...string) []byte {
+	helper := "!" + strconv.Quote(self) + " git-credential"
+	for _, a := range args {
+		helper += " " + strconv.Quote(a)
+	}
+	return []byte(fmt.Sprintf("[credential]\n\thelper = %s\n", strconv.Quote(helper)))
+}
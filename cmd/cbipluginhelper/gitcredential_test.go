@@ -0,0 +1,143 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadGitHTTPSCredentials(t *testing.T) {
+	cases := []struct {
+		files            map[string]string
+		expectedUsername string
+		expectedPassword string
+		invalid          bool
+	}{
+		{
+			files:            map[string]string{"username": "alice", "token": "app-password\n"},
+			expectedUsername: "alice",
+			expectedPassword: "app-password",
+		},
+		{
+			files:            map[string]string{"token": "ghp_foo"},
+			expectedUsername: "x-access-token",
+			expectedPassword: "ghp_foo",
+		},
+		{
+			files:            map[string]string{"username": "alice", "password": "secret"},
+			expectedUsername: "alice",
+			expectedPassword: "secret",
+		},
+		{
+			files:   map[string]string{"password": "secret"},
+			invalid: true,
+		},
+		{
+			files:   map[string]string{"username": "alice", "password": "secret", "token": "ghp_foo"},
+			invalid: true,
+		},
+		{
+			files:   map[string]string{"username": "alice"},
+			invalid: true,
+		},
+	}
+	for _, c := range cases {
+		dir, err := ioutil.TempDir("", "cbi-test-gitcredential")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		for k, v := range c.files {
+			if err := ioutil.WriteFile(filepath.Join(dir, k), []byte(v), 0400); err != nil {
+				t.Fatal(err)
+			}
+		}
+		username, password, err := readGitHTTPSCredentials(dir)
+		if c.invalid {
+			if err == nil {
+				t.Fatalf("%v: error is expected", c.files)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%v: %v", c.files, err)
+		}
+		if username != c.expectedUsername || password != c.expectedPassword {
+			t.Fatalf("%v: expected %q:%q, got %q:%q", c.files, c.expectedUsername, c.expectedPassword, username, password)
+		}
+		var b bytes.Buffer
+		if err := writeGitCredentials(&b, dir); err != nil {
+			t.Fatal(err)
+		}
+		expected := "username=" + c.expectedUsername + "\npassword=" + c.expectedPassword + "\n"
+		if b.String() != expected {
+			t.Fatalf("%v: expected %q, got %q", c.files, expected, b.String())
+		}
+	}
+}
+
+func TestGitCredentialConfig(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	tmp, err := ioutil.TempDir("", "cbi-test-gitcredential")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	config := filepath.Join(tmp, "config")
+	if err := ioutil.WriteFile(config, gitCredentialConfig("/cbipluginhelper", "/cbi auth"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	out, err := exec.Command("git", "config", "--file", config, "credential.helper").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `!"/cbipluginhelper" git-credential "/cbi auth"`
+	if actual := strings.TrimSpace(string(out)); actual != expected {
+		t.Fatalf("expected %q, got %q", expected, actual)
+	}
+}
+
+func TestConfigureGitCredentialHelperToken(t *testing.T) {
+	for _, env := range []string{"XDG_CONFIG_HOME", gitCredentialTokenEnv} {
+		if v, ok := os.LookupEnv(env); ok {
+			defer os.Setenv(env, v)
+		} else {
+			defer os.Unsetenv(env)
+		}
+	}
+	if err := configureGitCredentialHelperToken("ghs_secret"); err != nil {
+		t.Fatal(err)
+	}
+	xdgConfigHome := os.Getenv("XDG_CONFIG_HOME")
+	defer os.RemoveAll(xdgConfigHome)
+	b, err := ioutil.ReadFile(filepath.Join(xdgConfigHome, "git", "config"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the token is passed via the environment, not via the disk
+	if strings.Contains(string(b), "ghs_secret") || !strings.Contains(string(b), gitCredentialTokenEnv) {
+		t.Fatalf("unexpected config %q", string(b))
+	}
+}
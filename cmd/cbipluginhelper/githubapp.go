@@ -0,0 +1,195 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// The keys of the GitHub App secret, i.e. the file names in --github-app-dir.
+const (
+	githubAppIDKey             = "appID"
+	githubAppInstallationIDKey = "installationID"
+	githubAppPrivateKeyKey     = "privateKey"
+)
+
+// githubApp is the GitHub App installation used for minting the installation token.
+type githubApp struct {
+	appID          string
+	installationID string
+	privateKey     *rsa.PrivateKey
+}
+
+// readGitHubApp reads the app ID, the installation ID, and the PEM private key from dir.
+func readGitHubApp(dir string) (*githubApp, error) {
+	var values [3]string
+	for i, key := range []string{githubAppIDKey, githubAppInstallationIDKey, githubAppPrivateKeyKey} {
+		b, err := ioutil.ReadFile(filepath.Join(dir, key))
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil, errors.Errorf("%s needs to contain %q", dir, key)
+			}
+			return nil, err
+		}
+		values[i] = strings.TrimSpace(string(b))
+	}
+	key, err := parseRSAPrivateKey([]byte(values[2]))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse %q in %s", githubAppPrivateKeyKey, dir)
+	}
+	return &githubApp{appID: values[0], installationID: values[1], privateKey: key}, nil
+}
+
+// parseRSAPrivateKey parses PKCS#1 (as generated by GitHub) and PKCS#8 PEM keys.
+func parseRSAPrivateKey(b []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.Errorf("expected RSA private key, got %T", parsed)
+	}
+	return key, nil
+}
+
+// githubAPIURL returns the REST API endpoint of the server of repoURL,
+// i.e. https://api.github.com for github.com, and https://HOST/api/v3 for GitHub Enterprise Server.
+func githubAPIURL(repoURL string) (string, error) {
+	u, err := url.Parse(repoURL)
+	if err != nil {
+		return "", err
+	}
+	if !strings.EqualFold(u.Scheme, "https") || u.Host == "" {
+		return "", errors.Errorf("GitHub App requires https:// URL, got %q", repoURL)
+	}
+	if strings.EqualFold(u.Host, "github.com") || strings.EqualFold(u.Host, "www.github.com") {
+		return "https://api.github.com", nil
+	}
+	return "https://" + u.Host + "/api/v3", nil
+}
+
+// jwt returns the JWT for authenticating as the app.
+// iat is backdated for clock skew, and exp is below the maximum of 10 minutes.
+func (a *githubApp) jwt(now time.Time) (string, error) {
+	enc := base64.RawURLEncoding
+	header := enc.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT"}`))
+	claims, err := json.Marshal(map[string]interface{}{
+		"iat": now.Add(-time.Minute).Unix(),
+		"exp": now.Add(9 * time.Minute).Unix(),
+		"iss": a.appID,
+	})
+	if err != nil {
+		return "", err
+	}
+	signed := header + "." + enc.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, a.privateKey, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return signed + "." + enc.EncodeToString(sig), nil
+}
+
+// installationToken mints a short-lived installation token, restricted to reading the contents.
+func (a *githubApp) installationToken(ctx context.Context, client *http.Client, apiURL string) (string, error) {
+	jwt, err := a.jwt(time.Now())
+	if err != nil {
+		return "", err
+	}
+	body := []byte(`{"permissions":{"contents":"read"}}`)
+	u := fmt.Sprintf("%s/app/installations/%s/access_tokens", strings.TrimSuffix(apiURL, "/"), url.PathEscape(a.installationID))
+	req, err := http.NewRequest(http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+jwt)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusCreated {
+		return "", errors.Errorf("failed to mint the installation token for GitHub App %s: %s: %s", a.appID, resp.Status, strings.TrimSpace(string(b)))
+	}
+	var res struct {
+		Token string `json:"token"`
+	}
+	if err := json.Unmarshal(b, &res); err != nil {
+		return "", err
+	}
+	if res.Token == "" {
+		return "", errors.New("no installation token returned")
+	}
+	return res.Token, nil
+}
+
+// configureGitHubApp mints the installation token of the app in dir, and configures git to use the token.
+// The token is kept in the environment of populate-git, and expires in an hour.
+func configureGitHubApp(ctx context.Context, dir, repoURL string) error {
+	app, err := readGitHubApp(dir)
+	if err != nil {
+		return err
+	}
+	apiURL, err := githubAPIURL(repoURL)
+	if err != nil {
+		return err
+	}
+	client, err := newHTTPClient("", false)
+	if err != nil {
+		return err
+	}
+	token, err := app.installationToken(ctx, client, apiURL)
+	if err != nil {
+		return err
+	}
+	logrus.Infof("using the installation token of GitHub App %s", app.appID)
+	return configureGitCredentialHelperToken(token)
+}
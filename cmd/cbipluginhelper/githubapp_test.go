@@ -0,0 +1,165 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGitHubAPIURL(t *testing.T) {
+	cases := []struct {
+		repoURL  string
+		expected string
+		invalid  bool
+	}{
+		{repoURL: "https://github.com/foo/bar.git", expected: "https://api.github.com"},
+		{repoURL: "HTTPS://GitHub.com/foo/bar", expected: "https://api.github.com"},
+		{repoURL: "https://github.example.com/foo/bar.git", expected: "https://github.example.com/api/v3"},
+		{repoURL: "https://github.example.com:8443/foo/bar.git", expected: "https://github.example.com:8443/api/v3"},
+		{repoURL: "git@github.com:foo/bar.git", invalid: true},
+		{repoURL: "http://github.example.com/foo/bar.git", invalid: true},
+	}
+	for _, c := range cases {
+		actual, err := githubAPIURL(c.repoURL)
+		if c.invalid {
+			if err == nil {
+				t.Fatalf("%q: error is expected", c.repoURL)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%q: %v", c.repoURL, err)
+		}
+		if actual != c.expected {
+			t.Fatalf("%q: expected %q, got %q", c.repoURL, c.expected, actual)
+		}
+	}
+}
+
+func writeTestGitHubApp(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "cbi-test-githubapp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, k), []byte(v), 0400); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestGitHubAppInstallationToken(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	dir := writeTestGitHubApp(t, map[string]string{
+		"appID":          "42\n",
+		"installationID": "4242\n",
+		"privateKey":     string(keyPEM),
+	})
+	defer os.RemoveAll(dir)
+	app, err := readGitHubApp(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/api/v3/app/installations/4242/access_tokens" {
+			http.Error(w, "unexpected request "+r.Method+" "+r.URL.Path, http.StatusNotFound)
+			return
+		}
+		jwt := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		parts := strings.Split(jwt, ".")
+		if len(parts) != 3 {
+			http.Error(w, "malformed JWT", http.StatusUnauthorized)
+			return
+		}
+		sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+		if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], sig); err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		claimsJSON, err := base64.RawURLEncoding.DecodeString(parts[1])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		var claims struct {
+			Iat int64  `json:"iat"`
+			Exp int64  `json:"exp"`
+			Iss string `json:"iss"`
+		}
+		if err := json.Unmarshal(claimsJSON, &claims); err != nil || claims.Iss != "42" || claims.Exp-claims.Iat > 600 {
+			http.Error(w, "unexpected claims "+string(claimsJSON), http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"token":"ghs_foo","expires_at":"2016-07-11T22:14:10Z"}`))
+	}))
+	defer ts.Close()
+
+	token, err := app.installationToken(context.TODO(), ts.Client(), ts.URL+"/api/v3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "ghs_foo" {
+		t.Fatalf("expected ghs_foo, got %q", token)
+	}
+
+	// the error from the server is reported
+	app.installationID = "1"
+	if _, err := app.installationToken(context.TODO(), ts.Client(), ts.URL+"/api/v3"); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Fatalf("expected 404 error, got %v", err)
+	}
+}
+
+func TestReadGitHubAppInvalid(t *testing.T) {
+	cases := []map[string]string{
+		{"appID": "42", "installationID": "4242"},
+		{"appID": "42", "installationID": "4242", "privateKey": "not a key"},
+	}
+	for _, files := range cases {
+		dir := writeTestGitHubApp(t, files)
+		defer os.RemoveAll(dir)
+		if _, err := readGitHubApp(dir); err == nil {
+			t.Fatalf("%v: error is expected", files)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/urfave/cli.v2"
+)
+
+// heartbeatInterval is the interval of checking the progress of populate-* commands.
+// The controller regards an init container without log lines as stalled
+// (see BuildJobSpec.ContextFetchStallThreshold).
+const heartbeatInterval = 30 * time.Second
+
+// withHeartbeat wraps the action of a populate-* command, so that a heartbeat line is logged
+// every heartbeatInterval while DIRECTORY (the last argument) or the files staged next to it
+// (e.g. the downloaded archives) keep growing.
+// No heartbeat is logged when no progress is made, e.g. when the remote hangs.
+func withHeartbeat(action cli.ActionFunc) cli.ActionFunc {
+	return func(clicontext *cli.Context) error {
+		dir := clicontext.Args().Get(clicontext.Args().Len() - 1)
+		stop := make(chan struct{})
+		defer close(stop)
+		go heartbeat(dir, heartbeatInterval, stop)
+		return action(clicontext)
+	}
+}
+
+func heartbeat(dir string, interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var last int64
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if size := stagedSize(dir); size != last {
+				last = size
+				logrus.WithFields(logrus.Fields{"phase": "heartbeat", "bytes": size}).Infof("heartbeat: %d bytes populated", size)
+			}
+		}
+	}
+}
@@ -0,0 +1,107 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+type syncBuffer struct {
+	mu sync.Mutex
+	b  bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.b.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.b.String()
+}
+
+func TestHeartbeat(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-heartbeat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	var buf syncBuffer
+	logrus.SetOutput(&buf)
+	defer logrus.SetOutput(os.Stderr)
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		heartbeat(dir, 10*time.Millisecond, stop)
+		close(done)
+	}()
+	if err := ioutil.WriteFile(filepath.Join(dir, "foo"), []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// no heartbeat is logged while the directory does not grow
+	time.Sleep(200 * time.Millisecond)
+	close(stop)
+	<-done
+	if n := strings.Count(buf.String(), "heartbeat: 5 bytes populated"); n != 1 {
+		t.Fatalf("expected 1 heartbeat, got %d: %q", n, buf.String())
+	}
+}
+
+func TestHeartbeatStaged(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "test-heartbeat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	dir := filepath.Join(tmp, "context")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	var buf syncBuffer
+	logrus.SetOutput(&buf)
+	defer logrus.SetOutput(os.Stderr)
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		heartbeat(dir, 10*time.Millisecond, stop)
+		close(done)
+	}()
+	// the archive being downloaded is counted as progress, while DIRECTORY is still empty
+	if err := ioutil.WriteFile(filepath.Join(tmp, stagingPrefix(dir)+"archive"), []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(200 * time.Millisecond)
+	close(stop)
+	<-done
+	if n := strings.Count(buf.String(), "heartbeat: 5 bytes populated"); n != 1 {
+		t.Fatalf("expected 1 heartbeat, got %d: %q", n, buf.String())
+	}
+}
@@ -26,6 +26,7 @@ import (
 
 func main() {
 	debug := false
+	logFormat := "text"
 	app := &cli.App{}
 	app.Name = "cbipluginhelper"
 	app.Usage = "Don't call this manually"
@@ -35,15 +36,43 @@ func main() {
 			Usage:       "debug mode",
 			Destination: &debug,
 		},
+		&cli.StringFlag{
+			Name:        "log-format",
+			Usage:       "log format (text or json). The json format emits JSON lines with the \"phase\" and \"percent\" fields for the progress",
+			Value:       logFormat,
+			Destination: &logFormat,
+		},
+		&cli.Int64Flag{
+			Name:        "max-context-size",
+			Usage:       "fail populate-* commands when the populated DIRECTORY exceeds the size in bytes (0 for unlimited)",
+			Destination: &maxContextSize,
+		},
 	}
 	app.Commands = []*cli.Command{
+		populateConfigMapCommand,
 		populateGitCommand,
 		populateHTTPCommand,
+		populateRcloneCommand,
+		populateS3Command,
+		populateGCSCommand,
+		populateAzureCommand,
+		populateOCICommand,
+		exportRcloneCommand,
+		exportS3Command,
+		mergeDockerConfigCommand,
+		gitCredentialCommand,
 	}
 	app.Before = func(context *cli.Context) error {
 		if debug {
 			logrus.SetLevel(logrus.DebugLevel)
 		}
+		switch logFormat {
+		case "text":
+		case "json":
+			logrus.SetFormatter(&logrus.JSONFormatter{})
+		default:
+			return fmt.Errorf("unknown log format: %q", logFormat)
+		}
 		return nil
 	}
 	if err := app.Run(os.Args); err != nil {
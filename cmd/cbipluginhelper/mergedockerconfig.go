@@ -0,0 +1,128 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/urfave/cli.v2"
+)
+
+var mergeDockerConfigCommand = &cli.Command{
+	Name:      "merge-docker-config",
+	Usage:     "merge docker config.json files. The later files take precedence for the same registry.",
+	ArgsUsage: "OUTPUT [INPUT...]",
+	Flags: []cli.Flag{
+		&cli.StringSliceFlag{
+			Name:  "cred-helper",
+			Usage: "Add the credential helper for the registry, in the form of REGISTRY=HELPER (e.g. example.com=ecr-login). Takes precedence over INPUT",
+		},
+	},
+	Action: mergeDockerConfigAction,
+}
+
+func mergeDockerConfigAction(clicontext *cli.Context) error {
+	args := clicontext.Args().Slice()
+	credHelpers, err := parseCredHelpers(clicontext.StringSlice("cred-helper"))
+	if err != nil {
+		return err
+	}
+	if len(args) < 1 || (len(args) < 2 && len(credHelpers) == 0) {
+		return errors.New("OUTPUT and INPUT missing")
+	}
+	var inputs [][]byte
+	for _, f := range args[1:] {
+		b, err := ioutil.ReadFile(f)
+		if err != nil {
+			return err
+		}
+		inputs = append(inputs, b)
+	}
+	if len(credHelpers) > 0 {
+		b, err := json.Marshal(map[string]interface{}{"credHelpers": credHelpers})
+		if err != nil {
+			return err
+		}
+		inputs = append(inputs, b)
+	}
+	merged, err := mergeDockerConfig(inputs...)
+	if err != nil {
+		return err
+	}
+	output := args[0]
+	if err := os.MkdirAll(filepath.Dir(output), 0755); err != nil {
+		return err
+	}
+	// contains credentials
+	return ioutil.WriteFile(output, merged, 0600)
+}
+
+// parseCredHelpers parses REGISTRY=HELPER strings.
+func parseCredHelpers(ss []string) (map[string]string, error) {
+	m := make(map[string]string)
+	for _, s := range ss {
+		kv := strings.SplitN(s, "=", 2)
+		if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+			return nil, errors.Errorf("invalid credential helper %q: must be in the form of REGISTRY=HELPER", s)
+		}
+		m[kv[0]] = kv[1]
+	}
+	return m, nil
+}
+
+// mergeDockerConfig merges the "auths" and the "credHelpers" of the docker config.json contents.
+// The other fields are overridden by the later contents.
+func mergeDockerConfig(inputs ...[]byte) ([]byte, error) {
+	merged := make(map[string]interface{})
+	auths := make(map[string]interface{})
+	credHelpers := make(map[string]interface{})
+	for i, b := range inputs {
+		var m map[string]interface{}
+		if err := json.Unmarshal(b, &m); err != nil {
+			return nil, errors.Wrapf(err, "failed to parse the config #%d", i)
+		}
+		for k, v := range m {
+			var dest map[string]interface{}
+			switch k {
+			case "auths":
+				dest = auths
+			case "credHelpers":
+				dest = credHelpers
+			default:
+				merged[k] = v
+				continue
+			}
+			a, ok := v.(map[string]interface{})
+			if !ok {
+				return nil, errors.Errorf("unexpected %q in the config #%d", k, i)
+			}
+			for host, x := range a {
+				dest[host] = x
+			}
+		}
+	}
+	merged["auths"] = auths
+	if len(credHelpers) > 0 {
+		merged["credHelpers"] = credHelpers
+	}
+	return json.Marshal(merged)
+}
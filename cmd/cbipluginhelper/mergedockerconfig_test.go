@@ -0,0 +1,86 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestMergeDockerConfig(t *testing.T) {
+	pull := `{"auths":{"docker.io":{"auth":"cHVsbA=="},"quay.io":{"auth":"cHVsbA=="}},"credsStore":"foo"}`
+	push := `{"auths":{"docker.io":{"auth":"cHVzaA=="}}}`
+	b, err := mergeDockerConfig([]byte(pull), []byte(push))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var actual map[string]interface{}
+	if err := json.Unmarshal(b, &actual); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"auths": map[string]interface{}{
+			"docker.io": map[string]interface{}{"auth": "cHVzaA=="},
+			"quay.io":   map[string]interface{}{"auth": "cHVsbA=="},
+		},
+		"credsStore": "foo",
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("expected %v, got %v", expected, actual)
+	}
+	if _, err := mergeDockerConfig([]byte(`{"auths":[]}`)); err == nil {
+		t.Fatal("error is expected for invalid auths")
+	}
+}
+
+func TestMergeDockerConfigCredHelpers(t *testing.T) {
+	credHelpers, err := parseCredHelpers([]string{"123456789012.dkr.ecr.us-east-1.amazonaws.com=ecr-login"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	generated, err := json.Marshal(map[string]interface{}{"credHelpers": credHelpers})
+	if err != nil {
+		t.Fatal(err)
+	}
+	push := `{"auths":{"docker.io":{"auth":"cHVzaA=="}},"credHelpers":{"gcr.io":"gcr","123456789012.dkr.ecr.us-east-1.amazonaws.com":"foo"}}`
+	b, err := mergeDockerConfig([]byte(push), generated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var actual map[string]interface{}
+	if err := json.Unmarshal(b, &actual); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"auths": map[string]interface{}{
+			"docker.io": map[string]interface{}{"auth": "cHVzaA=="},
+		},
+		"credHelpers": map[string]interface{}{
+			"gcr.io": "gcr",
+			"123456789012.dkr.ecr.us-east-1.amazonaws.com": "ecr-login",
+		},
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("expected %v, got %v", expected, actual)
+	}
+	for _, s := range []string{"ecr-login", "=ecr-login", "example.com="} {
+		if _, err := parseCredHelpers([]string{s}); err == nil {
+			t.Fatalf("%q: error is expected", s)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"os"
+
+	"github.com/pkg/errors"
+	"gopkg.in/urfave/cli.v2"
+)
+
+var populateAzureCommand = &cli.Command{
+	Name:      "populate-azure",
+	Usage:     "populate an archive via Azure Blob Storage. Requires rclone and bsdtar to be installed. Credentials are read from AZURE_STORAGE_KEY or AZURE_STORAGE_SAS_URL.",
+	ArgsUsage: "[flags] ACCOUNT CONTAINER BLOB DIRECTORY",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "endpoint",
+			Usage: "Endpoint of the blob service. Empty for https://ACCOUNT.blob.core.windows.net",
+		},
+	},
+	Action: withHeartbeat(limitContextSize(populateAzureAction)),
+}
+
+// azureRemote is the name of the rclone remote configured via environment variables.
+const azureRemote = "cbiazure"
+
+func populateAzureAction(ctx context.Context, clicontext *cli.Context) error {
+	account := clicontext.Args().Get(0)
+	if account == "" {
+		return errors.New("ACCOUNT missing")
+	}
+	container := clicontext.Args().Get(1)
+	if container == "" {
+		return errors.New("CONTAINER missing")
+	}
+	blob := clicontext.Args().Get(2)
+	if blob == "" {
+		return errors.New("BLOB missing")
+	}
+	dir := clicontext.Args().Get(3)
+	if dir == "" {
+		return errors.New("DIRECTORY missing")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	if err := configureAzureRemote(account, clicontext.String("endpoint")); err != nil {
+		return err
+	}
+	return populateRcloneArchive(ctx, azureRemote+":"+container+"/"+blob, dir)
+}
+
+// configureAzureRemote configures the rclone remote via environment variables,
+// so that users do not need to write the rclone config.
+// The account key takes precedence over the SAS URL.
+func configureAzureRemote(account, endpoint string) error {
+	const prefix = "RCLONE_CONFIG_CBIAZURE_"
+	env := map[string]string{
+		"TYPE":     "azureblob",
+		"ACCOUNT":  account,
+		"ENDPOINT": endpoint,
+	}
+	switch {
+	case os.Getenv("AZURE_STORAGE_KEY") != "":
+		env["KEY"] = os.Getenv("AZURE_STORAGE_KEY")
+	case os.Getenv("AZURE_STORAGE_SAS_URL") != "":
+		env["SAS_URL"] = os.Getenv("AZURE_STORAGE_SAS_URL")
+	default:
+		// e.g. managed identities
+		env["ENV_AUTH"] = "true"
+	}
+	return setRcloneRemoteEnv(prefix, env)
+}
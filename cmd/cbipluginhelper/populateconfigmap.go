@@ -0,0 +1,172 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cyphar/filepath-securejoin"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/urfave/cli.v2"
+)
+
+var populateConfigMapCommand = &cli.Command{
+	Name:      "populate-configmap",
+	Usage:     "populate files from a ConfigMap volume, including binaryData entries. Requires bsdtar to be installed (only for --archive-key).",
+	ArgsUsage: "[flags] VOLUME DIRECTORY",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "archive-key",
+			Usage: "Extract the entry (a tar archive, optionally compressed) instead of copying the volume",
+		},
+		&cli.BoolFlag{
+			Name:  "reuse",
+			Usage: "Skip populating when DIRECTORY already exists, and populate DIRECTORY atomically otherwise (for the directories shared across pods)",
+		},
+	},
+	Action: withHeartbeat(limitContextSize(populateConfigMapAction)),
+}
+
+func populateConfigMapAction(ctx context.Context, clicontext *cli.Context) error {
+	vol := clicontext.Args().Get(0)
+	if vol == "" {
+		return errors.New("VOLUME missing")
+	}
+	dir := clicontext.Args().Get(1)
+	if dir == "" {
+		return errors.New("DIRECTORY missing")
+	}
+	key := clicontext.String("archive-key")
+	if clicontext.Bool("reuse") {
+		return populateReuse(dir, func(tmp string) error {
+			return populateConfigMap(ctx, vol, key, tmp)
+		})
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	return populateConfigMap(ctx, vol, key, dir)
+}
+
+func populateConfigMap(ctx context.Context, vol, key, dir string) error {
+	if key != "" {
+		p, err := securejoin.SecureJoin(vol, key)
+		if err != nil {
+			return err
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		return extractArchive(ctx, f, dir)
+	}
+	return copyConfigMapVolume(vol, dir)
+}
+
+// populateReuse populates dir with populate, unless dir already exists.
+// populate is called with a temporary directory, which is renamed to dir on success,
+// so that the other pods never see a partially populated dir.
+func populateReuse(dir string, populate func(string) error) error {
+	if _, err := os.Stat(dir); err == nil {
+		logrus.Infof("reusing %s", dir)
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(dir), 0755); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempDir(filepath.Dir(dir), stagingPrefix(dir))
+	if err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp, 0755); err != nil {
+		os.RemoveAll(tmp)
+		return err
+	}
+	if err := populate(tmp); err != nil {
+		os.RemoveAll(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, dir); err != nil {
+		os.RemoveAll(tmp)
+		// populated by another pod in the meantime
+		if _, statErr := os.Stat(dir); statErr == nil {
+			logrus.Infof("reusing %s", dir)
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+// copyConfigMapVolume copies the entries of a ConfigMap volume to dir, dereferencing the symlinks.
+// The internal entries created by kubelet (e.g. "..data") are skipped.
+// The file modes (DefaultMode and Items[].Mode of the volume) are preserved.
+// The contents are copied byte-for-byte, so that binaryData entries are not corrupted.
+func copyConfigMapVolume(vol, dir string) error {
+	entries, err := ioutil.ReadDir(vol)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), "..") {
+			continue
+		}
+		if err := copyDereference(filepath.Join(vol, e.Name()), filepath.Join(dir, e.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func copyDereference(src, dst string) error {
+	st, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	if !st.IsDir() {
+		logrus.Debugf("copying %q", src)
+		f, err := os.Open(src)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if err := writeFile(dst, f, st.Mode().Perm()); err != nil {
+			return err
+		}
+		// the mode passed to writeFile is masked by umask, e.g. for executable scripts
+		return os.Chmod(dst, st.Mode().Perm())
+	}
+	if err := os.MkdirAll(dst, st.Mode().Perm()|0700); err != nil {
+		return err
+	}
+	entries, err := ioutil.ReadDir(src)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if err := copyDereference(filepath.Join(src, e.Name()), filepath.Join(dst, e.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
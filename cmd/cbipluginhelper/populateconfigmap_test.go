@@ -0,0 +1,166 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestCopyConfigMapVolume(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "cbi-test-configmap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	binary := make([]byte, 512)
+	for i := range binary {
+		binary[i] = byte(i)
+	}
+	files := map[string][]byte{
+		"Dockerfile":    []byte("FROM scratch\nADD blob /\n"),
+		"blob":          binary,
+		"app/Some.file": []byte("\x00\xff\r\n"),
+	}
+	// mimic the layout created by kubelet:
+	// `KEY -> ..data/KEY`, `..data -> ..TIMESTAMP`
+	vol := filepath.Join(tmp, "vol")
+	for name, content := range files {
+		if err := writeFile(filepath.Join(vol, "..2018_01_01", name), bytes.NewReader(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("..2018_01_01", filepath.Join(vol, "..data")); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"Dockerfile", "blob", "app"} {
+		if err := os.Symlink(filepath.Join("..data", name), filepath.Join(vol, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dir := filepath.Join(tmp, "context")
+	if err := copyConfigMapVolume(vol, dir); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		p := filepath.Join(dir, name)
+		st, err := os.Lstat(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !st.Mode().IsRegular() {
+			t.Fatalf("%s: expected a regular file, got %v", name, st.Mode())
+		}
+		b, err := ioutil.ReadFile(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(content, b) {
+			t.Fatalf("%s: content mismatch", name)
+		}
+	}
+	if _, err := os.Lstat(filepath.Join(dir, "..data")); !os.IsNotExist(err) {
+		t.Fatalf("..data should not be copied: %v", err)
+	}
+}
+
+func TestCopyConfigMapVolumeMode(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "cbi-test-configmap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	// the mode of the ConfigMap volume needs to be preserved regardless of umask
+	oldUmask := syscall.Umask(0077)
+	defer syscall.Umask(oldUmask)
+	vol := filepath.Join(tmp, "vol")
+	script := []byte("#!/bin/sh\necho ok\n")
+	if err := writeFile(filepath.Join(vol, "..2018_01_01", "build.sh"), bytes.NewReader(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(filepath.Join(vol, "..2018_01_01", "build.sh"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("..2018_01_01", filepath.Join(vol, "..data")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join("..data", "build.sh"), filepath.Join(vol, "build.sh")); err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Join(tmp, "context")
+	if err := copyConfigMapVolume(vol, dir); err != nil {
+		t.Fatal(err)
+	}
+	p := filepath.Join(dir, "build.sh")
+	st, err := os.Stat(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Mode().Perm() != 0755 {
+		t.Fatalf("expected 0755, got %v", st.Mode().Perm())
+	}
+	out, err := exec.Command(p).Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "ok\n" {
+		t.Fatalf("unexpected output %q", string(out))
+	}
+}
+
+func TestPopulateReuse(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "cbi-test-configmap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	dir := filepath.Join(tmp, "configmap", "deadbeef")
+	calls := 0
+	populate := func(d string) error {
+		calls++
+		return ioutil.WriteFile(filepath.Join(d, "Dockerfile"), []byte("FROM scratch\n"), 0644)
+	}
+	for i := 0; i < 2; i++ {
+		if err := populateReuse(dir, populate); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if calls != 1 {
+		t.Fatalf("expected the directory to be populated once, got %d", calls)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "Dockerfile")); err != nil {
+		t.Fatal(err)
+	}
+
+	// a failed attempt leaves nothing behind
+	failed := filepath.Join(tmp, "configmap", "failed")
+	if err := populateReuse(failed, func(d string) error { return os.ErrInvalid }); err == nil {
+		t.Fatal("error is expected")
+	}
+	entries, err := ioutil.ReadDir(filepath.Join(tmp, "configmap"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "deadbeef" {
+		t.Fatalf("unexpected entries %v", entries)
+	}
+}
@@ -0,0 +1,73 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"os"
+
+	"github.com/pkg/errors"
+	"gopkg.in/urfave/cli.v2"
+)
+
+var populateGCSCommand = &cli.Command{
+	Name:      "populate-gcs",
+	Usage:     "populate an archive via Google Cloud Storage. Requires rclone and bsdtar to be installed. Credentials are read from GCS_SERVICE_ACCOUNT_CREDENTIALS.",
+	ArgsUsage: "BUCKET OBJECT DIRECTORY",
+	Action:    withHeartbeat(limitContextSize(populateGCSAction)),
+}
+
+// gcsRemote is the name of the rclone remote configured via environment variables.
+const gcsRemote = "cbigcs"
+
+func populateGCSAction(ctx context.Context, clicontext *cli.Context) error {
+	bucket := clicontext.Args().Get(0)
+	if bucket == "" {
+		return errors.New("BUCKET missing")
+	}
+	object := clicontext.Args().Get(1)
+	if object == "" {
+		return errors.New("OBJECT missing")
+	}
+	dir := clicontext.Args().Get(2)
+	if dir == "" {
+		return errors.New("DIRECTORY missing")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	if err := configureGCSRemote(); err != nil {
+		return err
+	}
+	return populateRcloneArchive(ctx, gcsRemote+":"+bucket+"/"+object, dir)
+}
+
+// configureGCSRemote configures the rclone remote via environment variables,
+// so that users do not need to write the rclone config.
+func configureGCSRemote() error {
+	const prefix = "RCLONE_CONFIG_CBIGCS_"
+	env := map[string]string{
+		"TYPE": "google cloud storage",
+	}
+	if creds := os.Getenv("GCS_SERVICE_ACCOUNT_CREDENTIALS"); creds != "" {
+		env["SERVICE_ACCOUNT_CREDENTIALS"] = creds
+	} else {
+		// e.g. Workload Identity
+		env["ENV_AUTH"] = "true"
+	}
+	return setRcloneRemoteEnv(prefix, env)
+}
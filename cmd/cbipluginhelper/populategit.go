@@ -18,10 +18,17 @@ package main
 
 import (
 	"context"
+	"io/ioutil"
 	"os"
+	"regexp"
+	"strconv"
+	"time"
 
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 	"gopkg.in/urfave/cli.v2"
+
+	pluginapi "github.com/containerbuilding/cbi/pkg/plugin/api"
 )
 
 var populateGitCommand = &cli.Command{
@@ -31,13 +38,78 @@ var populateGitCommand = &cli.Command{
 	Flags: []cli.Flag{
 		&cli.StringFlag{
 			Name:  "revision",
-			Usage: "Revision. e.g. master",
+			Usage: "Revision. e.g. master (default: HEAD of the default branch)",
+		},
+		&cli.StringFlag{
+			Name:  "revision-type",
+			Usage: "Type of the revision: auto, branch, tag, or commit",
+			Value: revisionTypeAuto,
+		},
+		&cli.StringFlag{
+			Name:  "fetch-refspec",
+			Usage: "Fetch the refspec verbatim and check out FETCH_HEAD, instead of --revision. e.g. refs/pull/42/head",
+		},
+		&cli.IntFlag{
+			Name:  "depth",
+			Usage: "Create a shallow clone with the specified number of commits (0 for full clone)",
+		},
+		&cli.BoolFlag{
+			Name:  "single-commit",
+			Usage: "Fetch only the commit of the revision (by SHA for a full commit SHA, with depth 1 otherwise), falling back to a full clone if the server does not allow fetching the SHA. Ignored when --depth is specified",
+		},
+		&cli.BoolFlag{
+			Name:  "single-branch",
+			Usage: "Fetch only the refs of the branch or the tag of the revision (the default branch if empty). Implied by --depth and --single-commit, ignored with --fetch-refspec",
+		},
+		&cli.BoolFlag{
+			Name:  "recursive",
+			Usage: "Initialize and update submodules recursively after checkout",
+		},
+		&cli.BoolFlag{
+			Name:  "lfs",
+			Usage: "Fetch Git LFS objects after checkout. Requires git-lfs to be installed",
+		},
+		&cli.StringFlag{
+			Name:  "ssh-known-hosts",
+			Usage: "Enable strict host key checking with the known_hosts file, if the file exists",
+		},
+		&cli.BoolFlag{
+			Name:  "strict-host-key-checking",
+			Usage: "Require the file specified in --ssh-known-hosts to exist",
+		},
+		&cli.StringFlag{
+			Name:  "https-auth-dir",
+			Usage: "Directory containing \"username\" and \"password\", or \"token\" (with optional \"username\", defaults to x-access-token) for HTTPS authentication",
+		},
+		&cli.StringFlag{
+			Name:  "github-app-dir",
+			Usage: "Directory containing \"appID\", \"installationID\", and \"privateKey\" of the GitHub App for HTTPS authentication",
+		},
+		&cli.StringSliceFlag{
+			Name:  "sparse-path",
+			Usage: "Check out only the specified directory with sparse-checkout (can be specified multiple times)",
+		},
+		&cli.StringFlag{
+			Name:  "cache-dir",
+			Usage: "Cache the mirror of the repo in the directory, and use it as the reference for non-shallow clones",
+		},
+		&cli.IntFlag{
+			Name:  "retries",
+			Usage: "Retry fetching the repo up to the specified number of times, with exponential backoff",
+		},
+		&cli.StringFlag{
+			Name:  "resolved-revision-file",
+			Usage: "Write the resolved commit SHA to the file",
+		},
+		&cli.StringFlag{
+			Name:  "termination-message-path",
+			Usage: "Report the resolved commit SHA as the Kubernetes termination message. e.g. /dev/termination-log",
 		},
 	},
-	Action: populateGitAction,
+	Action: withHeartbeat(limitContextSize(populateGitAction)),
 }
 
-func populateGitAction(clicontext *cli.Context) error {
+func populateGitAction(ctx context.Context, clicontext *cli.Context) error {
 	repoURL := clicontext.Args().Get(0)
 	if repoURL == "" {
 		return errors.New("REPOURL missing")
@@ -46,13 +118,366 @@ func populateGitAction(clicontext *cli.Context) error {
 	if dir == "" {
 		return errors.New("DIRECTORY missing")
 	}
-	ctx := context.Background()
-	if err := run(ctx, "git", "clone", repoURL, dir); err != nil {
+	if err := configureGitSSH(clicontext.String("ssh-known-hosts"), clicontext.Bool("strict-host-key-checking")); err != nil {
+		return err
+	}
+	authDir, appDir := clicontext.String("https-auth-dir"), clicontext.String("github-app-dir")
+	if authDir != "" && appDir != "" {
+		return errors.New("--https-auth-dir and --github-app-dir are mutually exclusive")
+	}
+	if authDir != "" {
+		if err := configureGitCredentialHelper(authDir); err != nil {
+			return err
+		}
+	}
+	if appDir != "" {
+		if err := configureGitHubApp(ctx, appDir, repoURL); err != nil {
+			return err
+		}
+	}
+	lfs := clicontext.Bool("lfs")
+	if lfs {
+		if err := checkGitLFS(ctx); err != nil {
+			return err
+		}
+	}
+	revision := clicontext.String("revision")
+	revisionType := clicontext.String("revision-type")
+	refspec := clicontext.String("fetch-refspec")
+	if refspec != "" && (revision != "" || revisionType != revisionTypeAuto) {
+		return errors.New("--fetch-refspec and --revision are mutually exclusive")
+	}
+	checkoutRev, err := checkoutRevision(revision, revisionType)
+	if err != nil {
+		return err
+	}
+	fetchRef, err := shallowFetchRef(revision, revisionType)
+	if err != nil {
+		return err
+	}
+	var cloneOpts []string
+	if clicontext.Bool("single-branch") && refspec == "" {
+		cloneOpts, err = singleBranchCloneOpts(revision, revisionType)
+		if err != nil {
+			return err
+		}
+	}
+	sparsePaths := clicontext.StringSlice("sparse-path")
+	fetch := func() error {
+		// clean up the previous attempt
+		if err := os.RemoveAll(dir); err != nil {
+			return err
+		}
+		logPhase("clone")
+		fullClone := func() error {
+			var reference string
+			if cacheDir := clicontext.String("cache-dir"); cacheDir != "" {
+				var unlock func()
+				reference, unlock = prepareGitCache(ctx, cacheDir, repoURL)
+				defer unlock()
+			}
+			return cloneGit(ctx, repoURL, dir, checkoutRev, reference, sparsePaths, cloneOpts...)
+		}
+		var err error
+		depth := clicontext.Int("depth")
+		switch {
+		case refspec != "":
+			// the cache is not used, as the mirror does not contain refs such as refs/pull/*
+			if depth == 0 && clicontext.Bool("single-commit") {
+				depth = 1
+			}
+			err = refspecCloneGit(ctx, repoURL, dir, refspec, depth, sparsePaths)
+		case depth > 0:
+			err = shallowCloneGit(ctx, repoURL, dir, revision, fetchRef, depth, sparsePaths)
+		case clicontext.Bool("single-commit"):
+			err = singleCommitCloneGit(ctx, repoURL, dir, revision, fetchRef, sparsePaths, fullClone)
+		default:
+			err = fullClone()
+		}
+		if err != nil {
+			return err
+		}
+		if lfs {
+			logPhase("lfs")
+			if err := pullGitLFS(ctx, dir); err != nil {
+				return err
+			}
+		}
+		if clicontext.Bool("recursive") {
+			// submodules are fetched with the same ~/.ssh as the parent repo.
+			// URLs in .gitmodules are used as-is.
+			logPhase("submodules")
+			return run(ctx, "git", "-C", dir, "submodule", "update", "--init", "--recursive")
+		}
+		return nil
+	}
+	if err := retry(clicontext.Int("retries"), time.Second, fetch); err != nil {
+		return err
+	}
+	return reportResolvedRevision(ctx, dir, clicontext.String("resolved-revision-file"), clicontext.String("termination-message-path"))
+}
+
+// configureGitSSH sets GIT_SSH_COMMAND for enabling strict host key checking when knownHosts exists.
+// When strict is true, knownHosts is required to exist.
+func configureGitSSH(knownHosts string, strict bool) error {
+	if knownHosts == "" {
+		if strict {
+			return errors.New("strict host key checking requires --ssh-known-hosts")
+		}
+		return nil
+	}
+	if _, err := os.Stat(knownHosts); err != nil {
+		if os.IsNotExist(err) && !strict {
+			return nil
+		}
+		return errors.Wrapf(err, "strict host key checking requires %s", knownHosts)
+	}
+	logrus.Infof("enabling strict host key checking with %s", knownHosts)
+	// command-line options take precedence over ~/.ssh/config
+	return os.Setenv("GIT_SSH_COMMAND", "ssh -o StrictHostKeyChecking=yes -o UserKnownHostsFile="+knownHosts)
+}
+
+// checkGitLFS returns an error if git-lfs is not installed.
+func checkGitLFS(ctx context.Context) error {
+	if _, err := output(ctx, "git", "lfs", "version"); err != nil {
+		return errors.Wrap(err, "--lfs requires git-lfs to be installed in the helper image")
+	}
+	return nil
+}
+
+// pullGitLFS replaces the LFS pointer files in the checkout of dir with the actual objects.
+// The objects are fetched with the same credentials as the repo, i.e. the ones in the
+// URL or --https-auth-dir for HTTP(S), and git-lfs-authenticate of the server for SSH.
+func pullGitLFS(ctx context.Context, dir string) error {
+	// --local avoids writing to ~/.gitconfig, which may be read-only
+	if err := run(ctx, "git", "-C", dir, "lfs", "install", "--local"); err != nil {
+		return err
+	}
+	return run(ctx, "git", "-C", dir, "lfs", "pull")
+}
+
+func reportResolvedRevision(ctx context.Context, dir, resolvedRevisionFile, terminationMessagePath string) error {
+	if resolvedRevisionFile == "" && terminationMessagePath == "" {
+		return nil
+	}
+	sha, err := output(ctx, "git", "-C", dir, "rev-parse", "HEAD")
+	if err != nil {
+		return err
+	}
+	logrus.Infof("resolved revision: %s", sha)
+	if resolvedRevisionFile != "" {
+		if err := ioutil.WriteFile(resolvedRevisionFile, []byte(sha+"\n"), 0644); err != nil {
+			return err
+		}
+	}
+	if terminationMessagePath != "" {
+		msg := pluginapi.FormatTerminationMessage(map[string]string{
+			pluginapi.TResolvedRevision: sha,
+		})
+		if err := ioutil.WriteFile(terminationMessagePath, []byte(msg), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cloneGit clones the repo. When reference is not empty, the objects are copied from
+// the reference repo, and only the missing objects are fetched from repoURL.
+// cloneOpts are appended to the flags of `git clone`, e.g. the ones from singleBranchCloneOpts.
+func cloneGit(ctx context.Context, repoURL, dir, revision, reference string, sparsePaths []string, cloneOpts ...string) error {
+	args := append([]string{"clone", "--progress"}, cloneOpts...)
+	if reference != "" {
+		// --dissociate makes the clone independent of the cache after cloning
+		args = append(args, "--reference-if-able", reference, "--dissociate")
+	}
+	if len(sparsePaths) > 0 {
+		args = append(args, "--no-checkout")
+		if err := runWithStderr(ctx, newGitProgressWriter(), "git", append(args, repoURL, dir)...); err != nil {
+			return err
+		}
+		return checkoutSparse(ctx, dir, revision, sparsePaths)
+	}
+	if err := runWithStderr(ctx, newGitProgressWriter(), "git", append(args, repoURL, dir)...); err != nil {
 		return err
 	}
-	os.Chdir(dir)
-	if revision := clicontext.String("revision"); revision != "" {
-		return run(ctx, "git", "checkout", revision)
+	if revision != "" {
+		return run(ctx, "git", "-C", dir, "checkout", revision)
 	}
 	return nil
 }
+
+var (
+	commitSHARegexp       = regexp.MustCompile(`^[0-9a-f]{40}$`)
+	abbrevCommitSHARegexp = regexp.MustCompile(`^[0-9a-f]{4,40}$`)
+)
+
+func isCommitSHA(revision string) bool {
+	return commitSHARegexp.MatchString(revision)
+}
+
+// Revision types for --revision-type.
+const (
+	revisionTypeAuto   = "auto"
+	revisionTypeBranch = "branch"
+	revisionTypeTag    = "tag"
+	revisionTypeCommit = "commit"
+)
+
+// checkoutRevision returns the unambiguous revision to check out after a non-shallow clone.
+// For revisionTypeAuto, revision is returned as-is.
+func checkoutRevision(revision, revisionType string) (string, error) {
+	if revision == "" {
+		if revisionType != revisionTypeAuto {
+			return "", errors.Errorf("revision type %q requires revision", revisionType)
+		}
+		return "", nil
+	}
+	switch revisionType {
+	case revisionTypeAuto:
+		return revision, nil
+	case revisionTypeBranch:
+		// the branches are cloned as the remote-tracking branches
+		return "refs/remotes/origin/" + revision, nil
+	case revisionTypeTag:
+		return "refs/tags/" + revision, nil
+	case revisionTypeCommit:
+		if !abbrevCommitSHARegexp.MatchString(revision) {
+			return "", errors.Errorf("revision type %q requires a hex commit SHA, got %q", revisionType, revision)
+		}
+		return revision + "^{commit}", nil
+	default:
+		return "", errors.Errorf("unknown revision type %q", revisionType)
+	}
+}
+
+// singleBranchCloneOpts returns the flags of `git clone` for fetching only the refs of revision.
+// revision needs to be a branch or a tag, as `git clone --branch` does not accept commits.
+// Empty revision means the default branch of the remote.
+func singleBranchCloneOpts(revision, revisionType string) ([]string, error) {
+	if revisionType == revisionTypeCommit || isCommitSHA(revision) {
+		return nil, errors.Errorf("--single-branch requires a branch or a tag revision, got %q", revision)
+	}
+	if revision == "" {
+		return []string{"--single-branch"}, nil
+	}
+	// --branch accepts tags as well
+	return []string{"--single-branch", "--branch", revision}, nil
+}
+
+// shallowFetchRef returns the ref to fetch for a shallow clone.
+// Empty string means `git clone --branch` can be used.
+func shallowFetchRef(revision, revisionType string) (string, error) {
+	if _, err := checkoutRevision(revision, revisionType); err != nil {
+		return "", err
+	}
+	switch revisionType {
+	case revisionTypeBranch:
+		return "refs/heads/" + revision, nil
+	case revisionTypeTag:
+		return "refs/tags/" + revision, nil
+	case revisionTypeCommit:
+		if !isCommitSHA(revision) {
+			return "", errors.Errorf("shallow clone requires the full commit SHA, got %q", revision)
+		}
+		return revision, nil
+	}
+	if isCommitSHA(revision) {
+		return revision, nil
+	}
+	return "", nil
+}
+
+// shallowCloneGit clones the repo with the depth.
+// When fetchRef is not empty, fetchRef is fetched instead of cloning revision with `git clone --branch`.
+func shallowCloneGit(ctx context.Context, repoURL, dir, revision, fetchRef string, depth int, sparsePaths []string) error {
+	depthStr := strconv.Itoa(depth)
+	if fetchRef == "" {
+		args := []string{"clone", "--progress", "--depth", depthStr}
+		if revision != "" {
+			// --branch accepts tags as well
+			args = append(args, "--branch", revision)
+		}
+		if len(sparsePaths) == 0 {
+			return runWithStderr(ctx, newGitProgressWriter(), "git", append(args, repoURL, dir)...)
+		}
+		args = append(args, "--no-checkout")
+		if err := runWithStderr(ctx, newGitProgressWriter(), "git", append(args, repoURL, dir)...); err != nil {
+			return err
+		}
+		// HEAD already points to the revision
+		return checkoutSparse(ctx, dir, "", sparsePaths)
+	}
+	// A commit cannot be checked out from a shallow clone unless it is
+	// within the truncated history, so we fetch the commit directly.
+	// Branches and tags are also fetched directly, as `git clone --branch` cannot
+	// distinguish a branch from a tag with the same name.
+	if err := run(ctx, "git", "init", dir); err != nil {
+		return err
+	}
+	if err := run(ctx, "git", "-C", dir, "remote", "add", "origin", repoURL); err != nil {
+		return err
+	}
+	if err := runWithStderr(ctx, newGitProgressWriter(), "git", "-C", dir, "fetch", "--progress", "--depth", depthStr, "origin", fetchRef); err != nil {
+		if isCommitSHA(fetchRef) {
+			return errors.Wrapf(err, "failed to fetch commit %s with depth %d (the server needs to allow fetching unadvertised objects, or depth needs to be 0)", fetchRef, depth)
+		}
+		return errors.Wrapf(err, "failed to fetch %s with depth %d", fetchRef, depth)
+	}
+	if len(sparsePaths) > 0 {
+		return checkoutSparse(ctx, dir, "FETCH_HEAD", sparsePaths)
+	}
+	return run(ctx, "git", "-C", dir, "checkout", "FETCH_HEAD")
+}
+
+// refspecCloneGit fetches refspec verbatim and checks out FETCH_HEAD.
+// depth 0 fetches the full history.
+func refspecCloneGit(ctx context.Context, repoURL, dir, refspec string, depth int, sparsePaths []string) error {
+	if err := run(ctx, "git", "init", dir); err != nil {
+		return err
+	}
+	if err := run(ctx, "git", "-C", dir, "remote", "add", "origin", repoURL); err != nil {
+		return err
+	}
+	args := []string{"-C", dir, "fetch", "--progress"}
+	if depth > 0 {
+		args = append(args, "--depth", strconv.Itoa(depth))
+	}
+	if err := runWithStderr(ctx, newGitProgressWriter(), "git", append(args, "origin", refspec)...); err != nil {
+		return errors.Wrapf(err, "failed to fetch refspec %s", refspec)
+	}
+	if len(sparsePaths) > 0 {
+		return checkoutSparse(ctx, dir, "FETCH_HEAD", sparsePaths)
+	}
+	return run(ctx, "git", "-C", dir, "checkout", "FETCH_HEAD")
+}
+
+// singleCommitCloneGit clones only the commit of revision, i.e. a shallow clone with depth 1.
+// When fetchRef is a commit SHA, the server needs to allow fetching the SHA
+// (uploadpack.allowReachableSHA1InWant, or protocol v2).
+// If the server does not allow it, fallback (a full clone) is used instead.
+func singleCommitCloneGit(ctx context.Context, repoURL, dir, revision, fetchRef string, sparsePaths []string, fallback func() error) error {
+	err := shallowCloneGit(ctx, repoURL, dir, revision, fetchRef, 1, sparsePaths)
+	if err == nil || !isCommitSHA(fetchRef) {
+		return err
+	}
+	logrus.WithError(err).Warnf("failed to fetch commit %s directly, falling back to a full clone", fetchRef)
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	return fallback()
+}
+
+// checkoutSparse checks out sparsePaths of revision (HEAD if empty) in dir, which has no checkout yet.
+func checkoutSparse(ctx context.Context, dir, revision string, sparsePaths []string) error {
+	if err := run(ctx, "git", "-C", dir, "sparse-checkout", "init", "--cone"); err != nil {
+		return err
+	}
+	if err := run(ctx, "git", append([]string{"-C", dir, "sparse-checkout", "set"}, sparsePaths...)...); err != nil {
+		return err
+	}
+	if revision == "" {
+		// populate the index and the working tree from HEAD, respecting the sparse-checkout patterns
+		return run(ctx, "git", "-C", dir, "read-tree", "-mu", "HEAD")
+	}
+	return run(ctx, "git", "-C", dir, "checkout", revision)
+}
@@ -0,0 +1,373 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestRevisionRefs(t *testing.T) {
+	sha := "0123456789abcdef0123456789abcdef01234567"
+	cases := []struct {
+		revision     string
+		revisionType string
+		checkout     string
+		fetch        string
+		invalid      bool
+	}{
+		{revision: "", revisionType: revisionTypeAuto},
+		{revision: "v1", revisionType: revisionTypeAuto, checkout: "v1"},
+		{revision: sha, revisionType: revisionTypeAuto, checkout: sha, fetch: sha},
+		{revision: "v1", revisionType: revisionTypeBranch, checkout: "refs/remotes/origin/v1", fetch: "refs/heads/v1"},
+		{revision: "v1", revisionType: revisionTypeTag, checkout: "refs/tags/v1", fetch: "refs/tags/v1"},
+		{revision: sha, revisionType: revisionTypeCommit, checkout: sha + "^{commit}", fetch: sha},
+		{revision: "v1", revisionType: revisionTypeCommit, invalid: true},
+		{revision: "", revisionType: revisionTypeTag, invalid: true},
+		{revision: "v1", revisionType: "ref", invalid: true},
+	}
+	for _, c := range cases {
+		checkout, err := checkoutRevision(c.revision, c.revisionType)
+		if err != nil && !c.invalid {
+			t.Fatalf("%+v: %v", c, err)
+		}
+		if err == nil && c.invalid {
+			t.Fatalf("%+v: error is expected", c)
+		}
+		if checkout != c.checkout {
+			t.Fatalf("%+v: expected checkout %q, got %q", c, c.checkout, checkout)
+		}
+		fetch, err := shallowFetchRef(c.revision, c.revisionType)
+		if err != nil && !c.invalid {
+			t.Fatalf("%+v: %v", c, err)
+		}
+		if fetch != c.fetch {
+			t.Fatalf("%+v: expected fetch %q, got %q", c, c.fetch, fetch)
+		}
+	}
+	// shallow clones cannot fetch abbreviated SHAs
+	if _, err := shallowFetchRef("deadbeef", revisionTypeCommit); err == nil {
+		t.Fatal("error is expected")
+	}
+}
+
+func TestCloneGitBranchAndTagWithSameName(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	tmp, err := ioutil.TempDir("", "cbi-test-populategit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	ctx := context.Background()
+	src := filepath.Join(tmp, "src")
+	git := func(args ...string) {
+		args = append([]string{"-C", src, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)
+		if err := run(ctx, "git", args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	commit := func(content string) {
+		if err := ioutil.WriteFile(filepath.Join(src, "Dockerfile"), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		git("add", "Dockerfile")
+		git("commit", "-m", content)
+	}
+	if err := run(ctx, "git", "init", src); err != nil {
+		t.Fatal(err)
+	}
+	commit("tag\n")
+	git("tag", "-a", "-m", "v1", "v1")
+	commit("branch\n")
+	git("branch", "v1")
+	repoURL := "file://" + src
+	for i, revisionType := range []string{revisionTypeBranch, revisionTypeTag} {
+		for _, depth := range []int{0, 1} {
+			dir := filepath.Join(tmp, "clone", revisionType, strings.Repeat("shallow", depth))
+			fetchRef, err := shallowFetchRef("v1", revisionType)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkout, err := checkoutRevision("v1", revisionType)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if depth > 0 {
+				err = shallowCloneGit(ctx, repoURL, dir, "v1", fetchRef, depth, nil)
+			} else {
+				err = cloneGit(ctx, repoURL, dir, checkout, "", nil)
+			}
+			if err != nil {
+				t.Fatalf("%s (depth=%d): %v", revisionType, depth, err)
+			}
+			b, err := ioutil.ReadFile(filepath.Join(dir, "Dockerfile"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if expected := []string{"branch\n", "tag\n"}[i]; string(b) != expected {
+				t.Fatalf("%s (depth=%d): expected %q, got %q", revisionType, depth, expected, string(b))
+			}
+		}
+	}
+}
+
+func TestSingleBranchCloneGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	tmp, err := ioutil.TempDir("", "cbi-test-populategit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	ctx := context.Background()
+	src := filepath.Join(tmp, "src")
+	git := func(args ...string) {
+		args = append([]string{"-C", src, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)
+		if err := run(ctx, "git", args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	commit := func(content string) {
+		if err := ioutil.WriteFile(filepath.Join(src, "Dockerfile"), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		git("add", "Dockerfile")
+		git("commit", "-m", content)
+	}
+	if err := run(ctx, "git", "init", src); err != nil {
+		t.Fatal(err)
+	}
+	commit("base\n")
+	git("checkout", "-b", "feature")
+	commit("feature\n")
+	git("checkout", "-b", "other")
+	commit("other\n")
+	git("checkout", "feature")
+	repoURL := "file://" + src
+	for _, revisionType := range []string{revisionTypeAuto, revisionTypeBranch} {
+		for _, singleBranch := range []bool{false, true} {
+			dir := filepath.Join(tmp, "clone", revisionType, strconv.FormatBool(singleBranch))
+			var cloneOpts []string
+			if singleBranch {
+				cloneOpts, err = singleBranchCloneOpts("feature", revisionType)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			checkout, err := checkoutRevision("feature", revisionType)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := cloneGit(ctx, repoURL, dir, checkout, "", nil, cloneOpts...); err != nil {
+				t.Fatalf("%s (singleBranch=%v): %v", revisionType, singleBranch, err)
+			}
+			b, err := ioutil.ReadFile(filepath.Join(dir, "Dockerfile"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != "feature\n" {
+				t.Fatalf("%s (singleBranch=%v): expected %q, got %q", revisionType, singleBranch, "feature\n", string(b))
+			}
+			refs, err := output(ctx, "git", "-C", dir, "for-each-ref", "--format=%(refname)", "refs/remotes/origin/")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if hasOther := strings.Contains(refs, "refs/remotes/origin/other"); hasOther == singleBranch {
+				t.Fatalf("%s (singleBranch=%v): unexpected remote refs %q", revisionType, singleBranch, refs)
+			}
+		}
+	}
+	for _, c := range []struct {
+		revision, revisionType string
+	}{
+		{"deadbeef", revisionTypeCommit},
+		{strings.Repeat("a", 40), revisionTypeAuto},
+	} {
+		if _, err := singleBranchCloneOpts(c.revision, c.revisionType); err == nil {
+			t.Fatalf("%s (%s): error is expected", c.revision, c.revisionType)
+		}
+	}
+}
+
+func TestRefspecCloneGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	tmp, err := ioutil.TempDir("", "cbi-test-populategit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	ctx := context.Background()
+	src := filepath.Join(tmp, "src")
+	git := func(args ...string) {
+		args = append([]string{"-C", src, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)
+		if err := run(ctx, "git", args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	commit := func(content string) {
+		if err := ioutil.WriteFile(filepath.Join(src, "Dockerfile"), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		git("add", "Dockerfile")
+		git("commit", "-m", content)
+	}
+	if err := run(ctx, "git", "init", src); err != nil {
+		t.Fatal(err)
+	}
+	commit("base\n")
+	// emulate the refs of a pull request, which are not reachable from any branch
+	git("checkout", "-b", "pr")
+	commit("head\n")
+	git("update-ref", "refs/pull/1/head", "HEAD")
+	commit("merge\n")
+	git("update-ref", "refs/pull/1/merge", "HEAD")
+	git("checkout", "-")
+	git("branch", "-D", "pr")
+	repoURL := "file://" + src
+	cases := []struct {
+		refspec  string
+		expected string
+	}{
+		{refspec: "refs/pull/1/head", expected: "head\n"},
+		{refspec: "+refs/pull/1/merge:refs/remotes/origin/pr/1", expected: "merge\n"},
+	}
+	for i, c := range cases {
+		for _, depth := range []int{0, 1} {
+			dir := filepath.Join(tmp, "clone", strconv.Itoa(i), strconv.Itoa(depth))
+			if err := refspecCloneGit(ctx, repoURL, dir, c.refspec, depth, nil); err != nil {
+				t.Fatalf("%s (depth=%d): %v", c.refspec, depth, err)
+			}
+			b, err := ioutil.ReadFile(filepath.Join(dir, "Dockerfile"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != c.expected {
+				t.Fatalf("%s (depth=%d): expected %q, got %q", c.refspec, depth, c.expected, string(b))
+			}
+		}
+	}
+}
+
+func TestSingleCommitCloneGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	tmp, err := ioutil.TempDir("", "cbi-test-populategit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	ctx := context.Background()
+	src := filepath.Join(tmp, "src")
+	git := func(args ...string) {
+		args = append([]string{"-C", src, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)
+		if err := run(ctx, "git", args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := run(ctx, "git", "init", src); err != nil {
+		t.Fatal(err)
+	}
+	for _, content := range []string{"first\n", "second\n"} {
+		if err := ioutil.WriteFile(filepath.Join(src, "Dockerfile"), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		git("add", "Dockerfile")
+		git("commit", "-m", content)
+	}
+	first, err := output(ctx, "git", "-C", src, "rev-parse", "HEAD~1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	repoURL := "file://" + src
+	cases := []struct {
+		name     string
+		revision string
+		// protocol v0 does not allow fetching unadvertised objects by default
+		protocol         string
+		expected         string
+		expectedFallback bool
+	}{
+		{name: "sha", revision: first, protocol: "2", expected: "first\n"},
+		{name: "fallback", revision: first, protocol: "0", expected: "first\n", expectedFallback: true},
+		{name: "branch", revision: "", protocol: "0", expected: "second\n"},
+	}
+	for _, c := range cases {
+		os.Setenv("GIT_CONFIG_COUNT", "1")
+		os.Setenv("GIT_CONFIG_KEY_0", "protocol.version")
+		os.Setenv("GIT_CONFIG_VALUE_0", c.protocol)
+		dir := filepath.Join(tmp, "clone", c.name)
+		fetchRef, err := shallowFetchRef(c.revision, revisionTypeAuto)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var fellBack bool
+		fallback := func() error {
+			fellBack = true
+			return cloneGit(ctx, repoURL, dir, c.revision, "", nil)
+		}
+		err = singleCommitCloneGit(ctx, repoURL, dir, c.revision, fetchRef, nil, fallback)
+		for _, k := range []string{"GIT_CONFIG_COUNT", "GIT_CONFIG_KEY_0", "GIT_CONFIG_VALUE_0"} {
+			os.Unsetenv(k)
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if fellBack != c.expectedFallback {
+			t.Fatalf("%s: expected fallback=%v, got %v", c.name, c.expectedFallback, fellBack)
+		}
+		b, err := ioutil.ReadFile(filepath.Join(dir, "Dockerfile"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != c.expected {
+			t.Fatalf("%s: expected %q, got %q", c.name, c.expected, string(b))
+		}
+		shallow, err := output(ctx, "git", "-C", dir, "rev-parse", "--is-shallow-repository")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := strconv.FormatBool(!c.expectedFallback); shallow != expected {
+			t.Fatalf("%s: expected shallow=%s, got %s", c.name, expected, shallow)
+		}
+	}
+}
+
+func TestCheckGitLFS(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	_, lookErr := exec.LookPath("git-lfs")
+	err := checkGitLFS(context.Background())
+	if lookErr == nil && err != nil {
+		t.Fatal(err)
+	}
+	if lookErr != nil && (err == nil || !strings.Contains(err.Error(), "requires git-lfs")) {
+		t.Fatalf("expected an error about missing git-lfs, got %v", err)
+	}
+}
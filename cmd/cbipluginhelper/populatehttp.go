@@ -17,23 +17,61 @@ limitations under the License.
 package main
 
 import (
+	"compress/gzip"
 	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
 	"net/http"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strings"
 
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 	"gopkg.in/urfave/cli.v2"
+
+	crd "github.com/containerbuilding/cbi/pkg/apis/cbi/v1alpha1"
 )
 
 var populateHTTPCommand = &cli.Command{
 	Name:      "populate-http",
-	Usage:     "populate an tar archive via HTTP(S). Requires bsdtar to be installed (for auto-detecting gzip compression).",
+	Usage:     "populate an archive via HTTP(S). Requires bsdtar to be installed (for auto-detecting the archive format when --media-type is not specified), and zstd (for application/zstd).",
 	ArgsUsage: "[flags] URL DIRECTORY",
-	Action:    populateHTTPAction,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "sha256",
+			Usage: "Verify the SHA-256 digest (hex) of the archive before extracting it",
+		},
+		&cli.StringFlag{
+			Name:  "media-type",
+			Usage: "Media type of the archive (application/x-tar, application/gzip, application/zstd, or application/zip). Auto-detected if not specified.",
+		},
+		&cli.StringFlag{
+			Name:  "ca-file",
+			Usage: "PEM-encoded CA bundle for verifying the server certificate, in addition to the system CAs",
+		},
+		&cli.BoolFlag{
+			Name:  "insecure",
+			Usage: "Skip verifying the server certificate (for testing only)",
+		},
+		&cli.StringFlag{
+			Name:  "basic-auth-username-file",
+			Usage: "File containing the username for HTTP Basic authentication",
+		},
+		&cli.StringFlag{
+			Name:  "basic-auth-password-file",
+			Usage: "File containing the password for HTTP Basic authentication",
+		},
+	},
+	Action: withHeartbeat(limitContextSize(populateHTTPAction)),
 }
 
-func populateHTTPAction(clicontext *cli.Context) error {
+func populateHTTPAction(ctx context.Context, clicontext *cli.Context) error {
 	u := clicontext.Args().Get(0)
 	if u == "" {
 		return errors.New("URL missing")
@@ -45,18 +83,158 @@ func populateHTTPAction(clicontext *cli.Context) error {
 	if err := os.MkdirAll(dir, 0755); err != nil {
 		return err
 	}
-	resp, err := http.Get(u)
+	client, err := newHTTPClient(clicontext.String("ca-file"), clicontext.Bool("insecure"))
+	if err != nil {
+		return err
+	}
+	req, err := newHTTPRequest(u, clicontext.String("basic-auth-username-file"), clicontext.String("basic-auth-password-file"))
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req.WithContext(ctx))
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
-	ctx := context.Background()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return errors.Errorf("GET %s: %s", u, resp.Status)
+	}
+	mediaType := clicontext.String("media-type")
+	expected := clicontext.String("sha256")
+	logPhase("download")
+	body := newProgressReader(resp.Body, resp.ContentLength, "download")
+	var (
+		r          io.Reader = body
+		downloaded *os.File
+	)
+	if expected != "" || mediaType == crd.HTTPMediaTypeZip {
+		// the archive needs to be verified before extracting it,
+		// and zip archives cannot be extracted from a stream.
+		downloaded, err = download(body, expected, dir)
+		if err != nil {
+			return err
+		}
+		defer os.Remove(downloaded.Name())
+		defer downloaded.Close()
+		r = downloaded
+	}
+	// stop extracting in the process when the context exceeds maxContextSize
+	r = &contextReader{ctx: ctx, r: r}
+	switch mediaType {
+	case "":
+		return extractArchive(ctx, r, dir)
+	case crd.HTTPMediaTypeTar:
+		return untar(r, dir)
+	case crd.HTTPMediaTypeGzip:
+		gr, err := gzip.NewReader(r)
+		if err != nil {
+			return err
+		}
+		defer gr.Close()
+		return untar(gr, dir)
+	case crd.HTTPMediaTypeZstd:
+		return untarZstd(ctx, r, dir)
+	case crd.HTTPMediaTypeZip:
+		st, err := downloaded.Stat()
+		if err != nil {
+			return err
+		}
+		return unzip(&contextReaderAt{ctx: ctx, r: downloaded}, st.Size(), dir)
+	default:
+		return errors.Errorf("unsupported media type: %q", mediaType)
+	}
+}
+
+// newHTTPRequest returns a GET request for u, with HTTP Basic authentication
+// when usernameFile or passwordFile is not empty.
+func newHTTPRequest(u, usernameFile, passwordFile string) (*http.Request, error) {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if usernameFile == "" && passwordFile == "" {
+		return req, nil
+	}
+	var username, password string
+	if usernameFile != "" {
+		b, err := ioutil.ReadFile(usernameFile)
+		if err != nil {
+			return nil, err
+		}
+		username = strings.TrimRight(string(b), "\r\n")
+	}
+	if passwordFile != "" {
+		b, err := ioutil.ReadFile(passwordFile)
+		if err != nil {
+			return nil, err
+		}
+		password = strings.TrimRight(string(b), "\r\n")
+	}
+	req.SetBasicAuth(username, password)
+	return req, nil
+}
+
+// newHTTPClient returns an HTTP client that respects HTTP_PROXY, HTTPS_PROXY, and NO_PROXY.
+func newHTTPClient(caFile string, insecure bool) (*http.Client, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: insecure,
+	}
+	if caFile != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			logrus.WithError(err).Warn("failed to load the system CAs")
+			pool = x509.NewCertPool()
+		}
+		b, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, errors.Errorf("no certificate found in %s", caFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: tlsConfig,
+		},
+	}, nil
+}
+
+// extractArchive extracts an archive with auto-detection of the format.
+func extractArchive(ctx context.Context, r io.Reader, dir string) error {
 	// busybox tar and GNU tar can auto-detect gzip files, but not gzip stream.
-	// so we use bsdtar.
-	// TODO: rewrite in pure Go.
+	// so we use bsdtar, which also detects zstd stream.
 	cmd := exec.CommandContext(ctx, "bsdtar", "Cxvf", dir, "-")
-	cmd.Stdin = resp.Body
+	cmd.Stdin = r
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	return cmd.Run()
 }
+
+// download saves r to a temporary file staged next to dir, and verifies the SHA-256 digest if expected is not empty.
+// The returned file is rewound to the beginning, and needs to be removed by the caller.
+func download(r io.Reader, expected, dir string) (*os.File, error) {
+	f, err := ioutil.TempFile(filepath.Dir(dir), stagingPrefix(dir))
+	if err != nil {
+		return nil, err
+	}
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(f, h), r); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, err
+	}
+	if actual := hex.EncodeToString(h.Sum(nil)); expected != "" && actual != strings.ToLower(expected) {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, errors.Errorf("SHA-256 mismatch: expected %s, got %s", expected, actual)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, err
+	}
+	return f, nil
+}
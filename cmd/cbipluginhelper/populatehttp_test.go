@@ -0,0 +1,144 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/urfave/cli.v2"
+)
+
+func TestDownload(t *testing.T) {
+	const (
+		content = "hello\n"
+		digest  = "5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03"
+	)
+	tmp, err := ioutil.TempDir("", "cbi-test-download")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	dir := filepath.Join(tmp, "context")
+	f, err := download(bytes.NewBufferString(content), digest, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	// the archive is staged in the same volume as dir, and counted by stagedSize
+	if filepath.Dir(f.Name()) != tmp {
+		t.Fatalf("expected the file to be staged in %s, got %s", tmp, f.Name())
+	}
+	if size := stagedSize(dir); size != int64(len(content)) {
+		t.Fatalf("expected %d bytes staged, got %d", len(content), size)
+	}
+	b, err := ioutil.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != content {
+		t.Fatalf("expected %q, got %q", content, string(b))
+	}
+
+	if _, err := download(bytes.NewBufferString("tampered\n"), digest, dir); err == nil {
+		t.Fatal("error is expected")
+	}
+}
+
+func TestNewHTTPRequestBasicAuth(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if u, p, ok := r.BasicAuth(); !ok || u != "user" || p != "pass" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer ts.Close()
+	tmp, err := ioutil.TempDir("", "cbi-test-populatehttp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	usernameFile := filepath.Join(tmp, "username")
+	passwordFile := filepath.Join(tmp, "password")
+	if err := ioutil.WriteFile(usernameFile, []byte("user"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	// the trailing newline is ignored
+	if err := ioutil.WriteFile(passwordFile, []byte("pass\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		usernameFile string
+		passwordFile string
+		expected     int
+	}{
+		{expected: http.StatusUnauthorized},
+		{usernameFile: usernameFile, passwordFile: passwordFile, expected: http.StatusOK},
+		{usernameFile: usernameFile, expected: http.StatusUnauthorized},
+	}
+	for _, c := range cases {
+		req, err := newHTTPRequest(ts.URL, c.usernameFile, c.passwordFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != c.expected {
+			t.Fatalf("%+v: expected %d, got %d", c, c.expected, resp.StatusCode)
+		}
+	}
+	if _, err := newHTTPRequest(ts.URL, filepath.Join(tmp, "nonexistent"), ""); err == nil {
+		t.Fatal("error is expected")
+	}
+}
+
+func TestPopulateHTTPStatus(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("not an archive"))
+	}))
+	defer ts.Close()
+	tmp, err := ioutil.TempDir("", "cbi-test-populatehttp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	dir := filepath.Join(tmp, "context")
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	if err := fs.Parse([]string{ts.URL, dir}); err != nil {
+		t.Fatal(err)
+	}
+	err = populateHTTPAction(context.Background(), cli.NewContext(&cli.App{}, fs, nil))
+	if err == nil || !strings.Contains(err.Error(), "401 Unauthorized") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// the body of the error response is not extracted
+	if size := dirSize(dir); size != 0 {
+		t.Fatalf("expected nothing populated, got %d bytes", size)
+	}
+}
@@ -0,0 +1,591 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/urfave/cli.v2"
+)
+
+var populateOCICommand = &cli.Command{
+	Name:      "populate-oci",
+	Usage:     "populate an OCI image layout by fetching an image from a registry",
+	ArgsUsage: "[flags] IMAGE DIRECTORY",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "docker-config",
+			Usage: "docker config.json (or .dockerconfigjson) file containing the credentials for the registry",
+		},
+		&cli.StringFlag{
+			Name:  "platform",
+			Usage: "Fetch only the image for the platform (os/arch[/variant]) from the manifest list",
+		},
+	},
+	Action: withHeartbeat(limitContextSize(populateOCIAction)),
+}
+
+func populateOCIAction(ctx context.Context, clicontext *cli.Context) error {
+	image := clicontext.Args().Get(0)
+	if image == "" {
+		return errors.New("IMAGE missing")
+	}
+	dir := clicontext.Args().Get(1)
+	if dir == "" {
+		return errors.New("DIRECTORY missing")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	var auths map[string]registryAuth
+	if f := clicontext.String("docker-config"); f != "" {
+		var err error
+		auths, err = readDockerConfigAuths(f)
+		if err != nil {
+			return err
+		}
+	}
+	client, err := newHTTPClient("", false)
+	if err != nil {
+		return err
+	}
+	logPhase("download")
+	return populateOCI(ctx, client, auths, image, clicontext.String("platform"), dir)
+}
+
+const (
+	mediaTypeOCIManifest         = "application/vnd.oci.image.manifest.v1+json"
+	mediaTypeOCIIndex            = "application/vnd.oci.image.index.v1+json"
+	mediaTypeDockerManifest      = "application/vnd.docker.distribution.manifest.v2+json"
+	mediaTypeDockerManifestList  = "application/vnd.docker.distribution.manifest.list.v2+json"
+	annotationRefName            = "org.opencontainers.image.ref.name"
+	dockerHubDomain              = "docker.io"
+	dockerHubRegistry            = "registry-1.docker.io"
+	maxManifestSize              = 4 * 1024 * 1024
+	ociImageLayoutVersion        = "1.0.0"
+	ociImageLayoutFile           = "oci-layout"
+	ociImageIndexFile            = "index.json"
+	ociImageLayoutBlobsDirectory = "blobs"
+)
+
+// ociDescriptor is the subset of the OCI content descriptor used by populate-oci.
+type ociDescriptor struct {
+	MediaType   string            `json:"mediaType,omitempty"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Platform    *ociPlatform      `json:"platform,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+type ociPlatform struct {
+	OS           string `json:"os"`
+	Architecture string `json:"architecture"`
+	Variant      string `json:"variant,omitempty"`
+}
+
+// ociManifest covers both image manifests and indices (manifest lists).
+type ociManifest struct {
+	SchemaVersion int             `json:"schemaVersion"`
+	MediaType     string          `json:"mediaType,omitempty"`
+	Config        *ociDescriptor  `json:"config,omitempty"`
+	Layers        []ociDescriptor `json:"layers,omitempty"`
+	Manifests     []ociDescriptor `json:"manifests,omitempty"`
+}
+
+// imageReference is a parsed image reference.
+type imageReference struct {
+	// Domain is the normalized registry domain, e.g. "docker.io".
+	Domain string
+	// Repository is the path within the registry, e.g. "library/alpine".
+	Repository string
+	// Reference is the tag or the digest.
+	Reference string
+}
+
+// parseImageReference parses ref in the same way as docker, e.g. "alpine" is parsed as
+// "docker.io/library/alpine:latest".
+func parseImageReference(ref string) (imageReference, error) {
+	var r imageReference
+	name := ref
+	if i := strings.Index(name, "@"); i >= 0 {
+		r.Reference = name[i+1:]
+		name = name[:i]
+	}
+	if i := strings.LastIndex(name, ":"); i >= 0 && !strings.Contains(name[i:], "/") {
+		if r.Reference == "" {
+			r.Reference = name[i+1:]
+		}
+		name = name[:i]
+	}
+	if r.Reference == "" {
+		r.Reference = "latest"
+	}
+	if name == "" {
+		return r, errors.Errorf("invalid image reference %q", ref)
+	}
+	r.Domain, r.Repository = dockerHubDomain, name
+	if i := strings.Index(name, "/"); i >= 0 {
+		if d := name[:i]; strings.ContainsAny(d, ".:") || d == "localhost" {
+			r.Domain, r.Repository = normalizeRegistryDomain(d), name[i+1:]
+		}
+	}
+	if r.Domain == dockerHubDomain && !strings.Contains(r.Repository, "/") {
+		r.Repository = "library/" + r.Repository
+	}
+	return r, nil
+}
+
+// normalizeRegistryDomain normalizes the registry domain or the key of docker config.json,
+// e.g. "https://index.docker.io/v1/" is normalized to "docker.io".
+func normalizeRegistryDomain(s string) string {
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "https://"), "http://")
+	s = strings.SplitN(s, "/", 2)[0]
+	switch s {
+	case "index.docker.io", "registry-1.docker.io":
+		return dockerHubDomain
+	}
+	return s
+}
+
+// registryHost returns the host to connect for domain.
+func registryHost(domain string) string {
+	if domain == dockerHubDomain {
+		return dockerHubRegistry
+	}
+	return domain
+}
+
+type registryAuth struct {
+	Username string
+	Password string
+}
+
+// readDockerConfigAuths reads the credentials from docker config.json, indexed by the normalized domain.
+func readDockerConfigAuths(f string) (map[string]registryAuth, error) {
+	b, err := ioutil.ReadFile(f)
+	if err != nil {
+		return nil, err
+	}
+	var config struct {
+		Auths map[string]struct {
+			Auth     string `json:"auth"`
+			Username string `json:"username"`
+			Password string `json:"password"`
+		} `json:"auths"`
+	}
+	if err := json.Unmarshal(b, &config); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse %s", f)
+	}
+	auths := make(map[string]registryAuth)
+	for k, v := range config.Auths {
+		a := registryAuth{Username: v.Username, Password: v.Password}
+		if v.Auth != "" {
+			decoded, err := base64.StdEncoding.DecodeString(v.Auth)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to decode the auth for %q", k)
+			}
+			kv := strings.SplitN(string(decoded), ":", 2)
+			if len(kv) != 2 {
+				return nil, errors.Errorf("invalid auth for %q", k)
+			}
+			a = registryAuth{Username: kv[0], Password: kv[1]}
+		}
+		auths[normalizeRegistryDomain(k)] = a
+	}
+	return auths, nil
+}
+
+// registryClient is a minimal client of the Docker Registry HTTP API V2 for pulling a repository.
+type registryClient struct {
+	client     *http.Client
+	host       string
+	repository string
+	auth       *registryAuth
+	// authorization is the Authorization header obtained via the challenge.
+	authorization string
+}
+
+// get issues a GET request for the path, and retries once with the credentials
+// when the registry responds with 401 and a WWW-Authenticate challenge.
+func (c *registryClient) get(ctx context.Context, path string, accept ...string) (*http.Response, error) {
+	newReq := func() (*http.Request, error) {
+		req, err := http.NewRequest(http.MethodGet, "https://"+c.host+"/v2/"+c.repository+path, nil)
+		if err != nil {
+			return nil, err
+		}
+		req = req.WithContext(ctx)
+		for _, a := range accept {
+			req.Header.Add("Accept", a)
+		}
+		if c.authorization != "" {
+			req.Header.Set("Authorization", c.authorization)
+		}
+		return req, nil
+	}
+	req, err := newReq()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusUnauthorized || c.authorization != "" {
+		return resp, nil
+	}
+	challenge := resp.Header.Get("WWW-Authenticate")
+	resp.Body.Close()
+	c.authorization, err = c.authenticate(ctx, challenge)
+	if err != nil {
+		return nil, err
+	}
+	req, err = newReq()
+	if err != nil {
+		return nil, err
+	}
+	return c.client.Do(req)
+}
+
+// authenticate returns the Authorization header for the WWW-Authenticate challenge.
+func (c *registryClient) authenticate(ctx context.Context, challenge string) (string, error) {
+	scheme, params := parseAuthChallenge(challenge)
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if c.auth == nil {
+			return "", errors.Errorf("%s requires credentials", c.host)
+		}
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(c.auth.Username+":"+c.auth.Password)), nil
+	case "bearer":
+		realm := params["realm"]
+		if realm == "" {
+			return "", errors.Errorf("no realm in the challenge from %s: %q", c.host, challenge)
+		}
+		u, err := url.Parse(realm)
+		if err != nil {
+			return "", err
+		}
+		q := u.Query()
+		if s := params["service"]; s != "" {
+			q.Set("service", s)
+		}
+		q.Set("scope", "repository:"+c.repository+":pull")
+		u.RawQuery = q.Encode()
+		req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+		if err != nil {
+			return "", err
+		}
+		req = req.WithContext(ctx)
+		if c.auth != nil {
+			req.SetBasicAuth(c.auth.Username, c.auth.Password)
+		}
+		resp, err := c.client.Do(req)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return "", errors.Errorf("unexpected status from %s: %s", realm, resp.Status)
+		}
+		var token struct {
+			Token       string `json:"token"`
+			AccessToken string `json:"access_token"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+			return "", errors.Wrapf(err, "failed to decode the token from %s", realm)
+		}
+		if token.Token == "" {
+			token.Token = token.AccessToken
+		}
+		if token.Token == "" {
+			return "", errors.Errorf("no token from %s", realm)
+		}
+		return "Bearer " + token.Token, nil
+	default:
+		return "", errors.Errorf("unsupported challenge from %s: %q", c.host, challenge)
+	}
+}
+
+// parseAuthChallenge parses WWW-Authenticate header, e.g. `Bearer realm="https://auth.example.com/token",service="example.com"`.
+func parseAuthChallenge(s string) (string, map[string]string) {
+	params := make(map[string]string)
+	kv := strings.SplitN(strings.TrimSpace(s), " ", 2)
+	if len(kv) < 2 {
+		return kv[0], params
+	}
+	rest := kv[1]
+	for rest != "" {
+		rest = strings.TrimLeft(rest, ", ")
+		eq := strings.Index(rest, "=")
+		if eq < 0 {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(rest[:eq]))
+		rest = rest[eq+1:]
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				value, rest = rest[1:], ""
+			} else {
+				value, rest = rest[1:end+1], rest[end+2:]
+			}
+		} else {
+			end := strings.Index(rest, ",")
+			if end < 0 {
+				value, rest = rest, ""
+			} else {
+				value, rest = rest[:end], rest[end:]
+			}
+		}
+		params[key] = value
+	}
+	return kv[0], params
+}
+
+// ociStore writes the blobs of an OCI image layout.
+type ociStore struct {
+	dir string
+}
+
+// blobPath returns the path of the blob, after validating the digest.
+func (s *ociStore) blobPath(digest string) (string, error) {
+	kv := strings.SplitN(digest, ":", 2)
+	if len(kv) != 2 || kv[0] != "sha256" {
+		return "", errors.Errorf("unsupported digest %q", digest)
+	}
+	if _, err := hex.DecodeString(kv[1]); err != nil || len(kv[1]) != sha256.Size*2 {
+		return "", errors.Errorf("invalid digest %q", digest)
+	}
+	return filepath.Join(s.dir, ociImageLayoutBlobsDirectory, kv[0], kv[1]), nil
+}
+
+// writeBlob writes r as the blob after verifying the digest.
+func (s *ociStore) writeBlob(r io.Reader, digest string) error {
+	p, err := s.blobPath(digest)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(p), ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(f, h), r); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if actual := "sha256:" + hex.EncodeToString(h.Sum(nil)); actual != digest {
+		return errors.Errorf("digest mismatch: expected %s, got %s", digest, actual)
+	}
+	return os.Rename(f.Name(), p)
+}
+
+// populateOCI fetches image into dir as an OCI image layout.
+// When platform is not empty, only the image for the platform is fetched from the manifest list.
+func populateOCI(ctx context.Context, client *http.Client, auths map[string]registryAuth, image, platform, dir string) error {
+	ref, err := parseImageReference(image)
+	if err != nil {
+		return err
+	}
+	c := &registryClient{
+		client:     client,
+		host:       registryHost(ref.Domain),
+		repository: ref.Repository,
+	}
+	if a, ok := auths[ref.Domain]; ok {
+		c.auth = &a
+	}
+	store := &ociStore{dir: dir}
+	desc, manifest, err := fetchManifest(ctx, c, store, ref.Reference)
+	if err != nil {
+		return err
+	}
+	if isIndex(desc.MediaType) {
+		var selected []ociDescriptor
+		for _, m := range manifest.Manifests {
+			if platform == "" || matchPlatform(m.Platform, platform) {
+				selected = append(selected, m)
+			}
+		}
+		if len(selected) == 0 {
+			return errors.Errorf("no image for platform %q in %s", platform, image)
+		}
+		for _, m := range selected {
+			if err := fetchImage(ctx, c, store, m.Digest); err != nil {
+				return err
+			}
+		}
+		if platform != "" {
+			// the layout points to the image for the platform, not to the manifest list
+			desc = selected[0]
+		}
+	} else if err := fetchImageBlobs(ctx, c, store, manifest); err != nil {
+		return err
+	}
+	desc.Platform = nil
+	if !strings.Contains(ref.Reference, ":") {
+		// tag
+		desc.Annotations = map[string]string{annotationRefName: ref.Reference}
+	}
+	return writeOCILayout(dir, desc)
+}
+
+func isIndex(mediaType string) bool {
+	return mediaType == mediaTypeOCIIndex || mediaType == mediaTypeDockerManifestList
+}
+
+// matchPlatform returns true if p matches s (`os/arch[/variant]`).
+func matchPlatform(p *ociPlatform, s string) bool {
+	if p == nil {
+		return false
+	}
+	ss := strings.SplitN(s, "/", 3)
+	if len(ss) < 2 || p.OS != ss[0] || p.Architecture != ss[1] {
+		return false
+	}
+	return len(ss) < 3 || p.Variant == ss[2]
+}
+
+// fetchManifest fetches the manifest (or the index) for reference, and stores it as a blob.
+func fetchManifest(ctx context.Context, c *registryClient, store *ociStore, reference string) (ociDescriptor, *ociManifest, error) {
+	var desc ociDescriptor
+	resp, err := c.get(ctx, "/manifests/"+reference,
+		mediaTypeOCIManifest, mediaTypeOCIIndex, mediaTypeDockerManifest, mediaTypeDockerManifestList)
+	if err != nil {
+		return desc, nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return desc, nil, errors.Errorf("unexpected status for manifest %s: %s", reference, resp.Status)
+	}
+	b, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxManifestSize+1))
+	if err != nil {
+		return desc, nil, err
+	}
+	if len(b) > maxManifestSize {
+		return desc, nil, errors.Errorf("manifest %s is too large", reference)
+	}
+	var manifest ociManifest
+	if err := json.Unmarshal(b, &manifest); err != nil {
+		return desc, nil, errors.Wrapf(err, "failed to parse manifest %s", reference)
+	}
+	desc.MediaType = manifest.MediaType
+	if desc.MediaType == "" {
+		desc.MediaType = strings.TrimSpace(strings.SplitN(resp.Header.Get("Content-Type"), ";", 2)[0])
+	}
+	switch desc.MediaType {
+	case mediaTypeOCIManifest, mediaTypeDockerManifest, mediaTypeOCIIndex, mediaTypeDockerManifestList:
+	default:
+		return desc, nil, errors.Errorf("unsupported media type of manifest %s: %q", reference, desc.MediaType)
+	}
+	sum := sha256.Sum256(b)
+	desc.Digest = "sha256:" + hex.EncodeToString(sum[:])
+	desc.Size = int64(len(b))
+	if strings.Contains(reference, ":") && reference != desc.Digest {
+		return desc, nil, errors.Errorf("digest mismatch: expected %s, got %s", reference, desc.Digest)
+	}
+	if err := store.writeBlob(bytes.NewReader(b), desc.Digest); err != nil {
+		return desc, nil, err
+	}
+	return desc, &manifest, nil
+}
+
+// fetchImage fetches the image manifest and its blobs.
+func fetchImage(ctx context.Context, c *registryClient, store *ociStore, digest string) error {
+	desc, manifest, err := fetchManifest(ctx, c, store, digest)
+	if err != nil {
+		return err
+	}
+	if isIndex(desc.MediaType) {
+		return errors.Errorf("nested manifest list %s is not supported", digest)
+	}
+	return fetchImageBlobs(ctx, c, store, manifest)
+}
+
+// fetchImageBlobs fetches the config and the layers of the image manifest.
+func fetchImageBlobs(ctx context.Context, c *registryClient, store *ociStore, manifest *ociManifest) error {
+	if manifest.Config == nil {
+		return errors.New("no config in the image manifest")
+	}
+	for _, d := range append([]ociDescriptor{*manifest.Config}, manifest.Layers...) {
+		if err := fetchBlob(ctx, c, store, d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func fetchBlob(ctx context.Context, c *registryClient, store *ociStore, d ociDescriptor) error {
+	p, err := store.blobPath(d.Digest)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(p); err == nil {
+		return nil
+	}
+	logrus.Debugf("fetching blob %s (%d bytes)", d.Digest, d.Size)
+	resp, err := c.get(ctx, "/blobs/"+d.Digest)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("unexpected status for blob %s: %s", d.Digest, resp.Status)
+	}
+	return store.writeBlob(newProgressReader(resp.Body, d.Size, "download"), d.Digest)
+}
+
+// writeOCILayout writes oci-layout and index.json.
+func writeOCILayout(dir string, desc ociDescriptor) error {
+	layout, err := json.Marshal(map[string]string{"imageLayoutVersion": ociImageLayoutVersion})
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, ociImageLayoutFile), layout, 0644); err != nil {
+		return err
+	}
+	index, err := json.Marshal(ociManifest{
+		SchemaVersion: 2,
+		MediaType:     mediaTypeOCIIndex,
+		Manifests:     []ociDescriptor{desc},
+	})
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, ociImageIndexFile), index, 0644)
+}
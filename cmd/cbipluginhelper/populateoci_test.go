@@ -0,0 +1,253 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseImageReference(t *testing.T) {
+	cases := []struct {
+		ref      string
+		expected imageReference
+	}{
+		{ref: "alpine", expected: imageReference{Domain: "docker.io", Repository: "library/alpine", Reference: "latest"}},
+		{ref: "foo/bar:3.7", expected: imageReference{Domain: "docker.io", Repository: "foo/bar", Reference: "3.7"}},
+		{ref: "index.docker.io/library/alpine", expected: imageReference{Domain: "docker.io", Repository: "library/alpine", Reference: "latest"}},
+		{ref: "localhost:5000/foo", expected: imageReference{Domain: "localhost:5000", Repository: "foo", Reference: "latest"}},
+		{ref: "example.com/foo/bar:baz@sha256:abc", expected: imageReference{Domain: "example.com", Repository: "foo/bar", Reference: "sha256:abc"}},
+	}
+	for _, c := range cases {
+		actual, err := parseImageReference(c.ref)
+		if err != nil {
+			t.Fatalf("%q: %v", c.ref, err)
+		}
+		if actual != c.expected {
+			t.Fatalf("%q: expected %+v, got %+v", c.ref, c.expected, actual)
+		}
+	}
+}
+
+func TestParseAuthChallenge(t *testing.T) {
+	scheme, params := parseAuthChallenge(`Bearer realm="https://auth.example.com/token",service="example.com",scope="repository:foo:pull,push"`)
+	if scheme != "Bearer" {
+		t.Fatalf("expected Bearer, got %q", scheme)
+	}
+	expected := map[string]string{
+		"realm":   "https://auth.example.com/token",
+		"service": "example.com",
+		"scope":   "repository:foo:pull,push",
+	}
+	for k, v := range expected {
+		if params[k] != v {
+			t.Fatalf("%s: expected %q, got %q", k, v, params[k])
+		}
+	}
+	if scheme, _ := parseAuthChallenge(`Basic realm="registry"`); scheme != "Basic" {
+		t.Fatalf("expected Basic, got %q", scheme)
+	}
+}
+
+func TestReadDockerConfigAuths(t *testing.T) {
+	f, err := ioutil.TempFile("", "cbi-test-dockerconfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	// "Zm9vOmJhcg==" is "foo:bar"
+	if _, err := f.WriteString(`{"auths":{"https://index.docker.io/v1/":{"auth":"Zm9vOmJhcg=="},"example.com":{"username":"u","password":"p"}}}`); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	auths, err := readDockerConfigAuths(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a := auths["docker.io"]; a.Username != "foo" || a.Password != "bar" {
+		t.Fatalf("unexpected auth for docker.io: %+v", a)
+	}
+	if a := auths["example.com"]; a.Username != "u" || a.Password != "p" {
+		t.Fatalf("unexpected auth for example.com: %+v", a)
+	}
+}
+
+type testBlob struct {
+	mediaType string
+	content   []byte
+}
+
+func testDigest(b []byte) string {
+	sum := sha256.Sum256(b)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func testDescriptor(t *testing.T, blobs map[string]testBlob, mediaType string, v interface{}) ociDescriptor {
+	b, ok := v.([]byte)
+	if !ok {
+		var err error
+		b, err = json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	d := testDigest(b)
+	blobs[d] = testBlob{mediaType: mediaType, content: b}
+	return ociDescriptor{MediaType: mediaType, Digest: d, Size: int64(len(b))}
+}
+
+// newTestRegistry returns a registry that serves "foo:latest" (a manifest list for linux/amd64 and linux/arm/v7),
+// with the bearer token authentication for the "foo:bar" credentials.
+func newTestRegistry(t *testing.T) (*httptest.Server, map[string]testBlob) {
+	blobs := make(map[string]testBlob)
+	var manifests []ociDescriptor
+	for _, p := range []ociPlatform{{OS: "linux", Architecture: "amd64"}, {OS: "linux", Architecture: "arm", Variant: "v7"}} {
+		config := testDescriptor(t, blobs, "application/vnd.oci.image.config.v1+json", map[string]string{"architecture": p.Architecture})
+		layer := testDescriptor(t, blobs, "application/vnd.oci.image.layer.v1.tar", []byte("layer-"+p.Architecture))
+		m := testDescriptor(t, blobs, mediaTypeOCIManifest, ociManifest{
+			SchemaVersion: 2,
+			MediaType:     mediaTypeOCIManifest,
+			Config:        &config,
+			Layers:        []ociDescriptor{layer},
+		})
+		platform := p
+		m.Platform = &platform
+		manifests = append(manifests, m)
+	}
+	index := testDescriptor(t, blobs, mediaTypeOCIIndex, ociManifest{
+		SchemaVersion: 2,
+		MediaType:     mediaTypeOCIIndex,
+		Manifests:     manifests,
+	})
+	tag := index.Digest
+	var ts *httptest.Server
+	ts = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			if u, p, ok := r.BasicAuth(); !ok || u != "foo" || p != "bar" || r.URL.Query().Get("scope") != "repository:foo:pull" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(`{"access_token":"deadbeef"}`))
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer deadbeef" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="`+ts.URL+`/token",service="test"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var d string
+		switch {
+		case r.URL.Path == "/v2/foo/manifests/latest":
+			d = tag
+		case strings.HasPrefix(r.URL.Path, "/v2/foo/manifests/"):
+			d = strings.TrimPrefix(r.URL.Path, "/v2/foo/manifests/")
+		case strings.HasPrefix(r.URL.Path, "/v2/foo/blobs/"):
+			d = strings.TrimPrefix(r.URL.Path, "/v2/foo/blobs/")
+		}
+		b, ok := blobs[d]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", b.mediaType)
+		w.Write(b.content)
+	}))
+	return ts, blobs
+}
+
+func readTestOCIIndex(t *testing.T, dir string) ociManifest {
+	b, err := ioutil.ReadFile(filepath.Join(dir, "index.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var index ociManifest
+	if err := json.Unmarshal(b, &index); err != nil {
+		t.Fatal(err)
+	}
+	if len(index.Manifests) != 1 {
+		t.Fatalf("expected 1 manifest, got %+v", index.Manifests)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "oci-layout")); err != nil {
+		t.Fatal(err)
+	}
+	return index
+}
+
+func TestPopulateOCI(t *testing.T) {
+	ts, blobs := newTestRegistry(t)
+	defer ts.Close()
+	image := strings.TrimPrefix(ts.URL, "https://") + "/foo"
+	auths := map[string]registryAuth{strings.TrimPrefix(ts.URL, "https://"): {Username: "foo", Password: "bar"}}
+	ctx := context.Background()
+
+	// all the platforms
+	dir, err := ioutil.TempDir("", "cbi-test-populateoci")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := populateOCI(ctx, ts.Client(), auths, image, "", dir); err != nil {
+		t.Fatal(err)
+	}
+	index := readTestOCIIndex(t, dir)
+	if m := index.Manifests[0]; m.MediaType != mediaTypeOCIIndex || m.Annotations[annotationRefName] != "latest" {
+		t.Fatalf("unexpected manifest: %+v", m)
+	}
+	for d, b := range blobs {
+		actual, err := ioutil.ReadFile(filepath.Join(dir, "blobs", "sha256", strings.TrimPrefix(d, "sha256:")))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(actual) != string(b.content) {
+			t.Fatalf("%s: unexpected content", d)
+		}
+	}
+
+	// single platform
+	dir2, err := ioutil.TempDir("", "cbi-test-populateoci")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir2)
+	if err := populateOCI(ctx, ts.Client(), auths, image, "linux/arm/v7", dir2); err != nil {
+		t.Fatal(err)
+	}
+	index = readTestOCIIndex(t, dir2)
+	if m := index.Manifests[0]; m.MediaType != mediaTypeOCIManifest {
+		t.Fatalf("unexpected manifest: %+v", m)
+	}
+	if _, err := os.Stat(filepath.Join(dir2, "blobs", "sha256", strings.TrimPrefix(testDigest([]byte("layer-amd64")), "sha256:"))); !os.IsNotExist(err) {
+		t.Fatalf("the layer for linux/amd64 should not be fetched: %v", err)
+	}
+	if err := populateOCI(ctx, ts.Client(), auths, image, "linux/s390x", dir2); err == nil {
+		t.Fatal("error is expected for missing platform")
+	}
+
+	// wrong credentials
+	if err := populateOCI(ctx, ts.Client(), nil, image, "", dir2); err == nil {
+		t.Fatal("error is expected without credentials")
+	}
+}
@@ -0,0 +1,77 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"os"
+
+	"github.com/pkg/errors"
+	"gopkg.in/urfave/cli.v2"
+
+	crd "github.com/containerbuilding/cbi/pkg/apis/cbi/v1alpha1"
+)
+
+var populateRcloneCommand = &cli.Command{
+	Name:      "populate-rclone",
+	Usage:     "populate files via rclone. Requires rclone to be installed.",
+	ArgsUsage: "[flags] REMOTE:PATH DIRECTORY",
+	Flags: []cli.Flag{
+		&cli.StringSliceFlag{
+			Name:  "rclone-flag",
+			Usage: "Pass the flag (e.g. --bwlimit=10M) to rclone copy (can be specified multiple times)",
+		},
+	},
+	Action: withHeartbeat(limitContextSize(populateRcloneAction)),
+}
+
+func populateRcloneAction(ctx context.Context, clicontext *cli.Context) error {
+	src := clicontext.Args().Get(0)
+	if src == "" {
+		return errors.New("REMOTE:PATH missing")
+	}
+	dir := clicontext.Args().Get(1)
+	if dir == "" {
+		return errors.New("DIRECTORY missing")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	args, err := rcloneCopyArgs(clicontext.StringSlice("rclone-flag"), src, dir)
+	if err != nil {
+		return err
+	}
+	return run(ctx, "rclone", args...)
+}
+
+// rcloneCopyArgs returns the args for `rclone copy`.
+func rcloneCopyArgs(flags []string, src, dir string) ([]string, error) {
+	return rcloneArgs("copy", flags, src, dir)
+}
+
+// rcloneArgs returns the args for the rclone subcommand, e.g. `rclone copyto`.
+// The flags are validated again, as the helper may be invoked directly.
+func rcloneArgs(subcommand string, flags []string, src, dst string) ([]string, error) {
+	args := []string{subcommand}
+	for _, f := range flags {
+		if err := crd.ValidateRcloneFlag(f); err != nil {
+			return nil, err
+		}
+		args = append(args, f)
+	}
+	return append(args, src, dst), nil
+}
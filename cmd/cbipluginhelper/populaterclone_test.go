@@ -0,0 +1,38 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRcloneCopyArgs(t *testing.T) {
+	args, err := rcloneCopyArgs([]string{"--bwlimit=1M", "--retries=3"}, "remote:foo", "/tmp/foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"copy", "--bwlimit=1M", "--retries=3", "remote:foo", "/tmp/foo"}
+	if !reflect.DeepEqual(expected, args) {
+		t.Fatalf("expected %v, got %v", expected, args)
+	}
+	for _, flag := range []string{"--config=/tmp/rclone.conf", "--bwlimit", "--bwlimit=", "bwlimit=1M"} {
+		if _, err := rcloneCopyArgs([]string{flag}, "remote:foo", "/tmp/foo"); err == nil {
+			t.Fatalf("%q: error is expected", flag)
+		}
+	}
+}
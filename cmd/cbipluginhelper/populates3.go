@@ -0,0 +1,123 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"gopkg.in/urfave/cli.v2"
+)
+
+var populateS3Command = &cli.Command{
+	Name:      "populate-s3",
+	Usage:     "populate an archive via S3. Requires rclone and bsdtar to be installed. Credentials are read from AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY.",
+	ArgsUsage: "[flags] BUCKET KEY DIRECTORY",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "endpoint",
+			Usage: "Endpoint for S3-compatible object stores. Empty for AWS.",
+		},
+		&cli.StringFlag{
+			Name:  "region",
+			Usage: "Region. e.g. us-east-1",
+		},
+	},
+	Action: withHeartbeat(limitContextSize(populateS3Action)),
+}
+
+// s3Remote is the name of the rclone remote configured via environment variables.
+const s3Remote = "cbis3"
+
+func populateS3Action(ctx context.Context, clicontext *cli.Context) error {
+	bucket := clicontext.Args().Get(0)
+	if bucket == "" {
+		return errors.New("BUCKET missing")
+	}
+	key := clicontext.Args().Get(1)
+	if key == "" {
+		return errors.New("KEY missing")
+	}
+	dir := clicontext.Args().Get(2)
+	if dir == "" {
+		return errors.New("DIRECTORY missing")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	if err := configureS3Remote(clicontext.String("endpoint"), clicontext.String("region")); err != nil {
+		return err
+	}
+	return populateRcloneArchive(ctx, s3Remote+":"+bucket+"/"+key, dir)
+}
+
+// populateRcloneArchive downloads the archive object src (in the `REMOTE:PATH` form of rclone)
+// and extracts it into dir, with auto-detection of the format.
+func populateRcloneArchive(ctx context.Context, src, dir string) error {
+	tmp, err := ioutil.TempDir(filepath.Dir(dir), stagingPrefix(dir))
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	archive := filepath.Join(tmp, "archive")
+	if err := run(ctx, "rclone", "copyto", src, archive); err != nil {
+		return err
+	}
+	f, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return extractArchive(ctx, f, dir)
+}
+
+// setRcloneRemoteEnv configures the rclone remote with the environment variables of prefix,
+// e.g. RCLONE_CONFIG_CBIS3_TYPE for prefix "RCLONE_CONFIG_CBIS3_" and key "TYPE".
+// Empty values are not set.
+func setRcloneRemoteEnv(prefix string, env map[string]string) error {
+	for k, v := range env {
+		if v == "" {
+			continue
+		}
+		if err := os.Setenv(prefix+k, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// configureS3Remote configures the rclone remote via environment variables,
+// so that users do not need to write the rclone config.
+func configureS3Remote(endpoint, region string) error {
+	const prefix = "RCLONE_CONFIG_CBIS3_"
+	env := map[string]string{
+		"TYPE":     "s3",
+		"ENDPOINT": endpoint,
+		"REGION":   region,
+	}
+	if os.Getenv("AWS_ACCESS_KEY_ID") != "" {
+		env["ACCESS_KEY_ID"] = os.Getenv("AWS_ACCESS_KEY_ID")
+		env["SECRET_ACCESS_KEY"] = os.Getenv("AWS_SECRET_ACCESS_KEY")
+	} else {
+		// e.g. IAM roles
+		env["ENV_AUTH"] = "true"
+	}
+	return setRcloneRemoteEnv(prefix, env)
+}
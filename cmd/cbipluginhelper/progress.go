@@ -0,0 +1,126 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"io"
+	"regexp"
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+)
+
+// progressStep is the minimum increase of the percentage between the progress logs.
+const progressStep = 10
+
+// progressLogger logs the progress of a phase with the "phase" and "percent" fields,
+// which are machine-readable with --log-format=json.
+type progressLogger struct {
+	phase       string
+	lastPercent int
+}
+
+func newProgressLogger(phase string) *progressLogger {
+	return &progressLogger{phase: phase, lastPercent: -progressStep}
+}
+
+// report logs percent if it increased by progressStep or reached 100.
+func (l *progressLogger) report(percent int) {
+	if percent < l.lastPercent+progressStep && !(percent == 100 && l.lastPercent < 100) {
+		return
+	}
+	l.lastPercent = percent
+	logrus.WithFields(logrus.Fields{"phase": l.phase, "percent": percent}).Infof("%s: %d%%", l.phase, percent)
+}
+
+// logPhase logs the start of a phase without the percentage.
+func logPhase(phase string) {
+	logrus.WithField("phase", phase).Info(phase)
+}
+
+// gitProgressRegexp matches the progress lines of git, e.g. "Receiving objects:  45% (450/1000)".
+var gitProgressRegexp = regexp.MustCompile(`^(?:remote: )?([A-Za-z ]+):\s+(\d+)%`)
+
+// gitProgressWriter parses the progress output of `git clone --progress` and `git fetch --progress`.
+// The other lines are logged in the debug level.
+type gitProgressWriter struct {
+	buf     []byte
+	loggers map[string]*progressLogger
+}
+
+func newGitProgressWriter() *gitProgressWriter {
+	return &gitProgressWriter{loggers: make(map[string]*progressLogger)}
+}
+
+func (w *gitProgressWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		// git updates the progress lines with '\r'
+		i := bytes.IndexAny(w.buf, "\r\n")
+		if i < 0 {
+			return len(p), nil
+		}
+		w.line(string(w.buf[:i]))
+		w.buf = w.buf[i+1:]
+	}
+}
+
+func (w *gitProgressWriter) line(s string) {
+	if s == "" {
+		return
+	}
+	m := gitProgressRegexp.FindStringSubmatch(s)
+	if m == nil {
+		logrus.Debugf("git: %s", s)
+		return
+	}
+	percent, err := strconv.Atoi(m[2])
+	if err != nil {
+		return
+	}
+	phase := m[1]
+	l, ok := w.loggers[phase]
+	if !ok {
+		l = newProgressLogger(phase)
+		w.loggers[phase] = l
+	}
+	l.report(percent)
+}
+
+// progressReader logs the progress of reading total bytes.
+// The progress is not logged when total is unknown (negative).
+type progressReader struct {
+	r      io.Reader
+	total  int64
+	read   int64
+	logger *progressLogger
+}
+
+func newProgressReader(r io.Reader, total int64, phase string) io.Reader {
+	if total <= 0 {
+		return r
+	}
+	return &progressReader{r: r, total: total, logger: newProgressLogger(phase)}
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.read += int64(n)
+	r.logger.report(int(r.read * 100 / r.total))
+	return n, err
+}
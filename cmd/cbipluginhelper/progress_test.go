@@ -0,0 +1,110 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+type progressEntry struct {
+	Phase   string `json:"phase"`
+	Percent int    `json:"percent"`
+}
+
+// captureProgress captures the progress logs emitted by fn.
+func captureProgress(t *testing.T, fn func()) []progressEntry {
+	var buf bytes.Buffer
+	logrus.SetOutput(&buf)
+	logrus.SetFormatter(&logrus.JSONFormatter{})
+	defer logrus.SetOutput(os.Stderr)
+	defer logrus.SetFormatter(&logrus.TextFormatter{})
+	fn()
+	var entries []progressEntry
+	for _, l := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if l == "" {
+			continue
+		}
+		var e progressEntry
+		if err := json.Unmarshal([]byte(l), &e); err != nil {
+			t.Fatalf("%q: %v", l, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+func TestGitProgressWriter(t *testing.T) {
+	entries := captureProgress(t, func() {
+		w := newGitProgressWriter()
+		// the lines may be split across writes
+		for _, s := range []string{
+			"Cloning into 'foo'...\n",
+			"remote: Counting objects:  50% (1/2)\rremote: Counting objects: 100% (2/2), done.\n",
+			"Receiving objects:   1% (1/100)\rReceiving objects:   5% (5/100)\rReceiving obj",
+			"ects:  12% (12/100)\rReceiving objects: 100% (100/100), done.\n",
+		} {
+			if _, err := w.Write([]byte(s)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	})
+	expected := []progressEntry{
+		{Phase: "Counting objects", Percent: 50},
+		{Phase: "Counting objects", Percent: 100},
+		{Phase: "Receiving objects", Percent: 1},
+		{Phase: "Receiving objects", Percent: 12},
+		{Phase: "Receiving objects", Percent: 100},
+	}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, entries)
+	}
+}
+
+func TestProgressReader(t *testing.T) {
+	data := bytes.Repeat([]byte("x"), 1000)
+	entries := captureProgress(t, func() {
+		r := newProgressReader(bytes.NewReader(data), int64(len(data)), "download")
+		buf := make([]byte, 300)
+		for {
+			if _, err := r.Read(buf); err != nil {
+				break
+			}
+		}
+	})
+	expected := []progressEntry{
+		{Phase: "download", Percent: 30},
+		{Phase: "download", Percent: 60},
+		{Phase: "download", Percent: 90},
+		{Phase: "download", Percent: 100},
+	}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, entries)
+	}
+	// unknown size
+	r := newProgressReader(bytes.NewReader(data), -1, "download")
+	if b, err := ioutil.ReadAll(r); err != nil || len(b) != len(data) {
+		t.Fatalf("unexpected result: %d bytes, %v", len(b), err)
+	}
+}
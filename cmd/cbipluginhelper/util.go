@@ -19,8 +19,11 @@ package main
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
+	"strings"
+	"time"
 
 	"github.com/sirupsen/logrus"
 )
@@ -34,6 +37,26 @@ func run(ctx context.Context, name string, args ...string) error {
 	return cmd.Run()
 }
 
+// runWithStderr is similar to run, but writes the stderr of the command to stderr.
+func runWithStderr(ctx context.Context, stderr io.Writer, name string, args ...string) error {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Env = os.Environ()
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = stderr
+	logrus.Debugf("running %q (%v)", name, args)
+	return cmd.Run()
+}
+
+// output runs the command and returns the stdout without trailing spaces
+func output(ctx context.Context, name string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Env = os.Environ()
+	cmd.Stderr = &logrusDebugWriter{prefix: fmt.Sprintf("%s: ", name)}
+	logrus.Debugf("running %q (%v)", name, args)
+	b, err := cmd.Output()
+	return strings.TrimSpace(string(b)), err
+}
+
 type logrusDebugWriter struct {
 	prefix string
 }
@@ -42,3 +65,24 @@ func (w *logrusDebugWriter) Write(p []byte) (int, error) {
 	logrus.Debugf("%s%s", w.prefix, string(p))
 	return len(p), nil
 }
+
+// maxRetryInterval caps the interval of retry.
+const maxRetryInterval = 30 * time.Second
+
+// retry calls fn up to retries+1 times until it succeeds.
+// The interval starts with initialInterval and doubles on each retry.
+func retry(retries int, initialInterval time.Duration, fn func() error) error {
+	interval := initialInterval
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= retries {
+			return err
+		}
+		logrus.WithError(err).Warnf("attempt %d/%d failed, retrying in %v", attempt+1, retries+1, interval)
+		time.Sleep(interval)
+		interval *= 2
+		if interval > maxRetryInterval {
+			interval = maxRetryInterval
+		}
+	}
+}
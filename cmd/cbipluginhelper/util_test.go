@@ -0,0 +1,52 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRetry(t *testing.T) {
+	cases := []struct {
+		retries          int
+		failures         int
+		expectedAttempts int
+		expectedErr      bool
+	}{
+		{retries: 0, failures: 0, expectedAttempts: 1},
+		{retries: 0, failures: 1, expectedAttempts: 1, expectedErr: true},
+		{retries: 2, failures: 2, expectedAttempts: 3},
+		{retries: 2, failures: 3, expectedAttempts: 3, expectedErr: true},
+	}
+	for _, c := range cases {
+		attempts := 0
+		err := retry(c.retries, 0, func() error {
+			attempts++
+			if attempts <= c.failures {
+				return errors.New("transient")
+			}
+			return nil
+		})
+		if (err != nil) != c.expectedErr {
+			t.Fatalf("%+v: unexpected error %v", c, err)
+		}
+		if attempts != c.expectedAttempts {
+			t.Fatalf("%+v: expected %d attempts, got %d", c, c.expectedAttempts, attempts)
+		}
+	}
+}
@@ -27,24 +27,78 @@ if [ -z "${DBP_DIALECT}" ]; then
     exit 1
 fi
 
+# DBP_TARGET_REVISION_FILE is optional (path to the file that contains the Git commit SHA).
+# The {{.SHA}} and {{.ShortSHA}} placeholders in DBP_IMAGE_NAME are replaced with the commit SHA.
+if [ -n "${DBP_TARGET_REVISION_FILE}" ]; then
+    sha=$(cat ${DBP_TARGET_REVISION_FILE})
+    short_sha=$(echo ${sha} | cut -c 1-7)
+    DBP_IMAGE_NAME=$(echo ${DBP_IMAGE_NAME} | sed -e "s/{{\.SHA}}/${sha}/g" -e "s/{{\.ShortSHA}}/${short_sha}/g")
+fi
+
+# DBP_REVISION_FILE is optional (path to the file that contains the Git commit SHA)
+if [ -n "${DBP_REVISION_FILE}" ]; then
+    set -- --label "org.opencontainers.image.revision=$(cat ${DBP_REVISION_FILE})" "$@"
+fi
+
 case ${DBP_DIALECT} in
     docker )
-        ${DBP_DOCKER_BINARY} build -t ${DBP_IMAGE_NAME} $@ ;;
+        ${DBP_DOCKER_BINARY} build -t ${DBP_IMAGE_NAME} "$@" ;;
     buildah )
-        ${DBP_DOCKER_BINARY} bud -t ${DBP_IMAGE_NAME} $@ ;;
+        ${DBP_DOCKER_BINARY} bud -t ${DBP_IMAGE_NAME} "$@" ;;
     *)
         echo "Unsupported dialect: ${DBP_DIALECT}"
         exit 1
 esac
 
+# DBP_ADDITIONAL_IMAGE_NAMES is optional (space-separated strings)
+for name in ${DBP_ADDITIONAL_IMAGE_NAMES}; do
+    ${DBP_DOCKER_BINARY} tag ${DBP_IMAGE_NAME} ${name}
+done
+
+# DBP_PUSH_RETRIES is optional (the number of retries of a failed push, with exponential backoff).
+# Retrying is idempotent, as the registry skips the blobs that were already uploaded.
+push_retries=0
+retry_push() {
+    attempt=0
+    delay=1
+    until "$@"; do
+        if [ "${attempt}" -ge "${DBP_PUSH_RETRIES:-0}" ]; then
+            return 1
+        fi
+        attempt=$((attempt + 1))
+        push_retries=$((push_retries + 1))
+        echo "Push failed, retrying in ${delay}s (${attempt}/${DBP_PUSH_RETRIES})"
+        sleep ${delay}
+        delay=$((delay * 2))
+        if [ "${delay}" -gt 30 ]; then
+            delay=30
+        fi
+    done
+}
+
 if [ "${DBP_PUSH}" = 1 ]; then
-    case ${DBP_DIALECT} in
-        docker )
-            ${DBP_DOCKER_BINARY} push ${DBP_IMAGE_NAME} ;;
-        buildah )
-            ${DBP_DOCKER_BINARY} push ${DBP_IMAGE_NAME} docker://${DBP_IMAGE_NAME} ;;
-        *)
-            echo "Unsupported dialect: ${DBP_DIALECT}"
-            exit 1
-    esac
+    for name in ${DBP_IMAGE_NAME} ${DBP_ADDITIONAL_IMAGE_NAMES}; do
+        case ${DBP_DIALECT} in
+            docker )
+                retry_push ${DBP_DOCKER_BINARY} push ${name} ;;
+            buildah )
+                # DBP_PUSH_FLAGS is optional (space-separated strings)
+                retry_push ${DBP_DOCKER_BINARY} push ${DBP_PUSH_FLAGS} ${name} docker://${name} ;;
+            *)
+                echo "Unsupported dialect: ${DBP_DIALECT}"
+                exit 1
+        esac
+    done
+fi
+
+# DBP_TERMINATION_MESSAGE_PATH is optional. The image digest is only reported for docker dialect.
+if [ -n "${DBP_TERMINATION_MESSAGE_PATH}" ]; then
+    : > ${DBP_TERMINATION_MESSAGE_PATH}
+    if [ "${DBP_PUSH}" = 1 ] && [ "${DBP_DIALECT}" = docker ]; then
+        repo_digest=$(${DBP_DOCKER_BINARY} inspect --format '{{index .RepoDigests 0}}' ${DBP_IMAGE_NAME})
+        echo "cbi.image-digest=${repo_digest#*@}" >> ${DBP_TERMINATION_MESSAGE_PATH}
+    fi
+    if [ "${push_retries}" -gt 0 ]; then
+        echo "cbi.push-retries=${push_retries}" >> ${DBP_TERMINATION_MESSAGE_PATH}
+    fi
 fi
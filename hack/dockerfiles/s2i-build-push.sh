@@ -16,7 +16,13 @@ if [ -z "${SBP_PUSH}" ]; then
     exit 1
 fi
 
-s2i build $@
+s2i build "$@"
+# SBP_ADDITIONAL_IMAGE_NAMES is optional (space-separated strings)
+for name in ${SBP_ADDITIONAL_IMAGE_NAMES}; do
+    docker tag ${SBP_IMAGE_NAME} ${name}
+done
 if [ "${SBP_PUSH}" = 1 ]; then
-    docker push ${SBP_IMAGE_NAME}
+    for name in ${SBP_IMAGE_NAME} ${SBP_ADDITIONAL_IMAGE_NAMES}; do
+        docker push ${name}
+    done
 fi
@@ -0,0 +1,181 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// maxFillDepth limits the recursion of fillValue, e.g. for Context.Additional.
+const maxFillDepth = 8
+
+// fillValue sets all the exported fields of v to non-zero values derived from s.
+// Unexported fields (e.g. the ones of time.Time) are kept as-is.
+func fillValue(v reflect.Value, s string, depth int) {
+	if depth > maxFillDepth {
+		return
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		v.SetBool(true)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v.SetInt(int64(len(s)))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v.SetUint(uint64(len(s)))
+	case reflect.Float32, reflect.Float64:
+		v.SetFloat(float64(len(s)))
+	case reflect.Ptr:
+		p := reflect.New(v.Type().Elem())
+		fillValue(p.Elem(), s, depth+1)
+		v.Set(p)
+	case reflect.Slice:
+		sl := reflect.MakeSlice(v.Type(), 1, 1)
+		fillValue(sl.Index(0), s, depth+1)
+		v.Set(sl)
+	case reflect.Map:
+		m := reflect.MakeMap(v.Type())
+		k := reflect.New(v.Type().Key()).Elem()
+		fillValue(k, s, depth+1)
+		e := reflect.New(v.Type().Elem()).Elem()
+		fillValue(e, s, depth+1)
+		m.SetMapIndex(k, e)
+		v.Set(m)
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if f := v.Field(i); f.CanSet() {
+				fillValue(f, s, depth+1)
+			}
+		}
+	}
+}
+
+// mutateValue modifies the strings and the bools reachable from v in place,
+// without allocating new pointers, slices, or maps.
+func mutateValue(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.String:
+		if v.CanSet() {
+			v.SetString(v.String() + "-mutated")
+		}
+	case reflect.Bool:
+		if v.CanSet() {
+			v.SetBool(!v.Bool())
+		}
+	case reflect.Ptr:
+		if !v.IsNil() {
+			mutateValue(v.Elem())
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			mutateValue(v.Index(i))
+		}
+	case reflect.Map:
+		for _, k := range v.MapKeys() {
+			e := reflect.New(v.Type().Elem()).Elem()
+			e.Set(v.MapIndex(k))
+			mutateValue(e)
+			v.SetMapIndex(k, e)
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			mutateValue(v.Field(i))
+		}
+	}
+}
+
+// checkNoAliasing returns an error if a and b share a pointer, a slice, or a map.
+func checkNoAliasing(a, b reflect.Value, path string) error {
+	switch a.Kind() {
+	case reflect.Ptr, reflect.Map:
+		if a.IsNil() || b.IsNil() {
+			return nil
+		}
+		if a.Pointer() == b.Pointer() {
+			return fmt.Errorf("%s is shallow-copied", path)
+		}
+		if a.Kind() == reflect.Ptr {
+			return checkNoAliasing(a.Elem(), b.Elem(), path)
+		}
+		for _, k := range a.MapKeys() {
+			if err := checkNoAliasing(a.MapIndex(k), b.MapIndex(k), fmt.Sprintf("%s[%v]", path, k)); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice:
+		if a.Len() == 0 || b.Len() == 0 {
+			return nil
+		}
+		if a.Pointer() == b.Pointer() {
+			return fmt.Errorf("%s is shallow-copied", path)
+		}
+		for i := 0; i < a.Len(); i++ {
+			if err := checkNoAliasing(a.Index(i), b.Index(i), fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		for i := 0; i < a.NumField(); i++ {
+			if err := checkNoAliasing(a.Field(i), b.Field(i), path+"."+a.Type().Field(i).Name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func TestDeepCopy(t *testing.T) {
+	var orig, expected BuildJob
+	fillValue(reflect.ValueOf(&orig).Elem(), "foo", 0)
+	fillValue(reflect.ValueOf(&expected).Elem(), "foo", 0)
+	if len(orig.Spec.Context.Additional) == 0 || orig.Spec.Language.Dockerfile.BuildArgs == nil || len(orig.Status.Conditions) == 0 {
+		t.Fatalf("fillValue did not fill the nested fields: %+v", orig)
+	}
+
+	copied := orig.DeepCopy()
+	if !reflect.DeepEqual(orig, *copied) {
+		t.Fatalf("expected %+v, got %+v", orig, *copied)
+	}
+	if err := checkNoAliasing(reflect.ValueOf(orig), reflect.ValueOf(*copied), "BuildJob"); err != nil {
+		t.Fatal(err)
+	}
+	mutateValue(reflect.ValueOf(copied).Elem())
+	if reflect.DeepEqual(orig, *copied) {
+		t.Fatal("mutateValue did not mutate the copy")
+	}
+	if !reflect.DeepEqual(expected, orig) {
+		t.Fatalf("the original was modified via the copy: expected %+v, got %+v", expected, orig)
+	}
+}
+
+func TestDeepCopyObject(t *testing.T) {
+	var orig BuildJobList
+	fillValue(reflect.ValueOf(&orig).Elem(), "foo", 0)
+	copied, ok := orig.DeepCopyObject().(*BuildJobList)
+	if !ok {
+		t.Fatalf("unexpected type %T", orig.DeepCopyObject())
+	}
+	if !reflect.DeepEqual(orig, *copied) {
+		t.Fatalf("expected %+v, got %+v", orig, *copied)
+	}
+	if err := checkNoAliasing(reflect.ValueOf(orig), reflect.ValueOf(*copied), "BuildJobList"); err != nil {
+		t.Fatal(err)
+	}
+}
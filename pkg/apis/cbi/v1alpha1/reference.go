@@ -0,0 +1,100 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	// DefaultRegistry is the registry used when the reference does not contain the registry.
+	DefaultRegistry = "docker.io"
+	// DefaultTag is the tag used when the reference contains neither the tag nor the digest.
+	DefaultTag = "latest"
+)
+
+var anchoredReferenceRegexp = regexp.MustCompile(`^(?:(` + domain + `)/)?(` + nameComponent + `(?:/` + nameComponent + `)*)(?::(` + tag + `))?(?:@(` + digest + `))?$`)
+
+// Reference is a parsed image reference.
+type Reference struct {
+	// Registry is the host (and the port) of the registry. e.g. `example.com:5000`
+	Registry string
+	// Repository is the path in the registry. e.g. `foo/bar`
+	Repository string
+	// Tag is the tag. e.g. `latest`
+	Tag string
+	// Digest is the digest. e.g. `sha256:...`
+	// +optional
+	Digest string
+}
+
+// String returns the string representation of the reference.
+func (r Reference) String() string {
+	s := r.Registry + "/" + r.Repository
+	if r.Tag != "" {
+		s += ":" + r.Tag
+	}
+	if r.Digest != "" {
+		s += "@" + r.Digest
+	}
+	return s
+}
+
+// ParseReference parses an image reference such as `example.com:5000/foo/bar:latest`.
+// Following the Docker convention, the registry is defaulted to DefaultRegistry
+// (with `library/` for single-component repositories), and the tag is defaulted to
+// DefaultTag unless the digest is specified.
+func ParseReference(ref string) (Reference, error) {
+	if err := ValidateReference(ref); err != nil {
+		return Reference{}, err
+	}
+	m := anchoredReferenceRegexp.FindStringSubmatch(ref)
+	if m == nil {
+		return Reference{}, fmt.Errorf("invalid image reference %q", ref)
+	}
+	r := Reference{
+		Registry:   m[1],
+		Repository: m[2],
+		Tag:        m[3],
+		Digest:     m[4],
+	}
+	// the first component is a registry only if it looks like a host name, e.g. "foo/bar" is a repository
+	if r.Registry != "" && !strings.ContainsAny(r.Registry, ".:") && r.Registry != "localhost" {
+		if strings.ToLower(r.Registry) != r.Registry {
+			return Reference{}, fmt.Errorf("invalid image reference %q: repository name must be lowercase", ref)
+		}
+		r.Repository = r.Registry + "/" + r.Repository
+		r.Registry = ""
+	}
+	if r.Registry == "" {
+		r.Registry = DefaultRegistry
+		if !strings.Contains(r.Repository, "/") {
+			r.Repository = "library/" + r.Repository
+		}
+	}
+	if r.Tag == "" && r.Digest == "" {
+		r.Tag = DefaultTag
+	}
+	return r, nil
+}
+
+// Parse parses Target.
+func (r Registry) Parse() (Reference, error) {
+	return ParseReference(r.Target)
+}
@@ -0,0 +1,109 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseReference(t *testing.T) {
+	dgst := "sha256:" + strings.Repeat("a", 64)
+	testCases := []struct {
+		ref      string
+		expected Reference
+		invalid  bool
+	}{
+		{
+			ref:      "example.com:5000/foo/bar:latest",
+			expected: Reference{Registry: "example.com:5000", Repository: "foo/bar", Tag: "latest"},
+		},
+		{
+			ref:      "example.com/foo/bar:baz",
+			expected: Reference{Registry: "example.com", Repository: "foo/bar", Tag: "baz"},
+		},
+		{
+			ref:      "example.com/foo/bar",
+			expected: Reference{Registry: "example.com", Repository: "foo/bar", Tag: "latest"},
+		},
+		{
+			ref:      "example.com/foo/bar@" + dgst,
+			expected: Reference{Registry: "example.com", Repository: "foo/bar", Digest: dgst},
+		},
+		{
+			ref:      "example.com/foo/bar:baz@" + dgst,
+			expected: Reference{Registry: "example.com", Repository: "foo/bar", Tag: "baz", Digest: dgst},
+		},
+		{
+			ref:      "localhost/foo",
+			expected: Reference{Registry: "localhost", Repository: "foo", Tag: "latest"},
+		},
+		{
+			ref:      "localhost:5000/foo",
+			expected: Reference{Registry: "localhost:5000", Repository: "foo", Tag: "latest"},
+		},
+		{
+			ref:      "foo/bar:baz",
+			expected: Reference{Registry: "docker.io", Repository: "foo/bar", Tag: "baz"},
+		},
+		{
+			ref:      "foo",
+			expected: Reference{Registry: "docker.io", Repository: "library/foo", Tag: "latest"},
+		},
+		{
+			ref:     "",
+			invalid: true,
+		},
+		{
+			ref:     "Foo/bar",
+			invalid: true,
+		},
+		{
+			ref:     "example.com/foo/../bar",
+			invalid: true,
+		},
+		{
+			ref:     "example.com/foo:",
+			invalid: true,
+		},
+	}
+	for _, tc := range testCases {
+		actual, err := ParseReference(tc.ref)
+		if err != nil && !tc.invalid {
+			t.Fatalf("%q: %v", tc.ref, err)
+		}
+		if err == nil {
+			if tc.invalid {
+				t.Fatalf("%q: error is expected", tc.ref)
+			}
+			if actual != tc.expected {
+				t.Fatalf("%q: expected %+v, got %+v", tc.ref, tc.expected, actual)
+			}
+		}
+	}
+}
+
+func TestRegistryParse(t *testing.T) {
+	r := Registry{Target: "example.com/foo/bar"}
+	ref, err := r.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := ref.String(); s != "example.com/foo/bar:latest" {
+		t.Fatalf("unexpected reference %q", s)
+	}
+}
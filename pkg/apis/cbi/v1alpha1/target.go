@@ -0,0 +1,111 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// TargetVariables are the variables of the Go template in Registry.Target,
+// e.g. `example.com/foo:{{.ShortSHA}}`.
+type TargetVariables struct {
+	// SHA is the full commit SHA of the Git context.
+	SHA string
+	// ShortSHA is the first ShortSHALength characters of SHA.
+	ShortSHA string
+	// Branch is Git.Revision when it is a branch.
+	Branch string
+	// Tag is Git.Revision when it is a tag.
+	Tag string
+}
+
+// ShortSHALength is the length of TargetVariables.ShortSHA.
+const ShortSHALength = 7
+
+// RuntimeTargetVariables are the placeholders kept for SHA and ShortSHA when the commit SHA is not
+// known until the Git context is fetched. Plugins replace them with the resolved revision at run time.
+var RuntimeTargetVariables = TargetVariables{SHA: "{{.SHA}}", ShortSHA: "{{.ShortSHA}}"}
+
+var (
+	fullSHARegexp = regexp.MustCompile(`^[0-9a-f]{40}$`)
+	// invalidTagCharRegexp matches the characters that are not allowed in image tags.
+	invalidTagCharRegexp = regexp.MustCompile(`[^A-Za-z0-9_.-]`)
+)
+
+// IsTargetTemplate returns true if target contains a Go template action.
+func IsTargetTemplate(target string) bool {
+	return strings.Contains(target, "{{")
+}
+
+// ExpandTarget executes the Go template in target with vars.
+func ExpandTarget(target string, vars TargetVariables) (string, error) {
+	tmpl, err := template.New("target").Parse(target)
+	if err != nil {
+		return "", fmt.Errorf("invalid template %q: %v", target, err)
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, vars); err != nil {
+		return "", fmt.Errorf("invalid template %q: %v", target, err)
+	}
+	return b.String(), nil
+}
+
+// GitTargetVariables returns the target variables for git.
+// resolvedRevision is the commit SHA reported by the Git context. When it is empty, SHA is
+// git.Revision if it is a full commit SHA, and RuntimeTargetVariables.SHA otherwise.
+// Branch and Tag have the characters that are not allowed in image tags replaced with '-'.
+// Branch and Tag are empty when git.FetchRefspec is set.
+func GitTargetVariables(git Git, resolvedRevision string) TargetVariables {
+	vars := RuntimeTargetVariables
+	switch {
+	case resolvedRevision != "":
+		vars.SHA = resolvedRevision
+	case fullSHARegexp.MatchString(git.Revision):
+		vars.SHA = git.Revision
+	}
+	if vars.SHA != RuntimeTargetVariables.SHA && len(vars.SHA) >= ShortSHALength {
+		vars.ShortSHA = vars.SHA[:ShortSHALength]
+	}
+	if git.FetchRefspec != "" {
+		return vars
+	}
+	tag := invalidTagCharRegexp.ReplaceAllString(git.Revision, "-")
+	switch git.RevisionType {
+	case GitRevisionTypeBranch:
+		vars.Branch = tag
+	case GitRevisionTypeTag:
+		vars.Tag = tag
+	case "", GitRevisionTypeAuto:
+		if !fullSHARegexp.MatchString(git.Revision) {
+			vars.Branch = tag
+		}
+	}
+	return vars
+}
+
+// NeedsRuntimeTargetExpansion returns true if Registry.Target still contains RuntimeTargetVariables
+// after the expansion with the variables known before the build.
+func NeedsRuntimeTargetExpansion(s BuildJobSpec) bool {
+	if !IsTargetTemplate(s.Registry.Target) || s.Context.Kind != ContextKindGit {
+		return false
+	}
+	target, err := ExpandTarget(s.Registry.Target, GitTargetVariables(s.Context.Git, ""))
+	return err == nil && IsTargetTemplate(target)
+}
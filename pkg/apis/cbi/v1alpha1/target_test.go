@@ -0,0 +1,133 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"testing"
+)
+
+func TestExpandTarget(t *testing.T) {
+	vars := TargetVariables{
+		SHA:      "0123456789abcdef0123456789abcdef01234567",
+		ShortSHA: "0123456",
+		Branch:   "master",
+		Tag:      "v1.0.0",
+	}
+	cases := []struct {
+		s        string
+		expected string
+		invalid  bool
+	}{
+		{s: "example.com/foo:latest", expected: "example.com/foo:latest"},
+		{s: "example.com/foo:{{.SHA}}", expected: "example.com/foo:0123456789abcdef0123456789abcdef01234567"},
+		{s: "example.com/foo:git-{{.ShortSHA}}", expected: "example.com/foo:git-0123456"},
+		{s: "example.com/foo:{{.Branch}}", expected: "example.com/foo:master"},
+		{s: "example.com/foo:{{ .Tag }}", expected: "example.com/foo:v1.0.0"},
+		{s: "example.com/foo:{{or .Tag .Branch}}", expected: "example.com/foo:v1.0.0"},
+		{s: "example.com/foo:{{.Unknown}}", invalid: true},
+		{s: "example.com/foo:{{.SHA", invalid: true},
+	}
+	for _, c := range cases {
+		actual, err := ExpandTarget(c.s, vars)
+		if err != nil && !c.invalid {
+			t.Fatalf("%q: %v", c.s, err)
+		}
+		if err == nil {
+			if c.invalid {
+				t.Fatalf("%q: error is expected, got %q", c.s, actual)
+			}
+			if actual != c.expected {
+				t.Fatalf("%q: expected %q, got %q", c.s, c.expected, actual)
+			}
+		}
+	}
+}
+
+func TestGitTargetVariables(t *testing.T) {
+	sha := "0123456789abcdef0123456789abcdef01234567"
+	cases := []struct {
+		git              Git
+		resolvedRevision string
+		expected         TargetVariables
+	}{
+		{
+			git:      Git{URL: "https://example.com/foo.git"},
+			expected: RuntimeTargetVariables,
+		},
+		{
+			git:              Git{URL: "https://example.com/foo.git"},
+			resolvedRevision: sha,
+			expected:         TargetVariables{SHA: sha, ShortSHA: "0123456"},
+		},
+		{
+			git:      Git{URL: "https://example.com/foo.git", Revision: sha},
+			expected: TargetVariables{SHA: sha, ShortSHA: "0123456"},
+		},
+		{
+			git:      Git{URL: "https://example.com/foo.git", Revision: "feature/foo"},
+			expected: TargetVariables{SHA: "{{.SHA}}", ShortSHA: "{{.ShortSHA}}", Branch: "feature-foo"},
+		},
+		{
+			git:              Git{URL: "https://example.com/foo.git", Revision: "master", RevisionType: GitRevisionTypeBranch},
+			resolvedRevision: sha,
+			expected:         TargetVariables{SHA: sha, ShortSHA: "0123456", Branch: "master"},
+		},
+		{
+			git:              Git{URL: "https://example.com/foo.git", Revision: "v1.0.0", RevisionType: GitRevisionTypeTag},
+			resolvedRevision: sha,
+			expected:         TargetVariables{SHA: sha, ShortSHA: "0123456", Tag: "v1.0.0"},
+		},
+		{
+			git:      Git{URL: "https://example.com/foo.git", Revision: sha, RevisionType: GitRevisionTypeCommit},
+			expected: TargetVariables{SHA: sha, ShortSHA: "0123456"},
+		},
+		{
+			git:              Git{URL: "https://example.com/foo.git", Revision: "master", FetchRefspec: "refs/pull/42/head"},
+			resolvedRevision: sha,
+			expected:         TargetVariables{SHA: sha, ShortSHA: "0123456"},
+		},
+	}
+	for i, c := range cases {
+		if actual := GitTargetVariables(c.git, c.resolvedRevision); actual != c.expected {
+			t.Fatalf("case %d: expected %+v, got %+v", i, c.expected, actual)
+		}
+	}
+}
+
+func TestNeedsRuntimeTargetExpansion(t *testing.T) {
+	git := func(revision, target string) BuildJobSpec {
+		return BuildJobSpec{
+			Registry: Registry{Target: target},
+			Context:  Context{Kind: ContextKindGit, Git: Git{URL: "https://example.com/foo.git", Revision: revision}},
+		}
+	}
+	cases := []struct {
+		spec     BuildJobSpec
+		expected bool
+	}{
+		{spec: git("master", "example.com/foo:latest")},
+		{spec: git("master", "example.com/foo:{{.Branch}}")},
+		{spec: git("master", "example.com/foo:{{.ShortSHA}}"), expected: true},
+		{spec: git("0123456789abcdef0123456789abcdef01234567", "example.com/foo:{{.ShortSHA}}")},
+		{spec: BuildJobSpec{Registry: Registry{Target: "example.com/foo:{{.SHA}}"}}},
+	}
+	for i, c := range cases {
+		if actual := NeedsRuntimeTargetExpansion(c.spec); actual != c.expected {
+			t.Fatalf("case %d: expected %v, got %v", i, c.expected, actual)
+		}
+	}
+}
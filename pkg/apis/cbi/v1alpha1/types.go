@@ -59,6 +59,115 @@ type BuildJobSpec struct {
 	//
 	// +optional
 	PluginSelector string `json:"pluginSelector" yaml:"pluginSelector"`
+	// Timeout bounds the duration of the build, including fetching the context.
+	// When the timeout elapses, the build is terminated and marked as failed.
+	// Nil means no timeout.
+	// +optional
+	Timeout *metav1.Duration `json:"timeout" yaml:"timeout"`
+	// ContextFetchStallThreshold is the duration after which a running init container that shows
+	// no progress (i.e. no log line, including the heartbeats of cbipluginhelper) is reported
+	// with a ContextFetchStalled event.
+	// The build is not terminated. Nil disables the detection.
+	// +optional
+	ContextFetchStallThreshold *metav1.Duration `json:"contextFetchStallThreshold" yaml:"contextFetchStallThreshold"`
+	// BackoffLimit is the number of retries of the failed build, e.g. 0 for no retries.
+	// Each retry runs in a new pod. Nil means the default of the Kubernetes Job (6).
+	// +optional
+	BackoffLimit *int32 `json:"backoffLimit" yaml:"backoffLimit"`
+	// Labels are added to the image.
+	// For Git context, "org.opencontainers.image.source" and "org.opencontainers.image.revision"
+	// are also added automatically, unless specified in Labels.
+	// +optional
+	Labels map[string]string `json:"labels"`
+	// DryRun validates the BuildJob without running the build.
+	// The controller selects the plugin and generates the pod spec, and reports
+	// the result as the Validated condition, but does not create the job.
+	// +optional
+	DryRun bool `json:"dryRun" yaml:"dryRun"`
+	// ServiceAccountName is the service account of the build pod, e.g. for GKE Workload Identity.
+	// When empty, the default service account of the namespace is used.
+	// Registry.SecretRef is still used for the registry credentials, even when the service account
+	// has image pull secrets.
+	// +optional
+	ServiceAccountName string `json:"serviceAccountName" yaml:"serviceAccountName"`
+	// PriorityClassName is the priority class of the build pod, e.g. for preempting routine builds
+	// with urgent release builds. The existence of the class is not validated.
+	// +optional
+	PriorityClassName string `json:"priorityClassName" yaml:"priorityClassName"`
+	// NodeSelector is merged into the node selector of the build pod.
+	// The keys set by the plugin cannot be overridden.
+	// +optional
+	NodeSelector map[string]string `json:"nodeSelector" yaml:"nodeSelector"`
+	// Tolerations are appended to the tolerations of the build pod.
+	// +optional
+	Tolerations []corev1.Toleration `json:"tolerations"`
+	// Affinity is combined with the affinity of the build pod, so that both the constraints
+	// of the plugin and Affinity are satisfied.
+	// +optional
+	Affinity *corev1.Affinity `json:"affinity"`
+	// Output exports the image as an archive instead of pushing it to the registry.
+	// Registry.Push needs to be false.
+	// +optional
+	Output Output `json:"output"`
+	// Platforms are the target platforms of the image, e.g. `linux/amd64` and `linux/arm64`.
+	// A single platform requires the "platform.single" plugin label, and multiple platforms
+	// (i.e. a manifest list) require the "platform.multi" plugin label.
+	// When empty, the platform of the builder is used.
+	// +optional
+	Platforms []string `json:"platforms" yaml:"platforms"`
+	// BuildSecrets are mounted on the build container (not on the init containers), e.g. for npm tokens
+	// or Maven settings. Unlike BuildArgsFrom, the values are not passed to the build as build args,
+	// so they do not leak into the image layers.
+	// BuildSecrets require the "build.secrets" plugin label.
+	// +optional
+	BuildSecrets []SecretMount `json:"buildSecrets" yaml:"buildSecrets"`
+	// Rerun is a counter for re-running the BuildJob, e.g. for retrying against a mutable branch.
+	// When Rerun differs from Status.ObservedRerun, the controller deletes the job, clears the status,
+	// and creates a new job.
+	// +optional
+	Rerun int64 `json:"rerun" yaml:"rerun"`
+	// PersistLogs stores the logs of the build container when the build finishes, so that the logs
+	// are preserved after the pod is garbage-collected. The location is recorded as Status.LogsLocation.
+	// Requires the controller to be configured with a logs store (`--logs-rclone-remote`).
+	// +optional
+	PersistLogs bool `json:"persistLogs" yaml:"persistLogs"`
+	// BuilderImage overrides the image of the build container set by the plugin,
+	// e.g. for pinning a patched builder version without waiting for a new plugin release.
+	// The image bypasses the image tested with the plugin, and is used at the user's risk.
+	// +optional
+	BuilderImage string `json:"builderImage" yaml:"builderImage"`
+	// Rootless requires the build to run without privileged containers, e.g. for clusters that
+	// forbid privileged pods. Requires the "build.rootless" plugin label.
+	// +optional
+	Rootless bool `json:"rootless" yaml:"rootless"`
+	// ExtraArgs are the raw flags appended to the builder invocation by the plugin,
+	// in the `--name` or `--name=value` form, e.g. `--network=host`.
+	// ExtraArgs are plugin-specific, and are rejected unless the controller allows them.
+	// Requires the "build.extra-args" plugin label.
+	// +optional
+	ExtraArgs []string `json:"extraArgs" yaml:"extraArgs"`
+	// NetrcSecretRef contains ".netrc", which is mounted on $HOME/.netrc of the build container
+	// (mode 0400), e.g. for fetching the dependencies from multiple authenticated HTTP hosts.
+	// Requires the "build.netrc" plugin label.
+	// +optional
+	NetrcSecretRef corev1.LocalObjectReference `json:"netrcSecretRef" yaml:"netrcSecretRef"`
+}
+
+// SecretMount mounts a secret on the build container.
+type SecretMount struct {
+	// SecretRef is the secret.
+	SecretRef corev1.LocalObjectReference `json:"secretRef" yaml:"secretRef"`
+	// MountPath is the absolute path of the directory in the build container.
+	MountPath string `json:"mountPath" yaml:"mountPath"`
+	// Items selects the keys of the secret. When empty, all the keys are mounted.
+	// +optional
+	Items []corev1.KeyToPath `json:"items"`
+	// DefaultMode is the mode of the files, e.g. 0400. Nil means 0644.
+	// +optional
+	DefaultMode *int32 `json:"defaultMode" yaml:"defaultMode"`
+	// Optional allows the secret or the keys in Items not to exist.
+	// +optional
+	Optional bool `json:"optional"`
 }
 
 // Registry specifies the registry.
@@ -67,19 +176,63 @@ type Registry struct {
 	// Most plugin implementations would require non-empty Target string,
 	// even when Push is set to false.
 	//
-	// Cloudbuild requires this filed not to be set.
+	// Cloudbuild requires this field not to be set (see BuildJobSpec.Validate).
+	//
+	// For Git context, Target may be a Go template with TargetVariables,
+	// e.g. `example.com/foo/bar:git-{{.ShortSHA}}`. The expanded target is recorded as
+	// Status.ExpandedTarget.
 	// +optional
-	// e.g. `example.com:foo/bar:latest`
+	// e.g. `example.com/foo/bar:latest`
 	Target string `json:"target"`
 	// Push pushes the image.
 	// Can be set to false, especially for testing purposes.
 	// +optional
 	Push bool `json:"push"`
+	// AdditionalTargets are tagged and pushed in addition to Target.
+	// SecretRef is used for all the targets, so the secret needs to contain the credentials
+	// for all the registries.
+	// +optional
+	AdditionalTargets []string `json:"additionalTargets" yaml:"additionalTargets"`
 	// SecretRef used for pushing and pulling.
 	// +optional
 	SecretRef corev1.LocalObjectReference `json:"secretRef" yaml:"secretRef"`
+	// PullSecretRef is a .dockerconfigjson secret for pulling the base images, e.g. `FROM` images.
+	// When both SecretRef and PullSecretRef are used, the credentials are merged, and SecretRef takes
+	// precedence for the same registry.
+	// PullSecretRef is also added to the imagePullSecrets of the build pod.
+	// +optional
+	PullSecretRef corev1.LocalObjectReference `json:"pullSecretRef" yaml:"pullSecretRef"`
+	// Insecure allows plain HTTP and skips verifying the certificate of the registry.
+	// Insecure is vulnerable to man-in-the-middle attacks; consider CASecretRef instead.
+	// Not supported by all plugins.
+	// +optional
+	Insecure bool `json:"insecure"`
+	// CASecretRef contains the CA certificate of the registry as "ca.crt".
+	// Not supported by all plugins.
+	// +optional
+	CASecretRef corev1.LocalObjectReference `json:"caSecretRef" yaml:"caSecretRef"`
+	// CacheRef is the image reference for importing and exporting the build cache,
+	// e.g. `example.com/foo/bar:buildcache`.
+	// The cache is exported even when Push is false, using SecretRef.
+	// Not supported by all plugins.
+	// +optional
+	CacheRef string `json:"cacheRef" yaml:"cacheRef"`
+	// CredentialHelper is the docker credential helper for the registries of the targets and CacheRef,
+	// for registries with dynamic tokens, e.g. `ecr-login` for `docker-credential-ecr-login`.
+	// The credential helper takes precedence over SecretRef for the same registry.
+	// Requires the "registry.credential-helper.<name>" plugin label.
+	// +optional
+	CredentialHelper string `json:"credentialHelper" yaml:"credentialHelper"`
+	// PushRetries is the number of retries of a failed push, with exponential backoff.
+	// Pushes are content-addressed, so a retry skips the blobs uploaded by the failed attempt.
+	// Requires the "registry.push-retry" plugin label when non-zero.
+	// +optional
+	PushRetries int32 `json:"pushRetries" yaml:"pushRetries"`
 }
 
+// MaxPushRetries is the maximum value of Registry.PushRetries.
+const MaxPushRetries = 10
+
 type LanguageKind string
 
 // Language specifies the language.
@@ -88,6 +241,8 @@ type Language struct {
 	Dockerfile Dockerfile   `json:"dockerfile"`
 	S2I        S2I          `json:"s2i"`
 	Cloudbuild Cloudbuild   `json:"cloudbuild"`
+	Bazel      Bazel        `json:"bazel"`
+	Buildpacks Buildpacks   `json:"buildpacks"`
 }
 
 const (
@@ -99,20 +254,84 @@ const (
 	LanguageKindS2I LanguageKind = "S2I"
 	// LanguageKindCloudbuild stands for Google cloudbuild.yaml
 	LanguageKindCloudbuild LanguageKind = "Cloudbuild"
+	// LanguageKindBazel stands for Bazel targets that produce images,
+	// e.g. container_image of rules_docker.
+	LanguageKindBazel LanguageKind = "Bazel"
+	// LanguageKindBuildpacks stands for Cloud Native Buildpacks, which detect
+	// the runtime from the source without a Dockerfile.
+	LanguageKindBuildpacks LanguageKind = "Buildpacks"
 )
 
 // Dockerfile-specific fields
 type Dockerfile struct {
+	// Path of the Dockerfile, relative to the context.
+	// Path MUST NOT point outside of the context.
+	// Defaults to "Dockerfile".
+	// +optional
+	Path string `json:"path"`
+	// Target stage of a multi-stage Dockerfile.
+	// +optional
+	Target string `json:"target"`
+	// BuildArgs are passed to the build as `--build-arg KEY=VALUE`.
+	// +optional
+	BuildArgs map[string]string `json:"buildArgs" yaml:"buildArgs"`
+	// BuildArgsFrom are build args sourced from secrets or configmaps.
+	// The values are not inlined in the pod spec.
+	// +optional
+	BuildArgsFrom []BuildArgSource `json:"buildArgsFrom" yaml:"buildArgsFrom"`
+	// Squash squashes the layers of the image into a single layer.
+	// Requires the "build.squash" plugin label.
+	// +optional
+	Squash bool `json:"squash"`
+}
+
+// BuildArgSource is a build arg sourced from a secret or a configmap.
+type BuildArgSource struct {
+	// Name of the build arg.
+	Name string `json:"name"`
+	// ValueFrom is the source of the value.
+	ValueFrom corev1.EnvVarSource `json:"valueFrom" yaml:"valueFrom"`
 }
 
 // S2I-specific fields
 type S2I struct {
 	// S2I-specific base image. e,g, centos/ruby-22-centos7
 	BaseImage string `json:"baseImage" yaml:"baseImage"`
+	// Env is passed to the builder as `-e NAME=VALUE`.
+	// Values sourced via ValueFrom are not inlined in the pod spec.
+	// +optional
+	Env []corev1.EnvVar `json:"env"`
 }
 
 // Cloudbuild-specific fields
 type Cloudbuild struct {
+	// Substitutions for cloudbuild.yaml.
+	// Keys MUST be prefixed with an underscore, e.g. "_FOO".
+	// +optional
+	Substitutions map[string]string `json:"substitutions"`
+}
+
+// Bazel-specific fields
+type Bazel struct {
+	// Target is the Bazel target that produces the image. e.g. //app:image
+	Target string `json:"target"`
+	// Args are additional arguments for `bazel run`. e.g. --config=release
+	// +optional
+	Args []string `json:"args"`
+}
+
+// DefaultBuildpacksBuilder is the builder used when Buildpacks.Builder is empty.
+const DefaultBuildpacksBuilder = "heroku/buildpacks:18"
+
+// Buildpacks-specific fields
+type Buildpacks struct {
+	// Builder is the builder image that provides the buildpacks.
+	// Defaults to DefaultBuildpacksBuilder.
+	// +optional
+	Builder string `json:"builder"`
+	// Buildpacks are the buildpacks to use instead of the auto-detected ones. e.g. heroku/nodejs
+	// +optional
+	Buildpacks []string `json:"buildpacks"`
 }
 
 type ContextKind string
@@ -124,6 +343,57 @@ type Context struct {
 	ConfigMapRef corev1.LocalObjectReference `json:"configMapRef" yaml:"configMapRef"`
 	HTTP         HTTP                        `json:"http"`
 	Rclone       Rclone                      `json:"rclone"`
+	Local        Local                       `json:"local"`
+	S3           S3                          `json:"s3"`
+	GCS          GCS                         `json:"gcs"`
+	AzureBlob    AzureBlob                   `json:"azureBlob" yaml:"azureBlob"`
+	PVC          PVC                         `json:"pvc"`
+	OCI          OCI                         `json:"oci"`
+	// ConfigMapItems projects the keys of the ConfigMap to the paths within the context.
+	// When empty, all the keys are projected to the top-level directory.
+	// +optional
+	ConfigMapItems []corev1.KeyToPath `json:"configMapItems" yaml:"configMapItems"`
+	// ConfigMapSubPath within the ConfigMap context.
+	// +optional
+	ConfigMapSubPath string `json:"configMapSubPath" yaml:"configMapSubPath"`
+	// ConfigMapDefaultMode is the mode of the files in the ConfigMap context, e.g. 0755 for executable scripts.
+	// The mode of each file can be also specified as ConfigMapItems[].Mode.
+	// The modes are preserved when the files are copied into the context.
+	// Defaults to 0644.
+	// +optional
+	ConfigMapDefaultMode *int32 `json:"configMapDefaultMode" yaml:"configMapDefaultMode"`
+	// ConfigMapArchiveKey is the key of the ConfigMap entry (typically in binaryData)
+	// that contains the context as a tar archive, optionally compressed.
+	// When set, the entry is extracted, and the other entries are ignored.
+	// +optional
+	ConfigMapArchiveKey string `json:"configMapArchiveKey" yaml:"configMapArchiveKey"`
+	// ContextCacheClaimRef is the PersistentVolumeClaim for sharing the ConfigMap context across BuildJobs.
+	// The ConfigMap is materialized once per resource version, and reused by the BuildJobs referencing
+	// the same version, instead of being copied for each pod. Only for ConfigMap context.
+	// Not used for the main context when Additional is set, as the main context is modified by merging.
+	// +optional
+	ContextCacheClaimRef corev1.LocalObjectReference `json:"contextCacheClaimRef" yaml:"contextCacheClaimRef"`
+	// ConfigMapResourceVersion is the resource version of ConfigMapRef, set by the controller
+	// when ContextCacheClaimRef is set. Users do not need to set it.
+	// +optional
+	ConfigMapResourceVersion string `json:"configMapResourceVersion" yaml:"configMapResourceVersion"`
+	// Additional contexts are merged into the context in order.
+	// Files in the later contexts overwrite the files in the earlier ones.
+	// Additional contexts cannot have Additional contexts.
+	// +optional
+	Additional []Context `json:"additional"`
+	// Variables are expanded in Git.URL and Git.Revision by the controller, e.g. `$(REVISION)`.
+	// `$$(VAR)` is expanded to the literal `$(VAR)`.
+	// Referencing an undefined variable is an error.
+	// Additional contexts have their own Variables.
+	// +optional
+	Variables map[string]string `json:"variables"`
+	// DestPath is the absolute path where the context is placed in the build container,
+	// e.g. `/go/src/github.com/foo/bar` for builders that expect the source at a specific path.
+	// When empty, the path is chosen by the injector, e.g. `/cbi-gitcontext/context`.
+	// Not supported for additional contexts, as they are merged into the main context.
+	// +optional
+	DestPath string `json:"destPath" yaml:"destPath"`
 }
 
 const (
@@ -146,6 +416,38 @@ const (
 	// When BuildJob.Context.Kind is set to ContextKindHTTP, the controller
 	// MUST add "context.rclone" to its default plugin selector logic.
 	ContextKindRclone ContextKind = "Rclone"
+
+	// ContextKindLocal stands for Local context, which is a directory on the node.
+	// Local context is only for local development (e.g. minikube), and needs to be explicitly
+	// enabled on the plugin side, as it uses hostPath volumes.
+	// When BuildJob.Context.Kind is set to ContextKindLocal, the controller
+	// MUST add "context.local" to its default plugin selector logic.
+	ContextKindLocal ContextKind = "Local"
+
+	// ContextKindS3 stands for S3 context.
+	// When BuildJob.Context.Kind is set to ContextKindS3, the controller
+	// MUST add "context.s3" to its default plugin selector logic.
+	ContextKindS3 ContextKind = "S3"
+
+	// ContextKindGCS stands for Google Cloud Storage context.
+	// When BuildJob.Context.Kind is set to ContextKindGCS, the controller
+	// MUST add "context.gcs" to its default plugin selector logic.
+	ContextKindGCS ContextKind = "GCS"
+
+	// ContextKindAzureBlob stands for Azure Blob Storage context.
+	// When BuildJob.Context.Kind is set to ContextKindAzureBlob, the controller
+	// MUST add "context.azureblob" to its default plugin selector logic.
+	ContextKindAzureBlob ContextKind = "AzureBlob"
+
+	// ContextKindPVC stands for PersistentVolumeClaim context, e.g. for the artifacts staged by CI systems.
+	// When BuildJob.Context.Kind is set to ContextKindPVC, the controller
+	// MUST add "context.pvc" to its default plugin selector logic.
+	ContextKindPVC ContextKind = "PVC"
+
+	// ContextKindOCI stands for OCI image layout context, e.g. for rebasing or patching an existing image.
+	// When BuildJob.Context.Kind is set to ContextKindOCI, the controller
+	// fetches the image into an OCI image layout directory, which is used as the context.
+	ContextKindOCI ContextKind = "OCI"
 )
 
 // Git
@@ -159,45 +461,400 @@ type Git struct {
 	// although not useful for CBI.
 	URL string `json:"url"`
 	// Revision such as commit, branch, or tag.
+	// Empty means the HEAD of the default branch of the remote.
 	// +optional
 	Revision string `json:"revision"`
+	// RevisionType specifies whether Revision is a branch, a tag, or a commit.
+	// Defaults to GitRevisionTypeAuto.
+	// +optional
+	RevisionType GitRevisionType `json:"revisionType" yaml:"revisionType"`
+	// FetchRefspec is fetched verbatim, and FETCH_HEAD is checked out,
+	// e.g. `refs/pull/42/head` or `refs/merge-requests/42/head` for the pull requests.
+	// FetchRefspec takes precedence over Revision and RevisionType, which are ignored.
+	// CacheVolumeClaimRef is not used with FetchRefspec.
+	// +optional
+	FetchRefspec string `json:"fetchRefspec" yaml:"fetchRefspec"`
 	// SubPath within the repo.
 	// +optinal
 	SubPath string `json:"subPath" yaml:"subPath"`
-	// SSHSecretRef contains the contents of ~/.ssh.
+	// Depth creates a shallow clone with the history truncated to the specified number of commits.
+	// Zero means a full clone.
+	// When Revision is a full commit SHA, the commit is fetched directly,
+	// which requires the server to allow fetching unadvertised objects.
+	// +optional
+	Depth int `json:"depth"`
+	// SingleCommit fetches only the commit of Revision, without the history.
+	// When Revision is a full commit SHA, the commit is fetched directly if the server allows
+	// (uploadpack.allowReachableSHA1InWant), otherwise a full clone is used as a fallback.
+	// May not be set together with Depth.
+	// +optional
+	SingleCommit bool `json:"singleCommit" yaml:"singleCommit"`
+	// SingleBranch fetches only the refs of the branch or the tag of Revision
+	// (the default branch of the remote if Revision is empty), instead of all the branches.
+	// Depth and SingleCommit imply SingleBranch. Ignored when FetchRefspec is set.
+	// May not be set together with a commit Revision.
+	// +optional
+	SingleBranch bool `json:"singleBranch" yaml:"singleBranch"`
+	// Submodules checks out the submodules recursively.
+	// SSHSecretRef is also used for fetching the submodules.
+	// Submodule URLs are used as-is; HTTPS URLs with embedded credentials are not rewritten.
+	// +optional
+	Submodules bool `json:"submodules"`
+	// LFS fetches the Git LFS objects after checkout.
+	// The helper image needs to contain git-lfs.
+	// +optional
+	LFS bool `json:"lfs"`
+	// SparsePaths are the directories to be checked out with `git sparse-checkout` (cone mode).
+	// Unlike SubPath, SparsePaths reduce the files materialized in the context.
+	// When empty, all the files are checked out.
+	// +optional
+	SparsePaths []string `json:"sparsePaths" yaml:"sparsePaths"`
+	// Retries is the number of times to retry fetching the repo on failures,
+	// with exponential backoff. Zero means no retry.
+	// +optional
+	Retries int `json:"retries"`
+	// SSHSecretRef contains the contents of ~/.ssh, e.g. "id_rsa", "config", and "known_hosts".
+	// When "known_hosts" is present, strict host key checking is enabled.
 	// +optional
 	SSHSecretRef corev1.LocalObjectReference `json:"sshSecretRef" yaml:"sshSecretRef"`
+	// StrictHostKeyChecking requires SSHSecretRef to contain "known_hosts".
+	// +optional
+	StrictHostKeyChecking bool `json:"strictHostKeyChecking" yaml:"strictHostKeyChecking"`
+	// HTTPSAuthSecretRef contains the credentials for https:// URLs: "username" and "password",
+	// or "token" with optional "username" (defaults to "x-access-token", for GitHub-style tokens).
+	// The credentials are also used for the submodules and the LFS objects on the same server.
+	// +optional
+	HTTPSAuthSecretRef corev1.LocalObjectReference `json:"httpsAuthSecretRef" yaml:"httpsAuthSecretRef"`
+	// GitHubAppSecretRef contains the GitHub App credentials for https:// URLs: "appID", "installationID",
+	// and "privateKey" (PEM). An installation token is minted before cloning, and used only for the clone.
+	// May not be set together with HTTPSAuthSecretRef.
+	// +optional
+	GitHubAppSecretRef corev1.LocalObjectReference `json:"githubAppSecretRef" yaml:"githubAppSecretRef"`
+	// CacheVolumeClaimRef is the PersistentVolumeClaim for caching the mirrors of the repos across BuildJobs.
+	// The cache is not used for shallow clones (Depth > 0).
+	// +optional
+	CacheVolumeClaimRef corev1.LocalObjectReference `json:"cacheVolumeClaimRef" yaml:"cacheVolumeClaimRef"`
 }
 
+// GitRevisionType is the type of Git.Revision.
+type GitRevisionType string
+
+const (
+	// GitRevisionTypeAuto lets git guess the type of the revision.
+	// When a branch and a tag have the same name, the result depends on how the repo is cloned.
+	GitRevisionTypeAuto GitRevisionType = "Auto"
+	// GitRevisionTypeBranch means Revision is a branch (refs/heads/...).
+	GitRevisionTypeBranch GitRevisionType = "Branch"
+	// GitRevisionTypeTag means Revision is a tag (refs/tags/...).
+	GitRevisionTypeTag GitRevisionType = "Tag"
+	// GitRevisionTypeCommit means Revision is a commit SHA.
+	// Shallow clones require the full SHA.
+	GitRevisionTypeCommit GitRevisionType = "Commit"
+)
+
 // HTTP
 type HTTP struct {
-	// URL for a tar archive.
+	// URL for an archive.
 	// URL MUST be http:// or https:// .
 	// Implementations SHOULD accept tar+gz.
 	URL string `json:"url"`
-	// TODO: add mediatype
-	// TODO: add TLS stuff
-	//
+	// MediaType of the archive, e.g. HTTPMediaTypeZip.
+	// When empty, the format is auto-detected.
+	// +optional
+	MediaType string `json:"mediaType" yaml:"mediaType"`
+	// CASecretRef contains the CA bundle as "ca.crt", for verifying the server certificate.
+	// +optional
+	CASecretRef corev1.LocalObjectReference `json:"caSecretRef" yaml:"caSecretRef"`
+	// Insecure skips verifying the server certificate.
+	// Insecure is only for testing.
+	// +optional
+	Insecure bool `json:"insecure"`
+	// BasicAuthSecretRef contains "username" and "password" for HTTP Basic authentication,
+	// e.g. a secret of type kubernetes.io/basic-auth.
+	// BasicAuthSecretRef requires https:// URL unless Insecure is set.
+	// +optional
+	BasicAuthSecretRef corev1.LocalObjectReference `json:"basicAuthSecretRef" yaml:"basicAuthSecretRef"`
 	// SubPath within the archive.
 	// +optinal
 	SubPath string `json:"subPath" yaml:"subPath"`
+	// SHA256 is the hex-encoded SHA-256 digest of the archive.
+	// When set, the archive is verified before being extracted.
+	// +optional
+	SHA256 string `json:"sha256"`
 }
 
+const (
+	// HTTPMediaTypeTar stands for tar archives.
+	HTTPMediaTypeTar = "application/x-tar"
+	// HTTPMediaTypeGzip stands for gzip-compressed tar archives.
+	HTTPMediaTypeGzip = "application/gzip"
+	// HTTPMediaTypeZstd stands for zstd-compressed tar archives.
+	HTTPMediaTypeZstd = "application/zstd"
+	// HTTPMediaTypeZip stands for zip archives.
+	HTTPMediaTypeZip = "application/zip"
+)
+
 // Rclone
 type Rclone struct {
 	Remote string
 	Path   string
 	// SecretRef contains the contents of ~/.config/rclone.
 	SecretRef corev1.LocalObjectReference `json:"secretRef" yaml:"secretRef"`
-	// SSHSecretRef contains the contents of ~/.ssh.OLD.
-	// Only required for SFTP remote.
+	// RemoteType is the type of Remote in the rclone config, e.g. "sftp" or "s3".
+	// The type of on-the-fly remotes (e.g. ":sftp,host=example.com") is detected from Remote.
+	// +optional
+	RemoteType string `json:"remoteType" yaml:"remoteType"`
+	// SSHSecretRef contains the contents of ~/.ssh.
+	// Required for SFTP remote, and not mounted for other types of remotes.
+	// When the type is unknown, SSHSecretRef is mounted if specified.
 	// +optional
 	SSHSecretRef corev1.LocalObjectReference `json:"sshSecretRef" yaml:"sshSecretRef"`
+	// Flags are appended to `rclone copy`, e.g. `--bwlimit=10M` for throttling the transfer.
+	// Only the flags in RcloneAllowedFlags are accepted, in the `--name=value` form.
+	// +optional
+	Flags []string `json:"flags"`
+}
+
+// RcloneRemoteTypeSFTP is the rclone remote type for SFTP.
+const RcloneRemoteTypeSFTP = "sftp"
+
+// RcloneAllowedFlags is the allowlist of Rclone.Flags.
+// Flags that can read or write arbitrary files (e.g. `--config`, `--log-file`) are not allowed.
+var RcloneAllowedFlags = []string{
+	"--bwlimit",
+	"--buffer-size",
+	"--checkers",
+	"--contimeout",
+	"--exclude",
+	"--include",
+	"--low-level-retries",
+	"--max-age",
+	"--max-depth",
+	"--max-size",
+	"--min-age",
+	"--min-size",
+	"--retries",
+	"--timeout",
+	"--tpslimit",
+	"--tpslimit-burst",
+	"--transfers",
+}
+
+// Local
+type Local struct {
+	// Path is the absolute path of the directory on the node.
+	Path string `json:"path"`
+}
+
+// OCI
+type OCI struct {
+	// Image is the reference of the image to fetch, e.g. `example.com/foo/bar:latest`.
+	Image string `json:"image"`
+	// Platform selects the image from the manifest list, in the form of `os/arch[/variant]`.
+	// When empty, all the images in the manifest list are fetched.
+	// +optional
+	Platform string `json:"platform"`
+	// SecretRef is a .dockerconfigjson secret for pulling the image.
+	// Defaults to Registry.SecretRef.
+	// +optional
+	SecretRef corev1.LocalObjectReference `json:"secretRef" yaml:"secretRef"`
+}
+
+// PVC
+type PVC struct {
+	// ClaimName is the name of the PersistentVolumeClaim in the namespace of the BuildJob.
+	ClaimName string `json:"claimName" yaml:"claimName"`
+	// SubPath is the context directory within the volume.
+	// +optional
+	SubPath string `json:"subPath" yaml:"subPath"`
+	// ReadOnly mounts the volume read-only.
+	// +optional
+	ReadOnly bool `json:"readOnly" yaml:"readOnly"`
+}
+
+// S3
+type S3 struct {
+	// Endpoint for S3-compatible object stores, e.g. https://minio.example.com .
+	// Empty for AWS.
+	// +optional
+	Endpoint string `json:"endpoint"`
+	Bucket   string `json:"bucket"`
+	// Key of the archive object.
+	// The archive format is auto-detected.
+	Key string `json:"key"`
+	// +optional
+	Region string `json:"region"`
+	// SecretRef contains "AWS_ACCESS_KEY_ID" and "AWS_SECRET_ACCESS_KEY".
+	// When empty, the credentials are obtained from the environment, e.g. IAM roles.
+	// +optional
+	SecretRef corev1.LocalObjectReference `json:"secretRef" yaml:"secretRef"`
+	// SubPath within the archive.
+	// +optional
+	SubPath string `json:"subPath" yaml:"subPath"`
+}
+
+// GCS
+type GCS struct {
+	Bucket string `json:"bucket"`
+	// Object is the name of the archive object.
+	// The archive format is auto-detected.
+	Object string `json:"object"`
+	// SecretRef contains "service-account.json", the JSON key of the service account.
+	// When empty, the credentials are obtained from the environment, e.g. Workload Identity.
+	// +optional
+	SecretRef corev1.LocalObjectReference `json:"secretRef" yaml:"secretRef"`
+	// SubPath within the archive.
+	// +optional
+	SubPath string `json:"subPath" yaml:"subPath"`
+}
+
+// AzureBlob
+type AzureBlob struct {
+	// Account is the name of the storage account.
+	Account string `json:"account"`
+	// Endpoint overrides the blob service endpoint, e.g. for sovereign clouds or Azurite.
+	// Empty for https://ACCOUNT.blob.core.windows.net .
+	// +optional
+	Endpoint  string `json:"endpoint"`
+	Container string `json:"container"`
+	// Blob is the name of the archive blob.
+	// The archive format is auto-detected.
+	Blob string `json:"blob"`
+	// SecretRef contains either "AZURE_STORAGE_KEY" or "AZURE_STORAGE_SAS_URL".
+	// When empty, the credentials are obtained from the environment, e.g. managed identities.
+	// +optional
+	SecretRef corev1.LocalObjectReference `json:"secretRef" yaml:"secretRef"`
+	// SubPath within the archive.
+	// +optional
+	SubPath string `json:"subPath" yaml:"subPath"`
+}
+
+type OutputKind string
+
+const (
+	// OutputKindNone is the default: the image is not exported.
+	OutputKindNone   OutputKind = ""
+	OutputKindS3     OutputKind = "S3"
+	OutputKindRclone OutputKind = "Rclone"
+)
+
+type OutputFormat string
+
+const (
+	// OutputFormatDefault is the default format of the plugin.
+	// e.g. OCI for BuildKit, docker-archive for kaniko.
+	OutputFormatDefault OutputFormat = ""
+	// OutputFormatOCI is the OCI image layout tar.
+	OutputFormatOCI OutputFormat = "oci"
+	// OutputFormatDocker is the tar for `docker load`.
+	OutputFormatDocker OutputFormat = "docker"
+)
+
+// Output specifies the destination of the exported image archive.
+// The destinations share the types with the contexts, but SubPath and SSHSecretRef are not supported.
+// HTTP is not supported as a destination; use an rclone remote (e.g. WebDAV) instead.
+type Output struct {
+	Kind OutputKind `json:"kind"`
+	// +optional
+	Format OutputFormat `json:"format"`
+	// S3 is the object for storing the archive.
+	// +optional
+	S3 S3 `json:"s3"`
+	// Rclone is the file for storing the archive, i.e. Remote:Path.
+	// +optional
+	Rclone Rclone `json:"rclone"`
 }
 
 // BuildJobStatus is the status for a BuildJob resource
 type BuildJobStatus struct {
 	Job string `json:"job"`
+	// ObservedRerun is the Spec.Rerun value of the current job.
+	// +optional
+	ObservedRerun int64 `json:"observedRerun" yaml:"observedRerun"`
+	// SelectedPlugin is the name of the plugin selected for the BuildJob,
+	// i.e. the "plugin.name" label.
+	// +optional
+	SelectedPlugin string `json:"selectedPlugin" yaml:"selectedPlugin"`
+	// SelectedPluginLabels are the labels of the selected plugin.
+	// +optional
+	SelectedPluginLabels map[string]string `json:"selectedPluginLabels" yaml:"selectedPluginLabels"`
+	// ResolvedRevision is the revision of the context that was actually built.
+	// e.g. the full commit SHA for Git context.
+	// +optional
+	ResolvedRevision string `json:"resolvedRevision" yaml:"resolvedRevision"`
+	// ImageDigest is the digest of the pushed image. e.g. `sha256:...`
+	// Empty when Spec.Registry.Push is false, or when ManifestListDigest is set.
+	// +optional
+	ImageDigest string `json:"imageDigest" yaml:"imageDigest"`
+	// ExpandedTarget is Spec.Registry.Target with the template expanded, e.g. `example.com/foo:git-0123456`.
+	// Empty until the commit SHA is resolved, when the template refers to it.
+	// +optional
+	ExpandedTarget string `json:"expandedTarget" yaml:"expandedTarget"`
+	// PushedTargets are the references pushed successfully, i.e. Spec.Registry.Target and
+	// Spec.Registry.AdditionalTargets.
+	// +optional
+	PushedTargets []string `json:"pushedTargets" yaml:"pushedTargets"`
+	// ManifestListDigest is the digest of the pushed manifest list, when Spec.Platforms has
+	// multiple platforms. e.g. `sha256:...`
+	// +optional
+	ManifestListDigest string `json:"manifestListDigest" yaml:"manifestListDigest"`
+	// ExportedArchive is the location of the archive exported for Spec.Output,
+	// e.g. `s3://bucket/key` or `remote:path`.
+	// +optional
+	ExportedArchive string `json:"exportedArchive" yaml:"exportedArchive"`
+	// LogsLocation is the location of the logs of the build container stored for Spec.PersistLogs,
+	// e.g. `remote:path/namespace/name-job.log`.
+	// +optional
+	LogsLocation string `json:"logsLocation" yaml:"logsLocation"`
+	// PushRetries is the number of push retries of the build container for Spec.Registry.PushRetries.
+	// +optional
+	PushRetries int32 `json:"pushRetries" yaml:"pushRetries"`
+	// StartTime is the time when the underlying job started.
+	// +optional
+	StartTime *metav1.Time `json:"startTime" yaml:"startTime"`
+	// CompletionTime is the time when the underlying job completed or failed.
+	// +optional
+	CompletionTime *metav1.Time `json:"completionTime" yaml:"completionTime"`
+	// Conditions is the latest available observations of the BuildJob.
+	// +optional
+	Conditions []BuildJobCondition `json:"conditions"`
+}
+
+type BuildJobConditionType string
+
+const (
+	// BuildJobContextFetched means the init containers for fetching the context have completed.
+	// Status is False when an init container has failed.
+	BuildJobContextFetched BuildJobConditionType = "ContextFetched"
+	// BuildJobBuilding means the build container is running.
+	// Status turns into False when the build container has terminated.
+	BuildJobBuilding BuildJobConditionType = "Building"
+	// BuildJobPushed means the image has been pushed to Spec.Registry.
+	// Only set when Spec.Registry.Push is true.
+	BuildJobPushed BuildJobConditionType = "Pushed"
+	// BuildJobComplete means the build has completed successfully.
+	BuildJobComplete BuildJobConditionType = "Complete"
+	// BuildJobFailed means the build has failed, e.g. timed out.
+	BuildJobFailed BuildJobConditionType = "Failed"
+	// BuildJobValidated is set for DryRun BuildJobs, and for BuildJobs rejected before creating the job.
+	// Status is False when the spec is invalid, no plugin supports the spec, or the plugin rejected the spec.
+	// Status is Unknown while waiting for a plugin that supports the spec.
+	BuildJobValidated BuildJobConditionType = "Validated"
+)
+
+// BuildJobCondition describes the state of the BuildJob at a certain point.
+type BuildJobCondition struct {
+	Type   BuildJobConditionType  `json:"type"`
+	Status corev1.ConditionStatus `json:"status"`
+	// +optional
+	LastTransitionTime metav1.Time `json:"lastTransitionTime" yaml:"lastTransitionTime"`
+	// Reason is a brief CamelCase string for the condition's last transition.
+	// e.g. DeadlineExceeded
+	// +optional
+	Reason string `json:"reason"`
+	// Message is a human readable message for the condition's last transition.
+	// +optional
+	Message string `json:"message"`
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -0,0 +1,520 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// The grammar of the image references, derived from github.com/docker/distribution/reference.
+var (
+	alphaNumeric    = `[a-z0-9]+`
+	separator       = `(?:[._]|__|[-]*)`
+	nameComponent   = alphaNumeric + `(?:` + separator + alphaNumeric + `)*`
+	domainComponent = `(?:[a-zA-Z0-9]|[a-zA-Z0-9][a-zA-Z0-9-]*[a-zA-Z0-9])`
+	domain          = domainComponent + `(?:\.` + domainComponent + `)*(?::[0-9]+)?`
+	name            = `(?:` + domain + `/)?` + nameComponent + `(?:/` + nameComponent + `)*`
+	tag             = `[\w][\w.-]{0,127}`
+	digest          = `[A-Za-z][A-Za-z0-9]*(?:[-_+.][A-Za-z][A-Za-z0-9]*)*:[0-9a-fA-F]{32,}`
+
+	referenceRegexp = regexp.MustCompile(`^(` + name + `)(?::` + tag + `)?(?:@` + digest + `)?$`)
+)
+
+// platformRegexp matches `os/arch[/variant]`, e.g. "linux/arm/v7".
+var platformRegexp = regexp.MustCompile(`^[a-z0-9_]+/[a-z0-9_]+(?:/[a-z0-9_]+)?$`)
+
+// credentialHelperRegexp matches the suffix of `docker-credential-<name>`, e.g. "ecr-login".
+var credentialHelperRegexp = regexp.MustCompile(`^[a-z0-9](?:[a-z0-9.-]{0,30}[a-z0-9])?$`)
+
+// nameTotalLengthMax is the maximum length of the name part of a reference.
+const nameTotalLengthMax = 255
+
+// ValidateReference returns an error if ref is not a valid image reference,
+// e.g. "example.com/foo/bar:baz".
+func ValidateReference(ref string) error {
+	if ref == "" {
+		return fmt.Errorf("empty image reference")
+	}
+	m := referenceRegexp.FindStringSubmatch(ref)
+	if m == nil {
+		if strings.ToLower(ref) != ref {
+			return fmt.Errorf("invalid image reference %q: repository name must be lowercase", ref)
+		}
+		return fmt.Errorf("invalid image reference %q", ref)
+	}
+	if len(m[1]) > nameTotalLengthMax {
+		return fmt.Errorf("invalid image reference %q: repository name must not be longer than %d characters", ref, nameTotalLengthMax)
+	}
+	return nil
+}
+
+// EffectiveRemoteType returns the lower-cased RemoteType, or the type detected from
+// the on-the-fly Remote. An empty string is returned if the type is unknown.
+func (r Rclone) EffectiveRemoteType() string {
+	if r.RemoteType != "" {
+		return strings.ToLower(r.RemoteType)
+	}
+	if strings.HasPrefix(r.Remote, ":") {
+		return strings.ToLower(strings.SplitN(strings.TrimPrefix(r.Remote, ":"), ",", 2)[0])
+	}
+	return ""
+}
+
+// isRelativeSubPath returns true if p is empty or a relative path that does not escape the parent with `..`.
+func isRelativeSubPath(p string) bool {
+	if p == "" {
+		return true
+	}
+	cleaned := path.Clean(p)
+	return !path.IsAbs(cleaned) && cleaned != ".." && !strings.HasPrefix(cleaned, "../")
+}
+
+// gitFetchRefspecRegexp loosely matches `[+]<src>[:<dst>]` without globs.
+var gitFetchRefspecRegexp = regexp.MustCompile(`^\+?[^-:\s*][^:\s*]*(:[^:\s*]+)?$`)
+
+// ValidateGitFetchRefspec returns an error if refspec is not a single-ref refspec for `git fetch`,
+// e.g. `refs/pull/42/head` or `+refs/pull/42/merge:refs/remotes/origin/pr/42`.
+func ValidateGitFetchRefspec(refspec string) error {
+	if !gitFetchRefspecRegexp.MatchString(refspec) || strings.Contains(refspec, "..") {
+		return fmt.Errorf("invalid fetch refspec %q: must be in the [+]<src>[:<dst>] form without globs, e.g. `refs/pull/42/head`", refspec)
+	}
+	return nil
+}
+
+// ExtraArgName returns the name of the flag arg of BuildJobSpec.ExtraArgs, e.g. `--network` for `--network=host`.
+// An error is returned if arg is not in the `--name` or `--name=value` form.
+func ExtraArgName(arg string) (string, error) {
+	name := strings.SplitN(arg, "=", 2)[0]
+	if !strings.HasPrefix(name, "-") || strings.TrimLeft(name, "-") == "" {
+		return "", fmt.Errorf("invalid extra arg %q: must be in the --name or --name=value form", arg)
+	}
+	return name, nil
+}
+
+// ValidateRcloneFlag returns an error if flag is not in the `--name=value` form
+// or the name is not in RcloneAllowedFlags.
+func ValidateRcloneFlag(flag string) error {
+	kv := strings.SplitN(flag, "=", 2)
+	if len(kv) != 2 || kv[1] == "" {
+		return fmt.Errorf("invalid rclone flag %q: must be in the --name=value form", flag)
+	}
+	for _, f := range RcloneAllowedFlags {
+		if kv[0] == f {
+			return nil
+		}
+	}
+	return fmt.Errorf("rclone flag %q is not allowed (allowed: %v)", kv[0], RcloneAllowedFlags)
+}
+
+// ValidatePluginSelector returns an error if s is not a valid label selector.
+// Both equality-based and set-based requirements are accepted.
+func ValidatePluginSelector(s string) error {
+	if _, err := labels.Parse(s); err != nil {
+		return fmt.Errorf("invalid plugin selector %q: %v", s, err)
+	}
+	return nil
+}
+
+// Validate validates Target and AdditionalTargets.
+// Empty Target is valid, as Target is not used for some languages (e.g. Cloudbuild).
+func (r Registry) Validate() error {
+	return validateRegistry(r, field.NewPath("spec", "registry")).ToAggregate()
+}
+
+func validateRegistry(r Registry, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	if r.Target != "" {
+		if err := validateTarget(r.Target); err != nil {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("target"), r.Target, err.Error()))
+		}
+	}
+	for i, t := range r.AdditionalTargets {
+		if err := ValidateReference(t); err != nil {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("additionalTargets").Index(i), t, err.Error()))
+		}
+	}
+	if r.CacheRef != "" {
+		if err := ValidateReference(r.CacheRef); err != nil {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("cacheRef"), r.CacheRef, err.Error()))
+		}
+	}
+	if r.Insecure && r.CASecretRef.Name != "" {
+		allErrs = append(allErrs, field.Forbidden(fldPath.Child("caSecretRef"), "may not be set together with insecure"))
+	}
+	if r.CredentialHelper != "" && !credentialHelperRegexp.MatchString(r.CredentialHelper) {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("credentialHelper"), r.CredentialHelper,
+			"must be the name of docker-credential-<name> in lower case, e.g. `ecr-login`"))
+	}
+	if r.PushRetries < 0 || r.PushRetries > MaxPushRetries {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("pushRetries"), r.PushRetries, fmt.Sprintf("must be between 0 and %d", MaxPushRetries)))
+	}
+	return allErrs
+}
+
+// sampleTargetVariables are used for validating the template in Registry.Target.
+var sampleTargetVariables = TargetVariables{
+	SHA:      "0123456789abcdef0123456789abcdef01234567",
+	ShortSHA: "0123456",
+	Branch:   "master",
+	Tag:      "v1.0.0",
+}
+
+// validateTarget validates target, with the template expanded with sampleTargetVariables.
+func validateTarget(target string) error {
+	if !IsTargetTemplate(target) {
+		return ValidateReference(target)
+	}
+	expanded, err := ExpandTarget(target, sampleTargetVariables)
+	if err != nil {
+		return err
+	}
+	return ValidateReference(expanded)
+}
+
+// Validate validates the spec independently of the plugins.
+func (s BuildJobSpec) Validate() error {
+	return ValidateBuildJobSpec(s, field.NewPath("spec")).ToAggregate()
+}
+
+// ValidateBuildJobSpec validates the spec independently of the plugins,
+// and returns the errors with the paths of the invalid fields.
+func ValidateBuildJobSpec(s BuildJobSpec, fldPath *field.Path) field.ErrorList {
+	allErrs := validateRegistry(s.Registry, fldPath.Child("registry"))
+	targetPath := fldPath.Child("registry", "target")
+	switch k := s.Language.Kind; {
+	case strings.EqualFold(string(k), string(LanguageKindCloudbuild)):
+		// the targets are specified in cloudbuild.yaml
+		if s.Registry.Target != "" {
+			allErrs = append(allErrs, field.Forbidden(targetPath, fmt.Sprintf("must be empty for language %q, as the images are specified in cloudbuild.yaml", LanguageKindCloudbuild)))
+		}
+	case strings.EqualFold(string(k), string(LanguageKindDockerfile)), strings.EqualFold(string(k), string(LanguageKindS2I)):
+		if s.Registry.Push && s.Registry.Target == "" {
+			allErrs = append(allErrs, field.Required(targetPath, "required for pushing the image"))
+		}
+	}
+	if IsTargetTemplate(s.Registry.Target) && s.Context.Kind != ContextKindGit {
+		allErrs = append(allErrs, field.Forbidden(targetPath, fmt.Sprintf("may contain a template only for context kind %q", ContextKindGit)))
+	}
+	if s.PluginSelector != "" {
+		if err := ValidatePluginSelector(s.PluginSelector); err != nil {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("pluginSelector"), s.PluginSelector, err.Error()))
+		}
+	}
+	if d := s.ContextFetchStallThreshold; d != nil && d.Duration <= 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("contextFetchStallThreshold"), d.Duration.String(), "must be positive"))
+	}
+	if s.BackoffLimit != nil && *s.BackoffLimit < 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("backoffLimit"), *s.BackoffLimit, "must be non-negative"))
+	}
+	if s.Rerun < 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("rerun"), s.Rerun, "must be non-negative"))
+	}
+	if s.ServiceAccountName != "" {
+		for _, msg := range validation.IsDNS1123Subdomain(s.ServiceAccountName) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("serviceAccountName"), s.ServiceAccountName, msg))
+		}
+	}
+	if s.PriorityClassName != "" {
+		for _, msg := range validation.IsDNS1123Subdomain(s.PriorityClassName) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("priorityClassName"), s.PriorityClassName, msg))
+		}
+	}
+	allErrs = append(allErrs, validateContext(s.Context, fldPath.Child("context"))...)
+	if s.BuilderImage != "" {
+		if err := ValidateReference(s.BuilderImage); err != nil {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("builderImage"), s.BuilderImage, err.Error()))
+		}
+	}
+	for i, arg := range s.ExtraArgs {
+		if _, err := ExtraArgName(arg); err != nil {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("extraArgs").Index(i), arg, err.Error()))
+		}
+	}
+	if s.Output.Kind != OutputKindNone && s.Registry.Push {
+		allErrs = append(allErrs, field.Forbidden(fldPath.Child("output"), "may not be set together with registry.push"))
+	}
+	allErrs = append(allErrs, validateOutput(s.Output, fldPath.Child("output"))...)
+	seenPlatforms := make(map[string]bool)
+	for i, p := range s.Platforms {
+		if !platformRegexp.MatchString(p) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("platforms").Index(i), p, "must be in the form of `os/arch[/variant]`, e.g. `linux/amd64`"))
+		}
+		if seenPlatforms[p] {
+			allErrs = append(allErrs, field.Duplicate(fldPath.Child("platforms").Index(i), p))
+		}
+		seenPlatforms[p] = true
+	}
+	allErrs = append(allErrs, validateBuildSecrets(s.BuildSecrets, fldPath.Child("buildSecrets"))...)
+	return allErrs
+}
+
+// validateBuildSecrets validates the secret names, the mount paths, and the modes.
+func validateBuildSecrets(secrets []SecretMount, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	seenMountPaths := make(map[string]bool)
+	for i, s := range secrets {
+		idxPath := fldPath.Index(i)
+		if s.SecretRef.Name == "" {
+			allErrs = append(allErrs, field.Required(idxPath.Child("secretRef", "name"), ""))
+		}
+		mountPathPath := idxPath.Child("mountPath")
+		switch {
+		case s.MountPath == "":
+			allErrs = append(allErrs, field.Required(mountPathPath, ""))
+		case !path.IsAbs(s.MountPath) || path.Clean(s.MountPath) == "/":
+			allErrs = append(allErrs, field.Invalid(mountPathPath, s.MountPath, "must be an absolute path other than /"))
+		case seenMountPaths[path.Clean(s.MountPath)]:
+			allErrs = append(allErrs, field.Duplicate(mountPathPath, s.MountPath))
+		}
+		seenMountPaths[path.Clean(s.MountPath)] = true
+		for j, item := range s.Items {
+			itemPath := idxPath.Child("items").Index(j)
+			if item.Key == "" {
+				allErrs = append(allErrs, field.Required(itemPath.Child("key"), ""))
+			}
+			if p := path.Clean(item.Path); item.Path == "" || path.IsAbs(p) || p == ".." || strings.HasPrefix(p, "../") {
+				allErrs = append(allErrs, field.Invalid(itemPath.Child("path"), item.Path, "must be a relative path without `..`"))
+			}
+		}
+		if m := s.DefaultMode; m != nil && (*m < 0 || *m > 0777) {
+			allErrs = append(allErrs, field.Invalid(idxPath.Child("defaultMode"), *m, "must be between 0 and 0777"))
+		}
+	}
+	return allErrs
+}
+
+// validateOutput validates the fields required by the output kind.
+// Unlike contexts, the outputs are exported by the helper, so unknown kinds are rejected.
+func validateOutput(o Output, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	switch o.Kind {
+	case OutputKindNone:
+		return nil
+	case OutputKindS3:
+		s3Path := fldPath.Child("s3")
+		if o.S3.Bucket == "" {
+			allErrs = append(allErrs, field.Required(s3Path.Child("bucket"), ""))
+		}
+		if o.S3.Key == "" {
+			allErrs = append(allErrs, field.Required(s3Path.Child("key"), ""))
+		}
+		if o.S3.SubPath != "" {
+			allErrs = append(allErrs, field.Forbidden(s3Path.Child("subPath"), "not supported for output"))
+		}
+	case OutputKindRclone:
+		rclonePath := fldPath.Child("rclone")
+		if o.Rclone.Remote == "" {
+			allErrs = append(allErrs, field.Required(rclonePath.Child("remote"), ""))
+		}
+		if o.Rclone.Path == "" {
+			allErrs = append(allErrs, field.Required(rclonePath.Child("path"), "required for the archive file"))
+		}
+		if o.Rclone.SecretRef.Name == "" {
+			allErrs = append(allErrs, field.Required(rclonePath.Child("secretRef", "name"), ""))
+		}
+		if o.Rclone.SSHSecretRef.Name != "" {
+			allErrs = append(allErrs, field.Forbidden(rclonePath.Child("sshSecretRef"), "not supported for output"))
+		}
+		for i, f := range o.Rclone.Flags {
+			if err := ValidateRcloneFlag(f); err != nil {
+				allErrs = append(allErrs, field.Invalid(rclonePath.Child("flags").Index(i), f, err.Error()))
+			}
+		}
+	default:
+		allErrs = append(allErrs, field.NotSupported(fldPath.Child("kind"), o.Kind,
+			[]string{string(OutputKindS3), string(OutputKindRclone)}))
+	}
+	switch o.Format {
+	case OutputFormatDefault, OutputFormatOCI, OutputFormatDocker:
+	default:
+		allErrs = append(allErrs, field.NotSupported(fldPath.Child("format"), o.Format,
+			[]string{string(OutputFormatOCI), string(OutputFormatDocker)}))
+	}
+	return allErrs
+}
+
+// validateContext validates the fields required by the context kind.
+// Unknown kinds are left to the plugins.
+func validateContext(c Context, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	switch c.Kind {
+	case ContextKindGit:
+		gitPath := fldPath.Child("git")
+		if c.Git.URL == "" {
+			allErrs = append(allErrs, field.Required(gitPath.Child("url"), ""))
+		} else if _, err := ExpandVariables(c.Git.URL, c.Variables); err != nil {
+			allErrs = append(allErrs, field.Invalid(gitPath.Child("url"), c.Git.URL, err.Error()))
+		}
+		if _, err := ExpandVariables(c.Git.Revision, c.Variables); err != nil {
+			allErrs = append(allErrs, field.Invalid(gitPath.Child("revision"), c.Git.Revision, err.Error()))
+		}
+		switch c.Git.RevisionType {
+		case "", GitRevisionTypeAuto:
+		case GitRevisionTypeBranch, GitRevisionTypeTag, GitRevisionTypeCommit:
+			// revisionType is ignored when fetchRefspec is set
+			if c.Git.Revision == "" && c.Git.FetchRefspec == "" {
+				allErrs = append(allErrs, field.Required(gitPath.Child("revision"), fmt.Sprintf("required for revisionType %q", c.Git.RevisionType)))
+			}
+		default:
+			allErrs = append(allErrs, field.NotSupported(gitPath.Child("revisionType"), c.Git.RevisionType,
+				[]string{string(GitRevisionTypeAuto), string(GitRevisionTypeBranch), string(GitRevisionTypeTag), string(GitRevisionTypeCommit)}))
+		}
+		if c.Git.FetchRefspec != "" {
+			if err := ValidateGitFetchRefspec(c.Git.FetchRefspec); err != nil {
+				allErrs = append(allErrs, field.Invalid(gitPath.Child("fetchRefspec"), c.Git.FetchRefspec, err.Error()))
+			}
+		}
+		if c.Git.SingleCommit && c.Git.Depth > 0 {
+			allErrs = append(allErrs, field.Forbidden(gitPath.Child("singleCommit"), "may not be set together with depth"))
+		}
+		if c.Git.SingleBranch && c.Git.FetchRefspec == "" && (c.Git.RevisionType == GitRevisionTypeCommit || fullSHARegexp.MatchString(c.Git.Revision)) {
+			allErrs = append(allErrs, field.Forbidden(gitPath.Child("singleBranch"), "may not be set together with a commit revision"))
+		}
+		if c.Git.StrictHostKeyChecking && c.Git.SSHSecretRef.Name == "" {
+			allErrs = append(allErrs, field.Required(gitPath.Child("sshSecretRef", "name"), "required for strictHostKeyChecking"))
+		}
+	case ContextKindConfigMap:
+		if c.ConfigMapRef.Name == "" {
+			allErrs = append(allErrs, field.Required(fldPath.Child("configMapRef", "name"), ""))
+		}
+		if m := c.ConfigMapDefaultMode; m != nil && (*m < 0 || *m > 0777) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("configMapDefaultMode"), *m, "must be between 0 and 0777 (octal)"))
+		}
+		for i, item := range c.ConfigMapItems {
+			if m := item.Mode; m != nil && (*m < 0 || *m > 0777) {
+				allErrs = append(allErrs, field.Invalid(fldPath.Child("configMapItems").Index(i).Child("mode"), *m, "must be between 0 and 0777 (octal)"))
+			}
+		}
+	case ContextKindHTTP:
+		httpPath := fldPath.Child("http")
+		if c.HTTP.URL == "" {
+			allErrs = append(allErrs, field.Required(httpPath.Child("url"), ""))
+		}
+		if c.HTTP.Insecure && c.HTTP.CASecretRef.Name != "" {
+			allErrs = append(allErrs, field.Forbidden(httpPath.Child("caSecretRef"), "may not be set together with insecure"))
+		}
+		if c.HTTP.BasicAuthSecretRef.Name != "" && !c.HTTP.Insecure && !strings.HasPrefix(strings.ToLower(c.HTTP.URL), "https://") {
+			allErrs = append(allErrs, field.Forbidden(httpPath.Child("basicAuthSecretRef"), "requires https:// URL unless insecure is set"))
+		}
+	case ContextKindRclone:
+		rclonePath := fldPath.Child("rclone")
+		if c.Rclone.Remote == "" {
+			allErrs = append(allErrs, field.Required(rclonePath.Child("remote"), ""))
+		}
+		if c.Rclone.SecretRef.Name == "" {
+			allErrs = append(allErrs, field.Required(rclonePath.Child("secretRef", "name"), ""))
+		}
+		if c.Rclone.EffectiveRemoteType() == RcloneRemoteTypeSFTP && c.Rclone.SSHSecretRef.Name == "" {
+			allErrs = append(allErrs, field.Required(rclonePath.Child("sshSecretRef", "name"), "required for SFTP remote"))
+		}
+		for i, f := range c.Rclone.Flags {
+			if err := ValidateRcloneFlag(f); err != nil {
+				allErrs = append(allErrs, field.Invalid(rclonePath.Child("flags").Index(i), f, err.Error()))
+			}
+		}
+	case ContextKindLocal:
+		if c.Local.Path == "" {
+			allErrs = append(allErrs, field.Required(fldPath.Child("local", "path"), ""))
+		}
+	case ContextKindPVC:
+		pvcPath := fldPath.Child("pvc")
+		if c.PVC.ClaimName == "" {
+			allErrs = append(allErrs, field.Required(pvcPath.Child("claimName"), ""))
+		}
+		if !isRelativeSubPath(c.PVC.SubPath) {
+			allErrs = append(allErrs, field.Invalid(pvcPath.Child("subPath"), c.PVC.SubPath, "must be a relative path without `..`"))
+		}
+	case ContextKindOCI:
+		ociPath := fldPath.Child("oci")
+		if c.OCI.Image == "" {
+			allErrs = append(allErrs, field.Required(ociPath.Child("image"), ""))
+		} else if err := ValidateReference(c.OCI.Image); err != nil {
+			allErrs = append(allErrs, field.Invalid(ociPath.Child("image"), c.OCI.Image, err.Error()))
+		}
+		if c.OCI.Platform != "" && !platformRegexp.MatchString(c.OCI.Platform) {
+			allErrs = append(allErrs, field.Invalid(ociPath.Child("platform"), c.OCI.Platform, "must be in the form of `os/arch[/variant]`"))
+		}
+	case ContextKindS3:
+		s3Path := fldPath.Child("s3")
+		if c.S3.Bucket == "" {
+			allErrs = append(allErrs, field.Required(s3Path.Child("bucket"), ""))
+		}
+		if c.S3.Key == "" {
+			allErrs = append(allErrs, field.Required(s3Path.Child("key"), ""))
+		}
+	case ContextKindGCS:
+		gcsPath := fldPath.Child("gcs")
+		if c.GCS.Bucket == "" {
+			allErrs = append(allErrs, field.Required(gcsPath.Child("bucket"), ""))
+		}
+		if c.GCS.Object == "" {
+			allErrs = append(allErrs, field.Required(gcsPath.Child("object"), ""))
+		}
+		if !isRelativeSubPath(c.GCS.SubPath) {
+			allErrs = append(allErrs, field.Invalid(gcsPath.Child("subPath"), c.GCS.SubPath, "must be a relative path without `..`"))
+		}
+	case ContextKindAzureBlob:
+		azurePath := fldPath.Child("azureBlob")
+		if c.AzureBlob.Account == "" {
+			allErrs = append(allErrs, field.Required(azurePath.Child("account"), ""))
+		}
+		if c.AzureBlob.Container == "" {
+			allErrs = append(allErrs, field.Required(azurePath.Child("container"), ""))
+		}
+		if c.AzureBlob.Blob == "" {
+			allErrs = append(allErrs, field.Required(azurePath.Child("blob"), ""))
+		}
+		if !isRelativeSubPath(c.AzureBlob.SubPath) {
+			allErrs = append(allErrs, field.Invalid(azurePath.Child("subPath"), c.AzureBlob.SubPath, "must be a relative path without `..`"))
+		}
+	}
+	if c.DestPath != "" && (!path.IsAbs(c.DestPath) || path.Clean(c.DestPath) != c.DestPath || c.DestPath == "/") {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("destPath"), c.DestPath, "must be a clean absolute path other than `/`"))
+	}
+	if c.ContextCacheClaimRef.Name != "" && c.Kind != ContextKindConfigMap {
+		allErrs = append(allErrs, field.Forbidden(fldPath.Child("contextCacheClaimRef"), "only supported for ConfigMap context"))
+	}
+	for name := range c.Variables {
+		if err := ValidateVariableName(name); err != nil {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("variables").Key(name), name, err.Error()))
+		}
+	}
+	if len(c.Additional) != 0 && c.Kind == ContextKindLocal {
+		allErrs = append(allErrs, field.Forbidden(fldPath.Child("additional"), "may not be set for Local context, as merging would modify the host directory"))
+	}
+	if len(c.Additional) != 0 && c.Kind == ContextKindPVC {
+		allErrs = append(allErrs, field.Forbidden(fldPath.Child("additional"), "may not be set for PVC context, as merging would modify the volume"))
+	}
+	for i, a := range c.Additional {
+		additionalPath := fldPath.Child("additional").Index(i)
+		if len(a.Additional) != 0 {
+			allErrs = append(allErrs, field.Forbidden(additionalPath.Child("additional"), "additional contexts cannot be nested"))
+		}
+		if a.DestPath != "" {
+			allErrs = append(allErrs, field.Forbidden(additionalPath.Child("destPath"), "may not be set for additional contexts"))
+		}
+		allErrs = append(allErrs, validateContext(a, additionalPath)...)
+	}
+	return allErrs
+}
@@ -0,0 +1,578 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+func TestValidateReference(t *testing.T) {
+	cases := []struct {
+		ref     string
+		invalid bool
+	}{
+		{ref: "foo"},
+		{ref: "foo/bar"},
+		{ref: "example.com/foo/bar:baz"},
+		{ref: "example.com:5000/foo/bar:baz"},
+		{ref: "localhost:5000/foo_bar/baz-qux.quux:v1.0"},
+		{ref: "foo@sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"},
+		{ref: "foo:bar@sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"},
+		{ref: "", invalid: true},
+		{ref: "foo/Bar", invalid: true},
+		{ref: "example.com:foo/bar:latest", invalid: true},
+		{ref: "example.com/", invalid: true},
+		{ref: "foo:", invalid: true},
+		{ref: "foo:-bar", invalid: true},
+		{ref: "foo:" + strings.Repeat("a", 129), invalid: true},
+		{ref: "foo@sha256:abc", invalid: true},
+		{ref: strings.Repeat("a", 256), invalid: true},
+	}
+	for _, c := range cases {
+		err := ValidateReference(c.ref)
+		if err != nil && !c.invalid {
+			t.Fatalf("%q: %v", c.ref, err)
+		}
+		if err == nil && c.invalid {
+			t.Fatalf("%q: error is expected", c.ref)
+		}
+	}
+}
+
+func TestValidatePluginSelector(t *testing.T) {
+	cases := []struct {
+		s     string
+		valid bool
+	}{
+		{"plugin.name=docker", true},
+		{"plugin.name==docker", true},
+		{"plugin.name!=docker", true},
+		{"plugin.name in (buildkit,kaniko)", true},
+		{"plugin.name notin (docker), language.dockerfile", true},
+		{"!example.com/experimental", true},
+		{"plugin.name in buildkit", false},
+		{"plugin.name in (buildkit", false},
+		{"=docker", false},
+		{"plugin.name=docker,", false},
+		{"plugin.name=dock er", false},
+		{"plugin name=docker", false},
+	}
+	for _, c := range cases {
+		err := ValidatePluginSelector(c.s)
+		if c.valid && err != nil {
+			t.Fatalf("%q: expected valid, got %v", c.s, err)
+		}
+		if !c.valid && err == nil {
+			t.Fatalf("%q: expected invalid", c.s)
+		}
+	}
+}
+
+func TestRegistryValidate(t *testing.T) {
+	cases := []struct {
+		registry Registry
+		invalid  bool
+	}{
+		{registry: Registry{}},
+		{registry: Registry{Target: "example.com/foo:bar", AdditionalTargets: []string{"example.com/foo:latest"}}},
+		{registry: Registry{Target: "example.com/foo:bar:baz"}, invalid: true},
+		{registry: Registry{Target: "example.com/foo:bar", AdditionalTargets: []string{""}}, invalid: true},
+	}
+	for _, c := range cases {
+		err := c.registry.Validate()
+		if err != nil && !c.invalid {
+			t.Fatalf("%+v: %v", c.registry, err)
+		}
+		if err == nil && c.invalid {
+			t.Fatalf("%+v: error is expected", c.registry)
+		}
+	}
+}
+
+func TestBuildJobSpecValidate(t *testing.T) {
+	cases := []struct {
+		spec    BuildJobSpec
+		invalid bool
+	}{
+		{
+			spec: BuildJobSpec{Language: Language{Kind: LanguageKindCloudbuild}},
+		},
+		{
+			spec:    BuildJobSpec{Language: Language{Kind: LanguageKindCloudbuild}, Registry: Registry{Target: "example.com/foo"}},
+			invalid: true,
+		},
+		{
+			spec: BuildJobSpec{Language: Language{Kind: LanguageKindDockerfile}},
+		},
+		{
+			spec: BuildJobSpec{Language: Language{Kind: LanguageKindDockerfile}, Registry: Registry{Target: "example.com/foo", Push: true}},
+		},
+		{
+			spec:    BuildJobSpec{Language: Language{Kind: "dockerfile"}, Registry: Registry{Push: true}},
+			invalid: true,
+		},
+		{
+			spec:    BuildJobSpec{Language: Language{Kind: LanguageKindS2I}, Registry: Registry{Push: true}},
+			invalid: true,
+		},
+		{
+			spec:    BuildJobSpec{Language: Language{Kind: LanguageKindDockerfile}, Registry: Registry{Target: "example.com/foo:bar:baz"}},
+			invalid: true,
+		},
+	}
+	for _, c := range cases {
+		err := c.spec.Validate()
+		if err != nil && !c.invalid {
+			t.Fatalf("%+v: %v", c.spec, err)
+		}
+		if err == nil && c.invalid {
+			t.Fatalf("%+v: error is expected", c.spec)
+		}
+	}
+}
+
+func TestValidateBuildJobSpecFields(t *testing.T) {
+	cases := []struct {
+		spec   BuildJobSpec
+		fields []string
+	}{
+		{
+			spec: BuildJobSpec{Context: Context{Kind: ContextKindGit, Git: Git{URL: "https://example.com/foo.git"}}},
+		},
+		{
+			spec:   BuildJobSpec{Context: Context{Kind: ContextKindGit}},
+			fields: []string{"spec.context.git.url"},
+		},
+		{
+			spec:   BuildJobSpec{Context: Context{Kind: ContextKindGit, Git: Git{URL: "git@example.com:foo.git", StrictHostKeyChecking: true}}},
+			fields: []string{"spec.context.git.sshSecretRef.name"},
+		},
+		{
+			spec:   BuildJobSpec{Context: Context{Kind: ContextKindGit, Git: Git{URL: "https://example.com/foo.git", RevisionType: GitRevisionTypeTag}}},
+			fields: []string{"spec.context.git.revision"},
+		},
+		{
+			spec:   BuildJobSpec{Context: Context{Kind: ContextKindGit, Git: Git{URL: "https://example.com/foo.git", Revision: "v1", RevisionType: "Ref"}}},
+			fields: []string{"spec.context.git.revisionType"},
+		},
+		{
+			spec: BuildJobSpec{Context: Context{Kind: ContextKindGit, Git: Git{URL: "https://example.com/foo.git"},
+				Additional: []Context{
+					{Kind: ContextKindConfigMap, ConfigMapRef: corev1.LocalObjectReference{Name: "foo"}},
+					{Kind: ContextKindConfigMap, Additional: []Context{{Kind: ContextKindLocal}}},
+				}}},
+			fields: []string{"spec.context.additional[1].additional", "spec.context.additional[1].configMapRef.name", "spec.context.additional[1].additional[0].local.path"},
+		},
+		{
+			spec:   BuildJobSpec{Context: Context{Kind: ContextKindConfigMap}},
+			fields: []string{"spec.context.configMapRef.name"},
+		},
+		{
+			spec: BuildJobSpec{Context: Context{Kind: ContextKindHTTP, HTTP: HTTP{URL: "https://example.com/foo.tar", Insecure: true,
+				CASecretRef: corev1.LocalObjectReference{Name: "ca"}}}},
+			fields: []string{"spec.context.http.caSecretRef"},
+		},
+		{
+			spec: BuildJobSpec{Context: Context{Kind: ContextKindHTTP, HTTP: HTTP{URL: "https://example.com/foo.tar",
+				BasicAuthSecretRef: corev1.LocalObjectReference{Name: "auth"}}}},
+		},
+		{
+			spec: BuildJobSpec{Context: Context{Kind: ContextKindHTTP, HTTP: HTTP{URL: "http://example.com/foo.tar",
+				BasicAuthSecretRef: corev1.LocalObjectReference{Name: "auth"}}}},
+			fields: []string{"spec.context.http.basicAuthSecretRef"},
+		},
+		{
+			spec: BuildJobSpec{Context: Context{Kind: ContextKindHTTP, HTTP: HTTP{URL: "http://example.com/foo.tar", Insecure: true,
+				BasicAuthSecretRef: corev1.LocalObjectReference{Name: "auth"}}}},
+		},
+		{
+			spec:   BuildJobSpec{Context: Context{Kind: ContextKindGit, Git: Git{URL: "https://example.com/foo.git", SingleCommit: true, Depth: 1}}},
+			fields: []string{"spec.context.git.singleCommit"},
+		},
+		{
+			spec: BuildJobSpec{Context: Context{Kind: ContextKindGit, Git: Git{URL: "https://example.com/foo.git", SingleBranch: true, Revision: "release-1.0"}}},
+		},
+		{
+			spec:   BuildJobSpec{Context: Context{Kind: ContextKindGit, Git: Git{URL: "https://example.com/foo.git", SingleBranch: true, Revision: "v1", RevisionType: GitRevisionTypeCommit}}},
+			fields: []string{"spec.context.git.singleBranch"},
+		},
+		{
+			spec:   BuildJobSpec{Context: Context{Kind: ContextKindGit, Git: Git{URL: "https://example.com/foo.git", SingleBranch: true, Revision: strings.Repeat("a", 40)}}},
+			fields: []string{"spec.context.git.singleBranch"},
+		},
+		{
+			spec: BuildJobSpec{Context: Context{Kind: ContextKindGit, Git: Git{URL: "https://github.com/foo/bar.git", FetchRefspec: "refs/pull/42/head"}}},
+		},
+		{
+			spec: BuildJobSpec{Context: Context{Kind: ContextKindGit, Git: Git{URL: "https://github.com/foo/bar.git",
+				FetchRefspec: "+refs/pull/42/merge:refs/remotes/origin/pr/42", RevisionType: GitRevisionTypeBranch}}},
+		},
+		{
+			spec: BuildJobSpec{Context: Context{Kind: ContextKindGit, Git: Git{URL: "https://gitlab.com/foo/bar.git", FetchRefspec: "refs/merge-requests/42/head"}}},
+		},
+		{
+			spec:   BuildJobSpec{Context: Context{Kind: ContextKindGit, Git: Git{URL: "https://github.com/foo/bar.git", FetchRefspec: "refs/pull/*/head"}}},
+			fields: []string{"spec.context.git.fetchRefspec"},
+		},
+		{
+			spec:   BuildJobSpec{Context: Context{Kind: ContextKindGit, Git: Git{URL: "https://github.com/foo/bar.git", FetchRefspec: "--upload-pack=evil"}}},
+			fields: []string{"spec.context.git.fetchRefspec"},
+		},
+		{
+			spec:   BuildJobSpec{Context: Context{Kind: ContextKindGit, Git: Git{URL: "https://github.com/foo/bar.git", FetchRefspec: "refs/pull/42/head refs/heads/master"}}},
+			fields: []string{"spec.context.git.fetchRefspec"},
+		},
+		{
+			spec:   BuildJobSpec{Context: Context{Kind: ContextKindGit, Git: Git{URL: "https://github.com/foo/bar.git", FetchRefspec: "refs/pull/../head"}}},
+			fields: []string{"spec.context.git.fetchRefspec"},
+		},
+		{
+			spec:   BuildJobSpec{Context: Context{Kind: ContextKindRclone}},
+			fields: []string{"spec.context.rclone.remote", "spec.context.rclone.secretRef.name"},
+		},
+		{
+			spec: BuildJobSpec{Context: Context{Kind: ContextKindRclone, Rclone: Rclone{Remote: "foo",
+				SecretRef: corev1.LocalObjectReference{Name: "bar"}, Flags: []string{"--bwlimit=10M", "--config=/tmp/foo", "--transfers"}}}},
+			fields: []string{"spec.context.rclone.flags[1]", "spec.context.rclone.flags[2]"},
+		},
+		{
+			spec: BuildJobSpec{Context: Context{Kind: ContextKindRclone, Rclone: Rclone{Remote: ":sftp,host=example.com",
+				SecretRef: corev1.LocalObjectReference{Name: "bar"}}}},
+			fields: []string{"spec.context.rclone.sshSecretRef.name"},
+		},
+		{
+			spec: BuildJobSpec{Context: Context{Kind: ContextKindRclone, Rclone: Rclone{Remote: "foo", RemoteType: "sftp",
+				SecretRef: corev1.LocalObjectReference{Name: "bar"}, SSHSecretRef: corev1.LocalObjectReference{Name: "baz"}}}},
+		},
+		{
+			spec:   BuildJobSpec{Context: Context{Kind: ContextKindLocal}},
+			fields: []string{"spec.context.local.path"},
+		},
+		{
+			spec: BuildJobSpec{Context: Context{Kind: ContextKindPVC, PVC: PVC{ClaimName: "artifacts", SubPath: "app/..foo"}}},
+		},
+		{
+			spec:   BuildJobSpec{Context: Context{Kind: ContextKindPVC, PVC: PVC{SubPath: "../app"}}},
+			fields: []string{"spec.context.pvc.claimName", "spec.context.pvc.subPath"},
+		},
+		{
+			spec: BuildJobSpec{Context: Context{Kind: ContextKindPVC, PVC: PVC{ClaimName: "artifacts"},
+				Additional: []Context{{Kind: ContextKindConfigMap, ConfigMapRef: corev1.LocalObjectReference{Name: "foo"}}}}},
+			fields: []string{"spec.context.additional"},
+		},
+		{
+			spec: BuildJobSpec{Context: Context{Kind: ContextKindOCI, OCI: OCI{Image: "example.com/foo:bar", Platform: "linux/arm/v7"}}},
+		},
+		{
+			spec: BuildJobSpec{Context: Context{Kind: ContextKindPVC, PVC: PVC{ClaimName: "artifacts"}, DestPath: "/go/src/github.com/foo/bar"}},
+		},
+		{
+			spec:   BuildJobSpec{Context: Context{Kind: ContextKindPVC, PVC: PVC{ClaimName: "artifacts"}, DestPath: "go/src"}},
+			fields: []string{"spec.context.destPath"},
+		},
+		{
+			spec:   BuildJobSpec{Context: Context{Kind: ContextKindPVC, PVC: PVC{ClaimName: "artifacts"}, DestPath: "/go/../etc"}},
+			fields: []string{"spec.context.destPath"},
+		},
+		{
+			spec:   BuildJobSpec{Context: Context{Kind: ContextKindPVC, PVC: PVC{ClaimName: "artifacts"}, DestPath: "/"}},
+			fields: []string{"spec.context.destPath"},
+		},
+		{
+			spec: BuildJobSpec{Context: Context{Kind: ContextKindConfigMap, ConfigMapRef: corev1.LocalObjectReference{Name: "foo"},
+				Additional: []Context{{Kind: ContextKindConfigMap, ConfigMapRef: corev1.LocalObjectReference{Name: "bar"}, DestPath: "/src"}}}},
+			fields: []string{"spec.context.additional[0].destPath"},
+		},
+		{
+			spec:   BuildJobSpec{Context: Context{Kind: ContextKindOCI, OCI: OCI{Platform: "arm"}}},
+			fields: []string{"spec.context.oci.image", "spec.context.oci.platform"},
+		},
+		{
+			spec:   BuildJobSpec{Context: Context{Kind: ContextKindOCI, OCI: OCI{Image: "Example.com/Foo"}}},
+			fields: []string{"spec.context.oci.image"},
+		},
+		{
+			spec: BuildJobSpec{Context: Context{Kind: ContextKindConfigMap, ConfigMapRef: corev1.LocalObjectReference{Name: "foo"},
+				ContextCacheClaimRef: corev1.LocalObjectReference{Name: "cache"}}},
+		},
+		{
+			spec: BuildJobSpec{Context: Context{Kind: ContextKindGit, Git: Git{URL: "https://example.com/foo.git"},
+				ContextCacheClaimRef: corev1.LocalObjectReference{Name: "cache"}}},
+			fields: []string{"spec.context.contextCacheClaimRef"},
+		},
+		{
+			spec: BuildJobSpec{Context: Context{Kind: ContextKindGCS, GCS: GCS{Bucket: "foo", Object: "bar.tar.gz", SubPath: "baz"}}},
+		},
+		{
+			spec:   BuildJobSpec{Context: Context{Kind: ContextKindGCS, GCS: GCS{SubPath: "../baz"}}},
+			fields: []string{"spec.context.gcs.bucket", "spec.context.gcs.object", "spec.context.gcs.subPath"},
+		},
+		{
+			spec: BuildJobSpec{Context: Context{Kind: ContextKindAzureBlob,
+				AzureBlob: AzureBlob{Account: "foo", Container: "bar", Blob: "contexts/baz.tar.gz", SubPath: "qux/"}}},
+		},
+		{
+			spec:   BuildJobSpec{Context: Context{Kind: ContextKindAzureBlob, AzureBlob: AzureBlob{Account: "foo", SubPath: "/qux"}}},
+			fields: []string{"spec.context.azureBlob.container", "spec.context.azureBlob.blob", "spec.context.azureBlob.subPath"},
+		},
+		{
+			spec:   BuildJobSpec{Context: Context{Kind: ContextKindS3, S3: S3{Bucket: "foo"}}},
+			fields: []string{"spec.context.s3.key"},
+		},
+		{
+			spec: BuildJobSpec{
+				Language: Language{Kind: LanguageKindDockerfile},
+				Registry: Registry{Target: "example.com/foo", AdditionalTargets: []string{"example.com/foo:bar", "Foo"},
+					Insecure: true, CASecretRef: corev1.LocalObjectReference{Name: "ca"}},
+			},
+			fields: []string{"spec.registry.additionalTargets[1]", "spec.registry.caSecretRef"},
+		},
+		{
+			spec: BuildJobSpec{
+				Language: Language{Kind: LanguageKindDockerfile},
+				Registry: Registry{Target: "123456789012.dkr.ecr.us-east-1.amazonaws.com/foo", CredentialHelper: "ecr-login"},
+			},
+		},
+		{
+			spec: BuildJobSpec{
+				Language: Language{Kind: LanguageKindDockerfile},
+				Registry: Registry{Target: "example.com/foo", CredentialHelper: "/usr/bin/docker-credential-ecr-login"},
+			},
+			fields: []string{"spec.registry.credentialHelper"},
+		},
+		{
+			spec: BuildJobSpec{
+				Language: Language{Kind: LanguageKindDockerfile},
+				Registry: Registry{Target: "example.com/foo", Push: true, PushRetries: 3},
+			},
+		},
+		{
+			spec: BuildJobSpec{
+				Language:  Language{Kind: LanguageKindDockerfile},
+				Registry:  Registry{Target: "example.com/foo"},
+				ExtraArgs: []string{"--network=host", "--squash", "-q"},
+			},
+		},
+		{
+			spec: BuildJobSpec{
+				Language:  Language{Kind: LanguageKindDockerfile},
+				Registry:  Registry{Target: "example.com/foo"},
+				ExtraArgs: []string{"--network", "host", "--=foo"},
+			},
+			fields: []string{"spec.extraArgs[1]", "spec.extraArgs[2]"},
+		},
+		{
+			spec: BuildJobSpec{
+				Language: Language{Kind: LanguageKindDockerfile},
+				Registry: Registry{Target: "example.com/foo:git-{{.ShortSHA}}", Push: true},
+				Context:  Context{Kind: ContextKindGit, Git: Git{URL: "https://example.com/foo.git"}},
+			},
+		},
+		{
+			spec: BuildJobSpec{
+				Language: Language{Kind: LanguageKindDockerfile},
+				Registry: Registry{Target: "example.com/foo:{{.Unknown}}", Push: true},
+				Context:  Context{Kind: ContextKindGit, Git: Git{URL: "https://example.com/foo.git"}},
+			},
+			fields: []string{"spec.registry.target"},
+		},
+		{
+			spec: BuildJobSpec{
+				Language: Language{Kind: LanguageKindDockerfile},
+				Registry: Registry{Target: "example.com/Foo:{{.Branch}}", Push: true},
+				Context:  Context{Kind: ContextKindGit, Git: Git{URL: "https://example.com/foo.git"}},
+			},
+			fields: []string{"spec.registry.target"},
+		},
+		{
+			spec: BuildJobSpec{
+				Language: Language{Kind: LanguageKindDockerfile},
+				Registry: Registry{Target: "example.com/foo:{{.ShortSHA}}", Push: true},
+				Context:  Context{Kind: ContextKindConfigMap, ConfigMapRef: corev1.LocalObjectReference{Name: "foo"}},
+			},
+			fields: []string{"spec.registry.target"},
+		},
+		{
+			spec: BuildJobSpec{
+				Language: Language{Kind: LanguageKindDockerfile},
+				Registry: Registry{Target: "example.com/foo", Push: true, PushRetries: -1},
+			},
+			fields: []string{"spec.registry.pushRetries"},
+		},
+		{
+			spec: BuildJobSpec{
+				Language: Language{Kind: LanguageKindDockerfile},
+				Registry: Registry{Target: "example.com/foo", Push: true, PushRetries: MaxPushRetries + 1},
+			},
+			fields: []string{"spec.registry.pushRetries"},
+		},
+		{
+			spec: BuildJobSpec{
+				Language: Language{Kind: LanguageKindDockerfile},
+				Registry: Registry{Target: "example.com/foo", CacheRef: "example.com/foo:buildcache"},
+			},
+		},
+		{
+			spec: BuildJobSpec{
+				Language: Language{Kind: LanguageKindDockerfile},
+				Registry: Registry{Target: "example.com/foo", CacheRef: "Foo:buildcache"},
+			},
+			fields: []string{"spec.registry.cacheRef"},
+		},
+		{
+			spec:   BuildJobSpec{Language: Language{Kind: LanguageKindCloudbuild}, Registry: Registry{Target: "example.com/foo"}},
+			fields: []string{"spec.registry.target"},
+		},
+		{
+			spec: BuildJobSpec{Output: Output{Kind: OutputKindS3, Format: OutputFormatDocker, S3: S3{Bucket: "foo", Key: "bar.tar"}}},
+		},
+		{
+			spec: BuildJobSpec{Registry: Registry{Target: "example.com/foo", Push: true},
+				Output: Output{Kind: OutputKindS3, S3: S3{Bucket: "foo", SubPath: "baz"}}},
+			fields: []string{"spec.output", "spec.output.s3.key", "spec.output.s3.subPath"},
+		},
+		{
+			spec: BuildJobSpec{Output: Output{Kind: OutputKindRclone, Format: "tar",
+				Rclone: Rclone{Remote: "foo", SecretRef: corev1.LocalObjectReference{Name: "bar"}, Flags: []string{"--config=/tmp/foo"}}}},
+			fields: []string{"spec.output.rclone.path", "spec.output.rclone.flags[0]", "spec.output.format"},
+		},
+		{
+			spec:   BuildJobSpec{Output: Output{Kind: "HTTP"}},
+			fields: []string{"spec.output.kind"},
+		},
+		{
+			spec: BuildJobSpec{BackoffLimit: int32Ptr(0)},
+		},
+		{
+			spec: BuildJobSpec{ContextFetchStallThreshold: &metav1.Duration{Duration: 5 * time.Minute}},
+		},
+		{
+			spec:   BuildJobSpec{ContextFetchStallThreshold: &metav1.Duration{}},
+			fields: []string{"spec.contextFetchStallThreshold"},
+		},
+		{
+			spec:   BuildJobSpec{BackoffLimit: int32Ptr(-1)},
+			fields: []string{"spec.backoffLimit"},
+		},
+		{
+			spec:   BuildJobSpec{Rerun: -1},
+			fields: []string{"spec.rerun"},
+		},
+		{
+			spec:   BuildJobSpec{PriorityClassName: "Release_Builds"},
+			fields: []string{"spec.priorityClassName"},
+		},
+		{
+			spec: BuildJobSpec{Context: Context{Kind: ContextKindConfigMap, ConfigMapRef: corev1.LocalObjectReference{Name: "foo"},
+				ConfigMapDefaultMode: int32Ptr(0755)}},
+		},
+		{
+			spec: BuildJobSpec{Context: Context{Kind: ContextKindConfigMap, ConfigMapRef: corev1.LocalObjectReference{Name: "foo"},
+				ConfigMapDefaultMode: int32Ptr(01000), ConfigMapItems: []corev1.KeyToPath{{Key: "run", Path: "run.sh", Mode: int32Ptr(-1)}}}},
+			fields: []string{"spec.context.configMapDefaultMode", "spec.context.configMapItems[0].mode"},
+		},
+		{
+			spec: BuildJobSpec{ServiceAccountName: "builder"},
+		},
+		{
+			spec:   BuildJobSpec{ServiceAccountName: "Builder"},
+			fields: []string{"spec.serviceAccountName"},
+		},
+		{
+			spec: BuildJobSpec{BuilderImage: "gcr.io/kaniko-project/executor:v0.2.0@sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"},
+		},
+		{
+			spec:   BuildJobSpec{BuilderImage: "Kaniko:latest"},
+			fields: []string{"spec.builderImage"},
+		},
+		{
+			spec: BuildJobSpec{Platforms: []string{"linux/amd64", "linux/arm/v7"}},
+		},
+		{
+			spec: BuildJobSpec{Context: Context{
+				Kind:      ContextKindGit,
+				Git:       Git{URL: "https://github.com/$(ORG)/foo.git", Revision: "$(REVISION)"},
+				Variables: map[string]string{"ORG": "example", "REVISION": "v1.0.0"},
+			}},
+		},
+		{
+			spec: BuildJobSpec{Context: Context{
+				Kind:      ContextKindGit,
+				Git:       Git{URL: "https://github.com/$(ORG)/foo.git", Revision: "$(REVISION)"},
+				Variables: map[string]string{"0RG": "example"},
+			}},
+			fields: []string{"spec.context.git.url", "spec.context.git.revision", "spec.context.variables[0RG]"},
+		},
+		{
+			spec: BuildJobSpec{BuildSecrets: []SecretMount{
+				{SecretRef: corev1.LocalObjectReference{Name: "npmrc"}, MountPath: "/cbi-secrets/npm"},
+				{SecretRef: corev1.LocalObjectReference{Name: "maven"}, MountPath: "/root/.m2", DefaultMode: int32Ptr(0400),
+					Items: []corev1.KeyToPath{{Key: "settings.xml", Path: "settings.xml"}}},
+			}},
+		},
+		{
+			spec: BuildJobSpec{BuildSecrets: []SecretMount{
+				{MountPath: "relative"},
+				{SecretRef: corev1.LocalObjectReference{Name: "foo"}, MountPath: "/"},
+				{SecretRef: corev1.LocalObjectReference{Name: "foo"}, MountPath: "/secrets", DefaultMode: int32Ptr(01000)},
+				{SecretRef: corev1.LocalObjectReference{Name: "bar"}, MountPath: "/secrets/",
+					Items: []corev1.KeyToPath{{Path: "../foo"}}},
+			}},
+			fields: []string{
+				"spec.buildSecrets[0].secretRef.name",
+				"spec.buildSecrets[0].mountPath",
+				"spec.buildSecrets[1].mountPath",
+				"spec.buildSecrets[2].defaultMode",
+				"spec.buildSecrets[3].mountPath",
+				"spec.buildSecrets[3].items[0].key",
+				"spec.buildSecrets[3].items[0].path",
+			},
+		},
+		{
+			spec: BuildJobSpec{PluginSelector: "plugin.name in (buildkit,kaniko)"},
+		},
+		{
+			spec:   BuildJobSpec{PluginSelector: "plugin.name in buildkit"},
+			fields: []string{"spec.pluginSelector"},
+		},
+		{
+			spec:   BuildJobSpec{Platforms: []string{"linux", "linux/amd64", "Linux/ARM64", "linux/amd64"}},
+			fields: []string{"spec.platforms[0]", "spec.platforms[2]", "spec.platforms[3]"},
+		},
+	}
+	for _, c := range cases {
+		errs := ValidateBuildJobSpec(c.spec, field.NewPath("spec"))
+		var fields []string
+		for _, e := range errs {
+			fields = append(fields, e.Field)
+		}
+		if !reflect.DeepEqual(fields, c.fields) {
+			t.Fatalf("%+v: expected %v, got %v", c.spec, c.fields, errs)
+		}
+	}
+}
+
+func int32Ptr(i int32) *int32 {
+	return &i
+}
@@ -0,0 +1,75 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"fmt"
+	"regexp"
+)
+
+var (
+	// variableReferenceRegexp matches `$(VAR)` and the escaped `$$(`.
+	variableReferenceRegexp = regexp.MustCompile(`\$\$\(|\$\(([^)]*)\)`)
+	variableNameRegexp      = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// ValidateVariableName returns an error if name cannot be referenced as `$(name)`.
+func ValidateVariableName(name string) error {
+	if !variableNameRegexp.MatchString(name) {
+		return fmt.Errorf("invalid variable name %q: must consist of alphanumeric characters or '_', and must not start with a digit", name)
+	}
+	return nil
+}
+
+// ExpandVariables expands the `$(VAR)` references in s with vars.
+// `$$(` is expanded to the literal `$(`.
+func ExpandVariables(s string, vars map[string]string) (string, error) {
+	var err error
+	res := variableReferenceRegexp.ReplaceAllStringFunc(s, func(ref string) string {
+		if ref == "$$(" {
+			return "$("
+		}
+		name := ref[2 : len(ref)-1]
+		v, ok := vars[name]
+		if !ok && err == nil {
+			err = fmt.Errorf("undefined variable %q in %q", name, s)
+		}
+		return v
+	})
+	if err != nil {
+		return "", err
+	}
+	return res, nil
+}
+
+// ExpandVariables expands the variable references in Git.URL and Git.Revision with Variables.
+// The additional contexts are expanded with their own Variables.
+func (c *Context) ExpandVariables() error {
+	var err error
+	if c.Git.URL, err = ExpandVariables(c.Git.URL, c.Variables); err != nil {
+		return fmt.Errorf("failed to expand Git.URL: %v", err)
+	}
+	if c.Git.Revision, err = ExpandVariables(c.Git.Revision, c.Variables); err != nil {
+		return fmt.Errorf("failed to expand Git.Revision: %v", err)
+	}
+	for i := range c.Additional {
+		if err := c.Additional[i].ExpandVariables(); err != nil {
+			return fmt.Errorf("additional[%d]: %v", i, err)
+		}
+	}
+	return nil
+}
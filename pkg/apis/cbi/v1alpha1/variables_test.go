@@ -0,0 +1,85 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"testing"
+)
+
+func TestExpandVariables(t *testing.T) {
+	vars := map[string]string{
+		"ORG":      "example",
+		"REVISION": "v1.0.0",
+		"EMPTY":    "",
+	}
+	cases := []struct {
+		s        string
+		expected string
+		invalid  bool
+	}{
+		{s: "https://github.com/foo/bar.git", expected: "https://github.com/foo/bar.git"},
+		{s: "https://github.com/$(ORG)/bar.git", expected: "https://github.com/example/bar.git"},
+		{s: "$(REVISION)$(EMPTY)-$(ORG)", expected: "v1.0.0-example"},
+		{s: "$$(REVISION)", expected: "$(REVISION)"},
+		{s: "$$$(REVISION)", expected: "$$(REVISION)"},
+		{s: "$REVISION $(", expected: "$REVISION $("},
+		{s: "$(UNKNOWN)", invalid: true},
+		{s: "$()", invalid: true},
+	}
+	for _, c := range cases {
+		actual, err := ExpandVariables(c.s, vars)
+		if err != nil && !c.invalid {
+			t.Fatalf("%q: %v", c.s, err)
+		}
+		if err == nil {
+			if c.invalid {
+				t.Fatalf("%q: error is expected, got %q", c.s, actual)
+			}
+			if actual != c.expected {
+				t.Fatalf("%q: expected %q, got %q", c.s, c.expected, actual)
+			}
+		}
+	}
+}
+
+func TestContextExpandVariables(t *testing.T) {
+	c := Context{
+		Kind: ContextKindGit,
+		Git:  Git{URL: "https://github.com/$(ORG)/foo.git", Revision: "$(REVISION)"},
+		Additional: []Context{
+			{
+				Kind:      ContextKindGit,
+				Git:       Git{URL: "https://github.com/$(ORG)/bar.git"},
+				Variables: map[string]string{"ORG": "other"},
+			},
+		},
+		Variables: map[string]string{"ORG": "example", "REVISION": "v1.0.0"},
+	}
+	if err := c.ExpandVariables(); err != nil {
+		t.Fatal(err)
+	}
+	if c.Git.URL != "https://github.com/example/foo.git" || c.Git.Revision != "v1.0.0" {
+		t.Fatalf("unexpected Git: %+v", c.Git)
+	}
+	if u := c.Additional[0].Git.URL; u != "https://github.com/other/bar.git" {
+		t.Fatalf("unexpected additional Git URL: %q", u)
+	}
+	c = Context{Kind: ContextKindGit, Git: Git{URL: "https://github.com/foo/bar.git", Revision: "$(REVISION)"}}
+	if err := c.ExpandVariables(); err == nil {
+		t.Fatal("error is expected for undefined variable")
+	}
+}
@@ -0,0 +1,49 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+
+	cbiv1alpha1 "github.com/containerbuilding/cbi/pkg/apis/cbi/v1alpha1"
+)
+
+// configMapGetter gets the ConfigMap, e.g. via the kube clientset.
+type configMapGetter func(namespace, name string) (*corev1.ConfigMap, error)
+
+// resolveConfigMapResourceVersions sets ConfigMapResourceVersion of the ConfigMap contexts with
+// ContextCacheClaimRef, so that the plugins can key the cache by the resource version.
+// Missing ConfigMaps are left unresolved, and the plugins fall back to copying the ConfigMap.
+func resolveConfigMapResourceVersions(c *cbiv1alpha1.Context, namespace string, getConfigMap configMapGetter) error {
+	c.ConfigMapResourceVersion = ""
+	if c.Kind == cbiv1alpha1.ContextKindConfigMap && c.ContextCacheClaimRef.Name != "" {
+		cm, err := getConfigMap(namespace, c.ConfigMapRef.Name)
+		if err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		if err == nil {
+			c.ConfigMapResourceVersion = cm.ResourceVersion
+		}
+	}
+	for i := range c.Additional {
+		if err := resolveConfigMapResourceVersions(&c.Additional[i], namespace, getConfigMap); err != nil {
+			return err
+		}
+	}
+	return nil
+}
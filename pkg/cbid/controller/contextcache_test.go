@@ -0,0 +1,64 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	cbiv1alpha1 "github.com/containerbuilding/cbi/pkg/apis/cbi/v1alpha1"
+)
+
+func TestResolveConfigMapResourceVersions(t *testing.T) {
+	resourceVersions := map[string]string{"default/foo": "42", "default/bar": "43"}
+	getConfigMap := func(namespace, name string) (*corev1.ConfigMap, error) {
+		rv, ok := resourceVersions[namespace+"/"+name]
+		if !ok {
+			return nil, errors.NewNotFound(schema.GroupResource{Resource: "configmaps"}, name)
+		}
+		return &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, ResourceVersion: rv}}, nil
+	}
+	cache := corev1.LocalObjectReference{Name: "cache"}
+	c := cbiv1alpha1.Context{
+		Kind:                     cbiv1alpha1.ContextKindConfigMap,
+		ConfigMapRef:             corev1.LocalObjectReference{Name: "foo"},
+		ContextCacheClaimRef:     cache,
+		ConfigMapResourceVersion: "bogus",
+		Additional: []cbiv1alpha1.Context{
+			{Kind: cbiv1alpha1.ContextKindConfigMap, ConfigMapRef: corev1.LocalObjectReference{Name: "bar"}, ContextCacheClaimRef: cache},
+			{Kind: cbiv1alpha1.ContextKindConfigMap, ConfigMapRef: corev1.LocalObjectReference{Name: "bar"}},
+			{Kind: cbiv1alpha1.ContextKindConfigMap, ConfigMapRef: corev1.LocalObjectReference{Name: "missing"}, ContextCacheClaimRef: cache},
+		},
+	}
+	if err := resolveConfigMapResourceVersions(&c, "default", getConfigMap); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"42", "43", "", ""}
+	actual := []string{c.ConfigMapResourceVersion}
+	for _, a := range c.Additional {
+		actual = append(actual, a.ConfigMapResourceVersion)
+	}
+	for i := range expected {
+		if actual[i] != expected[i] {
+			t.Fatalf("expected %v, got %v", expected, actual)
+		}
+	}
+}
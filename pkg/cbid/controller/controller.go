@@ -21,6 +21,9 @@ package controller
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
 	"time"
 
 	"github.com/golang/glog"
@@ -35,6 +38,7 @@ import (
 	"k8s.io/client-go/kubernetes/scheme"
 	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	batchlisters "k8s.io/client-go/listers/batch/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/record"
 	"k8s.io/client-go/util/workqueue"
@@ -45,6 +49,7 @@ import (
 	cbischeme "github.com/containerbuilding/cbi/pkg/client/clientset/versioned/scheme"
 	informers "github.com/containerbuilding/cbi/pkg/client/informers/externalversions"
 	listers "github.com/containerbuilding/cbi/pkg/client/listers/cbi/v1alpha1"
+	api "github.com/containerbuilding/cbi/pkg/plugin/api"
 )
 
 const controllerAgentName = "cbid"
@@ -62,6 +67,28 @@ const (
 	// MessageResourceSynced is the message used for an Event fired when a BuildJob
 	// is synced successfully
 	MessageResourceSynced = "BuildJob synced successfully"
+
+	// ContextFetchStarted is used as part of the Event 'reason' when the init
+	// containers start fetching the context
+	ContextFetchStarted = "ContextFetchStarted"
+	// ContextFetchCompleted is used as part of the Event 'reason' when all the
+	// init containers completed
+	ContextFetchCompleted = "ContextFetchCompleted"
+	// ContextFetchFailed is used as part of the Event 'reason' when an init
+	// container failed
+	ContextFetchFailed = "ContextFetchFailed"
+	// ContextFetchStalled is used as part of the Event 'reason' when an init
+	// container shows no progress for Spec.ContextFetchStallThreshold
+	ContextFetchStalled = "ContextFetchStalled"
+	// LogsPersistFailed is used as part of the Event 'reason' when the logs
+	// could not be stored for Spec.PersistLogs
+	LogsPersistFailed = "LogsPersistFailed"
+	// PushRetried is used as part of the Event 'reason' when the build container
+	// retried pushing the image for Spec.Registry.PushRetries
+	PushRetried = "PushRetried"
+	// MessageContextFetchCompleted is the message used for an Event fired when
+	// the context is fetched
+	MessageContextFetchCompleted = "Context fetched successfully"
 )
 
 // Controller is the controller implementation for BuildJob resources
@@ -72,6 +99,8 @@ type Controller struct {
 	cbiclientset    clientset.Interface
 	jobsLister      batchlisters.JobLister
 	jobsSynced      cache.InformerSynced
+	podsLister      corelisters.PodLister
+	podsSynced      cache.InformerSynced
 	buildJobsLister listers.BuildJobLister
 	buildJobsSynced cache.InformerSynced
 
@@ -87,6 +116,17 @@ type Controller struct {
 
 	// CBI plugin selector
 	pluginSelector *pluginselector.PluginSelector
+
+	metrics *controllerMetrics
+
+	// logsStore is used for Spec.PersistLogs (may be nil)
+	logsStore LogsStore
+
+	// extraArgsPolicy is used for Spec.ExtraArgs
+	extraArgsPolicy ExtraArgsPolicy
+
+	// pluginWaitPolicy is used for retrying the plugin selection
+	pluginWaitPolicy PluginWaitPolicy
 }
 
 // New returns a new CBI controller
@@ -100,6 +140,8 @@ func New(
 	// obtain references to shared index informers for the Job and BuildJob
 	// types.
 	jobInformer := kubeInformerFactory.Batch().V1().Jobs()
+	// pods are only used for collecting the termination messages and the container statuses
+	podInformer := kubeInformerFactory.Core().V1().Pods()
 	buildJobInformer := cbiInformerFactory.Cbi().V1alpha1().BuildJobs()
 
 	// Create event broadcaster
@@ -113,15 +155,19 @@ func New(
 	recorder := eventBroadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: controllerAgentName})
 
 	controller := &Controller{
-		kubeclientset:   kubeclientset,
-		cbiclientset:    cbiclientset,
-		jobsLister:      jobInformer.Lister(),
-		jobsSynced:      jobInformer.Informer().HasSynced,
-		buildJobsLister: buildJobInformer.Lister(),
-		buildJobsSynced: buildJobInformer.Informer().HasSynced,
-		workqueue:       workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "BuildJobs"),
-		recorder:        recorder,
-		pluginSelector:  pluginSelector,
+		kubeclientset:    kubeclientset,
+		cbiclientset:     cbiclientset,
+		jobsLister:       jobInformer.Lister(),
+		jobsSynced:       jobInformer.Informer().HasSynced,
+		podsLister:       podInformer.Lister(),
+		podsSynced:       podInformer.Informer().HasSynced,
+		buildJobsLister:  buildJobInformer.Lister(),
+		buildJobsSynced:  buildJobInformer.Informer().HasSynced,
+		workqueue:        workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "BuildJobs"),
+		recorder:         recorder,
+		pluginSelector:   pluginSelector,
+		metrics:          newControllerMetrics(),
+		pluginWaitPolicy: DefaultPluginWaitPolicy,
 	}
 
 	glog.Info("Setting up event handlers")
@@ -152,10 +198,27 @@ func New(
 		},
 		DeleteFunc: controller.handleObject,
 	})
+	// Set up an event handler for when Pod resources change, so that the
+	// conditions reflect the progress of the init containers.
+	podInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		UpdateFunc: func(old, new interface{}) {
+			newPod := new.(*corev1.Pod)
+			oldPod := old.(*corev1.Pod)
+			if newPod.ResourceVersion == oldPod.ResourceVersion {
+				return
+			}
+			controller.handlePod(newPod)
+		},
+	})
 
 	return controller
 }
 
+// MetricsHandler returns the handler of the `/metrics` endpoint in the Prometheus text format.
+func (c *Controller) MetricsHandler() http.Handler {
+	return c.metrics.registry
+}
+
 // Run will set up the event handlers for types we are interested in, as well
 // as syncing informer caches and starting workers. It will block until stopCh
 // is closed, at which point it will shutdown the workqueue and wait for
@@ -169,7 +232,7 @@ func (c *Controller) Run(threadiness int, stopCh <-chan struct{}) error {
 
 	// Wait for the caches to be synced before starting workers
 	glog.Info("Waiting for informer caches to sync")
-	if ok := cache.WaitForCacheSync(stopCh, c.jobsSynced, c.buildJobsSynced); !ok {
+	if ok := cache.WaitForCacheSync(stopCh, c.jobsSynced, c.podsSynced, c.buildJobsSynced); !ok {
 		return fmt.Errorf("failed to wait for caches to sync")
 	}
 
@@ -278,16 +341,72 @@ func (c *Controller) syncHandler(key string) error {
 		runtime.HandleError(fmt.Errorf("%s: invalid BuildJob spec", key))
 		return nil
 	}
-	pluginClient := c.pluginSelector.Select(*buildJob)
-	if pluginClient == nil {
-		runtime.HandleError(fmt.Errorf("%s: no plugin support this spec", key))
+	if buildJob.DeletionTimestamp != nil {
+		return c.finalizeBuildJob(buildJob)
+	}
+	if err := buildJob.Spec.Validate(); err != nil {
+		runtime.HandleError(fmt.Errorf("%s: invalid BuildJob spec: %v", key, err))
+		return c.updateValidatedCondition(buildJob, nil, cbiv1alpha1.BuildJobCondition{
+			Type:               cbiv1alpha1.BuildJobValidated,
+			Status:             corev1.ConditionFalse,
+			LastTransitionTime: metav1.Now(),
+			Reason:             "InvalidSpec",
+			Message:            err.Error(),
+		})
+	}
+	if err := c.extraArgsPolicy.Validate(buildJob.Spec.ExtraArgs); err != nil {
+		runtime.HandleError(fmt.Errorf("%s: extra args not allowed: %v", key, err))
+		return c.updateValidatedCondition(buildJob, nil, cbiv1alpha1.BuildJobCondition{
+			Type:               cbiv1alpha1.BuildJobValidated,
+			Status:             corev1.ConditionFalse,
+			LastTransitionTime: metav1.Now(),
+			Reason:             "ExtraArgsNotAllowed",
+			Message:            err.Error(),
+		})
+	}
+	if buildJob.Spec.PersistLogs && c.logsStore == nil {
+		runtime.HandleError(fmt.Errorf("%s: logs store not configured", key))
+		return c.updateValidatedCondition(buildJob, nil, cbiv1alpha1.BuildJobCondition{
+			Type:               cbiv1alpha1.BuildJobValidated,
+			Status:             corev1.ConditionFalse,
+			LastTransitionTime: metav1.Now(),
+			Reason:             "LogsStoreNotConfigured",
+			Message:            "Spec.PersistLogs is set, but the controller is not configured with a logs store",
+		})
+	}
+	if buildJob.Spec.DryRun {
+		return c.validateBuildJob(buildJob)
+	}
+	if !hasFinalizer(buildJob.ObjectMeta, JobCleanupFinalizer) {
+		// the update enqueues the BuildJob again
+		buildJobCopy := buildJob.DeepCopy()
+		buildJobCopy.Finalizers = append(buildJobCopy.Finalizers, JobCleanupFinalizer)
+		_, err := c.cbiclientset.CbiV1alpha1().BuildJobs(buildJob.Namespace).Update(buildJobCopy)
+		return err
+	}
+	if rerunRequested(buildJob) {
+		return c.rerunBuildJob(buildJob)
+	}
+	if pluginWaitDeadlineExceeded(&buildJob.Status) {
 		return nil
 	}
+	pluginClient, info, err := c.pluginSelector.Select(*buildJob)
+	if err != nil {
+		// the plugins may have become available since the last update, e.g. at cluster bootstrap
+		if err := c.pluginSelector.UpdateCachedInfo(context.TODO()); err != nil {
+			glog.V(4).Infof("%s: failed to update the plugin info: %v", key, err)
+		}
+		pluginClient, info, err = c.pluginSelector.Select(*buildJob)
+	}
+	if err != nil {
+		runtime.HandleError(fmt.Errorf("%s: no plugin support this spec: %v", key, err))
+		return c.waitForPlugin(key, buildJob, err)
+	}
 
-	jobManifest, err := newJob(context.TODO(), pluginClient, buildJob)
+	jobManifest, err := newJob(context.TODO(), pluginClient, info.Labels, buildJob, c.getConfigMap)
 	if err != nil {
 		runtime.HandleError(fmt.Errorf("%s: invalid BuildJob spec: %v", key, err))
-		return nil
+		return c.updateValidatedCondition(buildJob, info, specRejectedCondition(info, err))
 	}
 
 	// Get the job with the name specified in BuildJob.spec
@@ -295,6 +414,9 @@ func (c *Controller) syncHandler(key string) error {
 	// If the resource doesn't exist, we'll create it
 	if errors.IsNotFound(err) {
 		job, err = c.kubeclientset.BatchV1().Jobs(buildJob.Namespace).Create(jobManifest)
+		if err == nil {
+			c.metrics.observeJobCreated(buildJob, info)
+		}
 	}
 
 	// If an error occurs during Get/Create, we'll requeue the item so we can
@@ -309,7 +431,7 @@ func (c *Controller) syncHandler(key string) error {
 	if !metav1.IsControlledBy(job, buildJob) {
 		msg := fmt.Sprintf(MessageResourceExists, job.Name)
 		c.recorder.Event(buildJob, corev1.EventTypeWarning, ErrResourceExists, msg)
-		return fmt.Errorf(msg)
+		return fmt.Errorf("%s", msg)
 	}
 
 	updateJob := false // TODO
@@ -326,7 +448,7 @@ func (c *Controller) syncHandler(key string) error {
 
 	// Finally, we update the status block of the BuildJob resource to reflect the
 	// current state of the world
-	err = c.updateBuildJobStatus(buildJob, job)
+	err = c.updateBuildJobStatus(buildJob, job, info)
 	if err != nil {
 		return err
 	}
@@ -335,18 +457,203 @@ func (c *Controller) syncHandler(key string) error {
 	return nil
 }
 
-func (c *Controller) updateBuildJobStatus(buildJob *cbiv1alpha1.BuildJob, job *batchv1.Job) error {
+func (c *Controller) getConfigMap(namespace, name string) (*corev1.ConfigMap, error) {
+	return c.kubeclientset.CoreV1().ConfigMaps(namespace).Get(name, metav1.GetOptions{})
+}
+
+// finalizeBuildJob deletes the job of the BuildJob being deleted, and then removes JobCleanupFinalizer.
+func (c *Controller) finalizeBuildJob(buildJob *cbiv1alpha1.BuildJob) error {
+	if !hasFinalizer(buildJob.ObjectMeta, JobCleanupFinalizer) {
+		return nil
+	}
+	deleteJob := func(job *batchv1.Job) error {
+		glog.V(4).Infof("deleting job %s/%s of BuildJob %s", job.Namespace, job.Name, buildJob.Name)
+		return c.kubeclientset.BatchV1().Jobs(job.Namespace).Delete(job.Name, jobDeleteOptions(job))
+	}
+	if err := cleanupJob(buildJob, c.jobsLister.Jobs(buildJob.Namespace), deleteJob); err != nil {
+		return err
+	}
+	buildJobCopy := buildJob.DeepCopy()
+	buildJobCopy.Finalizers = removeFinalizer(buildJobCopy.Finalizers, JobCleanupFinalizer)
+	_, err := c.cbiclientset.CbiV1alpha1().BuildJobs(buildJob.Namespace).Update(buildJobCopy)
+	return err
+}
+
+// validateBuildJob selects the plugin and generates the job for a DryRun BuildJob,
+// and reports the result as the Validated condition without creating the job.
+func (c *Controller) validateBuildJob(buildJob *cbiv1alpha1.BuildJob) error {
+	cond := cbiv1alpha1.BuildJobCondition{
+		Type:               cbiv1alpha1.BuildJobValidated,
+		Status:             corev1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		Reason:             "Valid",
+	}
+	pluginClient, info, err := c.pluginSelector.Select(*buildJob)
+	if err != nil {
+		cond.Status = corev1.ConditionFalse
+		cond.Reason = "NoPlugin"
+		cond.Message = err.Error()
+	} else if _, err = newJob(context.TODO(), pluginClient, info.Labels, buildJob, c.getConfigMap); err != nil {
+		cond = specRejectedCondition(info, err)
+	} else {
+		cond.Message = fmt.Sprintf("the build would be executed by plugin %q", info.Labels[api.LPluginName])
+		// count the selection only once for the BuildJob, as the resyncs select the plugin again
+		if findBuildJobCondition(&buildJob.Status, cbiv1alpha1.BuildJobValidated) == nil {
+			c.metrics.pluginSelections.Inc(metricLabelValues(buildJob, info.Labels[api.LPluginName])...)
+		}
+	}
+	return c.updateValidatedCondition(buildJob, info, cond)
+}
+
+// waitForPlugin reflects the plugin selection failure selectErr to the conditions, and requeues
+// the BuildJob with the backoff of c.pluginWaitPolicy until the deadline is exceeded.
+func (c *Controller) waitForPlugin(key string, buildJob *cbiv1alpha1.BuildJob, selectErr error) error {
+	buildJobCopy := buildJob.DeepCopy()
+	if backoff := c.pluginWaitPolicy.update(&buildJobCopy.Status, selectErr, time.Now()); backoff > 0 {
+		glog.V(4).Infof("%s: retrying the plugin selection in %v", key, backoff)
+		c.workqueue.AddAfter(key, backoff)
+	}
+	// avoid updating (and hence re-enqueuing) the BuildJob when nothing has changed
+	if reflect.DeepEqual(buildJob.Status, buildJobCopy.Status) {
+		return nil
+	}
+	if _, err := c.cbiclientset.CbiV1alpha1().BuildJobs(buildJob.Namespace).Update(buildJobCopy); err != nil {
+		return err
+	}
+	c.metrics.observeStatus(buildJob, &buildJob.Status, &buildJobCopy.Status, nil)
+	cond := findBuildJobCondition(&buildJobCopy.Status, cbiv1alpha1.BuildJobValidated)
+	if cond.Status == corev1.ConditionFalse {
+		c.recorder.Event(buildJob, corev1.EventTypeWarning, cond.Reason, cond.Message)
+	} else if old := findBuildJobCondition(&buildJob.Status, cbiv1alpha1.BuildJobValidated); old == nil || old.Reason != cond.Reason {
+		c.recorder.Event(buildJob, corev1.EventTypeNormal, cond.Reason, cond.Message)
+	}
+	return nil
+}
+
+// updateValidatedCondition sets the Validated condition and the selected plugin (may be nil).
+// A warning event is recorded when the condition status is False.
+func (c *Controller) updateValidatedCondition(buildJob *cbiv1alpha1.BuildJob, info *api.InfoResponse, cond cbiv1alpha1.BuildJobCondition) error {
+	buildJobCopy := buildJob.DeepCopy()
+	setSelectedPlugin(&buildJobCopy.Status, info)
+	setBuildJobCondition(&buildJobCopy.Status, cond)
+	// avoid updating (and hence re-enqueuing) the BuildJob when nothing has changed
+	if reflect.DeepEqual(buildJob.Status, buildJobCopy.Status) {
+		return nil
+	}
+	if _, err := c.cbiclientset.CbiV1alpha1().BuildJobs(buildJob.Namespace).Update(buildJobCopy); err != nil {
+		return err
+	}
+	if cond.Status == corev1.ConditionFalse {
+		c.recorder.Event(buildJob, corev1.EventTypeWarning, cond.Reason, cond.Message)
+	}
+	return nil
+}
+
+func (c *Controller) updateBuildJobStatus(buildJob *cbiv1alpha1.BuildJob, job *batchv1.Job, info *api.InfoResponse) error {
+	pods, err := c.jobPods(job)
+	if err != nil {
+		return err
+	}
+	results := terminationResults(pods)
 	// NEVER modify objects from the store. It's a read-only, local cache.
 	// You can use DeepCopy() to make a deep copy of original object and modify this copy
 	// Or create a copy manually for better performance
 	buildJobCopy := buildJob.DeepCopy()
 	buildJobCopy.Status.Job = job.Name
+	setSelectedPlugin(&buildJobCopy.Status, info)
+	resolvePluginWait(&buildJobCopy.Status, info.Labels[api.LPluginName], time.Now())
+	// keep the previous results when the pods are already garbage-collected
+	if v, ok := results[api.TResolvedRevision]; ok {
+		buildJobCopy.Status.ResolvedRevision = v
+	}
+	buildJobCopy.Status.ExpandedTarget = expandedTarget(buildJob, buildJobCopy.Status.ResolvedRevision)
+	if v, ok := results[api.TImageDigest]; ok && buildJob.Spec.Registry.Push {
+		// buildkit reports the digest of the manifest list for multiple platforms
+		if len(buildJob.Spec.Platforms) > 1 {
+			buildJobCopy.Status.ManifestListDigest = v
+		} else {
+			buildJobCopy.Status.ImageDigest = v
+		}
+	}
+	if v, ok := results[api.TExportedArchive]; ok {
+		buildJobCopy.Status.ExportedArchive = v
+	}
+	if v, ok := results[api.TPushRetries]; ok {
+		if n, err := strconv.ParseInt(v, 10, 32); err == nil {
+			buildJobCopy.Status.PushRetries = int32(n)
+		}
+	}
+	// the pods are kept until the job is deleted, so failed attempts are retried on the next sync
+	logsCtx, cancel := context.WithTimeout(context.Background(), logsPersistTimeout)
+	err = persistLogs(logsCtx, &buildJobCopy.Status, buildJob, latestPod(pods), c.logsStore, c.getLogs)
+	cancel()
+	if err != nil {
+		c.recorder.Event(buildJob, corev1.EventTypeWarning, LogsPersistFailed, err.Error())
+	}
+	if buildJob.Spec.Registry.Push && job.Status.Succeeded > 0 {
+		buildJobCopy.Status.PushedTargets = append([]string{buildJobCopy.Status.ExpandedTarget}, buildJob.Spec.Registry.AdditionalTargets...)
+	}
+	updateBuildJobTimes(&buildJobCopy.Status, job)
+	updateBuildJobConditions(&buildJobCopy.Status, buildJob, job, pods)
 	// Until #38113 is merged, we must use Update instead of UpdateStatus to
 	// update the Status block of the BuildJob resource. UpdateStatus will not
 	// allow changes to the Spec of the resource, which is ideal for ensuring
 	// nothing other than resource status has been updated.
-	_, err := c.cbiclientset.CbiV1alpha1().BuildJobs(buildJob.Namespace).Update(buildJobCopy)
-	return err
+	_, err = c.cbiclientset.CbiV1alpha1().BuildJobs(buildJob.Namespace).Update(buildJobCopy)
+	if err != nil {
+		return err
+	}
+	c.metrics.observeStatus(buildJob, &buildJob.Status, &buildJobCopy.Status, latestPod(pods))
+	if eventType, reason, message := contextFetchEvent(&buildJob.Status, &buildJobCopy.Status); reason != "" {
+		c.recorder.Event(buildJob, eventType, reason, message)
+	}
+	if message := pushRetryEventMessage(&buildJob.Status, &buildJobCopy.Status); message != "" {
+		c.recorder.Event(buildJob, corev1.EventTypeWarning, PushRetried, message)
+	}
+	c.checkContextFetchStalled(buildJob, latestPod(pods))
+	return nil
+}
+
+// checkContextFetchStalled records a ContextFetchStalled event when an init container of the pod
+// shows no progress for Spec.ContextFetchStallThreshold.
+func (c *Controller) checkContextFetchStalled(buildJob *cbiv1alpha1.BuildJob, pod *corev1.Pod) {
+	threshold := buildJob.Spec.ContextFetchStallThreshold
+	if threshold == nil || pod == nil {
+		return
+	}
+	lastLogTime := func(container string) (time.Time, error) {
+		tailLines := int64(1)
+		b, err := c.kubeclientset.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, &corev1.PodLogOptions{
+			Container:  container,
+			Timestamps: true,
+			TailLines:  &tailLines,
+		}).DoRaw()
+		if err != nil {
+			return time.Time{}, err
+		}
+		return parseLogTimestamp(b)
+	}
+	name, idle, err := stalledInitContainer(pod, threshold.Duration, time.Now(), lastLogTime)
+	if err != nil {
+		runtime.HandleError(fmt.Errorf("failed to check the progress of pod %s/%s: %v", pod.Namespace, pod.Name, err))
+		return
+	}
+	if name != "" {
+		c.recorder.Eventf(buildJob, corev1.EventTypeWarning, ContextFetchStalled,
+			"init container %q has shown no progress for %v", name, idle.Round(time.Second))
+	}
+}
+
+// jobPods returns the pods of the job.
+func (c *Controller) jobPods(job *batchv1.Job) ([]*corev1.Pod, error) {
+	if job.Spec.Selector == nil {
+		return nil, nil
+	}
+	selector, err := metav1.LabelSelectorAsSelector(job.Spec.Selector)
+	if err != nil {
+		return nil, err
+	}
+	return c.podsLister.Pods(job.Namespace).List(selector)
 }
 
 // enqueueBuildJob takes a BuildJob resource and converts it into a namespace/name
@@ -401,3 +708,17 @@ func (c *Controller) handleObject(obj interface{}) {
 		return
 	}
 }
+
+// handlePod enqueues the BuildJob that owns the Job of the pod.
+func (c *Controller) handlePod(pod *corev1.Pod) {
+	ownerRef := metav1.GetControllerOf(pod)
+	if ownerRef == nil || ownerRef.Kind != "Job" {
+		return
+	}
+	job, err := c.jobsLister.Jobs(pod.Namespace).Get(ownerRef.Name)
+	if err != nil {
+		glog.V(4).Infof("ignoring orphaned object '%s' of Job '%s'", pod.GetSelfLink(), ownerRef.Name)
+		return
+	}
+	c.handleObject(job)
+}
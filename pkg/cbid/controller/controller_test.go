@@ -0,0 +1,170 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+
+	cbiv1alpha1 "github.com/containerbuilding/cbi/pkg/apis/cbi/v1alpha1"
+	"github.com/containerbuilding/cbi/pkg/cbid/pluginselector"
+	"github.com/containerbuilding/cbi/pkg/client/clientset/versioned/fake"
+	cbilisters "github.com/containerbuilding/cbi/pkg/client/listers/cbi/v1alpha1"
+	api "github.com/containerbuilding/cbi/pkg/plugin/api"
+	"github.com/containerbuilding/cbi/pkg/plugin/base/cbipluginhelper"
+	"github.com/containerbuilding/cbi/pkg/plugin/base/service"
+)
+
+// rejectingBackend rejects every BuildJob with err.
+type rejectingBackend struct {
+	err error
+}
+
+func (rejectingBackend) Info(ctx context.Context, req *api.InfoRequest) (*api.InfoResponse, error) {
+	return &api.InfoResponse{Labels: map[string]string{api.LPluginName: "rejecting"}}, nil
+}
+
+func (b rejectingBackend) CreatePodTemplateSpec(ctx context.Context, bj cbiv1alpha1.BuildJob) (*corev1.PodTemplateSpec, error) {
+	return nil, b.err
+}
+
+func TestSyncHandlerUnsupportedContext(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gs := grpc.NewServer()
+	api.RegisterPluginServer(gs, &service.Service{Backend: rejectingBackend{err: &cbipluginhelper.InjectError{
+		Kind:   cbiv1alpha1.ContextKindGit,
+		Reason: cbipluginhelper.InjectErrorUnsupportedKind,
+		Err:    errors.New("unsupported Spec.Context: git"),
+	}}})
+	go gs.Serve(ln)
+	defer gs.Stop()
+	conn, err := grpc.Dial(ln.Addr().String(), grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	ps := pluginselector.NewPluginSelector(func(plugins []api.InfoResponse, bj cbiv1alpha1.BuildJob) (int, error) {
+		return 0, nil
+	}, conn)
+	if err := ps.UpdateCachedInfo(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+
+	buildJob := &cbiv1alpha1.BuildJob{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default", Finalizers: []string{JobCleanupFinalizer}},
+		Spec: cbiv1alpha1.BuildJobSpec{
+			Registry: cbiv1alpha1.Registry{Target: "example.com/foo"},
+			Language: cbiv1alpha1.Language{Kind: cbiv1alpha1.LanguageKindDockerfile},
+			Context: cbiv1alpha1.Context{
+				Kind: cbiv1alpha1.ContextKindGit,
+				Git:  cbiv1alpha1.Git{URL: "https://example.com/foo.git"},
+			},
+		},
+	}
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	if err := indexer.Add(buildJob); err != nil {
+		t.Fatal(err)
+	}
+	cbiClient := fake.NewSimpleClientset(buildJob)
+	recorder := record.NewFakeRecorder(10)
+	c := &Controller{
+		cbiclientset:     cbiClient,
+		buildJobsLister:  cbilisters.NewBuildJobLister(indexer),
+		recorder:         recorder,
+		pluginSelector:   ps,
+		metrics:          newControllerMetrics(),
+		pluginWaitPolicy: DefaultPluginWaitPolicy,
+	}
+	if err := c.syncHandler("default/foo"); err != nil {
+		t.Fatal(err)
+	}
+	updated, err := cbiClient.CbiV1alpha1().BuildJobs("default").Get("foo", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cond := findBuildJobCondition(&updated.Status, cbiv1alpha1.BuildJobValidated)
+	if cond == nil || cond.Status != corev1.ConditionFalse || cond.Reason != "UnsupportedContext" {
+		t.Fatalf("unexpected condition %+v", cond)
+	}
+	if !strings.Contains(cond.Message, "unsupported Spec.Context: git") {
+		t.Fatalf("unexpected message %q", cond.Message)
+	}
+	select {
+	case ev := <-recorder.Events:
+		if !strings.HasPrefix(ev, corev1.EventTypeWarning+" UnsupportedContext ") {
+			t.Fatalf("unexpected event %q", ev)
+		}
+	default:
+		t.Fatal("no event was recorded")
+	}
+}
+
+func TestSyncHandlerPersistLogsWithoutStore(t *testing.T) {
+	buildJob := &cbiv1alpha1.BuildJob{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default", Finalizers: []string{JobCleanupFinalizer}},
+		Spec: cbiv1alpha1.BuildJobSpec{
+			Registry:    cbiv1alpha1.Registry{Target: "example.com/foo"},
+			Language:    cbiv1alpha1.Language{Kind: cbiv1alpha1.LanguageKindDockerfile},
+			Context:     cbiv1alpha1.Context{Kind: cbiv1alpha1.ContextKindGit, Git: cbiv1alpha1.Git{URL: "https://example.com/foo.git"}},
+			PersistLogs: true,
+		},
+	}
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	if err := indexer.Add(buildJob); err != nil {
+		t.Fatal(err)
+	}
+	cbiClient := fake.NewSimpleClientset(buildJob)
+	recorder := record.NewFakeRecorder(10)
+	c := &Controller{
+		cbiclientset:    cbiClient,
+		buildJobsLister: cbilisters.NewBuildJobLister(indexer),
+		recorder:        recorder,
+		metrics:         newControllerMetrics(),
+	}
+	// the resync with the updated status does not record the event again
+	for i := 0; i < 2; i++ {
+		if err := c.syncHandler("default/foo"); err != nil {
+			t.Fatal(err)
+		}
+		updated, err := cbiClient.CbiV1alpha1().BuildJobs("default").Get("foo", metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		cond := findBuildJobCondition(&updated.Status, cbiv1alpha1.BuildJobValidated)
+		if cond == nil || cond.Status != corev1.ConditionFalse || cond.Reason != "LogsStoreNotConfigured" {
+			t.Fatalf("unexpected condition %+v", cond)
+		}
+		if err := indexer.Update(updated); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := len(recorder.Events); n != 1 {
+		t.Fatalf("expected 1 event, got %d", n)
+	}
+}
@@ -0,0 +1,64 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+
+	cbiv1alpha1 "github.com/containerbuilding/cbi/pkg/apis/cbi/v1alpha1"
+)
+
+// ExtraArgsPolicy is the cluster-level policy for Spec.ExtraArgs.
+type ExtraArgsPolicy struct {
+	// Enabled allows Spec.ExtraArgs. BuildJobs with Spec.ExtraArgs are rejected when Enabled is false.
+	Enabled bool
+	// Allowlist is the names of the allowed flags, e.g. `--network`.
+	// All the flags are allowed when Allowlist is empty.
+	Allowlist []string
+}
+
+// Validate returns an error if extraArgs are not allowed by the policy.
+func (p ExtraArgsPolicy) Validate(extraArgs []string) error {
+	if len(extraArgs) == 0 {
+		return nil
+	}
+	if !p.Enabled {
+		return fmt.Errorf("Spec.ExtraArgs is disabled on this cluster")
+	}
+	if len(p.Allowlist) == 0 {
+		return nil
+	}
+	allowed := make(map[string]bool, len(p.Allowlist))
+	for _, name := range p.Allowlist {
+		allowed[name] = true
+	}
+	for _, arg := range extraArgs {
+		name, err := cbiv1alpha1.ExtraArgName(arg)
+		if err != nil {
+			return err
+		}
+		if !allowed[name] {
+			return fmt.Errorf("extra arg %q is not allowed (allowed: %v)", name, p.Allowlist)
+		}
+	}
+	return nil
+}
+
+// SetExtraArgsPolicy sets the policy for Spec.ExtraArgs. Spec.ExtraArgs is rejected unless the policy is enabled.
+func (c *Controller) SetExtraArgsPolicy(p ExtraArgsPolicy) {
+	c.extraArgsPolicy = p
+}
@@ -0,0 +1,62 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"testing"
+)
+
+func TestExtraArgsPolicyValidate(t *testing.T) {
+	testCases := []struct {
+		policy    ExtraArgsPolicy
+		extraArgs []string
+		invalid   bool
+	}{
+		{},
+		{extraArgs: []string{"--network=host"}, invalid: true},
+		{policy: ExtraArgsPolicy{Enabled: true}, extraArgs: []string{"--network=host", "--squash"}},
+		{
+			policy:    ExtraArgsPolicy{Enabled: true, Allowlist: []string{"--network", "--squash"}},
+			extraArgs: []string{"--network=host", "--squash"},
+		},
+		{
+			policy:    ExtraArgsPolicy{Enabled: true, Allowlist: []string{"--network"}},
+			extraArgs: []string{"--network=host", "--squash"},
+			invalid:   true,
+		},
+		{
+			// the names are compared exactly, without the values
+			policy:    ExtraArgsPolicy{Enabled: true, Allowlist: []string{"--network=host"}},
+			extraArgs: []string{"--network=host"},
+			invalid:   true,
+		},
+		{
+			policy:    ExtraArgsPolicy{Enabled: true, Allowlist: []string{"--network"}},
+			extraArgs: []string{"host"},
+			invalid:   true,
+		},
+	}
+	for i, tc := range testCases {
+		err := tc.policy.Validate(tc.extraArgs)
+		if tc.invalid && err == nil {
+			t.Fatalf("case %d: error is expected", i)
+		}
+		if !tc.invalid && err != nil {
+			t.Fatalf("case %d: %v", i, err)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	batchlisters "k8s.io/client-go/listers/batch/v1"
+
+	cbiv1alpha1 "github.com/containerbuilding/cbi/pkg/apis/cbi/v1alpha1"
+)
+
+// JobCleanupFinalizer is added to the BuildJobs before the jobs are created, so that the controller
+// deletes the job (and its pods) before the BuildJob is removed.
+// The job also has the owner reference, but the garbage collector skips it for orphan deletion
+// (e.g. `kubectl delete --cascade=false`).
+const JobCleanupFinalizer = "cbi.containerbuilding.github.io/job-cleanup"
+
+func hasFinalizer(meta metav1.ObjectMeta, finalizer string) bool {
+	for _, f := range meta.Finalizers {
+		if f == finalizer {
+			return true
+		}
+	}
+	return false
+}
+
+func removeFinalizer(finalizers []string, finalizer string) []string {
+	var res []string
+	for _, f := range finalizers {
+		if f != finalizer {
+			res = append(res, f)
+		}
+	}
+	return res
+}
+
+// cleanupJob deletes the job controlled by buildJob with deleteJob, if any.
+// The job is looked up by Status.Job, or by the name generated by the controller.
+// Jobs that are not controlled by buildJob are left untouched.
+func cleanupJob(buildJob *cbiv1alpha1.BuildJob, jobs batchlisters.JobNamespaceLister, deleteJob func(*batchv1.Job) error) error {
+	names := []string{jobName(buildJob)}
+	if s := buildJob.Status.Job; s != "" && s != names[0] {
+		names = append(names, s)
+	}
+	for _, name := range names {
+		job, err := jobs.Get(name)
+		if errors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if !metav1.IsControlledBy(job, buildJob) {
+			continue
+		}
+		if err := deleteJob(job); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// jobDeleteOptions deletes the pods of the job as well, and avoids deleting
+// another job that was created with the same name in the meantime.
+func jobDeleteOptions(job *batchv1.Job) *metav1.DeleteOptions {
+	propagation := metav1.DeletePropagationBackground
+	uid := job.UID
+	return &metav1.DeleteOptions{
+		PropagationPolicy: &propagation,
+		Preconditions:     &metav1.Preconditions{UID: &uid},
+	}
+}
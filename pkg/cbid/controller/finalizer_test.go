@@ -0,0 +1,146 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	typedbatchv1 "k8s.io/client-go/kubernetes/typed/batch/v1"
+	batchlisters "k8s.io/client-go/listers/batch/v1"
+	"k8s.io/client-go/tools/cache"
+
+	cbiv1alpha1 "github.com/containerbuilding/cbi/pkg/apis/cbi/v1alpha1"
+	"github.com/containerbuilding/cbi/pkg/client/clientset/versioned/fake"
+)
+
+// fakeKubeClient records the deletion of the jobs.
+// Calling the other methods panics, as the embedded interfaces are nil.
+type fakeKubeClient struct {
+	kubernetes.Interface
+	jobs *fakeJobs
+}
+
+func (c fakeKubeClient) BatchV1() typedbatchv1.BatchV1Interface {
+	return fakeBatchV1{jobs: c.jobs}
+}
+
+type fakeBatchV1 struct {
+	typedbatchv1.BatchV1Interface
+	jobs *fakeJobs
+}
+
+func (c fakeBatchV1) Jobs(namespace string) typedbatchv1.JobInterface {
+	return c.jobs
+}
+
+type fakeJobs struct {
+	typedbatchv1.JobInterface
+	deleted []string
+	// err is the error of the unexpected Delete call, checked by the test
+	err error
+}
+
+func (c *fakeJobs) Delete(name string, options *metav1.DeleteOptions) error {
+	if options.PropagationPolicy == nil || *options.PropagationPolicy == metav1.DeletePropagationOrphan {
+		c.err = fmt.Errorf("%s: the pods need to be deleted as well", name)
+		return c.err
+	}
+	c.deleted = append(c.deleted, name)
+	return nil
+}
+
+func TestFinalizeBuildJob(t *testing.T) {
+	now := metav1.Now()
+	buildJob := &cbiv1alpha1.BuildJob{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "foo",
+			Namespace:         "default",
+			UID:               types.UID("foo-uid"),
+			DeletionTimestamp: &now,
+			Finalizers:        []string{"example.com/other", JobCleanupFinalizer},
+		},
+		Status: cbiv1alpha1.BuildJobStatus{Job: "foo-job"},
+	}
+	ownedJob := &batchv1.Job{ObjectMeta: objectMeta(buildJob)}
+	// a job with the same name in another namespace, controlled by another BuildJob
+	otherOwner := buildJob.DeepCopy()
+	otherOwner.UID = types.UID("bar-uid")
+	unownedJob := &batchv1.Job{ObjectMeta: objectMeta(otherOwner)}
+	unownedJob.Namespace = "other"
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for _, j := range []*batchv1.Job{ownedJob, unownedJob} {
+		if err := indexer.Add(j); err != nil {
+			t.Fatal(err)
+		}
+	}
+	jobs := &fakeJobs{}
+	cbiClient := fake.NewSimpleClientset(buildJob)
+	c := &Controller{
+		kubeclientset: fakeKubeClient{jobs: jobs},
+		cbiclientset:  cbiClient,
+		jobsLister:    batchlisters.NewJobLister(indexer),
+	}
+	err := c.finalizeBuildJob(buildJob)
+	if jobs.err != nil {
+		t.Fatal(jobs.err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(jobs.deleted, []string{"foo-job"}) {
+		t.Fatalf("expected foo-job to be deleted, got %v", jobs.deleted)
+	}
+	updated, err := cbiClient.CbiV1alpha1().BuildJobs("default").Get("foo", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(updated.Finalizers, []string{"example.com/other"}) {
+		t.Fatalf("unexpected finalizers %v", updated.Finalizers)
+	}
+
+	// the job of the other BuildJob is not deleted
+	jobs.deleted = nil
+	if err := cleanupJob(buildJob, c.jobsLister.Jobs("other"), func(j *batchv1.Job) error {
+		jobs.deleted = append(jobs.deleted, j.Name)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs.deleted) != 0 {
+		t.Fatalf("jobs not controlled by the BuildJob should not be deleted, got %v", jobs.deleted)
+	}
+}
+
+func TestObjectMetaOwnerReference(t *testing.T) {
+	buildJob := &cbiv1alpha1.BuildJob{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default", UID: types.UID("foo-uid")}}
+	meta := objectMeta(buildJob)
+	ref := metav1.GetControllerOf(&metav1.ObjectMeta{OwnerReferences: meta.OwnerReferences})
+	expectedGVK := schema.GroupVersionKind{Group: cbiv1alpha1.SchemeGroupVersion.Group, Version: cbiv1alpha1.SchemeGroupVersion.Version, Kind: "BuildJob"}
+	if ref == nil || ref.UID != buildJob.UID || ref.Kind != expectedGVK.Kind || ref.APIVersion != expectedGVK.GroupVersion().String() {
+		t.Fatalf("unexpected owner reference %+v", ref)
+	}
+	if ref.BlockOwnerDeletion == nil || !*ref.BlockOwnerDeletion {
+		t.Fatal("the owner reference should block the deletion of the BuildJob in foreground deletion")
+	}
+}
@@ -19,8 +19,13 @@ package controller
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
 
 	"github.com/pkg/errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -30,7 +35,12 @@ import (
 	api "github.com/containerbuilding/cbi/pkg/plugin/api"
 )
 
+// jobName is suffixed with Spec.Rerun, so that the new job does not conflict
+// with the previous one still being deleted.
 func jobName(buildJob *cbiv1alpha1.BuildJob) string {
+	if buildJob.Spec.Rerun != 0 {
+		return fmt.Sprintf("%s-job-%d", buildJob.Name, buildJob.Spec.Rerun)
+	}
 	return buildJob.Name + "-job"
 }
 
@@ -48,7 +58,103 @@ func objectMeta(buildJob *cbiv1alpha1.BuildJob) metav1.ObjectMeta {
 	}
 }
 
-func newJob(ctx context.Context, pluginClient api.PluginClient, buildJob *cbiv1alpha1.BuildJob) (*batchv1.Job, error) {
+// setDefaults returns the BuildJob with the defaults filled in by the controller.
+// buildJob is not modified; a copy is returned if any default is applied.
+func setDefaults(buildJob *cbiv1alpha1.BuildJob) *cbiv1alpha1.BuildJob {
+	if strings.EqualFold(string(buildJob.Spec.Language.Kind), string(cbiv1alpha1.LanguageKindBuildpacks)) &&
+		buildJob.Spec.Language.Buildpacks.Builder == "" {
+		buildJob = buildJob.DeepCopy()
+		buildJob.Spec.Language.Buildpacks.Builder = cbiv1alpha1.DefaultBuildpacksBuilder
+	}
+	if buildJob.Spec.Registry.SecretRef.Name != "" && needsOCISecretRef(buildJob.Spec.Context) {
+		buildJob = buildJob.DeepCopy()
+		setOCISecretRef(&buildJob.Spec.Context, buildJob.Spec.Registry.SecretRef)
+	}
+	return buildJob
+}
+
+// needsOCISecretRef returns true if c or its additional contexts are OCI contexts without OCI.SecretRef.
+func needsOCISecretRef(c cbiv1alpha1.Context) bool {
+	if strings.EqualFold(string(c.Kind), string(cbiv1alpha1.ContextKindOCI)) && c.OCI.SecretRef.Name == "" {
+		return true
+	}
+	for _, a := range c.Additional {
+		if needsOCISecretRef(a) {
+			return true
+		}
+	}
+	return false
+}
+
+// setOCISecretRef defaults OCI.SecretRef of c and its additional contexts to secretRef.
+func setOCISecretRef(c *cbiv1alpha1.Context, secretRef corev1.LocalObjectReference) {
+	if strings.EqualFold(string(c.Kind), string(cbiv1alpha1.ContextKindOCI)) && c.OCI.SecretRef.Name == "" {
+		c.OCI.SecretRef = secretRef
+	}
+	for i := range c.Additional {
+		setOCISecretRef(&c.Additional[i], secretRef)
+	}
+}
+
+// expandVariables returns the BuildJob with the variables of the contexts and the template of the target
+// expanded, so that the plugins do not need to be aware of the variables.
+// The commit SHA of the target is left as cbiv1alpha1.RuntimeTargetVariables if it is not known yet.
+// buildJob is not modified.
+func expandVariables(buildJob *cbiv1alpha1.BuildJob) (*cbiv1alpha1.BuildJob, error) {
+	buildJob = buildJob.DeepCopy()
+	if err := buildJob.Spec.Context.ExpandVariables(); err != nil {
+		return nil, errors.Wrap(err, "Spec.Context")
+	}
+	if target := buildJob.Spec.Registry.Target; cbiv1alpha1.IsTargetTemplate(target) {
+		expanded, err := cbiv1alpha1.ExpandTarget(target, cbiv1alpha1.GitTargetVariables(buildJob.Spec.Context.Git, ""))
+		if err != nil {
+			return nil, errors.Wrap(err, "Spec.Registry.Target")
+		}
+		buildJob.Spec.Registry.Target = expanded
+	}
+	return buildJob, nil
+}
+
+// expandedTarget returns Spec.Registry.Target with the template expanded with resolvedRevision.
+// Empty is returned if the template refers to the commit SHA and resolvedRevision is empty.
+func expandedTarget(buildJob *cbiv1alpha1.BuildJob, resolvedRevision string) string {
+	expanded, err := expandVariables(buildJob)
+	if err != nil {
+		return ""
+	}
+	target, err := cbiv1alpha1.ExpandTarget(expanded.Spec.Registry.Target, cbiv1alpha1.GitTargetVariables(expanded.Spec.Context.Git, resolvedRevision))
+	if err != nil || cbiv1alpha1.IsTargetTemplate(target) {
+		return ""
+	}
+	return target
+}
+
+// setContextDelivery sets the api.AContextURL annotation of buildJob when the plugin with pluginLabels
+// streams the context, so that the plugin does not inject the context volume.
+// buildJob is modified in place.
+func setContextDelivery(buildJob *cbiv1alpha1.BuildJob, pluginLabels map[string]string) api.ContextDelivery {
+	delivery := api.SelectContextDelivery(pluginLabels, buildJob.Spec.Context)
+	if delivery == api.ContextDeliveryStream {
+		url, _ := api.StreamContextURL(buildJob.Spec.Context)
+		if buildJob.Annotations == nil {
+			buildJob.Annotations = make(map[string]string)
+		}
+		buildJob.Annotations[api.AContextURL] = url
+	} else {
+		delete(buildJob.Annotations, api.AContextURL)
+	}
+	return delivery
+}
+
+func newJob(ctx context.Context, pluginClient api.PluginClient, pluginLabels map[string]string, buildJob *cbiv1alpha1.BuildJob, getConfigMap configMapGetter) (*batchv1.Job, error) {
+	buildJob, err := expandVariables(setDefaults(buildJob))
+	if err != nil {
+		return nil, err
+	}
+	setContextDelivery(buildJob, pluginLabels)
+	if err := resolveConfigMapResourceVersions(&buildJob.Spec.Context, buildJob.Namespace, getConfigMap); err != nil {
+		return nil, err
+	}
 	buildJobJSON, err := json.Marshal(buildJob)
 	if err != nil {
 		return nil, err
@@ -65,11 +171,117 @@ func newJob(ctx context.Context, pluginClient api.PluginClient, buildJob *cbiv1a
 	if err := json.Unmarshal(specRes.PodTemplateSpecJson, &pts); err != nil {
 		return nil, err
 	}
+	if err := applyScheduling(&pts.Spec, buildJob.Spec); err != nil {
+		return nil, err
+	}
+	if pull := buildJob.Spec.Registry.PullSecretRef; pull.Name != "" {
+		addImagePullSecret(&pts.Spec, pull)
+	}
+	if sa := buildJob.Spec.ServiceAccountName; sa != "" {
+		if pts.Spec.ServiceAccountName != "" && pts.Spec.ServiceAccountName != sa {
+			return nil, errors.Errorf("Spec.ServiceAccountName %q conflicts with the plugin (%q)", sa, pts.Spec.ServiceAccountName)
+		}
+		pts.Spec.ServiceAccountName = sa
+	}
+	if pc := buildJob.Spec.PriorityClassName; pc != "" {
+		if pts.Spec.PriorityClassName != "" && pts.Spec.PriorityClassName != pc {
+			return nil, errors.Errorf("Spec.PriorityClassName %q conflicts with the plugin (%q)", pc, pts.Spec.PriorityClassName)
+		}
+		pts.Spec.PriorityClassName = pc
+	}
+	if image := buildJob.Spec.BuilderImage; image != "" {
+		c := buildContainer(&pts.Spec)
+		if c == nil {
+			return nil, errors.New("Spec.BuilderImage is set, but the plugin did not create the build container")
+		}
+		c.Image = image
+	}
 	j := &batchv1.Job{
 		ObjectMeta: objectMeta(buildJob),
 		Spec: batchv1.JobSpec{
 			Template: pts,
 		},
 	}
+	if timeout := buildJob.Spec.Timeout; timeout != nil {
+		if timeout.Duration <= 0 {
+			return nil, errors.Errorf("Spec.Timeout needs to be positive, got %v", timeout.Duration)
+		}
+		activeDeadlineSeconds := int64(math.Ceil(timeout.Duration.Seconds()))
+		j.Spec.ActiveDeadlineSeconds = &activeDeadlineSeconds
+	}
+	if backoffLimit := buildJob.Spec.BackoffLimit; backoffLimit != nil {
+		if *backoffLimit < 0 {
+			return nil, errors.Errorf("Spec.BackoffLimit needs to be non-negative, got %d", *backoffLimit)
+		}
+		limit := *backoffLimit
+		j.Spec.BackoffLimit = &limit
+	}
 	return j, nil
 }
+
+// buildContainer returns the build container of podSpec, or nil.
+// The build container is the first container, or the last init container when the archive is
+// exported by api.ExportContainerName for Spec.Output.
+func buildContainer(podSpec *corev1.PodSpec) *corev1.Container {
+	if len(podSpec.Containers) == 0 {
+		return nil
+	}
+	if podSpec.Containers[0].Name == api.ExportContainerName && len(podSpec.InitContainers) > 0 {
+		return &podSpec.InitContainers[len(podSpec.InitContainers)-1]
+	}
+	return &podSpec.Containers[0]
+}
+
+// addImagePullSecret adds secretRef to the imagePullSecrets of podSpec unless already present.
+func addImagePullSecret(podSpec *corev1.PodSpec, secretRef corev1.LocalObjectReference) {
+	for _, s := range podSpec.ImagePullSecrets {
+		if s.Name == secretRef.Name {
+			return
+		}
+	}
+	podSpec.ImagePullSecrets = append(podSpec.ImagePullSecrets, secretRef)
+}
+
+// terminationResults parses the termination messages of the containers that exited with zero status.
+// See pkg/plugin/api for the format.
+func terminationResults(pods []*corev1.Pod) map[string]string {
+	res := make(map[string]string)
+	for _, pod := range pods {
+		var statuses []corev1.ContainerStatus
+		statuses = append(statuses, pod.Status.InitContainerStatuses...)
+		statuses = append(statuses, pod.Status.ContainerStatuses...)
+		for _, st := range statuses {
+			t := st.State.Terminated
+			if t == nil || t.ExitCode != 0 {
+				continue
+			}
+			for k, v := range api.ParseTerminationMessage(t.Message) {
+				res[k] = v
+			}
+		}
+	}
+	return res
+}
+
+// specRejectedCondition returns the Validated condition for the error returned from newJob.
+func specRejectedCondition(info *api.InfoResponse, err error) cbiv1alpha1.BuildJobCondition {
+	return cbiv1alpha1.BuildJobCondition{
+		Type:               cbiv1alpha1.BuildJobValidated,
+		Status:             corev1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             specErrorReason(err),
+		Message:            fmt.Sprintf("plugin %q rejected the spec: %v", info.Labels[api.LPluginName], err),
+	}
+}
+
+// specErrorReason returns the Validated condition reason for the error returned from newJob.
+func specErrorReason(err error) string {
+	switch status.Code(errors.Cause(err)) {
+	case codes.Unimplemented:
+		return "UnsupportedContext"
+	case codes.FailedPrecondition:
+		return "ContextNotEnabled"
+	default:
+		return "InvalidSpec"
+	}
+}
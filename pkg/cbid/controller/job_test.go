@@ -0,0 +1,375 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	cbiv1alpha1 "github.com/containerbuilding/cbi/pkg/apis/cbi/v1alpha1"
+	api "github.com/containerbuilding/cbi/pkg/plugin/api"
+)
+
+func TestSetDefaults(t *testing.T) {
+	cases := []struct {
+		language        cbiv1alpha1.Language
+		expectedBuilder string
+	}{
+		{
+			language: cbiv1alpha1.Language{Kind: cbiv1alpha1.LanguageKindDockerfile},
+		},
+		{
+			language:        cbiv1alpha1.Language{Kind: cbiv1alpha1.LanguageKindBuildpacks},
+			expectedBuilder: cbiv1alpha1.DefaultBuildpacksBuilder,
+		},
+		{
+			language:        cbiv1alpha1.Language{Kind: "buildpacks", Buildpacks: cbiv1alpha1.Buildpacks{Buildpacks: []string{"heroku/nodejs"}}},
+			expectedBuilder: cbiv1alpha1.DefaultBuildpacksBuilder,
+		},
+		{
+			language:        cbiv1alpha1.Language{Kind: cbiv1alpha1.LanguageKindBuildpacks, Buildpacks: cbiv1alpha1.Buildpacks{Builder: "example.com/builder"}},
+			expectedBuilder: "example.com/builder",
+		},
+	}
+	for _, c := range cases {
+		buildJob := &cbiv1alpha1.BuildJob{Spec: cbiv1alpha1.BuildJobSpec{Language: c.language}}
+		defaulted := setDefaults(buildJob)
+		if actual := defaulted.Spec.Language.Buildpacks.Builder; actual != c.expectedBuilder {
+			t.Fatalf("%+v: expected %q, got %q", c.language, c.expectedBuilder, actual)
+		}
+		if buildJob.Spec.Language.Buildpacks.Builder != c.language.Buildpacks.Builder {
+			t.Fatalf("%+v: the original BuildJob was modified", c.language)
+		}
+	}
+}
+
+func TestSetDefaultsOCISecretRef(t *testing.T) {
+	buildJob := &cbiv1alpha1.BuildJob{Spec: cbiv1alpha1.BuildJobSpec{
+		Registry: cbiv1alpha1.Registry{SecretRef: corev1.LocalObjectReference{Name: "regcred"}},
+		Context: cbiv1alpha1.Context{
+			Kind: cbiv1alpha1.ContextKindOCI,
+			OCI:  cbiv1alpha1.OCI{Image: "example.com/foo"},
+			Additional: []cbiv1alpha1.Context{
+				{Kind: cbiv1alpha1.ContextKindOCI, OCI: cbiv1alpha1.OCI{Image: "example.com/bar", SecretRef: corev1.LocalObjectReference{Name: "barcred"}}},
+				{Kind: "oci", OCI: cbiv1alpha1.OCI{Image: "example.com/baz"}},
+			},
+		},
+	}}
+	defaulted := setDefaults(buildJob)
+	expected := []string{"regcred", "barcred", "regcred"}
+	actual := []string{defaulted.Spec.Context.OCI.SecretRef.Name}
+	for _, a := range defaulted.Spec.Context.Additional {
+		actual = append(actual, a.OCI.SecretRef.Name)
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("expected %v, got %v", expected, actual)
+	}
+	if buildJob.Spec.Context.OCI.SecretRef.Name != "" {
+		t.Fatal("the original BuildJob was modified")
+	}
+}
+
+func TestExpandVariables(t *testing.T) {
+	buildJob := &cbiv1alpha1.BuildJob{Spec: cbiv1alpha1.BuildJobSpec{Context: cbiv1alpha1.Context{
+		Kind:      cbiv1alpha1.ContextKindGit,
+		Git:       cbiv1alpha1.Git{URL: "https://github.com/example/foo.git", Revision: "$(REVISION)"},
+		Variables: map[string]string{"REVISION": "v1.0.0"},
+	}}}
+	expanded, err := expandVariables(buildJob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := expanded.Spec.Context.Git.Revision; r != "v1.0.0" {
+		t.Fatalf("expected %q, got %q", "v1.0.0", r)
+	}
+	if r := buildJob.Spec.Context.Git.Revision; r != "$(REVISION)" {
+		t.Fatalf("the original BuildJob was modified: %q", r)
+	}
+	buildJob.Spec.Context.Variables = nil
+	if _, err := expandVariables(buildJob); err == nil {
+		t.Fatal("error is expected for undefined variable")
+	}
+}
+
+func TestExpandTarget(t *testing.T) {
+	sha := "0123456789abcdef0123456789abcdef01234567"
+	testCases := []struct {
+		target           string
+		revision         string
+		resolvedRevision string
+		expectedSpec     string
+		expectedStatus   string
+	}{
+		{
+			target:         "example.com/foo:latest",
+			revision:       "master",
+			expectedSpec:   "example.com/foo:latest",
+			expectedStatus: "example.com/foo:latest",
+		},
+		{
+			target:         "example.com/foo:{{.Branch}}",
+			revision:       "$(REVISION)",
+			expectedSpec:   "example.com/foo:release-1.0",
+			expectedStatus: "example.com/foo:release-1.0",
+		},
+		{
+			target:       "example.com/foo:git-{{.ShortSHA}}",
+			revision:     "master",
+			expectedSpec: "example.com/foo:git-{{.ShortSHA}}",
+		},
+		{
+			target:           "example.com/foo:{{.Branch}}-{{.SHA}}",
+			revision:         "master",
+			resolvedRevision: sha,
+			expectedSpec:     "example.com/foo:master-{{.SHA}}",
+			expectedStatus:   "example.com/foo:master-" + sha,
+		},
+		{
+			target:         "example.com/foo:git-{{.ShortSHA}}",
+			revision:       sha,
+			expectedSpec:   "example.com/foo:git-0123456",
+			expectedStatus: "example.com/foo:git-0123456",
+		},
+	}
+	for _, tc := range testCases {
+		buildJob := &cbiv1alpha1.BuildJob{Spec: cbiv1alpha1.BuildJobSpec{
+			Registry: cbiv1alpha1.Registry{Target: tc.target},
+			Context: cbiv1alpha1.Context{
+				Kind:      cbiv1alpha1.ContextKindGit,
+				Git:       cbiv1alpha1.Git{URL: "https://github.com/example/foo.git", Revision: tc.revision},
+				Variables: map[string]string{"REVISION": "release/1.0"},
+			},
+		}}
+		expanded, err := expandVariables(buildJob)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if actual := expanded.Spec.Registry.Target; actual != tc.expectedSpec {
+			t.Fatalf("%q: expected %q, got %q", tc.target, tc.expectedSpec, actual)
+		}
+		if actual := expandedTarget(buildJob, tc.resolvedRevision); actual != tc.expectedStatus {
+			t.Fatalf("%q: expected %q in the status, got %q", tc.target, tc.expectedStatus, actual)
+		}
+	}
+}
+
+func TestSetContextDelivery(t *testing.T) {
+	git := cbiv1alpha1.Context{Kind: cbiv1alpha1.ContextKindGit, Git: cbiv1alpha1.Git{URL: "https://github.com/example/foo.git", Revision: "v1.0.0"}}
+	streaming := map[string]string{api.LContextDelivery(cbiv1alpha1.ContextKindGit): string(api.ContextDeliveryStream)}
+	testCases := []struct {
+		pluginLabels map[string]string
+		context      cbiv1alpha1.Context
+		annotations  map[string]string
+		expected     api.ContextDelivery
+		expectedURL  string
+	}{
+		{
+			context:  git,
+			expected: api.ContextDeliveryVolume,
+		},
+		{
+			// the annotation set by the user is not passed to the plugin
+			context:     git,
+			annotations: map[string]string{api.AContextURL: "https://example.com/evil.git"},
+			expected:    api.ContextDeliveryVolume,
+		},
+		{
+			pluginLabels: streaming,
+			context:      git,
+			expected:     api.ContextDeliveryStream,
+			expectedURL:  "https://github.com/example/foo.git#v1.0.0",
+		},
+		{
+			pluginLabels: streaming,
+			context: cbiv1alpha1.Context{Kind: cbiv1alpha1.ContextKindGit, Git: cbiv1alpha1.Git{
+				URL: "https://github.com/example/foo.git", HTTPSAuthSecretRef: corev1.LocalObjectReference{Name: "token"},
+			}},
+			expected: api.ContextDeliveryVolume,
+		},
+	}
+	for i, tc := range testCases {
+		buildJob := &cbiv1alpha1.BuildJob{
+			ObjectMeta: metav1.ObjectMeta{Name: "foo", Annotations: tc.annotations},
+			Spec:       cbiv1alpha1.BuildJobSpec{Context: tc.context},
+		}
+		if actual := setContextDelivery(buildJob, tc.pluginLabels); actual != tc.expected {
+			t.Fatalf("case %d: expected %q, got %q", i, tc.expected, actual)
+		}
+		if url := buildJob.Annotations[api.AContextURL]; url != tc.expectedURL {
+			t.Fatalf("case %d: expected URL %q, got %q", i, tc.expectedURL, url)
+		}
+	}
+}
+
+// fakePluginClient returns a pod template spec with podSpec.
+type fakePluginClient struct {
+	podSpec corev1.PodSpec
+}
+
+func (fakePluginClient) Info(ctx context.Context, in *api.InfoRequest, opts ...grpc.CallOption) (*api.InfoResponse, error) {
+	return &api.InfoResponse{}, nil
+}
+
+func (c fakePluginClient) Spec(ctx context.Context, in *api.SpecRequest, opts ...grpc.CallOption) (*api.SpecResponse, error) {
+	b, err := json.Marshal(corev1.PodTemplateSpec{Spec: c.podSpec})
+	if err != nil {
+		return nil, err
+	}
+	return &api.SpecResponse{PodTemplateSpecJson: b}, nil
+}
+
+func TestNewJob(t *testing.T) {
+	zero, three, negative := int32(0), int32(3), int32(-1)
+	cases := []struct {
+		spec                          cbiv1alpha1.BuildJobSpec
+		expectedBackoffLimit          *int32
+		expectedActiveDeadlineSeconds *int64
+		expectedServiceAccountName    string
+		expectedPriorityClassName     string
+		expectedImagePullSecrets      []corev1.LocalObjectReference
+		expectedErr                   bool
+	}{
+		{
+			spec: cbiv1alpha1.BuildJobSpec{},
+		},
+		{
+			spec:                 cbiv1alpha1.BuildJobSpec{BackoffLimit: &zero},
+			expectedBackoffLimit: &zero,
+		},
+		{
+			spec:                          cbiv1alpha1.BuildJobSpec{BackoffLimit: &three, Timeout: &metav1.Duration{Duration: 90 * time.Second}},
+			expectedBackoffLimit:          &three,
+			expectedActiveDeadlineSeconds: func() *int64 { i := int64(90); return &i }(),
+		},
+		{
+			spec:        cbiv1alpha1.BuildJobSpec{BackoffLimit: &negative},
+			expectedErr: true,
+		},
+		{
+			spec:                       cbiv1alpha1.BuildJobSpec{ServiceAccountName: "builder"},
+			expectedServiceAccountName: "builder",
+		},
+		{
+			spec:                      cbiv1alpha1.BuildJobSpec{PriorityClassName: "release-builds"},
+			expectedPriorityClassName: "release-builds",
+		},
+		{
+			spec:                     cbiv1alpha1.BuildJobSpec{Registry: cbiv1alpha1.Registry{PullSecretRef: corev1.LocalObjectReference{Name: "pull"}}},
+			expectedImagePullSecrets: []corev1.LocalObjectReference{{Name: "pull"}},
+		},
+	}
+	for _, c := range cases {
+		buildJob := &cbiv1alpha1.BuildJob{ObjectMeta: metav1.ObjectMeta{Name: "foo"}, Spec: c.spec}
+		j, err := newJob(context.TODO(), fakePluginClient{}, nil, buildJob, nil)
+		if c.expectedErr {
+			if err == nil {
+				t.Fatalf("%+v: error is expected", c.spec)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (j.Spec.BackoffLimit == nil) != (c.expectedBackoffLimit == nil) ||
+			(j.Spec.BackoffLimit != nil && *j.Spec.BackoffLimit != *c.expectedBackoffLimit) {
+			t.Fatalf("%+v: expected backoffLimit %v, got %v", c.spec, c.expectedBackoffLimit, j.Spec.BackoffLimit)
+		}
+		if (j.Spec.ActiveDeadlineSeconds == nil) != (c.expectedActiveDeadlineSeconds == nil) ||
+			(j.Spec.ActiveDeadlineSeconds != nil && *j.Spec.ActiveDeadlineSeconds != *c.expectedActiveDeadlineSeconds) {
+			t.Fatalf("%+v: expected activeDeadlineSeconds %v, got %v", c.spec, c.expectedActiveDeadlineSeconds, j.Spec.ActiveDeadlineSeconds)
+		}
+		if sa := j.Spec.Template.Spec.ServiceAccountName; sa != c.expectedServiceAccountName {
+			t.Fatalf("%+v: expected service account %q, got %q", c.spec, c.expectedServiceAccountName, sa)
+		}
+		if pc := j.Spec.Template.Spec.PriorityClassName; pc != c.expectedPriorityClassName {
+			t.Fatalf("%+v: expected priority class %q, got %q", c.spec, c.expectedPriorityClassName, pc)
+		}
+		if s := j.Spec.Template.Spec.ImagePullSecrets; !reflect.DeepEqual(s, c.expectedImagePullSecrets) {
+			t.Fatalf("%+v: expected image pull secrets %v, got %v", c.spec, c.expectedImagePullSecrets, s)
+		}
+	}
+}
+
+func TestNewJobBuilderImage(t *testing.T) {
+	cases := []struct {
+		podSpec  corev1.PodSpec
+		expected corev1.PodSpec
+		invalid  bool
+	}{
+		{
+			podSpec:  corev1.PodSpec{Containers: []corev1.Container{{Name: "build", Image: "builder:v1"}}},
+			expected: corev1.PodSpec{Containers: []corev1.Container{{Name: "build", Image: "builder:v1.0.1"}}},
+		},
+		{
+			// the build container is moved to the init containers for Spec.Output
+			podSpec: corev1.PodSpec{
+				InitContainers: []corev1.Container{{Name: "cbi-gitcontext-init", Image: "helper"}, {Name: "build", Image: "builder:v1"}},
+				Containers:     []corev1.Container{{Name: api.ExportContainerName, Image: "helper"}},
+			},
+			expected: corev1.PodSpec{
+				InitContainers: []corev1.Container{{Name: "cbi-gitcontext-init", Image: "helper"}, {Name: "build", Image: "builder:v1.0.1"}},
+				Containers:     []corev1.Container{{Name: api.ExportContainerName, Image: "helper"}},
+			},
+		},
+		{
+			invalid: true,
+		},
+	}
+	for i, c := range cases {
+		buildJob := &cbiv1alpha1.BuildJob{ObjectMeta: metav1.ObjectMeta{Name: "foo"}, Spec: cbiv1alpha1.BuildJobSpec{BuilderImage: "builder:v1.0.1"}}
+		j, err := newJob(context.TODO(), fakePluginClient{podSpec: c.podSpec}, nil, buildJob, nil)
+		if c.invalid {
+			if err == nil {
+				t.Fatalf("case %d: error is expected", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(j.Spec.Template.Spec, c.expected) {
+			t.Fatalf("case %d: expected %+v, got %+v", i, c.expected, j.Spec.Template.Spec)
+		}
+	}
+}
+
+func TestSpecErrorReason(t *testing.T) {
+	testCases := []struct {
+		err      error
+		expected string
+	}{
+		{errors.Wrap(status.Error(codes.Unimplemented, "unsupported Spec.Context: foo"), "pluginClient.Spec() failed"), "UnsupportedContext"},
+		{errors.Wrap(status.Error(codes.FailedPrecondition, "Local context is not enabled"), "pluginClient.Spec() failed"), "ContextNotEnabled"},
+		{errors.Wrap(status.Error(codes.InvalidArgument, "foo"), "pluginClient.Spec() failed"), "InvalidSpec"},
+		{errors.New("foo"), "InvalidSpec"},
+	}
+	for i, tc := range testCases {
+		if got := specErrorReason(tc.err); got != tc.expected {
+			t.Fatalf("case %d: expected %q, got %q", i, tc.expected, got)
+		}
+	}
+}
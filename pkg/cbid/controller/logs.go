@@ -0,0 +1,104 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os/exec"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+
+	cbiv1alpha1 "github.com/containerbuilding/cbi/pkg/apis/cbi/v1alpha1"
+)
+
+// logsPersistTimeout is the timeout of storing the logs, so that a hanging store does not block the sync.
+const logsPersistTimeout = 5 * time.Minute
+
+// LogsStore stores the logs of the build containers for Spec.PersistLogs.
+type LogsStore interface {
+	// Store stores r as name (e.g. "namespace/name-job.log") and returns the location.
+	Store(ctx context.Context, name string, r io.Reader) (string, error)
+}
+
+// RcloneLogsStore stores the logs under Remote (`remote:path`) via `rclone rcat`.
+// rclone needs to be installed and configured, e.g. with RCLONE_CONFIG_* environment variables.
+type RcloneLogsStore struct {
+	Remote string
+}
+
+// Store implements LogsStore.
+func (s *RcloneLogsStore) Store(ctx context.Context, name string, r io.Reader) (string, error) {
+	location := strings.TrimSuffix(s.Remote, "/") + "/" + name
+	if strings.HasSuffix(s.Remote, ":") {
+		location = s.Remote + name
+	}
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "rclone", "rcat", location)
+	cmd.Stdin = r
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", errors.Wrapf(err, "rclone rcat %s failed: %s", location, strings.TrimSpace(stderr.String()))
+	}
+	return location, nil
+}
+
+// logsGetter returns the logs of the container of the pod.
+type logsGetter func(pod *corev1.Pod, container string) (io.ReadCloser, error)
+
+// SetLogsStore sets the store for Spec.PersistLogs. BuildJobs with Spec.PersistLogs are rejected when the store is not set.
+func (c *Controller) SetLogsStore(s LogsStore) {
+	c.logsStore = s
+}
+
+func (c *Controller) getLogs(pod *corev1.Pod, container string) (io.ReadCloser, error) {
+	return c.kubeclientset.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, &corev1.PodLogOptions{
+		Container: container,
+	}).Stream()
+}
+
+// persistLogs stores the logs of the build container of pod and sets status.LogsLocation,
+// once the build container has terminated.
+// NOP when Spec.PersistLogs is false or the logs have been already stored.
+func persistLogs(ctx context.Context, status *cbiv1alpha1.BuildJobStatus, buildJob *cbiv1alpha1.BuildJob, pod *corev1.Pod, store LogsStore, getLogs logsGetter) error {
+	if !buildJob.Spec.PersistLogs || status.LogsLocation != "" || pod == nil {
+		return nil
+	}
+	_, buildStatus := splitBuildContainerStatus(pod)
+	if buildStatus == nil || buildStatus.State.Terminated == nil {
+		return nil
+	}
+	if store == nil {
+		return errors.New("Spec.PersistLogs is set, but the controller is not configured with a logs store")
+	}
+	r, err := getLogs(pod, buildStatus.Name)
+	if err != nil {
+		return errors.Wrapf(err, "failed to get the logs of pod %s/%s", pod.Namespace, pod.Name)
+	}
+	defer r.Close()
+	location, err := store.Store(ctx, path.Join(buildJob.Namespace, jobName(buildJob)+".log"), r)
+	if err != nil {
+		return err
+	}
+	status.LogsLocation = location
+	return nil
+}
@@ -0,0 +1,140 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	cbiv1alpha1 "github.com/containerbuilding/cbi/pkg/apis/cbi/v1alpha1"
+	api "github.com/containerbuilding/cbi/pkg/plugin/api"
+)
+
+// fakeLogsStore records the stored logs.
+type fakeLogsStore struct {
+	stored map[string]string
+	err    error
+}
+
+func (s *fakeLogsStore) Store(ctx context.Context, name string, r io.Reader) (string, error) {
+	if s.err != nil {
+		return "", s.err
+	}
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	s.stored[name] = string(b)
+	return "remote:logs/" + name, nil
+}
+
+func TestPersistLogs(t *testing.T) {
+	terminated := corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 0}}
+	running := corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}
+	cases := []struct {
+		persistLogs      bool
+		logsLocation     string
+		initStatuses     []corev1.ContainerStatus
+		statuses         []corev1.ContainerStatus
+		storeErr         error
+		expectedLocation string
+		expectedLogs     string
+		expectedError    bool
+	}{
+		{
+			statuses: []corev1.ContainerStatus{{Name: "build", State: terminated}},
+		},
+		{
+			persistLogs: true,
+			statuses:    []corev1.ContainerStatus{{Name: "build", State: running}},
+		},
+		{
+			persistLogs:      true,
+			statuses:         []corev1.ContainerStatus{{Name: "build", State: terminated}},
+			expectedLocation: "remote:logs/default/foo-job.log",
+			expectedLogs:     "logs of build",
+		},
+		{
+			// the build container is moved to the init containers for Spec.Output
+			persistLogs:      true,
+			initStatuses:     []corev1.ContainerStatus{{Name: "cbi-gitcontext-init", State: terminated}, {Name: "build", State: terminated}},
+			statuses:         []corev1.ContainerStatus{{Name: api.ExportContainerName, State: running}},
+			expectedLocation: "remote:logs/default/foo-job.log",
+			expectedLogs:     "logs of build",
+		},
+		{
+			// already persisted
+			persistLogs:      true,
+			logsLocation:     "remote:old",
+			statuses:         []corev1.ContainerStatus{{Name: "build", State: terminated}},
+			expectedLocation: "remote:old",
+		},
+		{
+			persistLogs:   true,
+			statuses:      []corev1.ContainerStatus{{Name: "build", State: terminated}},
+			storeErr:      errors.New("fake error"),
+			expectedError: true,
+		},
+	}
+	for i, c := range cases {
+		buildJob := &cbiv1alpha1.BuildJob{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "foo"},
+			Spec:       cbiv1alpha1.BuildJobSpec{PersistLogs: c.persistLogs},
+		}
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "foo-job-xxxxx"},
+			Status:     corev1.PodStatus{InitContainerStatuses: c.initStatuses, ContainerStatuses: c.statuses},
+		}
+		status := cbiv1alpha1.BuildJobStatus{LogsLocation: c.logsLocation}
+		store := &fakeLogsStore{stored: make(map[string]string), err: c.storeErr}
+		getLogs := func(pod *corev1.Pod, container string) (io.ReadCloser, error) {
+			return ioutil.NopCloser(strings.NewReader("logs of " + container)), nil
+		}
+		err := persistLogs(context.TODO(), &status, buildJob, pod, store, getLogs)
+		if c.expectedError {
+			if err == nil {
+				t.Fatalf("case %d: error is expected", i)
+			}
+			if status.LogsLocation != "" {
+				t.Fatalf("case %d: LogsLocation should not be set on error, got %q", i, status.LogsLocation)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("case %d: %v", i, err)
+		}
+		if status.LogsLocation != c.expectedLocation {
+			t.Fatalf("case %d: expected %q, got %q", i, c.expectedLocation, status.LogsLocation)
+		}
+		if actual := store.stored["default/foo-job.log"]; actual != c.expectedLogs {
+			t.Fatalf("case %d: expected logs %q, got %q", i, c.expectedLogs, actual)
+		}
+	}
+	// the logs store is not configured
+	buildJob := &cbiv1alpha1.BuildJob{Spec: cbiv1alpha1.BuildJobSpec{PersistLogs: true}}
+	pod := &corev1.Pod{Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{{Name: "build", State: terminated}}}}
+	if err := persistLogs(context.TODO(), &cbiv1alpha1.BuildJobStatus{}, buildJob, pod, nil, nil); err == nil {
+		t.Fatal("error is expected without the logs store")
+	}
+}
@@ -0,0 +1,106 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	corev1 "k8s.io/api/core/v1"
+
+	cbiv1alpha1 "github.com/containerbuilding/cbi/pkg/apis/cbi/v1alpha1"
+	"github.com/containerbuilding/cbi/pkg/cbid/metrics"
+	api "github.com/containerbuilding/cbi/pkg/plugin/api"
+)
+
+// controllerMetrics are the Prometheus metrics of the controller.
+// All the metrics are labeled by the language kind, the context kind, and the selected plugin.
+type controllerMetrics struct {
+	registry             *metrics.Registry
+	buildsCreated        *metrics.CounterVec
+	buildsSucceeded      *metrics.CounterVec
+	buildsFailed         *metrics.CounterVec
+	pluginSelections     *metrics.CounterVec
+	contextFetchDuration *metrics.HistogramVec
+}
+
+var metricLabelNames = []string{"language", "context", "plugin"}
+
+func newControllerMetrics() *controllerMetrics {
+	m := &controllerMetrics{
+		registry:             metrics.NewRegistry(),
+		buildsCreated:        metrics.NewCounterVec("cbi_builds_created_total", "Number of the jobs created for BuildJobs.", metricLabelNames...),
+		buildsSucceeded:      metrics.NewCounterVec("cbi_builds_succeeded_total", "Number of the BuildJobs that completed successfully.", metricLabelNames...),
+		buildsFailed:         metrics.NewCounterVec("cbi_builds_failed_total", "Number of the BuildJobs that failed.", metricLabelNames...),
+		pluginSelections:     metrics.NewCounterVec("cbi_plugin_selections_total", "Number of the BuildJobs (including DryRun) for which the plugin was selected.", metricLabelNames...),
+		contextFetchDuration: metrics.NewHistogramVec("cbi_context_fetch_duration_seconds", "Duration of fetching the contexts by the init containers.", nil, metricLabelNames...),
+	}
+	m.registry.MustRegister(m.buildsCreated, m.buildsSucceeded, m.buildsFailed, m.pluginSelections, m.contextFetchDuration)
+	return m
+}
+
+func metricLabelValues(buildJob *cbiv1alpha1.BuildJob, plugin string) []string {
+	return []string{string(buildJob.Spec.Language.Kind), string(buildJob.Spec.Context.Kind), plugin}
+}
+
+// observeJobCreated is called when the job for buildJob is created with the plugin.
+func (m *controllerMetrics) observeJobCreated(buildJob *cbiv1alpha1.BuildJob, info *api.InfoResponse) {
+	labelValues := metricLabelValues(buildJob, info.Labels[api.LPluginName])
+	m.pluginSelections.Inc(labelValues...)
+	m.buildsCreated.Inc(labelValues...)
+}
+
+// observeStatus is called when the status of buildJob is updated from oldStatus to newStatus.
+// Only the transitions are counted, so that the resyncs do not increment the counters.
+func (m *controllerMetrics) observeStatus(buildJob *cbiv1alpha1.BuildJob, oldStatus, newStatus *cbiv1alpha1.BuildJobStatus, pod *corev1.Pod) {
+	labelValues := metricLabelValues(buildJob, newStatus.SelectedPlugin)
+	if conditionBecameTrue(oldStatus, newStatus, cbiv1alpha1.BuildJobComplete) {
+		m.buildsSucceeded.Inc(labelValues...)
+	}
+	if conditionBecameTrue(oldStatus, newStatus, cbiv1alpha1.BuildJobFailed) {
+		m.buildsFailed.Inc(labelValues...)
+	}
+	if conditionBecameTrue(oldStatus, newStatus, cbiv1alpha1.BuildJobContextFetched) && pod != nil {
+		if seconds, ok := contextFetchSeconds(pod); ok {
+			m.contextFetchDuration.Observe(seconds, labelValues...)
+		}
+	}
+}
+
+// conditionBecameTrue returns true if the condition of the type is True in newStatus but not in oldStatus.
+func conditionBecameTrue(oldStatus, newStatus *cbiv1alpha1.BuildJobStatus, typ cbiv1alpha1.BuildJobConditionType) bool {
+	cond := findBuildJobCondition(newStatus, typ)
+	if cond == nil || cond.Status != corev1.ConditionTrue {
+		return false
+	}
+	old := findBuildJobCondition(oldStatus, typ)
+	return old == nil || old.Status != corev1.ConditionTrue
+}
+
+// contextFetchSeconds returns the duration from the start of the first init container to the
+// completion of the last one for fetching the context.
+// ok is false when the pod has no such init container, or they have not completed successfully.
+func contextFetchSeconds(pod *corev1.Pod) (seconds float64, ok bool) {
+	initStatuses, _ := splitBuildContainerStatus(pod)
+	if len(initStatuses) == 0 {
+		return 0, false
+	}
+	first, last := initStatuses[0].State.Terminated, initStatuses[len(initStatuses)-1].State.Terminated
+	for _, st := range initStatuses {
+		if t := st.State.Terminated; t == nil || t.ExitCode != 0 {
+			return 0, false
+		}
+	}
+	return last.FinishedAt.Sub(first.StartedAt.Time).Seconds(), true
+}
@@ -0,0 +1,112 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"testing"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	cbiv1alpha1 "github.com/containerbuilding/cbi/pkg/apis/cbi/v1alpha1"
+	api "github.com/containerbuilding/cbi/pkg/plugin/api"
+)
+
+func TestControllerMetrics(t *testing.T) {
+	m := newControllerMetrics()
+	info := &api.InfoResponse{Labels: map[string]string{api.LPluginName: "buildkit"}}
+	newBuildJob := func() *cbiv1alpha1.BuildJob {
+		bj := &cbiv1alpha1.BuildJob{Spec: cbiv1alpha1.BuildJobSpec{
+			Language: cbiv1alpha1.Language{Kind: cbiv1alpha1.LanguageKindDockerfile},
+			Context:  cbiv1alpha1.Context{Kind: cbiv1alpha1.ContextKindGit},
+		}}
+		setSelectedPlugin(&bj.Status, info)
+		return bj
+	}
+	start := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	terminated := func(offset, duration time.Duration, code int32) corev1.ContainerState {
+		return corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{
+			ExitCode:   code,
+			StartedAt:  metav1.NewTime(start.Add(offset)),
+			FinishedAt: metav1.NewTime(start.Add(offset + duration)),
+		}}
+	}
+	fetchedPod := &corev1.Pod{Status: corev1.PodStatus{
+		InitContainerStatuses: []corev1.ContainerStatus{
+			{Name: "cbi-gitcontext-init", State: terminated(0, 10*time.Second, 0)},
+			{Name: "cbi-foo-init", State: terminated(10*time.Second, 5*time.Second, 0)},
+		},
+		ContainerStatuses: []corev1.ContainerStatus{
+			{Name: "cbi-build", State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{StartedAt: metav1.NewTime(start.Add(15 * time.Second))}}},
+		},
+	}}
+	failedPod := &corev1.Pod{Status: corev1.PodStatus{
+		InitContainerStatuses: []corev1.ContainerStatus{
+			{Name: "cbi-gitcontext-init", State: terminated(0, 10*time.Second, 1)},
+		},
+		ContainerStatuses: []corev1.ContainerStatus{{Name: "cbi-build"}},
+	}}
+	jobStatus := func(typ batchv1.JobConditionType) batchv1.JobStatus {
+		return batchv1.JobStatus{Conditions: []batchv1.JobCondition{{Type: typ, Status: corev1.ConditionTrue}}}
+	}
+	// reconcile simulates updateBuildJobStatus
+	reconcile := func(bj *cbiv1alpha1.BuildJob, job batchv1.JobStatus, pod *corev1.Pod) {
+		newStatus := bj.Status.DeepCopy()
+		updateBuildJobConditions(newStatus, bj, &batchv1.Job{Status: job}, []*corev1.Pod{pod})
+		m.observeStatus(bj, &bj.Status, newStatus, pod)
+		bj.Status = *newStatus
+	}
+	labelValues := []string{"Dockerfile", "Git", "buildkit"}
+
+	succeeding := newBuildJob()
+	m.observeJobCreated(succeeding, info)
+	reconcile(succeeding, batchv1.JobStatus{}, fetchedPod)
+	reconcile(succeeding, batchv1.JobStatus{}, fetchedPod)
+	reconcile(succeeding, jobStatus(batchv1.JobComplete), fetchedPod)
+	// resync
+	reconcile(succeeding, jobStatus(batchv1.JobComplete), fetchedPod)
+
+	failing := newBuildJob()
+	m.observeJobCreated(failing, info)
+	reconcile(failing, batchv1.JobStatus{}, failedPod)
+	reconcile(failing, jobStatus(batchv1.JobFailed), failedPod)
+	reconcile(failing, jobStatus(batchv1.JobFailed), failedPod)
+
+	for _, c := range []struct {
+		name     string
+		value    float64
+		expected float64
+	}{
+		{"created", m.buildsCreated.Value(labelValues...), 2},
+		{"selections", m.pluginSelections.Value(labelValues...), 2},
+		{"succeeded", m.buildsSucceeded.Value(labelValues...), 1},
+		{"failed", m.buildsFailed.Value(labelValues...), 1},
+		{"context fetch", float64(m.contextFetchDuration.Count(labelValues...)), 1},
+	} {
+		if c.value != c.expected {
+			t.Fatalf("%s: expected %v, got %v", c.name, c.expected, c.value)
+		}
+	}
+	if seconds, ok := contextFetchSeconds(fetchedPod); !ok || seconds != 15 {
+		t.Fatalf("expected 15 seconds, got %v (ok=%v)", seconds, ok)
+	}
+	if _, ok := contextFetchSeconds(failedPod); ok {
+		t.Fatal("failed init container should not be observed")
+	}
+}
@@ -0,0 +1,130 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	cbiv1alpha1 "github.com/containerbuilding/cbi/pkg/apis/cbi/v1alpha1"
+)
+
+const (
+	// ReasonWaitingForPlugin is the reason of the Validated condition (Unknown) while no plugin supports the spec.
+	ReasonWaitingForPlugin = "WaitingForPlugin"
+	// ReasonNoPlugin is the reason of the Validated (False) and Failed (True) conditions
+	// when no plugin became available within PluginWaitPolicy.Deadline.
+	ReasonNoPlugin = "NoPlugin"
+)
+
+// PluginWaitPolicy is the policy for retrying the plugin selection, e.g. when the plugin
+// deployments are not ready yet at cluster bootstrap.
+type PluginWaitPolicy struct {
+	// InitialBackoff is the delay of the first retry. The delay doubles on each retry.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the delay between the retries.
+	MaxBackoff time.Duration
+	// Deadline is the duration after which the BuildJob is marked as failed. Zero for no deadline.
+	Deadline time.Duration
+}
+
+// DefaultPluginWaitPolicy is the default PluginWaitPolicy.
+var DefaultPluginWaitPolicy = PluginWaitPolicy{
+	InitialBackoff: 5 * time.Second,
+	MaxBackoff:     5 * time.Minute,
+	Deadline:       30 * time.Minute,
+}
+
+// SetPluginWaitPolicy sets the policy for retrying the plugin selection.
+func (c *Controller) SetPluginWaitPolicy(p PluginWaitPolicy) {
+	c.pluginWaitPolicy = p
+}
+
+// update sets the conditions of status for the plugin selection failure selectErr at now,
+// and returns the delay until the next retry.
+// Zero is returned when the deadline has been exceeded, i.e. the BuildJob has failed.
+//
+// The wait starts at the transition of the Validated condition to Unknown, and the delay is the
+// time elapsed since then (clamped to InitialBackoff and MaxBackoff), so that the delay doubles
+// without keeping the number of the retries.
+func (p PluginWaitPolicy) update(status *cbiv1alpha1.BuildJobStatus, selectErr error, now time.Time) time.Duration {
+	since := now
+	if cond := findBuildJobCondition(status, cbiv1alpha1.BuildJobValidated); cond != nil &&
+		cond.Status == corev1.ConditionUnknown && cond.Reason == ReasonWaitingForPlugin {
+		since = cond.LastTransitionTime.Time
+	}
+	elapsed := now.Sub(since)
+	if p.Deadline > 0 && elapsed >= p.Deadline {
+		msg := fmt.Sprintf("no plugin became available within %v: %v", p.Deadline, selectErr)
+		for _, cond := range []cbiv1alpha1.BuildJobCondition{
+			{Type: cbiv1alpha1.BuildJobValidated, Status: corev1.ConditionFalse},
+			{Type: cbiv1alpha1.BuildJobFailed, Status: corev1.ConditionTrue},
+		} {
+			cond.LastTransitionTime = metav1.NewTime(now)
+			cond.Reason = ReasonNoPlugin
+			cond.Message = msg
+			setBuildJobCondition(status, cond)
+		}
+		return 0
+	}
+	// the message does not contain the delay, so that the retries do not update the BuildJob
+	setBuildJobCondition(status, cbiv1alpha1.BuildJobCondition{
+		Type:               cbiv1alpha1.BuildJobValidated,
+		Status:             corev1.ConditionUnknown,
+		LastTransitionTime: metav1.NewTime(since),
+		Reason:             ReasonWaitingForPlugin,
+		Message:            fmt.Sprintf("waiting for a plugin that supports the spec: %v", selectErr),
+	})
+	backoff := elapsed
+	if backoff < p.InitialBackoff {
+		backoff = p.InitialBackoff
+	}
+	if p.MaxBackoff > 0 && backoff > p.MaxBackoff {
+		backoff = p.MaxBackoff
+	}
+	if p.Deadline > 0 && elapsed+backoff > p.Deadline {
+		// retry at the deadline, so that the BuildJob is marked as failed in time
+		backoff = p.Deadline - elapsed
+	}
+	return backoff
+}
+
+// pluginWaitDeadlineExceeded returns true if the BuildJob has failed for PluginWaitPolicy.Deadline.
+// The plugin selection is not retried for such BuildJobs until Spec.Rerun is changed.
+func pluginWaitDeadlineExceeded(status *cbiv1alpha1.BuildJobStatus) bool {
+	cond := findBuildJobCondition(status, cbiv1alpha1.BuildJobFailed)
+	return cond != nil && cond.Status == corev1.ConditionTrue && cond.Reason == ReasonNoPlugin
+}
+
+// resolvePluginWait sets the Validated condition to True when the plugin has been selected
+// after waiting for it. Nothing is done when the BuildJob has not waited for a plugin.
+func resolvePluginWait(status *cbiv1alpha1.BuildJobStatus, pluginName string, now time.Time) {
+	cond := findBuildJobCondition(status, cbiv1alpha1.BuildJobValidated)
+	if cond == nil || cond.Status != corev1.ConditionUnknown || cond.Reason != ReasonWaitingForPlugin {
+		return
+	}
+	setBuildJobCondition(status, cbiv1alpha1.BuildJobCondition{
+		Type:               cbiv1alpha1.BuildJobValidated,
+		Status:             corev1.ConditionTrue,
+		LastTransitionTime: metav1.NewTime(now),
+		Reason:             "PluginAvailable",
+		Message:            fmt.Sprintf("plugin %q became available after %v", pluginName, now.Sub(cond.LastTransitionTime.Time).Round(time.Second)),
+	})
+}
@@ -0,0 +1,99 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+
+	cbiv1alpha1 "github.com/containerbuilding/cbi/pkg/apis/cbi/v1alpha1"
+)
+
+func TestPluginWaitPolicyUpdate(t *testing.T) {
+	policy := PluginWaitPolicy{InitialBackoff: 5 * time.Second, MaxBackoff: time.Minute, Deadline: 10 * time.Minute}
+	selectErr := errors.New("no plugin can handle foo")
+	start := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	var status cbiv1alpha1.BuildJobStatus
+	// the plugins are not ready yet, so the selection is retried with the doubling delay
+	now := start
+	for _, expected := range []time.Duration{5 * time.Second, 5 * time.Second, 10 * time.Second, 20 * time.Second, 40 * time.Second, time.Minute, time.Minute} {
+		if actual := policy.update(&status, selectErr, now); actual != expected {
+			t.Fatalf("%v: expected backoff %v, got %v", now.Sub(start), expected, actual)
+		}
+		cond := findBuildJobCondition(&status, cbiv1alpha1.BuildJobValidated)
+		if cond.Status != corev1.ConditionUnknown || cond.Reason != ReasonWaitingForPlugin || !cond.LastTransitionTime.Time.Equal(start) {
+			t.Fatalf("%v: unexpected condition %+v", now.Sub(start), cond)
+		}
+		if pluginWaitDeadlineExceeded(&status) {
+			t.Fatalf("%v: unexpected failure", now.Sub(start))
+		}
+		now = now.Add(expected)
+	}
+	// the plugin appears
+	waiting := status
+	waiting.Conditions = append([]cbiv1alpha1.BuildJobCondition(nil), status.Conditions...)
+	resolvePluginWait(&waiting, "foo", now)
+	if cond := findBuildJobCondition(&waiting, cbiv1alpha1.BuildJobValidated); cond.Status != corev1.ConditionTrue || cond.Reason != "PluginAvailable" {
+		t.Fatalf("unexpected condition %+v", cond)
+	}
+	// the retry is scheduled at the deadline
+	now = start.Add(9*time.Minute + 30*time.Second)
+	if actual := policy.update(&status, selectErr, now); actual != 30*time.Second {
+		t.Fatalf("expected backoff 30s, got %v", actual)
+	}
+	// the plugin does not appear until the deadline
+	if actual := policy.update(&status, selectErr, start.Add(policy.Deadline)); actual != 0 {
+		t.Fatalf("expected no retry, got %v", actual)
+	}
+	if !pluginWaitDeadlineExceeded(&status) {
+		t.Fatalf("expected failure, got %+v", status.Conditions)
+	}
+	if cond := findBuildJobCondition(&status, cbiv1alpha1.BuildJobValidated); cond.Status != corev1.ConditionFalse || cond.Reason != ReasonNoPlugin {
+		t.Fatalf("unexpected condition %+v", cond)
+	}
+}
+
+func TestPluginWaitPolicyUpdateNoDeadline(t *testing.T) {
+	policy := PluginWaitPolicy{InitialBackoff: time.Second, MaxBackoff: time.Minute}
+	var status cbiv1alpha1.BuildJobStatus
+	start := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	policy.update(&status, errors.New("no plugin"), start)
+	if actual := policy.update(&status, errors.New("no plugin"), start.Add(24*time.Hour)); actual != time.Minute {
+		t.Fatalf("expected backoff 1m, got %v", actual)
+	}
+	if pluginWaitDeadlineExceeded(&status) {
+		t.Fatal("unexpected failure")
+	}
+}
+
+func TestResolvePluginWaitWithoutWaiting(t *testing.T) {
+	status := cbiv1alpha1.BuildJobStatus{Conditions: []cbiv1alpha1.BuildJobCondition{
+		{Type: cbiv1alpha1.BuildJobValidated, Status: corev1.ConditionFalse, Reason: "InvalidSpec"},
+	}}
+	resolvePluginWait(&status, "foo", time.Now())
+	if cond := findBuildJobCondition(&status, cbiv1alpha1.BuildJobValidated); cond.Reason != "InvalidSpec" {
+		t.Fatalf("unexpected condition %+v", cond)
+	}
+	var empty cbiv1alpha1.BuildJobStatus
+	resolvePluginWait(&empty, "foo", time.Now())
+	if len(empty.Conditions) != 0 {
+		t.Fatalf("unexpected conditions %+v", empty.Conditions)
+	}
+}
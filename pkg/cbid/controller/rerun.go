@@ -0,0 +1,45 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"github.com/golang/glog"
+	batchv1 "k8s.io/api/batch/v1"
+
+	cbiv1alpha1 "github.com/containerbuilding/cbi/pkg/apis/cbi/v1alpha1"
+)
+
+// rerunRequested returns true when Spec.Rerun has been changed since the current job was created.
+func rerunRequested(buildJob *cbiv1alpha1.BuildJob) bool {
+	return buildJob.Spec.Rerun != buildJob.Status.ObservedRerun
+}
+
+// rerunBuildJob deletes the previous job and clears the status.
+// The update enqueues the BuildJob again, and the next sync creates the new job.
+func (c *Controller) rerunBuildJob(buildJob *cbiv1alpha1.BuildJob) error {
+	deleteJob := func(job *batchv1.Job) error {
+		glog.V(4).Infof("deleting job %s/%s for rerunning BuildJob %s", job.Namespace, job.Name, buildJob.Name)
+		return c.kubeclientset.BatchV1().Jobs(job.Namespace).Delete(job.Name, jobDeleteOptions(job))
+	}
+	if err := cleanupJob(buildJob, c.jobsLister.Jobs(buildJob.Namespace), deleteJob); err != nil {
+		return err
+	}
+	buildJobCopy := buildJob.DeepCopy()
+	buildJobCopy.Status = cbiv1alpha1.BuildJobStatus{ObservedRerun: buildJob.Spec.Rerun}
+	_, err := c.cbiclientset.CbiV1alpha1().BuildJobs(buildJob.Namespace).Update(buildJobCopy)
+	return err
+}
@@ -0,0 +1,112 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"reflect"
+	"testing"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	batchlisters "k8s.io/client-go/listers/batch/v1"
+	"k8s.io/client-go/tools/cache"
+
+	cbiv1alpha1 "github.com/containerbuilding/cbi/pkg/apis/cbi/v1alpha1"
+	"github.com/containerbuilding/cbi/pkg/client/clientset/versioned/fake"
+)
+
+func TestJobNameRerun(t *testing.T) {
+	testCases := []struct {
+		rerun    int64
+		expected string
+	}{
+		{0, "foo-job"},
+		{1, "foo-job-1"},
+		{42, "foo-job-42"},
+	}
+	for _, tc := range testCases {
+		buildJob := &cbiv1alpha1.BuildJob{
+			ObjectMeta: metav1.ObjectMeta{Name: "foo"},
+			Spec:       cbiv1alpha1.BuildJobSpec{Rerun: tc.rerun},
+		}
+		if got := jobName(buildJob); got != tc.expected {
+			t.Fatalf("expected %q for rerun %d, got %q", tc.expected, tc.rerun, got)
+		}
+	}
+}
+
+func TestRerunBuildJob(t *testing.T) {
+	now := metav1.Now()
+	buildJob := &cbiv1alpha1.BuildJob{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       "foo",
+			Namespace:  "default",
+			UID:        types.UID("foo-uid"),
+			Finalizers: []string{JobCleanupFinalizer},
+		},
+		Status: cbiv1alpha1.BuildJobStatus{
+			Job:              "foo-job",
+			SelectedPlugin:   "docker",
+			ResolvedRevision: "deadbeef",
+			CompletionTime:   &now,
+			Conditions: []cbiv1alpha1.BuildJobCondition{
+				{Type: cbiv1alpha1.BuildJobFailed, Status: corev1.ConditionTrue},
+			},
+		},
+	}
+	if rerunRequested(buildJob) {
+		t.Fatal("rerun should not be requested before bumping Spec.Rerun")
+	}
+	oldJob := &batchv1.Job{ObjectMeta: objectMeta(buildJob)}
+	buildJob.Spec.Rerun = 1
+	if !rerunRequested(buildJob) {
+		t.Fatal("rerun should be requested after bumping Spec.Rerun")
+	}
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	if err := indexer.Add(oldJob); err != nil {
+		t.Fatal(err)
+	}
+	jobs := &fakeJobs{}
+	cbiClient := fake.NewSimpleClientset(buildJob)
+	c := &Controller{
+		kubeclientset: fakeKubeClient{jobs: jobs},
+		cbiclientset:  cbiClient,
+		jobsLister:    batchlisters.NewJobLister(indexer),
+	}
+	if err := c.rerunBuildJob(buildJob); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(jobs.deleted, []string{"foo-job"}) {
+		t.Fatalf("expected the previous job foo-job to be deleted, got %v", jobs.deleted)
+	}
+	updated, err := cbiClient.CbiV1alpha1().BuildJobs("default").Get("foo", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedStatus := cbiv1alpha1.BuildJobStatus{ObservedRerun: 1}
+	if !reflect.DeepEqual(updated.Status, expectedStatus) {
+		t.Fatalf("expected the status to be cleared, got %+v", updated.Status)
+	}
+	if rerunRequested(updated) {
+		t.Fatal("rerun should not be requested after clearing the status")
+	}
+	if name := jobName(updated); name == oldJob.Name {
+		t.Fatalf("the new job should not reuse the name of the previous job %q", name)
+	}
+}
@@ -0,0 +1,120 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+
+	cbiv1alpha1 "github.com/containerbuilding/cbi/pkg/apis/cbi/v1alpha1"
+)
+
+// applyScheduling merges the scheduling constraints of spec into podSpec generated by the plugin.
+// The constraints of the plugin are never relaxed: conflicting node selector keys are rejected,
+// and the affinity terms are combined so that both are satisfied.
+func applyScheduling(podSpec *corev1.PodSpec, spec cbiv1alpha1.BuildJobSpec) error {
+	for k, v := range spec.NodeSelector {
+		if pv, ok := podSpec.NodeSelector[k]; ok && pv != v {
+			return errors.Errorf("Spec.NodeSelector %q=%q conflicts with the plugin (%q)", k, v, pv)
+		}
+		if podSpec.NodeSelector == nil {
+			podSpec.NodeSelector = make(map[string]string)
+		}
+		podSpec.NodeSelector[k] = v
+	}
+	for _, t := range spec.Tolerations {
+		podSpec.Tolerations = append(podSpec.Tolerations, *t.DeepCopy())
+	}
+	if spec.Affinity != nil {
+		podSpec.Affinity = mergeAffinity(podSpec.Affinity, spec.Affinity)
+	}
+	return nil
+}
+
+// mergeAffinity returns the affinity that requires both a and b.
+func mergeAffinity(a, b *corev1.Affinity) *corev1.Affinity {
+	if a == nil {
+		return b.DeepCopy()
+	}
+	merged := a.DeepCopy()
+	if b.NodeAffinity != nil {
+		if merged.NodeAffinity == nil {
+			merged.NodeAffinity = &corev1.NodeAffinity{}
+		}
+		merged.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution = mergeNodeSelector(
+			merged.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution,
+			b.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution)
+		for _, t := range b.NodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution {
+			merged.NodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution = append(
+				merged.NodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution, *t.DeepCopy())
+		}
+	}
+	// pod (anti-)affinity terms are ANDed, so they can be just appended
+	if b.PodAffinity != nil {
+		if merged.PodAffinity == nil {
+			merged.PodAffinity = &corev1.PodAffinity{}
+		}
+		for _, t := range b.PodAffinity.RequiredDuringSchedulingIgnoredDuringExecution {
+			merged.PodAffinity.RequiredDuringSchedulingIgnoredDuringExecution = append(
+				merged.PodAffinity.RequiredDuringSchedulingIgnoredDuringExecution, *t.DeepCopy())
+		}
+		for _, t := range b.PodAffinity.PreferredDuringSchedulingIgnoredDuringExecution {
+			merged.PodAffinity.PreferredDuringSchedulingIgnoredDuringExecution = append(
+				merged.PodAffinity.PreferredDuringSchedulingIgnoredDuringExecution, *t.DeepCopy())
+		}
+	}
+	if b.PodAntiAffinity != nil {
+		if merged.PodAntiAffinity == nil {
+			merged.PodAntiAffinity = &corev1.PodAntiAffinity{}
+		}
+		for _, t := range b.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution {
+			merged.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution = append(
+				merged.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution, *t.DeepCopy())
+		}
+		for _, t := range b.PodAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution {
+			merged.PodAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution = append(
+				merged.PodAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution, *t.DeepCopy())
+		}
+	}
+	return merged
+}
+
+// mergeNodeSelector returns the node selector that requires both a and b.
+// The terms of a node selector are ORed, so the result consists of the pairwise unions
+// of the terms.
+func mergeNodeSelector(a, b *corev1.NodeSelector) *corev1.NodeSelector {
+	if b == nil {
+		return a
+	}
+	if a == nil {
+		return b.DeepCopy()
+	}
+	merged := &corev1.NodeSelector{}
+	for _, ta := range a.NodeSelectorTerms {
+		for _, tb := range b.NodeSelectorTerms {
+			var t corev1.NodeSelectorTerm
+			for _, r := range ta.MatchExpressions {
+				t.MatchExpressions = append(t.MatchExpressions, *r.DeepCopy())
+			}
+			for _, r := range tb.MatchExpressions {
+				t.MatchExpressions = append(t.MatchExpressions, *r.DeepCopy())
+			}
+			merged.NodeSelectorTerms = append(merged.NodeSelectorTerms, t)
+		}
+	}
+	return merged
+}
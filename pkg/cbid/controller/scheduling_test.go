@@ -0,0 +1,94 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+
+	cbiv1alpha1 "github.com/containerbuilding/cbi/pkg/apis/cbi/v1alpha1"
+)
+
+func TestApplyScheduling(t *testing.T) {
+	exists := func(key string) corev1.NodeSelectorRequirement {
+		return corev1.NodeSelectorRequirement{Key: key, Operator: corev1.NodeSelectorOpExists}
+	}
+	nodeAffinity := func(terms ...[]corev1.NodeSelectorRequirement) *corev1.Affinity {
+		sel := &corev1.NodeSelector{}
+		for _, t := range terms {
+			sel.NodeSelectorTerms = append(sel.NodeSelectorTerms, corev1.NodeSelectorTerm{MatchExpressions: t})
+		}
+		return &corev1.Affinity{NodeAffinity: &corev1.NodeAffinity{RequiredDuringSchedulingIgnoredDuringExecution: sel}}
+	}
+	cases := []struct {
+		plugin      corev1.PodSpec
+		spec        cbiv1alpha1.BuildJobSpec
+		expected    corev1.PodSpec
+		expectedErr bool
+	}{
+		{
+			plugin:   corev1.PodSpec{NodeSelector: map[string]string{"docker": "true"}},
+			expected: corev1.PodSpec{NodeSelector: map[string]string{"docker": "true"}},
+		},
+		{
+			plugin: corev1.PodSpec{NodeSelector: map[string]string{"docker": "true"}},
+			spec: cbiv1alpha1.BuildJobSpec{
+				NodeSelector: map[string]string{"docker": "true", "gpu": "true"},
+				Tolerations:  []corev1.Toleration{{Key: "build", Operator: corev1.TolerationOpExists}},
+			},
+			expected: corev1.PodSpec{
+				NodeSelector: map[string]string{"docker": "true", "gpu": "true"},
+				Tolerations:  []corev1.Toleration{{Key: "build", Operator: corev1.TolerationOpExists}},
+			},
+		},
+		{
+			plugin:      corev1.PodSpec{NodeSelector: map[string]string{"docker": "true"}},
+			spec:        cbiv1alpha1.BuildJobSpec{NodeSelector: map[string]string{"docker": "false"}},
+			expectedErr: true,
+		},
+		{
+			spec:     cbiv1alpha1.BuildJobSpec{Affinity: nodeAffinity([]corev1.NodeSelectorRequirement{exists("gpu")})},
+			expected: corev1.PodSpec{Affinity: nodeAffinity([]corev1.NodeSelectorRequirement{exists("gpu")})},
+		},
+		{
+			// (a || b) && c
+			plugin: corev1.PodSpec{Affinity: nodeAffinity([]corev1.NodeSelectorRequirement{exists("a")}, []corev1.NodeSelectorRequirement{exists("b")})},
+			spec:   cbiv1alpha1.BuildJobSpec{Affinity: nodeAffinity([]corev1.NodeSelectorRequirement{exists("c")})},
+			expected: corev1.PodSpec{Affinity: nodeAffinity(
+				[]corev1.NodeSelectorRequirement{exists("a"), exists("c")},
+				[]corev1.NodeSelectorRequirement{exists("b"), exists("c")})},
+		},
+	}
+	for i, c := range cases {
+		podSpec := *c.plugin.DeepCopy()
+		err := applyScheduling(&podSpec, c.spec)
+		if c.expectedErr {
+			if err == nil {
+				t.Fatalf("case %d: error is expected", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(podSpec, c.expected) {
+			t.Fatalf("case %d: expected %+v, got %+v", i, c.expected, podSpec)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// stalledInitContainer returns the name of the running init container for fetching the context
+// that has shown no progress for threshold before now, and the duration since the last progress.
+// The last progress is the start of the container or the time of the last log line,
+// returned by lastLogTime (zero when the container has no log).
+// The name is empty when no init container is stalled.
+func stalledInitContainer(pod *corev1.Pod, threshold time.Duration, now time.Time, lastLogTime func(container string) (time.Time, error)) (string, time.Duration, error) {
+	initStatuses, _ := splitBuildContainerStatus(pod)
+	for _, st := range initStatuses {
+		if st.State.Terminated != nil {
+			continue
+		}
+		r := st.State.Running
+		if r == nil {
+			// not started yet (e.g. pulling the image)
+			return "", 0, nil
+		}
+		last := r.StartedAt.Time
+		if now.Sub(last) < threshold {
+			return "", 0, nil
+		}
+		logTime, err := lastLogTime(st.Name)
+		if err != nil {
+			return "", 0, err
+		}
+		if logTime.After(last) {
+			last = logTime
+		}
+		if idle := now.Sub(last); idle >= threshold {
+			return st.Name, idle, nil
+		}
+		return "", 0, nil
+	}
+	return "", 0, nil
+}
+
+// parseLogTimestamp returns the timestamp of the last line of the log fetched with
+// PodLogOptions.Timestamps, or zero when the log is empty.
+func parseLogTimestamp(b []byte) (time.Time, error) {
+	s := strings.TrimRight(string(b), "\n")
+	if s == "" {
+		return time.Time{}, nil
+	}
+	lines := strings.Split(s, "\n")
+	ts := strings.SplitN(lines[len(lines)-1], " ", 2)[0]
+	return time.Parse(time.RFC3339Nano, ts)
+}
@@ -0,0 +1,127 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestStalledInitContainer(t *testing.T) {
+	now := time.Date(2018, 5, 1, 12, 0, 0, 0, time.UTC)
+	threshold := 5 * time.Minute
+	running := func(name string, startedAt time.Time) corev1.ContainerStatus {
+		return corev1.ContainerStatus{
+			Name:  name,
+			State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{StartedAt: metav1.NewTime(startedAt)}},
+		}
+	}
+	terminated := corev1.ContainerStatus{
+		Name:  "cbi-gitcontext-init",
+		State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 0}},
+	}
+	buildWaiting := corev1.ContainerStatus{
+		Name:  "build",
+		State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "PodInitializing"}},
+	}
+	cases := []struct {
+		name         string
+		initStatuses []corev1.ContainerStatus
+		logs         map[string]time.Time
+		expected     string
+		expectedIdle time.Duration
+	}{
+		{
+			name:         "started recently",
+			initStatuses: []corev1.ContainerStatus{running("cbi-gitcontext-init", now.Add(-time.Minute))},
+		},
+		{
+			name:         "logged recently",
+			initStatuses: []corev1.ContainerStatus{running("cbi-gitcontext-init", now.Add(-time.Hour))},
+			logs:         map[string]time.Time{"cbi-gitcontext-init": now.Add(-30 * time.Second)},
+		},
+		{
+			name:         "no log",
+			initStatuses: []corev1.ContainerStatus{running("cbi-gitcontext-init", now.Add(-10*time.Minute))},
+			expected:     "cbi-gitcontext-init",
+			expectedIdle: 10 * time.Minute,
+		},
+		{
+			name:         "logged long ago",
+			initStatuses: []corev1.ContainerStatus{terminated, running("cbi-cmcontext-init", now.Add(-time.Hour))},
+			logs:         map[string]time.Time{"cbi-cmcontext-init": now.Add(-6 * time.Minute)},
+			expected:     "cbi-cmcontext-init",
+			expectedIdle: 6 * time.Minute,
+		},
+		{
+			name:         "all terminated",
+			initStatuses: []corev1.ContainerStatus{terminated},
+		},
+	}
+	for _, c := range cases {
+		pod := &corev1.Pod{Status: corev1.PodStatus{
+			InitContainerStatuses: c.initStatuses,
+			ContainerStatuses:     []corev1.ContainerStatus{buildWaiting},
+		}}
+		lastLogTime := func(container string) (time.Time, error) {
+			if container == "build" {
+				return time.Time{}, fmt.Errorf("unexpected container %q", container)
+			}
+			return c.logs[container], nil
+		}
+		actual, idle, err := stalledInitContainer(pod, threshold, now, lastLogTime)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if actual != c.expected || idle != c.expectedIdle {
+			t.Fatalf("%s: expected %q (%v), got %q (%v)", c.name, c.expected, c.expectedIdle, actual, idle)
+		}
+	}
+}
+
+func TestParseLogTimestamp(t *testing.T) {
+	cases := []struct {
+		log      string
+		expected time.Time
+		invalid  bool
+	}{
+		{log: ""},
+		{
+			log:      "2018-05-01T12:00:00.123456789Z foo\n2018-05-01T12:00:30Z heartbeat: 42 bytes populated\n",
+			expected: time.Date(2018, 5, 1, 12, 0, 30, 0, time.UTC),
+		},
+		{log: "foo\n", invalid: true},
+	}
+	for _, c := range cases {
+		actual, err := parseLogTimestamp([]byte(c.log))
+		if err != nil && !c.invalid {
+			t.Fatalf("%q: %v", c.log, err)
+		}
+		if err == nil {
+			if c.invalid {
+				t.Fatalf("%q: error is expected", c.log)
+			}
+			if !actual.Equal(c.expected) {
+				t.Fatalf("%q: expected %v, got %v", c.log, c.expected, actual)
+			}
+		}
+	}
+}
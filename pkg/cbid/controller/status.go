@@ -0,0 +1,246 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+
+	cbiv1alpha1 "github.com/containerbuilding/cbi/pkg/apis/cbi/v1alpha1"
+	api "github.com/containerbuilding/cbi/pkg/plugin/api"
+)
+
+// setBuildJobCondition adds or replaces the condition of the same type.
+// LastTransitionTime is kept when the status is not changed.
+func setBuildJobCondition(status *cbiv1alpha1.BuildJobStatus, cond cbiv1alpha1.BuildJobCondition) {
+	for i, c := range status.Conditions {
+		if c.Type != cond.Type {
+			continue
+		}
+		if c.Status == cond.Status {
+			cond.LastTransitionTime = c.LastTransitionTime
+		}
+		status.Conditions[i] = cond
+		return
+	}
+	status.Conditions = append(status.Conditions, cond)
+}
+
+// updateBuildJobConditions reflects the conditions of the job and its pods to status.
+func updateBuildJobConditions(status *cbiv1alpha1.BuildJobStatus, buildJob *cbiv1alpha1.BuildJob, job *batchv1.Job, pods []*corev1.Pod) {
+	if pod := latestPod(pods); pod != nil {
+		updatePodConditions(status, pod)
+	}
+	for _, c := range job.Status.Conditions {
+		switch c.Type {
+		case batchv1.JobComplete:
+			setBuildJobCondition(status, cbiv1alpha1.BuildJobCondition{
+				Type:               cbiv1alpha1.BuildJobComplete,
+				Status:             c.Status,
+				LastTransitionTime: c.LastTransitionTime,
+				Reason:             c.Reason,
+				Message:            c.Message,
+			})
+			if buildJob.Spec.Registry.Push && c.Status == corev1.ConditionTrue {
+				setBuildJobCondition(status, cbiv1alpha1.BuildJobCondition{
+					Type:               cbiv1alpha1.BuildJobPushed,
+					Status:             corev1.ConditionTrue,
+					LastTransitionTime: c.LastTransitionTime,
+				})
+			}
+		case batchv1.JobFailed:
+			// e.g. DeadlineExceeded when Spec.Timeout elapsed
+			setBuildJobCondition(status, cbiv1alpha1.BuildJobCondition{
+				Type:               cbiv1alpha1.BuildJobFailed,
+				Status:             c.Status,
+				LastTransitionTime: c.LastTransitionTime,
+				Reason:             c.Reason,
+				Message:            c.Message,
+			})
+		}
+	}
+}
+
+// updatePodConditions reflects the container statuses of the pod to the
+// ContextFetched and Building conditions.
+func updatePodConditions(status *cbiv1alpha1.BuildJobStatus, pod *corev1.Pod) {
+	initStatuses, build := splitBuildContainerStatus(pod)
+	fetched := true
+	for _, st := range initStatuses {
+		t := st.State.Terminated
+		if t == nil {
+			if r := st.State.Running; r != nil && fetched {
+				setBuildJobCondition(status, cbiv1alpha1.BuildJobCondition{
+					Type:               cbiv1alpha1.BuildJobContextFetched,
+					Status:             corev1.ConditionFalse,
+					LastTransitionTime: r.StartedAt,
+					Reason:             "Fetching",
+					Message:            fmt.Sprintf("init container %q is running", st.Name),
+				})
+			}
+			fetched = false
+			continue
+		}
+		if t.ExitCode != 0 {
+			setBuildJobCondition(status, cbiv1alpha1.BuildJobCondition{
+				Type:               cbiv1alpha1.BuildJobContextFetched,
+				Status:             corev1.ConditionFalse,
+				LastTransitionTime: t.FinishedAt,
+				Reason:             "InitContainerFailed",
+				Message:            fmt.Sprintf("init container %q exited with status %d: %s", st.Name, t.ExitCode, t.Reason),
+			})
+			return
+		}
+	}
+	if build == nil {
+		return
+	}
+	st := *build
+	switch {
+	case st.State.Running != nil:
+		if fetched {
+			setBuildJobCondition(status, cbiv1alpha1.BuildJobCondition{
+				Type:               cbiv1alpha1.BuildJobContextFetched,
+				Status:             corev1.ConditionTrue,
+				LastTransitionTime: st.State.Running.StartedAt,
+			})
+		}
+		setBuildJobCondition(status, cbiv1alpha1.BuildJobCondition{
+			Type:               cbiv1alpha1.BuildJobBuilding,
+			Status:             corev1.ConditionTrue,
+			LastTransitionTime: st.State.Running.StartedAt,
+		})
+	case st.State.Terminated != nil:
+		t := st.State.Terminated
+		if fetched {
+			setBuildJobCondition(status, cbiv1alpha1.BuildJobCondition{
+				Type:               cbiv1alpha1.BuildJobContextFetched,
+				Status:             corev1.ConditionTrue,
+				LastTransitionTime: t.StartedAt,
+			})
+		}
+		setBuildJobCondition(status, cbiv1alpha1.BuildJobCondition{
+			Type:               cbiv1alpha1.BuildJobBuilding,
+			Status:             corev1.ConditionFalse,
+			LastTransitionTime: t.FinishedAt,
+			Reason:             t.Reason,
+		})
+	}
+}
+
+// splitBuildContainerStatus returns the statuses of the init containers for fetching the context,
+// and the status of the build container, which may be nil.
+// The build container is the first container, or the last init container when the archive is
+// exported by api.ExportContainerName for Spec.Output.
+func splitBuildContainerStatus(pod *corev1.Pod) ([]corev1.ContainerStatus, *corev1.ContainerStatus) {
+	initStatuses := pod.Status.InitContainerStatuses
+	statuses := pod.Status.ContainerStatuses
+	if len(statuses) == 0 {
+		return initStatuses, nil
+	}
+	if statuses[0].Name == api.ExportContainerName && len(initStatuses) > 0 {
+		n := len(initStatuses) - 1
+		return initStatuses[:n], &initStatuses[n]
+	}
+	return initStatuses, &statuses[0]
+}
+
+// findBuildJobCondition returns the condition of the type, or nil.
+func findBuildJobCondition(status *cbiv1alpha1.BuildJobStatus, typ cbiv1alpha1.BuildJobConditionType) *cbiv1alpha1.BuildJobCondition {
+	for i := range status.Conditions {
+		if status.Conditions[i].Type == typ {
+			return &status.Conditions[i]
+		}
+	}
+	return nil
+}
+
+// contextFetchEvent returns the event for the transition of the ContextFetched condition
+// from oldStatus to newStatus. reason is empty when no event needs to be recorded.
+func contextFetchEvent(oldStatus, newStatus *cbiv1alpha1.BuildJobStatus) (eventType, reason, message string) {
+	cond := findBuildJobCondition(newStatus, cbiv1alpha1.BuildJobContextFetched)
+	if cond == nil {
+		return "", "", ""
+	}
+	old := findBuildJobCondition(oldStatus, cbiv1alpha1.BuildJobContextFetched)
+	if old != nil && old.Status == cond.Status && old.Reason == cond.Reason {
+		return "", "", ""
+	}
+	switch {
+	case cond.Status == corev1.ConditionTrue:
+		return corev1.EventTypeNormal, ContextFetchCompleted, MessageContextFetchCompleted
+	case cond.Reason == "Fetching":
+		return corev1.EventTypeNormal, ContextFetchStarted, cond.Message
+	default:
+		return corev1.EventTypeWarning, ContextFetchFailed, cond.Message
+	}
+}
+
+// pushRetryEventMessage returns the message of the PushRetried event when newStatus reports
+// more push retries than oldStatus. The message is empty when no event needs to be recorded.
+func pushRetryEventMessage(oldStatus, newStatus *cbiv1alpha1.BuildJobStatus) string {
+	if newStatus.PushRetries <= oldStatus.PushRetries {
+		return ""
+	}
+	return fmt.Sprintf("Pushed after %d retries", newStatus.PushRetries)
+}
+
+// updateBuildJobTimes reflects the start time and the completion time of the job to status.
+// The previous values are kept when the job does not have them.
+func updateBuildJobTimes(status *cbiv1alpha1.BuildJobStatus, job *batchv1.Job) {
+	if job.Status.StartTime != nil {
+		status.StartTime = job.Status.StartTime.DeepCopy()
+	}
+	if job.Status.CompletionTime != nil {
+		status.CompletionTime = job.Status.CompletionTime.DeepCopy()
+		return
+	}
+	// CompletionTime of the job is only set on success
+	for _, c := range job.Status.Conditions {
+		if c.Type == batchv1.JobFailed && c.Status == corev1.ConditionTrue {
+			status.CompletionTime = c.LastTransitionTime.DeepCopy()
+		}
+	}
+}
+
+// latestPod returns the most recently created pod, or nil.
+func latestPod(pods []*corev1.Pod) *corev1.Pod {
+	var latest *corev1.Pod
+	for _, pod := range pods {
+		if latest == nil || latest.CreationTimestamp.Before(&pod.CreationTimestamp) {
+			latest = pod
+		}
+	}
+	return latest
+}
+
+// setSelectedPlugin reflects the plugin info to status.
+// info may be nil when no plugin was selected.
+func setSelectedPlugin(status *cbiv1alpha1.BuildJobStatus, info *api.InfoResponse) {
+	if info == nil {
+		status.SelectedPlugin = ""
+		status.SelectedPluginLabels = nil
+		return
+	}
+	status.SelectedPlugin = info.Labels[api.LPluginName]
+	status.SelectedPluginLabels = make(map[string]string, len(info.Labels))
+	for k, v := range info.Labels {
+		status.SelectedPluginLabels[k] = v
+	}
+}
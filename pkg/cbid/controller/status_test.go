@@ -0,0 +1,232 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"testing"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	cbiv1alpha1 "github.com/containerbuilding/cbi/pkg/apis/cbi/v1alpha1"
+	api "github.com/containerbuilding/cbi/pkg/plugin/api"
+)
+
+func TestUpdateBuildJobConditions(t *testing.T) {
+	terminated := func(code int32) corev1.ContainerState {
+		return corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: code}}
+	}
+	running := corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}
+	waiting := corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{}}
+	cases := []struct {
+		push     bool
+		job      batchv1.JobStatus
+		pod      corev1.PodStatus
+		expected map[cbiv1alpha1.BuildJobConditionType]corev1.ConditionStatus
+	}{
+		{
+			pod: corev1.PodStatus{
+				InitContainerStatuses: []corev1.ContainerStatus{{State: running}},
+				ContainerStatuses:     []corev1.ContainerStatus{{State: waiting}},
+			},
+			expected: map[cbiv1alpha1.BuildJobConditionType]corev1.ConditionStatus{
+				cbiv1alpha1.BuildJobContextFetched: corev1.ConditionFalse,
+			},
+		},
+		{
+			pod: corev1.PodStatus{
+				InitContainerStatuses: []corev1.ContainerStatus{{State: waiting}},
+				ContainerStatuses:     []corev1.ContainerStatus{{State: waiting}},
+			},
+			expected: map[cbiv1alpha1.BuildJobConditionType]corev1.ConditionStatus{},
+		},
+		{
+			pod: corev1.PodStatus{
+				InitContainerStatuses: []corev1.ContainerStatus{{State: terminated(1)}},
+				ContainerStatuses:     []corev1.ContainerStatus{{State: waiting}},
+			},
+			expected: map[cbiv1alpha1.BuildJobConditionType]corev1.ConditionStatus{
+				cbiv1alpha1.BuildJobContextFetched: corev1.ConditionFalse,
+			},
+		},
+		{
+			pod: corev1.PodStatus{
+				InitContainerStatuses: []corev1.ContainerStatus{{State: terminated(0)}},
+				ContainerStatuses:     []corev1.ContainerStatus{{State: running}},
+			},
+			expected: map[cbiv1alpha1.BuildJobConditionType]corev1.ConditionStatus{
+				cbiv1alpha1.BuildJobContextFetched: corev1.ConditionTrue,
+				cbiv1alpha1.BuildJobBuilding:       corev1.ConditionTrue,
+			},
+		},
+		{
+			// the build container precedes the export container
+			pod: corev1.PodStatus{
+				InitContainerStatuses: []corev1.ContainerStatus{{State: terminated(0)}, {State: running}},
+				ContainerStatuses:     []corev1.ContainerStatus{{Name: api.ExportContainerName, State: waiting}},
+			},
+			expected: map[cbiv1alpha1.BuildJobConditionType]corev1.ConditionStatus{
+				cbiv1alpha1.BuildJobContextFetched: corev1.ConditionTrue,
+				cbiv1alpha1.BuildJobBuilding:       corev1.ConditionTrue,
+			},
+		},
+		{
+			pod: corev1.PodStatus{
+				InitContainerStatuses: []corev1.ContainerStatus{{State: terminated(0)}, {State: terminated(0)}},
+				ContainerStatuses:     []corev1.ContainerStatus{{Name: api.ExportContainerName, State: running}},
+			},
+			expected: map[cbiv1alpha1.BuildJobConditionType]corev1.ConditionStatus{
+				cbiv1alpha1.BuildJobContextFetched: corev1.ConditionTrue,
+				cbiv1alpha1.BuildJobBuilding:       corev1.ConditionFalse,
+			},
+		},
+		{
+			push: true,
+			job: batchv1.JobStatus{
+				Conditions: []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}},
+			},
+			pod: corev1.PodStatus{
+				ContainerStatuses: []corev1.ContainerStatus{{State: terminated(0)}},
+			},
+			expected: map[cbiv1alpha1.BuildJobConditionType]corev1.ConditionStatus{
+				cbiv1alpha1.BuildJobContextFetched: corev1.ConditionTrue,
+				cbiv1alpha1.BuildJobBuilding:       corev1.ConditionFalse,
+				cbiv1alpha1.BuildJobPushed:         corev1.ConditionTrue,
+				cbiv1alpha1.BuildJobComplete:       corev1.ConditionTrue,
+			},
+		},
+		{
+			job: batchv1.JobStatus{
+				Conditions: []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: corev1.ConditionTrue}},
+			},
+			pod: corev1.PodStatus{
+				ContainerStatuses: []corev1.ContainerStatus{{State: terminated(1)}},
+			},
+			expected: map[cbiv1alpha1.BuildJobConditionType]corev1.ConditionStatus{
+				cbiv1alpha1.BuildJobContextFetched: corev1.ConditionTrue,
+				cbiv1alpha1.BuildJobBuilding:       corev1.ConditionFalse,
+				cbiv1alpha1.BuildJobFailed:         corev1.ConditionTrue,
+			},
+		},
+	}
+	for i, c := range cases {
+		buildJob := &cbiv1alpha1.BuildJob{}
+		buildJob.Spec.Registry.Push = c.push
+		job := &batchv1.Job{Status: c.job}
+		pods := []*corev1.Pod{{Status: c.pod}}
+		var status cbiv1alpha1.BuildJobStatus
+		updateBuildJobConditions(&status, buildJob, job, pods)
+		actual := make(map[cbiv1alpha1.BuildJobConditionType]corev1.ConditionStatus)
+		for _, cond := range status.Conditions {
+			actual[cond.Type] = cond.Status
+		}
+		if len(actual) != len(c.expected) {
+			t.Fatalf("case %d: expected %v, got %v", i, c.expected, actual)
+		}
+		for k, v := range c.expected {
+			if actual[k] != v {
+				t.Fatalf("case %d: expected %v, got %v", i, c.expected, actual)
+			}
+		}
+	}
+}
+
+func TestUpdateBuildJobTimes(t *testing.T) {
+	start := metav1.NewTime(time.Unix(100, 0))
+	end := metav1.NewTime(time.Unix(200, 0))
+	cases := []struct {
+		job                batchv1.JobStatus
+		expectedCompletion *metav1.Time
+	}{
+		{
+			job: batchv1.JobStatus{StartTime: &start},
+		},
+		{
+			job:                batchv1.JobStatus{StartTime: &start, CompletionTime: &end},
+			expectedCompletion: &end,
+		},
+		{
+			job: batchv1.JobStatus{
+				StartTime:  &start,
+				Conditions: []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, LastTransitionTime: end}},
+			},
+			expectedCompletion: &end,
+		},
+	}
+	for i, c := range cases {
+		var status cbiv1alpha1.BuildJobStatus
+		updateBuildJobTimes(&status, &batchv1.Job{Status: c.job})
+		if status.StartTime == nil || !status.StartTime.Equal(&start) {
+			t.Fatalf("case %d: expected start time %v, got %v", i, start, status.StartTime)
+		}
+		if c.expectedCompletion == nil {
+			if status.CompletionTime != nil {
+				t.Fatalf("case %d: expected no completion time, got %v", i, status.CompletionTime)
+			}
+		} else if status.CompletionTime == nil || !status.CompletionTime.Equal(c.expectedCompletion) {
+			t.Fatalf("case %d: expected completion time %v, got %v", i, c.expectedCompletion, status.CompletionTime)
+		}
+	}
+}
+
+func TestContextFetchEvent(t *testing.T) {
+	fetching := cbiv1alpha1.BuildJobCondition{Type: cbiv1alpha1.BuildJobContextFetched, Status: corev1.ConditionFalse, Reason: "Fetching"}
+	failed := cbiv1alpha1.BuildJobCondition{Type: cbiv1alpha1.BuildJobContextFetched, Status: corev1.ConditionFalse, Reason: "InitContainerFailed"}
+	fetched := cbiv1alpha1.BuildJobCondition{Type: cbiv1alpha1.BuildJobContextFetched, Status: corev1.ConditionTrue}
+	building := cbiv1alpha1.BuildJobCondition{Type: cbiv1alpha1.BuildJobBuilding, Status: corev1.ConditionTrue}
+	cases := []struct {
+		old      []cbiv1alpha1.BuildJobCondition
+		new      []cbiv1alpha1.BuildJobCondition
+		expected string
+	}{
+		{},
+		{new: []cbiv1alpha1.BuildJobCondition{fetching}, expected: ContextFetchStarted},
+		{old: []cbiv1alpha1.BuildJobCondition{fetching}, new: []cbiv1alpha1.BuildJobCondition{fetching}},
+		{old: []cbiv1alpha1.BuildJobCondition{fetching}, new: []cbiv1alpha1.BuildJobCondition{fetched, building}, expected: ContextFetchCompleted},
+		{new: []cbiv1alpha1.BuildJobCondition{fetched}, expected: ContextFetchCompleted},
+		{old: []cbiv1alpha1.BuildJobCondition{fetched}, new: []cbiv1alpha1.BuildJobCondition{fetched, building}},
+		{old: []cbiv1alpha1.BuildJobCondition{fetching}, new: []cbiv1alpha1.BuildJobCondition{failed}, expected: ContextFetchFailed},
+		{old: []cbiv1alpha1.BuildJobCondition{failed}, new: []cbiv1alpha1.BuildJobCondition{failed}},
+	}
+	for i, c := range cases {
+		_, reason, _ := contextFetchEvent(&cbiv1alpha1.BuildJobStatus{Conditions: c.old}, &cbiv1alpha1.BuildJobStatus{Conditions: c.new})
+		if reason != c.expected {
+			t.Fatalf("case %d: expected %q, got %q", i, c.expected, reason)
+		}
+	}
+}
+
+func TestPushRetryEventMessage(t *testing.T) {
+	cases := []struct {
+		old      int32
+		new      int32
+		expected string
+	}{
+		{},
+		{new: 2, expected: "Pushed after 2 retries"},
+		{old: 2, new: 2},
+		{old: 1, new: 3, expected: "Pushed after 3 retries"},
+	}
+	for i, c := range cases {
+		actual := pushRetryEventMessage(&cbiv1alpha1.BuildJobStatus{PushRetries: c.old}, &cbiv1alpha1.BuildJobStatus{PushRetries: c.new})
+		if actual != c.expected {
+			t.Fatalf("case %d: expected %q, got %q", i, c.expected, actual)
+		}
+	}
+}
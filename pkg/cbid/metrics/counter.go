@@ -0,0 +1,67 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"fmt"
+	"io"
+)
+
+// CounterVec is a counter partitioned by the label values.
+type CounterVec struct {
+	metricVec
+}
+
+// NewCounterVec returns a new counter. The name SHOULD end with "_total".
+func NewCounterVec(name, help string, labelNames ...string) *CounterVec {
+	return &CounterVec{metricVec: newMetricVec(name, help, labelNames)}
+}
+
+// Inc increments the counter for the label values.
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds delta, which must not be negative, to the counter for the label values.
+func (c *CounterVec) Add(delta float64, labelValues ...string) {
+	if delta < 0 {
+		panic(fmt.Sprintf("metric %q: counter cannot decrease", c.metricName))
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	p := c.get(labelValues, func() interface{} { return new(float64) }).(*float64)
+	*p += delta
+}
+
+// Value returns the value of the counter for the label values.
+func (c *CounterVec) Value(labelValues ...string) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if p, ok := c.lookup(labelValues).(*float64); ok {
+		return *p
+	}
+	return 0
+}
+
+func (c *CounterVec) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.writeHeader(w, "counter")
+	for _, k := range c.sortedKeys() {
+		fmt.Fprintf(w, "%s%s %s\n", c.metricName, formatLabels(c.labelNames, c.labels[k], ""), formatFloat(*c.values[k].(*float64)))
+	}
+}
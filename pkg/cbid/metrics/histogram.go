@@ -0,0 +1,98 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+)
+
+// DefBuckets are the default buckets in seconds, suitable for the durations of fetching
+// the contexts and building the images.
+var DefBuckets = []float64{1, 5, 10, 30, 60, 120, 300, 600, 1800, 3600}
+
+// HistogramVec is a histogram partitioned by the label values.
+type HistogramVec struct {
+	metricVec
+	buckets []float64
+}
+
+type histogram struct {
+	// counts are not cumulative
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// NewHistogramVec returns a new histogram with the upper bounds of the buckets.
+// DefBuckets is used when buckets is empty.
+func NewHistogramVec(name, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	if len(buckets) == 0 {
+		buckets = DefBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	return &HistogramVec{metricVec: newMetricVec(name, help, labelNames), buckets: buckets}
+}
+
+func (h *HistogramVec) histogram(labelValues []string) *histogram {
+	return h.get(labelValues, func() interface{} {
+		return &histogram{counts: make([]uint64, len(h.buckets))}
+	}).(*histogram)
+}
+
+// Observe adds v to the histogram for the label values.
+func (h *HistogramVec) Observe(v float64, labelValues ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	x := h.histogram(labelValues)
+	if i := sort.SearchFloat64s(h.buckets, v); i < len(h.buckets) {
+		x.counts[i]++
+	}
+	x.count++
+	x.sum += v
+}
+
+// Count returns the number of the observations for the label values.
+func (h *HistogramVec) Count(labelValues ...string) uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if x, ok := h.lookup(labelValues).(*histogram); ok {
+		return x.count
+	}
+	return 0
+}
+
+func (h *HistogramVec) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.writeHeader(w, "histogram")
+	for _, k := range h.sortedKeys() {
+		x := h.values[k].(*histogram)
+		labelValues := h.labels[k]
+		var cumulative uint64
+		for i, b := range h.buckets {
+			cumulative += x.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.metricName, formatLabels(h.labelNames, labelValues, `le="`+formatFloat(b)+`"`), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.metricName, formatLabels(h.labelNames, labelValues, `le="`+formatFloat(math.Inf(+1))+`"`), x.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.metricName, formatLabels(h.labelNames, labelValues, ""), formatFloat(x.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.metricName, formatLabels(h.labelNames, labelValues, ""), x.count)
+	}
+}
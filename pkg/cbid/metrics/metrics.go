@@ -0,0 +1,193 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package metrics implements a minimal set of Prometheus metrics (counters and histograms),
+// exposed in the Prometheus text format.
+//
+// The Prometheus client library is not vendored, so only the features needed by cbid are implemented.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Collector is a metric family that can be registered to Registry.
+type Collector interface {
+	// write writes the metric family in the Prometheus text format.
+	write(w io.Writer)
+	name() string
+}
+
+// Registry is a set of metric families.
+// Registry implements http.Handler for the `/metrics` endpoint.
+type Registry struct {
+	mu         sync.Mutex
+	collectors []Collector
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// MustRegister registers the collectors, and panics if a collector with the same name is
+// already registered.
+func (r *Registry) MustRegister(cs ...Collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, c := range cs {
+		for _, existing := range r.collectors {
+			if existing.name() == c.name() {
+				panic(fmt.Sprintf("duplicate metric %q", c.name()))
+			}
+		}
+		r.collectors = append(r.collectors, c)
+	}
+}
+
+// WriteText writes all the metric families in the Prometheus text format, sorted by name.
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	cs := append([]Collector(nil), r.collectors...)
+	r.mu.Unlock()
+	sort.Slice(cs, func(i, j int) bool { return cs[i].name() < cs[j].name() })
+	bw := bufio.NewWriter(w)
+	for _, c := range cs {
+		c.write(bw)
+	}
+	return bw.Flush()
+}
+
+// ServeHTTP implements http.Handler.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	r.WriteText(w)
+}
+
+// metricVec holds the values of a metric family, keyed by the label values.
+type metricVec struct {
+	metricName string
+	help       string
+	labelNames []string
+	mu         sync.Mutex
+	values     map[string]interface{}
+	labels     map[string][]string
+}
+
+func newMetricVec(name, help string, labelNames []string) metricVec {
+	return metricVec{
+		metricName: name,
+		help:       help,
+		labelNames: labelNames,
+		values:     make(map[string]interface{}),
+		labels:     make(map[string][]string),
+	}
+}
+
+func (v *metricVec) name() string {
+	return v.metricName
+}
+
+func (v *metricVec) key(labelValues []string) string {
+	if len(labelValues) != len(v.labelNames) {
+		panic(fmt.Sprintf("metric %q: expected %d label values, got %d", v.metricName, len(v.labelNames), len(labelValues)))
+	}
+	return strings.Join(labelValues, "\xff")
+}
+
+// lookup returns the value for labelValues, or nil.
+// v.mu needs to be held.
+func (v *metricVec) lookup(labelValues []string) interface{} {
+	return v.values[v.key(labelValues)]
+}
+
+// get returns the value for labelValues, creating it with newValue if missing.
+// v.mu needs to be held.
+func (v *metricVec) get(labelValues []string, newValue func() interface{}) interface{} {
+	key := v.key(labelValues)
+	x, ok := v.values[key]
+	if !ok {
+		x = newValue()
+		v.values[key] = x
+		v.labels[key] = append([]string(nil), labelValues...)
+	}
+	return x
+}
+
+// sortedKeys returns the keys of the values, sorted for the deterministic output.
+// v.mu needs to be held.
+func (v *metricVec) sortedKeys() []string {
+	keys := make([]string, 0, len(v.values))
+	for k := range v.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (v *metricVec) writeHeader(w io.Writer, typ string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", v.metricName, escapeHelp(v.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", v.metricName, typ)
+}
+
+// formatLabels returns `{name="value",...}`, or an empty string for no labels.
+// extra is appended as-is, e.g. `le="0.5"`.
+func formatLabels(names, values []string, extra string) string {
+	var pairs []string
+	for i, n := range names {
+		pairs = append(pairs, n+`="`+escapeLabelValue(values[i])+`"`)
+	}
+	if extra != "" {
+		pairs = append(pairs, extra)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+var (
+	helpReplacer       = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelValueReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string {
+	return helpReplacer.Replace(s)
+}
+
+func escapeLabelValue(s string) string {
+	return labelValueReplacer.Replace(s)
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, +1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	case math.IsNaN(f):
+		return "NaN"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
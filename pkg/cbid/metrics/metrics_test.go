@@ -0,0 +1,81 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	c := NewCounterVec("cbi_test_total", "Test counter.", "plugin")
+	h := NewHistogramVec("cbi_test_duration_seconds", "Test histogram.", []float64{10, 1}, "plugin")
+	r.MustRegister(c, h)
+	c.Inc("docker")
+	c.Inc("docker")
+	c.Add(3, `weird"plugin`)
+	h.Observe(0.5, "docker")
+	h.Observe(1, "docker")
+	h.Observe(42, "docker")
+	if v := c.Value("docker"); v != 2 {
+		t.Fatalf("expected 2, got %v", v)
+	}
+	if v := c.Value("buildkit"); v != 0 {
+		t.Fatalf("expected 0, got %v", v)
+	}
+	if n := h.Count("docker"); n != 3 {
+		t.Fatalf("expected 3, got %d", n)
+	}
+	expected := `# HELP cbi_test_duration_seconds Test histogram.
+# TYPE cbi_test_duration_seconds histogram
+cbi_test_duration_seconds_bucket{plugin="docker",le="1"} 2
+cbi_test_duration_seconds_bucket{plugin="docker",le="10"} 2
+cbi_test_duration_seconds_bucket{plugin="docker",le="+Inf"} 3
+cbi_test_duration_seconds_sum{plugin="docker"} 43.5
+cbi_test_duration_seconds_count{plugin="docker"} 3
+# HELP cbi_test_total Test counter.
+# TYPE cbi_test_total counter
+cbi_test_total{plugin="docker"} 2
+cbi_test_total{plugin="weird\"plugin"} 3
+`
+	var b bytes.Buffer
+	if err := r.WriteText(&b); err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != expected {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expected, b.String())
+	}
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Body.String() != expected {
+		t.Fatalf("unexpected body: %s", rec.Body.String())
+	}
+}
+
+func TestRegistryDuplicate(t *testing.T) {
+	r := NewRegistry()
+	r.MustRegister(NewCounterVec("cbi_test_total", "Test counter."))
+	defer func() {
+		if recover() == nil {
+			t.Fatal("panic is expected for the duplicate metric")
+		}
+	}()
+	r.MustRegister(NewCounterVec("cbi_test_total", "Test counter."))
+}
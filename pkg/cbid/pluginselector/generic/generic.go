@@ -18,6 +18,7 @@ package generic
 
 import (
 	"fmt"
+	"sort"
 
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/selection"
@@ -27,31 +28,50 @@ import (
 )
 
 func defaultRequirements(bj crd.BuildJob) ([]labels.Requirement, error) {
-	var requirements []labels.Requirement
-	r, err := labels.NewRequirement(api.LLanguage(bj.Spec.Language.Kind), selection.Exists, nil)
-	if err != nil {
-		return nil, err
+	return existsRequirements(api.DefaultSelectorLabels(bj.Spec))
+}
+
+func capabilityRequirements(bj crd.BuildJob) ([]labels.Requirement, error) {
+	return existsRequirements(api.CapabilityLabels(bj.Spec))
+}
+
+func existsRequirements(set labels.Set) ([]labels.Requirement, error) {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
 	}
-	requirements = append(requirements, *r)
-	r, err = labels.NewRequirement(api.LContext(bj.Spec.Context.Kind), selection.Exists, nil)
-	if err != nil {
-		return nil, err
+	sort.Strings(keys)
+	var requirements []labels.Requirement
+	for _, k := range keys {
+		r, err := labels.NewRequirement(k, selection.Exists, nil)
+		if err != nil {
+			return nil, err
+		}
+		requirements = append(requirements, *r)
 	}
-	requirements = append(requirements, *r)
 	return requirements, nil
 }
 
-func labelsSelector(bj crd.BuildJob) (labels.Selector, error) {
+func labelsSelector(bj crd.BuildJob, withCapabilities bool) (labels.Selector, error) {
 	sel := labels.NewSelector()
 	reqs, err := defaultRequirements(bj)
 	if err != nil {
 		return nil, err
 	}
 	sel = sel.Add(reqs...)
+	if withCapabilities {
+		reqs, err = capabilityRequirements(bj)
+		if err != nil {
+			return nil, err
+		}
+		sel = sel.Add(reqs...)
+	}
 	if s := bj.Spec.PluginSelector; s != "" {
+		// supports both equality-based and set-based requirements,
+		// e.g. `plugin.name in (buildkit,kaniko), !example.com/experimental`
 		reqs, err = labels.ParseToRequirements(s)
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("invalid Spec.PluginSelector %q: %v", s, err)
 		}
 		sel = sel.Add(reqs...)
 	}
@@ -59,15 +79,48 @@ func labelsSelector(bj crd.BuildJob) (labels.Selector, error) {
 }
 
 func SelectPlugin(plugins []api.InfoResponse, bj crd.BuildJob) (int, error) {
-	sel, err := labelsSelector(bj)
+	sel, err := labelsSelector(bj, true)
 	if err != nil {
 		return -1, err
 	}
+	required := api.RequiredAPIVersion(bj.Spec)
+	var incompatible []string
 	for idx, info := range plugins {
-		lbls := labels.Set(info.Labels)
-		if sel.Matches(lbls) {
-			return idx, nil
+		if !sel.Matches(labels.Set(info.Labels)) {
+			continue
+		}
+		if v, err := api.PluginAPIVersion(info.Labels); err != nil || v < required {
+			incompatible = append(incompatible, info.Labels[api.LPluginName])
+			continue
+		}
+		return idx, nil
+	}
+	if len(incompatible) > 0 {
+		return -1, fmt.Errorf("no plugin can handle %s: plugin API version %d is required, but the plugins %v do not support it", bj.Name, required, incompatible)
+	}
+	if caps := api.CapabilityLabels(bj.Spec); len(caps) > 0 {
+		// distinguish missing capabilities from unsupported language, context, or selector
+		selWithoutCaps, err := labelsSelector(bj, false)
+		if err != nil {
+			return -1, err
+		}
+		if matchPlugin(plugins, selWithoutCaps) >= 0 {
+			keys := make([]string, 0, len(caps))
+			for k := range caps {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			return -1, fmt.Errorf("no plugin can handle %s: no plugin supports the capabilities %v", bj.Name, keys)
 		}
 	}
 	return -1, fmt.Errorf("no plugin can handle %s", bj.Name)
 }
+
+func matchPlugin(plugins []api.InfoResponse, sel labels.Selector) int {
+	for idx, info := range plugins {
+		if sel.Matches(labels.Set(info.Labels)) {
+			return idx
+		}
+	}
+	return -1
+}
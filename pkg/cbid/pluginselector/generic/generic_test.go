@@ -50,12 +50,65 @@ func TestSelectPlugin(t *testing.T) {
 				api.LContext(crd.ContextKindGit):          "",
 			},
 		},
+		{
+			// 3
+			Labels: map[string]string{
+				api.LPluginName:                           "baz",
+				api.LLanguage(crd.LanguageKindDockerfile): "",
+				api.LContext(crd.ContextKindGit):          "",
+				"example.com/experimental":                "",
+			},
+		},
+		{
+			// 4
+			Labels: map[string]string{
+				api.LPluginName:                      "qux",
+				api.LLanguage(crd.LanguageKindBazel): "",
+				api.LContext(crd.ContextKindGit):     "",
+			},
+		},
+		{
+			// 5
+			Labels: map[string]string{
+				api.LPluginName:                           "pack",
+				api.LLanguage(crd.LanguageKindBuildpacks): "",
+				api.LContext(crd.ContextKindGit):          "",
+			},
+		},
+		{
+			// 6
+			Labels: map[string]string{
+				api.LPluginName:                           "baz",
+				api.LLanguage(crd.LanguageKindDockerfile): "",
+				api.LContext(crd.ContextKindGit):          "",
+				api.LRegistryInsecure:                     "",
+			},
+		},
+		{
+			// 7
+			Labels: map[string]string{
+				api.LPluginName:                           "bar",
+				api.LPluginAPIVersion:                     "2",
+				api.LLanguage(crd.LanguageKindDockerfile): "",
+				api.LContext(crd.ContextKindGit):          "",
+			},
+		},
+		{
+			// 8
+			Labels: map[string]string{
+				api.LPluginName:                           "baz",
+				api.LLanguage(crd.LanguageKindDockerfile): "",
+				api.LContext(crd.ContextKindGit):          "",
+				api.LBuildSquash:                          "",
+			},
+		},
 	}
 
 	testCases := []struct {
-		bj          crd.BuildJob
-		expected    int
-		expectedErr bool
+		bj             crd.BuildJob
+		expected       int
+		expectedErr    bool
+		expectedErrMsg string
 	}{
 		{
 			bj: crd.BuildJob{
@@ -123,12 +176,326 @@ func TestSelectPlugin(t *testing.T) {
 			},
 			expectedErr: true,
 		},
+		{
+			bj: crd.BuildJob{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "dummy3",
+				},
+				Spec: crd.BuildJobSpec{
+					Language: crd.Language{
+						Kind: crd.LanguageKindDockerfile,
+					},
+					Context: crd.Context{
+						Kind: crd.ContextKindGit,
+					},
+					PluginSelector: "plugin.name in (bar,baz)",
+				},
+			},
+			expected: 2,
+		},
+		{
+			bj: crd.BuildJob{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "dummy4",
+				},
+				Spec: crd.BuildJobSpec{
+					Language: crd.Language{
+						Kind: crd.LanguageKindDockerfile,
+					},
+					Context: crd.Context{
+						Kind: crd.ContextKindGit,
+					},
+					PluginSelector: "plugin.name notin (foo,bar)",
+				},
+			},
+			expected: 3,
+		},
+		{
+			bj: crd.BuildJob{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "dummy5",
+				},
+				Spec: crd.BuildJobSpec{
+					Language: crd.Language{
+						Kind: crd.LanguageKindDockerfile,
+					},
+					Context: crd.Context{
+						Kind: crd.ContextKindGit,
+					},
+					PluginSelector: "example.com/experimental",
+				},
+			},
+			expected: 3,
+		},
+		{
+			bj: crd.BuildJob{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "dummy6",
+				},
+				Spec: crd.BuildJobSpec{
+					Language: crd.Language{
+						Kind: crd.LanguageKindDockerfile,
+					},
+					Context: crd.Context{
+						Kind: crd.ContextKindGit,
+					},
+					PluginSelector: "plugin.name in (bar,baz), !example.com/experimental",
+				},
+			},
+			expected: 2,
+		},
+		{
+			bj: crd.BuildJob{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "dummy7",
+				},
+				Spec: crd.BuildJobSpec{
+					Language: crd.Language{
+						Kind: crd.LanguageKindDockerfile,
+					},
+					Context: crd.Context{
+						Kind: crd.ContextKindGit,
+					},
+					PluginSelector: "plugin.name in (foo,baz), plugin.name != foo",
+				},
+			},
+			expected: 3,
+		},
+		{
+			bj: crd.BuildJob{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "dummy8",
+				},
+				Spec: crd.BuildJobSpec{
+					Language: crd.Language{
+						Kind: crd.LanguageKindDockerfile,
+					},
+					Context: crd.Context{
+						Kind: crd.ContextKindGit,
+					},
+					PluginSelector: "plugin.name notin (foo,bar,baz)",
+				},
+			},
+			expectedErr: true,
+		},
+		{
+			bj: crd.BuildJob{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "dummy9",
+				},
+				Spec: crd.BuildJobSpec{
+					Language: crd.Language{
+						Kind: crd.LanguageKindDockerfile,
+					},
+					Context: crd.Context{
+						Kind: crd.ContextKindGit,
+					},
+					PluginSelector: "plugin.name in (bar",
+				},
+			},
+			expectedErr: true,
+		},
+		{
+			bj: crd.BuildJob{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "dummy10",
+				},
+				Spec: crd.BuildJobSpec{
+					Language: crd.Language{
+						Kind: crd.LanguageKindBazel,
+					},
+					Context: crd.Context{
+						Kind: crd.ContextKindGit,
+					},
+				},
+			},
+			expected: 4,
+		},
+		{
+			bj: crd.BuildJob{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "dummy11",
+				},
+				Spec: crd.BuildJobSpec{
+					Language: crd.Language{
+						Kind: crd.LanguageKindBuildpacks,
+					},
+					Context: crd.Context{
+						Kind: crd.ContextKindGit,
+					},
+				},
+			},
+			expected: 5,
+		},
+		{
+			bj: crd.BuildJob{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "dummy12",
+				},
+				Spec: crd.BuildJobSpec{
+					Registry: crd.Registry{
+						Insecure: true,
+					},
+					Language: crd.Language{
+						Kind: crd.LanguageKindDockerfile,
+					},
+					Context: crd.Context{
+						Kind: crd.ContextKindGit,
+					},
+				},
+			},
+			expected: 6,
+		},
+		{
+			bj: crd.BuildJob{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "dummy13",
+				},
+				Spec: crd.BuildJobSpec{
+					Registry: crd.Registry{
+						Insecure:          true,
+						AdditionalTargets: []string{"example.com/foo"},
+					},
+					Language: crd.Language{
+						Kind: crd.LanguageKindDockerfile,
+					},
+					Context: crd.Context{
+						Kind: crd.ContextKindGit,
+					},
+				},
+			},
+			expectedErr:    true,
+			expectedErrMsg: "no plugin can handle dummy13: no plugin supports the capabilities [registry.insecure registry.multi-target]",
+		},
+		{
+			bj: crd.BuildJob{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "dummy14",
+				},
+				Spec: crd.BuildJobSpec{
+					Registry: crd.Registry{
+						Insecure: true,
+					},
+					Language: crd.Language{
+						Kind: crd.LanguageKindBazel,
+					},
+					Context: crd.Context{
+						Kind: crd.ContextKindGit,
+					},
+				},
+			},
+			expectedErr:    true,
+			expectedErrMsg: "no plugin can handle dummy14: no plugin supports the capabilities [registry.insecure]",
+		},
+		{
+			bj: crd.BuildJob{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "dummy15",
+				},
+				Spec: crd.BuildJobSpec{
+					Registry: crd.Registry{
+						Insecure: true,
+					},
+					Language: crd.Language{
+						Kind: crd.LanguageKindS2I,
+					},
+					Context: crd.Context{
+						Kind: crd.ContextKindGit,
+					},
+				},
+			},
+			expectedErr:    true,
+			expectedErrMsg: "no plugin can handle dummy15",
+		},
+		{
+			bj: crd.BuildJob{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "dummy16",
+				},
+				Spec: crd.BuildJobSpec{
+					Language: crd.Language{
+						Kind: crd.LanguageKindDockerfile,
+					},
+					Context: crd.Context{
+						Kind: crd.ContextKindGit,
+						Git: crd.Git{
+							LFS: true,
+						},
+					},
+				},
+			},
+			expected: 7,
+		},
+		{
+			bj: crd.BuildJob{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "dummy17",
+				},
+				Spec: crd.BuildJobSpec{
+					Language: crd.Language{
+						Kind: crd.LanguageKindDockerfile,
+					},
+					Context: crd.Context{
+						Kind: crd.ContextKindGit,
+						Git: crd.Git{
+							LFS: true,
+						},
+					},
+					PluginSelector: "plugin.name == foo",
+				},
+			},
+			expectedErr:    true,
+			expectedErrMsg: "no plugin can handle dummy17: plugin API version 2 is required, but the plugins [foo] do not support it",
+		},
+		{
+			bj: crd.BuildJob{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "dummy18",
+				},
+				Spec: crd.BuildJobSpec{
+					Language: crd.Language{
+						Kind: crd.LanguageKindDockerfile,
+						Dockerfile: crd.Dockerfile{
+							Squash: true,
+						},
+					},
+					Context: crd.Context{
+						Kind: crd.ContextKindGit,
+					},
+				},
+			},
+			expected: 8,
+		},
+		{
+			bj: crd.BuildJob{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "dummy19",
+				},
+				Spec: crd.BuildJobSpec{
+					Language: crd.Language{
+						Kind: crd.LanguageKindDockerfile,
+						Dockerfile: crd.Dockerfile{
+							Squash: true,
+						},
+					},
+					Context: crd.Context{
+						Kind: crd.ContextKindGit,
+					},
+					PluginSelector: "plugin.name == bar",
+				},
+			},
+			expectedErr:    true,
+			expectedErrMsg: "no plugin can handle dummy19: no plugin supports the capabilities [build.squash]",
+		},
 	}
 	for _, tc := range testCases {
 		actual, err := SelectPlugin(plugins, tc.bj)
 		if err != nil && !tc.expectedErr {
 			t.Fatalf("%s: %v", tc.bj.Name, err)
 		}
+		if err != nil && tc.expectedErrMsg != "" && err.Error() != tc.expectedErrMsg {
+			t.Fatalf("%s: expected error %q, got %q", tc.bj.Name, tc.expectedErrMsg, err.Error())
+		}
 		if err == nil {
 			if tc.expectedErr {
 				t.Fatalf("%s: error is expected", tc.bj.Name)
@@ -19,6 +19,7 @@ package pluginselector
 import (
 	"context"
 	"fmt"
+	"sync"
 
 	"github.com/golang/glog"
 	"google.golang.org/grpc"
@@ -46,33 +47,66 @@ type cachedInfo struct {
 }
 
 type PluginSelector struct {
-	fn         PluginSelectorFunc
+	fn PluginSelectorFunc
+	// mu guards the info of cachedInfo, as UpdateCachedInfo may be called by the controller workers
+	mu         sync.RWMutex
 	cachedInfo []*cachedInfo
 }
 
+// UpdateCachedInfo fetches the info of the plugins.
+// The plugins that cannot be reached are not selected until the next update.
 func (ps *PluginSelector) UpdateCachedInfo(ctx context.Context) error {
 	var errors []error
-	for _, x := range ps.cachedInfo {
+	// the lock is not held during the RPCs, so that Select is not blocked
+	infos := make([]*api.InfoResponse, len(ps.cachedInfo))
+	for i, x := range ps.cachedInfo {
 		client := api.NewPluginClient(x.conn)
 		info, err := client.Info(ctx, &api.InfoRequest{})
 		if err != nil {
 			errors = append(errors, err)
 			info = nil
 		}
-		x.info = info
+		infos[i] = info
+		if info != nil {
+			warnAPIVersion(info)
+		}
+	}
+	ps.mu.Lock()
+	for i, x := range ps.cachedInfo {
+		x.info = infos[i]
 	}
+	ps.mu.Unlock()
 	if len(errors) > 0 {
 		return fmt.Errorf("%v", errors)
 	}
 	return nil
 }
 
-func (ps *PluginSelector) Select(bj crd.BuildJob) api.PluginClient {
+func warnAPIVersion(info *api.InfoResponse) {
+	name := info.Labels[api.LPluginName]
+	if _, ok := info.Labels[api.LPluginAPIVersion]; !ok {
+		glog.Warningf("plugin %q does not advertise %s, assuming version %d", name, api.LPluginAPIVersion, api.APIVersion1)
+		return
+	}
+	v, err := api.PluginAPIVersion(info.Labels)
+	if err != nil {
+		glog.Warningf("plugin %q: %v", name, err)
+		return
+	}
+	if v > api.APIVersion {
+		glog.Warningf("plugin %q speaks plugin API version %d, which is newer than the controller (%d)", name, v, api.APIVersion)
+	}
+}
+
+// Select returns the client and the info of the plugin selected for bj.
+func (ps *PluginSelector) Select(bj crd.BuildJob) (api.PluginClient, *api.InfoResponse, error) {
 	var (
 		conns []*grpc.ClientConn
 		info  []api.InfoResponse
 	)
 
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
 	for _, x := range ps.cachedInfo {
 		if x.info != nil {
 			conns = append(conns, x.conn)
@@ -81,11 +115,10 @@ func (ps *PluginSelector) Select(bj crd.BuildJob) api.PluginClient {
 	}
 	idx, err := ps.fn(info, bj)
 	if err != nil {
-		glog.Warning(err)
+		return nil, nil, err
 	}
-	if idx >= 0 {
-		conn := conns[idx]
-		return api.NewPluginClient(conn)
+	if idx < 0 {
+		return nil, nil, fmt.Errorf("no plugin supports %s", bj.Name)
 	}
-	return nil
+	return api.NewPluginClient(conns[idx]), &info[idx], nil
 }
@@ -0,0 +1,68 @@
+package cbi_plugin_v1
+
+import (
+	"strings"
+
+	crd "github.com/containerbuilding/cbi/pkg/apis/cbi/v1alpha1"
+)
+
+// ContextDelivery is how the context reaches the builder.
+// Plugins advertise it as the value of LContextDelivery(k), e.g. "context.delivery.git=stream".
+type ContextDelivery string
+
+const (
+	// ContextDeliveryVolume materializes the context in a volume of the build pod,
+	// e.g. with cbipluginhelper.ContextInjector.
+	// ContextDeliveryVolume is the default when the label is absent.
+	ContextDeliveryVolume ContextDelivery = "volume"
+	// ContextDeliveryStream lets the builder fetch the context by itself from the coordinates
+	// in the AContextURL annotation, without materializing it in a volume.
+	// e.g. BuildKit-native Git access.
+	ContextDeliveryStream ContextDelivery = "stream"
+)
+
+// AContextURL is the annotation of the BuildJob passed to the plugin, set by the controller when the context
+// is delivered with ContextDeliveryStream. e.g. `https://github.com/example/foo.git#v1.0.0`
+// Plugins MUST NOT inject the context volume when the annotation is set.
+const AContextURL = "cbi.containerbuilding.github.io/context-url"
+
+// LContextDelivery returns the label for the delivery of the context kind, e.g. "context.delivery.git".
+func LContextDelivery(k crd.ContextKind) string {
+	return "context.delivery." + strings.ToLower(string(k))
+}
+
+// SelectContextDelivery returns the delivery of c for the plugin labels.
+// ContextDeliveryStream is returned only when the plugin advertises it for the kind,
+// and c can be streamed (see StreamContextURL).
+func SelectContextDelivery(pluginLabels map[string]string, c crd.Context) ContextDelivery {
+	if ContextDelivery(pluginLabels[LContextDelivery(c.Kind)]) != ContextDeliveryStream {
+		return ContextDeliveryVolume
+	}
+	if _, ok := StreamContextURL(c); !ok {
+		return ContextDeliveryVolume
+	}
+	return ContextDeliveryStream
+}
+
+// StreamContextURL returns the coordinates of c for ContextDeliveryStream, i.e. `URL[#REVISION]` for Git.
+// False is returned if c needs to be materialized in a volume, e.g. for the credentials,
+// the submodules, the sub-path, the revision type other than Auto, or the additional contexts.
+func StreamContextURL(c crd.Context) (string, bool) {
+	if !strings.EqualFold(string(c.Kind), string(crd.ContextKindGit)) || len(c.Additional) > 0 || c.DestPath != "" {
+		return "", false
+	}
+	g := c.Git
+	if g.SubPath != "" || g.Submodules || g.LFS || len(g.SparsePaths) > 0 ||
+		g.SSHSecretRef.Name != "" || g.HTTPSAuthSecretRef.Name != "" || g.GitHubAppSecretRef.Name != "" ||
+		g.CacheVolumeClaimRef.Name != "" || g.FetchRefspec != "" {
+		return "", false
+	}
+	// the fragment is resolved by the builder, which cannot be told the revision type
+	if g.RevisionType != "" && g.RevisionType != crd.GitRevisionTypeAuto {
+		return "", false
+	}
+	if g.Revision == "" {
+		return g.URL, true
+	}
+	return g.URL + "#" + g.Revision, true
+}
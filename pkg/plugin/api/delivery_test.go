@@ -0,0 +1,80 @@
+package cbi_plugin_v1
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+
+	crd "github.com/containerbuilding/cbi/pkg/apis/cbi/v1alpha1"
+)
+
+func TestSelectContextDelivery(t *testing.T) {
+	git := crd.Context{Kind: crd.ContextKindGit, Git: crd.Git{URL: "https://github.com/example/foo.git", Revision: "v1.0.0"}}
+	sshGit := crd.Context{Kind: crd.ContextKindGit, Git: crd.Git{URL: "git@github.com:example/foo.git", SSHSecretRef: corev1.LocalObjectReference{Name: "ssh"}}}
+	streaming := map[string]string{LContextGit: "", LContextDelivery(crd.ContextKindGit): string(ContextDeliveryStream)}
+	testCases := []struct {
+		labels      map[string]string
+		context     crd.Context
+		expected    ContextDelivery
+		expectedURL string
+	}{
+		{
+			labels:      map[string]string{LContextGit: ""},
+			context:     git,
+			expected:    ContextDeliveryVolume,
+			expectedURL: "https://github.com/example/foo.git#v1.0.0",
+		},
+		{
+			labels:      streaming,
+			context:     git,
+			expected:    ContextDeliveryStream,
+			expectedURL: "https://github.com/example/foo.git#v1.0.0",
+		},
+		{
+			labels:      streaming,
+			context:     crd.Context{Kind: "git", Git: crd.Git{URL: "https://github.com/example/foo.git"}},
+			expected:    ContextDeliveryStream,
+			expectedURL: "https://github.com/example/foo.git",
+		},
+		{
+			labels:   streaming,
+			context:  sshGit,
+			expected: ContextDeliveryVolume,
+		},
+		{
+			labels:   streaming,
+			context:  crd.Context{Kind: crd.ContextKindGit, Git: crd.Git{URL: "https://github.com/example/foo.git", SubPath: "app"}},
+			expected: ContextDeliveryVolume,
+		},
+		{
+			labels:   streaming,
+			context:  crd.Context{Kind: crd.ContextKindGit, Git: crd.Git{URL: "https://github.com/example/foo.git", FetchRefspec: "refs/pull/42/head"}},
+			expected: ContextDeliveryVolume,
+		},
+		{
+			labels:   streaming,
+			context:  crd.Context{Kind: crd.ContextKindGit, Git: crd.Git{URL: "https://github.com/example/foo.git", Revision: "v1.0.0", RevisionType: crd.GitRevisionTypeTag}},
+			expected: ContextDeliveryVolume,
+		},
+		{
+			labels:      streaming,
+			context:     crd.Context{Kind: crd.ContextKindGit, Git: crd.Git{URL: "https://github.com/example/foo.git", Revision: "v1.0.0", RevisionType: crd.GitRevisionTypeAuto}},
+			expected:    ContextDeliveryStream,
+			expectedURL: "https://github.com/example/foo.git#v1.0.0",
+		},
+		{
+			labels:   streaming,
+			context:  crd.Context{Kind: crd.ContextKindConfigMap, ConfigMapRef: corev1.LocalObjectReference{Name: "foo"}},
+			expected: ContextDeliveryVolume,
+		},
+	}
+	for i, tc := range testCases {
+		if actual := SelectContextDelivery(tc.labels, tc.context); actual != tc.expected {
+			t.Fatalf("case %d: expected %q, got %q", i, tc.expected, actual)
+		}
+		url, ok := StreamContextURL(tc.context)
+		if ok != (tc.expectedURL != "") || url != tc.expectedURL {
+			t.Fatalf("case %d: expected URL %q, got %q (%v)", i, tc.expectedURL, url, ok)
+		}
+	}
+}
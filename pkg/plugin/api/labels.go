@@ -3,6 +3,8 @@ package cbi_plugin_v1
 import (
 	"strings"
 
+	"k8s.io/apimachinery/pkg/labels"
+
 	crd "github.com/containerbuilding/cbi/pkg/apis/cbi/v1alpha1"
 )
 
@@ -17,6 +19,10 @@ var (
 		"plugin.",
 		"language.",
 		"context.",
+		"registry.",
+		"output.",
+		"platform.",
+		"build.",
 	}
 )
 
@@ -26,13 +32,184 @@ const (
 	//
 	// Example values: "buildkit", "buildah", ...
 	LPluginName = "plugin.name"
-	// TODO: add LPluginVersion = "v1alpha1"?
+	// LPluginAPIVersion is the version of the plugin API that the plugin speaks, e.g. "2".
+	// The plugin service sets LPluginAPIVersion to APIVersion unless the backend sets it.
+	// See RequiredAPIVersion for the compatibility with the BuildJob features.
+	LPluginAPIVersion = "plugin.apiVersion"
+)
+
+// Predefined language labels. These MUST be equal to LLanguage(k).
+const (
+	LLanguageDockerfile = "language.dockerfile"
+	LLanguageS2I        = "language.s2i"
+	LLanguageCloudbuild = "language.cloudbuild"
+	LLanguageBazel      = "language.bazel"
+	LLanguageBuildpacks = "language.buildpacks"
+)
+
+// Predefined context labels. These MUST be equal to LContext(k).
+const (
+	LContextGit       = "context.git"
+	LContextConfigMap = "context.configmap"
+	LContextHTTP      = "context.http"
+	LContextRclone    = "context.rclone"
+	LContextLocal     = "context.local"
+	LContextS3        = "context.s3"
+	LContextPVC       = "context.pvc"
+	LContextOCI       = "context.oci"
+	LContextGCS       = "context.gcs"
+	LContextAzureBlob = "context.azureblob"
+)
+
+// Predefined context compression labels. These MUST be equal to LContextCompression(c).
+// Plugins advertise these labels for the compressions of the archive contexts (HTTP, S3, GCS, and AzureBlob).
+const (
+	LContextCompressionGzip = "context.compression.gzip"
+	LContextCompressionZstd = "context.compression.zstd"
+)
+
+// Predefined registry capability labels.
+// Plugins SHOULD advertise these labels only when they can honor the corresponding
+// Registry fields.
+const (
+	// LRegistryInsecure is required when Registry.Insecure is set.
+	LRegistryInsecure = "registry.insecure"
+	// LRegistryMultiTarget is required when Registry.AdditionalTargets is set.
+	LRegistryMultiTarget = "registry.multi-target"
+	// LRegistryCache is required when Registry.CacheRef is set.
+	LRegistryCache = "registry.cache"
+	// LRegistryPushRetry is required when Registry.PushRetries is set.
+	LRegistryPushRetry = "registry.push-retry"
+	// LRegistryTargetTemplate is required when Registry.Target refers to the commit SHA that is
+	// resolved at run time (see crd.RuntimeTargetVariables).
+	LRegistryTargetTemplate = "registry.target-template"
+)
+
+// LRegistryCredentialHelper returns the label required when Registry.CredentialHelper is set,
+// e.g. "registry.credential-helper.ecr-login".
+// Plugins advertise the label when the builder image contains `docker-credential-<name>`.
+func LRegistryCredentialHelper(name string) string {
+	return "registry.credential-helper." + strings.ToLower(name)
+}
+
+// Predefined output capability labels.
+const (
+	// LOutputArchive is required when BuildJobSpec.Output is set.
+	// The plugin writes the archive to the path returned by cbipluginhelper.Injector.InjectOutput.
+	LOutputArchive = "output.archive"
+)
+
+// Predefined platform capability labels.
+const (
+	// LPlatformSingle is required when BuildJobSpec.Platforms has a single platform.
+	LPlatformSingle = "platform.single"
+	// LPlatformMulti is required when BuildJobSpec.Platforms has multiple platforms.
+	// Plugins advertising LPlatformMulti SHOULD also advertise LPlatformSingle.
+	LPlatformMulti = "platform.multi"
+)
+
+// Predefined build capability labels.
+const (
+	// LBuildSecrets is required when BuildJobSpec.BuildSecrets is set.
+	// Plugins SHOULD advertise LBuildSecrets only when the build steps (e.g. `RUN`) can read
+	// the secrets mounted by cbipluginhelper.InjectBuildSecrets.
+	LBuildSecrets = "build.secrets"
+	// LBuildRootless is required when BuildJobSpec.Rootless is set.
+	// Plugins SHOULD advertise LBuildRootless only when the build container runs without privileges,
+	// e.g. with cbipluginhelper.InjectRootless.
+	LBuildRootless = "build.rootless"
+	// LBuildSquash is required when Dockerfile.Squash is set for the Dockerfile language.
+	LBuildSquash = "build.squash"
+	// LBuildExtraArgs is required when BuildJobSpec.ExtraArgs is set.
+	LBuildExtraArgs = "build.extra-args"
+	// LBuildNetrc is required when BuildJobSpec.NetrcSecretRef is set.
+	// Plugins SHOULD advertise LBuildNetrc only when the build steps can read
+	// the .netrc mounted by cbipluginhelper.Helper.InjectNetrc.
+	LBuildNetrc = "build.netrc"
 )
 
+// LLanguage returns the label for the language kind.
+// The controller uses LLanguage for its default plugin selector logic, so that
+// non-canonical forms (e.g. "dockerfile") are also accepted.
 func LLanguage(k crd.LanguageKind) string {
 	return "language." + strings.ToLower(string(k))
 }
 
+// LContext returns the label for the context kind.
 func LContext(k crd.ContextKind) string {
 	return "context." + strings.ToLower(string(k))
 }
+
+// LContextCompression returns the label for the compression of the archive contexts, e.g. "zstd".
+func LContextCompression(c string) string {
+	return "context.compression." + strings.ToLower(c)
+}
+
+// DefaultSelectorLabels returns the labels that the plugin needs to have for the spec,
+// i.e. LLanguage(spec.Language.Kind) and LContext(spec.Context.Kind).
+// The controller requires the existence of these labels in its default plugin selector logic.
+// The values are empty, as only the keys are meaningful.
+func DefaultSelectorLabels(spec crd.BuildJobSpec) labels.Set {
+	return labels.Set{
+		LLanguage(spec.Language.Kind): "",
+		LContext(spec.Context.Kind):   "",
+	}
+}
+
+// RegistryCapabilityLabels returns the registry capability labels that the plugin needs to have
+// for honoring the registry spec.
+// The controller requires the existence of these labels in its default plugin selector logic.
+func RegistryCapabilityLabels(registry crd.Registry) labels.Set {
+	s := labels.Set{}
+	if registry.Insecure {
+		s[LRegistryInsecure] = ""
+	}
+	if len(registry.AdditionalTargets) > 0 {
+		s[LRegistryMultiTarget] = ""
+	}
+	if registry.CacheRef != "" {
+		s[LRegistryCache] = ""
+	}
+	if registry.PushRetries > 0 {
+		s[LRegistryPushRetry] = ""
+	}
+	if registry.CredentialHelper != "" {
+		s[LRegistryCredentialHelper(registry.CredentialHelper)] = ""
+	}
+	return s
+}
+
+// CapabilityLabels returns the capability labels that the plugin needs to have for the spec,
+// i.e. RegistryCapabilityLabels(spec.Registry), LOutputArchive, the platform labels, and the build labels.
+func CapabilityLabels(spec crd.BuildJobSpec) labels.Set {
+	s := RegistryCapabilityLabels(spec.Registry)
+	if crd.NeedsRuntimeTargetExpansion(spec) {
+		s[LRegistryTargetTemplate] = ""
+	}
+	if spec.Output.Kind != crd.OutputKindNone {
+		s[LOutputArchive] = ""
+	}
+	switch len(spec.Platforms) {
+	case 0:
+	case 1:
+		s[LPlatformSingle] = ""
+	default:
+		s[LPlatformMulti] = ""
+	}
+	if len(spec.BuildSecrets) > 0 {
+		s[LBuildSecrets] = ""
+	}
+	if spec.Rootless {
+		s[LBuildRootless] = ""
+	}
+	if strings.EqualFold(string(spec.Language.Kind), string(crd.LanguageKindDockerfile)) && spec.Language.Dockerfile.Squash {
+		s[LBuildSquash] = ""
+	}
+	if len(spec.ExtraArgs) > 0 {
+		s[LBuildExtraArgs] = ""
+	}
+	if spec.NetrcSecretRef.Name != "" {
+		s[LBuildNetrc] = ""
+	}
+	return s
+}
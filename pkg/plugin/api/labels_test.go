@@ -0,0 +1,203 @@
+package cbi_plugin_v1
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	crd "github.com/containerbuilding/cbi/pkg/apis/cbi/v1alpha1"
+)
+
+func TestPredefinedLabels(t *testing.T) {
+	languages := map[string]crd.LanguageKind{
+		LLanguageDockerfile: crd.LanguageKindDockerfile,
+		LLanguageS2I:        crd.LanguageKindS2I,
+		LLanguageCloudbuild: crd.LanguageKindCloudbuild,
+		LLanguageBazel:      crd.LanguageKindBazel,
+		LLanguageBuildpacks: crd.LanguageKindBuildpacks,
+	}
+	for l, k := range languages {
+		if actual := LLanguage(k); actual != l {
+			t.Fatalf("expected %q, got %q", l, actual)
+		}
+	}
+	contexts := map[string]crd.ContextKind{
+		LContextGit:       crd.ContextKindGit,
+		LContextConfigMap: crd.ContextKindConfigMap,
+		LContextHTTP:      crd.ContextKindHTTP,
+		LContextRclone:    crd.ContextKindRclone,
+		LContextLocal:     crd.ContextKindLocal,
+		LContextS3:        crd.ContextKindS3,
+		LContextOCI:       crd.ContextKindOCI,
+		LContextGCS:       crd.ContextKindGCS,
+		LContextAzureBlob: crd.ContextKindAzureBlob,
+	}
+	for l, k := range contexts {
+		if actual := LContext(k); actual != l {
+			t.Fatalf("expected %q, got %q", l, actual)
+		}
+	}
+	compressions := map[string]string{
+		LContextCompressionGzip: "gzip",
+		LContextCompressionZstd: "zstd",
+	}
+	for l, c := range compressions {
+		if actual := LContextCompression(c); actual != l {
+			t.Fatalf("expected %q, got %q", l, actual)
+		}
+	}
+}
+
+func TestDefaultSelectorLabels(t *testing.T) {
+	languages := map[crd.LanguageKind]string{
+		crd.LanguageKindDockerfile: "language.dockerfile",
+		crd.LanguageKindS2I:        "language.s2i",
+		crd.LanguageKindCloudbuild: "language.cloudbuild",
+		crd.LanguageKindBazel:      "language.bazel",
+		crd.LanguageKindBuildpacks: "language.buildpacks",
+	}
+	contexts := map[crd.ContextKind]string{
+		crd.ContextKindGit:       "context.git",
+		crd.ContextKindConfigMap: "context.configmap",
+		crd.ContextKindHTTP:      "context.http",
+		crd.ContextKindRclone:    "context.rclone",
+		crd.ContextKindLocal:     "context.local",
+		crd.ContextKindS3:        "context.s3",
+		crd.ContextKindGCS:       "context.gcs",
+		crd.ContextKindAzureBlob: "context.azureblob",
+	}
+	for lk, ll := range languages {
+		for ck, cl := range contexts {
+			spec := crd.BuildJobSpec{
+				Language: crd.Language{Kind: lk},
+				Context:  crd.Context{Kind: ck},
+			}
+			expected := labels.Set{ll: "", cl: ""}
+			if actual := DefaultSelectorLabels(spec); !reflect.DeepEqual(actual, expected) {
+				t.Fatalf("%s/%s: expected %v, got %v", lk, ck, expected, actual)
+			}
+		}
+	}
+	// non-canonical forms are accepted
+	spec := crd.BuildJobSpec{
+		Language: crd.Language{Kind: "dockerfile"},
+		Context:  crd.Context{Kind: "GIT"},
+	}
+	if actual := DefaultSelectorLabels(spec); !reflect.DeepEqual(actual, labels.Set{LLanguageDockerfile: "", LContextGit: ""}) {
+		t.Fatalf("unexpected labels %v", actual)
+	}
+}
+
+func TestRegistryCapabilityLabels(t *testing.T) {
+	testCases := []struct {
+		registry crd.Registry
+		expected labels.Set
+	}{
+		{
+			registry: crd.Registry{Target: "example.com/foo"},
+			expected: labels.Set{},
+		},
+		{
+			registry: crd.Registry{Target: "example.com/foo", Insecure: true},
+			expected: labels.Set{LRegistryInsecure: ""},
+		},
+		{
+			registry: crd.Registry{Target: "example.com/foo", AdditionalTargets: []string{"example.com/bar"}},
+			expected: labels.Set{LRegistryMultiTarget: ""},
+		},
+		{
+			registry: crd.Registry{Target: "example.com/foo", AdditionalTargets: []string{"example.com/bar"}, Insecure: true},
+			expected: labels.Set{LRegistryInsecure: "", LRegistryMultiTarget: ""},
+		},
+		{
+			registry: crd.Registry{Target: "example.com/foo", CacheRef: "example.com/foo:buildcache"},
+			expected: labels.Set{LRegistryCache: ""},
+		},
+		{
+			registry: crd.Registry{Target: "example.com/foo", Push: true, PushRetries: 3},
+			expected: labels.Set{LRegistryPushRetry: ""},
+		},
+		{
+			registry: crd.Registry{Target: "123456789012.dkr.ecr.us-east-1.amazonaws.com/foo", CredentialHelper: "ecr-login"},
+			expected: labels.Set{"registry.credential-helper.ecr-login": ""},
+		},
+	}
+	for _, tc := range testCases {
+		if actual := RegistryCapabilityLabels(tc.registry); !reflect.DeepEqual(actual, tc.expected) {
+			t.Fatalf("%+v: expected %v, got %v", tc.registry, tc.expected, actual)
+		}
+	}
+}
+
+func TestCapabilityLabels(t *testing.T) {
+	testCases := []struct {
+		spec     crd.BuildJobSpec
+		expected labels.Set
+	}{
+		{
+			spec:     crd.BuildJobSpec{Registry: crd.Registry{Target: "example.com/foo", Push: true}},
+			expected: labels.Set{},
+		},
+		{
+			spec: crd.BuildJobSpec{
+				Registry: crd.Registry{Target: "example.com/foo", Insecure: true},
+				Output:   crd.Output{Kind: crd.OutputKindS3},
+			},
+			expected: labels.Set{LRegistryInsecure: "", LOutputArchive: ""},
+		},
+		{
+			spec:     crd.BuildJobSpec{Platforms: []string{"linux/arm64"}},
+			expected: labels.Set{LPlatformSingle: ""},
+		},
+		{
+			spec:     crd.BuildJobSpec{Platforms: []string{"linux/amd64", "linux/arm64"}},
+			expected: labels.Set{LPlatformMulti: ""},
+		},
+		{
+			spec: crd.BuildJobSpec{BuildSecrets: []crd.SecretMount{
+				{SecretRef: corev1.LocalObjectReference{Name: "npmrc"}, MountPath: "/cbi-secrets/npm"},
+			}},
+			expected: labels.Set{LBuildSecrets: ""},
+		},
+		{
+			spec:     crd.BuildJobSpec{Rootless: true},
+			expected: labels.Set{LBuildRootless: ""},
+		},
+		{
+			spec:     crd.BuildJobSpec{ExtraArgs: []string{"--network=host"}},
+			expected: labels.Set{LBuildExtraArgs: ""},
+		},
+		{
+			spec:     crd.BuildJobSpec{NetrcSecretRef: corev1.LocalObjectReference{Name: "netrc"}},
+			expected: labels.Set{LBuildNetrc: ""},
+		},
+		{
+			spec: crd.BuildJobSpec{Language: crd.Language{
+				Kind:       crd.LanguageKindDockerfile,
+				Dockerfile: crd.Dockerfile{Squash: true},
+			}},
+			expected: labels.Set{LBuildSquash: ""},
+		},
+		{
+			spec: crd.BuildJobSpec{
+				Registry: crd.Registry{Target: "example.com/foo:git-{{.ShortSHA}}", Push: true},
+				Context:  crd.Context{Kind: crd.ContextKindGit, Git: crd.Git{URL: "https://example.com/foo.git"}},
+			},
+			expected: labels.Set{LRegistryTargetTemplate: ""},
+		},
+		{
+			spec: crd.BuildJobSpec{
+				Registry: crd.Registry{Target: "example.com/foo:{{.Branch}}", Push: true},
+				Context:  crd.Context{Kind: crd.ContextKindGit, Git: crd.Git{URL: "https://example.com/foo.git", Revision: "master"}},
+			},
+			expected: labels.Set{},
+		},
+	}
+	for _, tc := range testCases {
+		if actual := CapabilityLabels(tc.spec); !reflect.DeepEqual(actual, tc.expected) {
+			t.Fatalf("%+v: expected %v, got %v", tc.spec, tc.expected, actual)
+		}
+	}
+}
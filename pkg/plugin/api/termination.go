@@ -0,0 +1,80 @@
+package cbi_plugin_v1
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Containers in the pod MAY report results to the controller by writing
+// `key=value` lines to their termination message path (usually /dev/termination-log).
+// The controller collects the messages from the containers that exited with zero status.
+const (
+	// TResolvedRevision is the termination message key for the resolved revision of the context.
+	// e.g. the full commit SHA for Git context.
+	TResolvedRevision = "cbi.resolved-revision"
+	// TImageDigest is the termination message key for the digest of the pushed image.
+	// e.g. sha256:...
+	TImageDigest = "cbi.image-digest"
+	// TExportedArchive is the termination message key for the location of the exported archive.
+	// e.g. s3://bucket/key
+	TExportedArchive = "cbi.exported-archive"
+	// TPushRetries is the termination message key for the number of push retries.
+	// e.g. 2
+	TPushRetries = "cbi.push-retries"
+)
+
+// ExportContainerName is the name of the container that exports the archive for BuildJobSpec.Output.
+// When the pod has this container, the build container is the last init container,
+// so that the archive is complete before being exported.
+const ExportContainerName = "cbi-export"
+
+var digestRegexp = regexp.MustCompile(`^sha256:[0-9a-f]{64}$`)
+
+// FormatTerminationMessage formats m as `key=value` lines, sorted by keys.
+func FormatTerminationMessage(m map[string]string) string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, k := range keys {
+		fmt.Fprintf(&b, "%s=%s\n", k, m[k])
+	}
+	return b.String()
+}
+
+// ParseTerminationMessage parses `key=value` lines.
+//
+// For builders that cannot format the message by themselves, the following
+// formats are also accepted as TImageDigest:
+//   - a bare digest line, e.g. `kaniko --digest-file`
+//   - a JSON object with "containerimage.digest", e.g. `buildctl --metadata-file`
+//
+// Other lines are ignored.
+func ParseTerminationMessage(s string) map[string]string {
+	m := make(map[string]string)
+	var metadata map[string]interface{}
+	if err := json.Unmarshal([]byte(s), &metadata); err == nil {
+		if digest, ok := metadata["containerimage.digest"].(string); ok {
+			m[TImageDigest] = digest
+		}
+		return m
+	}
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		if digestRegexp.MatchString(line) {
+			m[TImageDigest] = line
+			continue
+		}
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		m[kv[0]] = kv[1]
+	}
+	return m
+}
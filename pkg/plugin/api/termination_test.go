@@ -0,0 +1,57 @@
+package cbi_plugin_v1
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseTerminationMessage(t *testing.T) {
+	digest := "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+	cases := []struct {
+		msg      string
+		expected map[string]string
+	}{
+		{
+			msg:      "",
+			expected: map[string]string{},
+		},
+		{
+			msg: FormatTerminationMessage(map[string]string{
+				TResolvedRevision: "deadbeef",
+				TImageDigest:      digest,
+			}),
+			expected: map[string]string{
+				TResolvedRevision: "deadbeef",
+				TImageDigest:      digest,
+			},
+		},
+		{
+			msg:      "foo\nbar=baz=qux\n",
+			expected: map[string]string{"bar": "baz=qux"},
+		},
+		{
+			// docker-build-push.sh
+			msg: "cbi.image-digest=" + digest + "\ncbi.push-retries=2\n",
+			expected: map[string]string{
+				TImageDigest: digest,
+				TPushRetries: "2",
+			},
+		},
+		{
+			// kaniko --digest-file
+			msg:      digest,
+			expected: map[string]string{TImageDigest: digest},
+		},
+		{
+			// buildctl --metadata-file
+			msg:      `{"containerimage.digest": "` + digest + `", "containerimage.descriptor": {}}`,
+			expected: map[string]string{TImageDigest: digest},
+		},
+	}
+	for _, c := range cases {
+		actual := ParseTerminationMessage(c.msg)
+		if !reflect.DeepEqual(c.expected, actual) {
+			t.Fatalf("%q: expected %v, got %v", c.msg, c.expected, actual)
+		}
+	}
+}
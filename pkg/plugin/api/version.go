@@ -0,0 +1,77 @@
+package cbi_plugin_v1
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	crd "github.com/containerbuilding/cbi/pkg/apis/cbi/v1alpha1"
+)
+
+// Plugin API versions.
+// A plugin that speaks version N supports all the features of the versions up to N.
+// The features that require a version newer than APIVersion1 are listed in RequiredAPIVersion.
+const (
+	// APIVersion1 is the initial version.
+	// Plugins that do not advertise LPluginAPIVersion are regarded as APIVersion1.
+	APIVersion1 = 1
+	// APIVersion2 adds Context.Additional, Git.RevisionType (except Auto), Git.LFS, and HTTP.BasicAuthSecretRef.
+	APIVersion2 = 2
+	// APIVersion3 adds Rclone.Flags.
+	APIVersion3 = 3
+	// APIVersion4 adds Git.HTTPSAuthSecretRef.
+	APIVersion4 = 4
+	// APIVersion5 adds Git.GitHubAppSecretRef.
+	APIVersion5 = 5
+	// APIVersion6 adds Git.FetchRefspec.
+	APIVersion6 = 6
+
+	// APIVersion is the latest version, implemented by this package.
+	APIVersion = APIVersion6
+)
+
+// PluginAPIVersion returns the version advertised in the plugin labels.
+func PluginAPIVersion(labels map[string]string) (int, error) {
+	s, ok := labels[LPluginAPIVersion]
+	if !ok {
+		return APIVersion1, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < APIVersion1 {
+		return 0, fmt.Errorf("invalid %s label: %q", LPluginAPIVersion, s)
+	}
+	return v, nil
+}
+
+// RequiredAPIVersion returns the minimum version that the plugin needs to speak for the spec.
+func RequiredAPIVersion(spec crd.BuildJobSpec) int {
+	return requiredContextAPIVersion(spec.Context)
+}
+
+func requiredContextAPIVersion(c crd.Context) int {
+	v := APIVersion1
+	if len(c.Additional) > 0 ||
+		(c.Git.RevisionType != "" && !strings.EqualFold(string(c.Git.RevisionType), string(crd.GitRevisionTypeAuto))) ||
+		c.Git.LFS ||
+		c.HTTP.BasicAuthSecretRef.Name != "" {
+		v = APIVersion2
+	}
+	if len(c.Rclone.Flags) > 0 {
+		v = APIVersion3
+	}
+	if c.Git.HTTPSAuthSecretRef.Name != "" {
+		v = APIVersion4
+	}
+	if c.Git.GitHubAppSecretRef.Name != "" {
+		v = APIVersion5
+	}
+	if c.Git.FetchRefspec != "" {
+		v = APIVersion6
+	}
+	for _, a := range c.Additional {
+		if av := requiredContextAPIVersion(a); av > v {
+			v = av
+		}
+	}
+	return v
+}
@@ -0,0 +1,113 @@
+package cbi_plugin_v1
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+
+	crd "github.com/containerbuilding/cbi/pkg/apis/cbi/v1alpha1"
+)
+
+func TestPluginAPIVersion(t *testing.T) {
+	testCases := []struct {
+		labels   map[string]string
+		expected int
+		invalid  bool
+	}{
+		{
+			labels:   map[string]string{LPluginName: "foo"},
+			expected: APIVersion1,
+		},
+		{
+			labels:   map[string]string{LPluginName: "foo", LPluginAPIVersion: "2"},
+			expected: APIVersion2,
+		},
+		{
+			labels:  map[string]string{LPluginName: "foo", LPluginAPIVersion: "v1alpha1"},
+			invalid: true,
+		},
+		{
+			labels:  map[string]string{LPluginName: "foo", LPluginAPIVersion: "0"},
+			invalid: true,
+		},
+	}
+	for _, tc := range testCases {
+		actual, err := PluginAPIVersion(tc.labels)
+		if err != nil && !tc.invalid {
+			t.Fatalf("%v: %v", tc.labels, err)
+		}
+		if err == nil {
+			if tc.invalid {
+				t.Fatalf("%v: error is expected", tc.labels)
+			} else if actual != tc.expected {
+				t.Fatalf("%v: expected %d, got %d", tc.labels, tc.expected, actual)
+			}
+		}
+	}
+}
+
+func TestRequiredAPIVersion(t *testing.T) {
+	testCases := []struct {
+		context  crd.Context
+		expected int
+	}{
+		{
+			context:  crd.Context{Kind: crd.ContextKindGit, Git: crd.Git{URL: "https://example.com/foo.git"}},
+			expected: APIVersion1,
+		},
+		{
+			context:  crd.Context{Kind: crd.ContextKindGit, Git: crd.Git{URL: "https://example.com/foo.git", LFS: true}},
+			expected: APIVersion2,
+		},
+		{
+			context:  crd.Context{Kind: crd.ContextKindGit, Git: crd.Git{URL: "https://example.com/foo.git", RevisionType: crd.GitRevisionTypeTag}},
+			expected: APIVersion2,
+		},
+		{
+			context:  crd.Context{Kind: crd.ContextKindGit, Git: crd.Git{URL: "https://example.com/foo.git", RevisionType: crd.GitRevisionTypeAuto}},
+			expected: APIVersion1,
+		},
+		{
+			context:  crd.Context{Kind: crd.ContextKindHTTP, HTTP: crd.HTTP{URL: "https://example.com/foo.tar", BasicAuthSecretRef: corev1.LocalObjectReference{Name: "foo"}}},
+			expected: APIVersion2,
+		},
+		{
+			context:  crd.Context{Kind: crd.ContextKindRclone, Rclone: crd.Rclone{Remote: "foo", Flags: []string{"--bwlimit=10M"}}},
+			expected: APIVersion3,
+		},
+		{
+			context:  crd.Context{Kind: crd.ContextKindGit, Git: crd.Git{URL: "https://example.com/foo.git", HTTPSAuthSecretRef: corev1.LocalObjectReference{Name: "foo"}}},
+			expected: APIVersion4,
+		},
+		{
+			context:  crd.Context{Kind: crd.ContextKindGit, Git: crd.Git{URL: "https://github.com/foo/bar.git", GitHubAppSecretRef: corev1.LocalObjectReference{Name: "foo"}}},
+			expected: APIVersion5,
+		},
+		{
+			context:  crd.Context{Kind: crd.ContextKindGit, Git: crd.Git{URL: "https://github.com/foo/bar.git", FetchRefspec: "refs/pull/42/head"}},
+			expected: APIVersion6,
+		},
+		{
+			context: crd.Context{
+				Kind:       crd.ContextKindGit,
+				Git:        crd.Git{URL: "https://example.com/foo.git"},
+				Additional: []crd.Context{{Kind: crd.ContextKindRclone, Rclone: crd.Rclone{Remote: "foo", Flags: []string{"--bwlimit=10M"}}}},
+			},
+			expected: APIVersion3,
+		},
+		{
+			context: crd.Context{
+				Kind:       crd.ContextKindGit,
+				Git:        crd.Git{URL: "https://example.com/foo.git"},
+				Additional: []crd.Context{{Kind: crd.ContextKindConfigMap}},
+			},
+			expected: APIVersion2,
+		},
+	}
+	for _, tc := range testCases {
+		actual := RequiredAPIVersion(crd.BuildJobSpec{Context: tc.context})
+		if actual != tc.expected {
+			t.Fatalf("%+v: expected %d, got %d", tc.context, tc.expected, actual)
+		}
+	}
+}
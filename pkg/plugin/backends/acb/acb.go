@@ -19,7 +19,6 @@ package acb
 import (
 	"context"
 	"fmt"
-	"regexp"
 	"strings"
 
 	corev1 "k8s.io/api/core/v1"
@@ -28,6 +27,9 @@ import (
 	pluginapi "github.com/containerbuilding/cbi/pkg/plugin/api"
 	"github.com/containerbuilding/cbi/pkg/plugin/base"
 	"github.com/containerbuilding/cbi/pkg/plugin/base/cbipluginhelper"
+	"github.com/containerbuilding/cbi/pkg/plugin/base/dockerfileutil"
+	"github.com/containerbuilding/cbi/pkg/plugin/base/labelutil"
+	"github.com/containerbuilding/cbi/pkg/plugin/base/registryutil"
 )
 
 const (
@@ -49,11 +51,12 @@ var _ base.Backend = &ACB{}
 func (b *ACB) Info(ctx context.Context, req *pluginapi.InfoRequest) (*pluginapi.InfoResponse, error) {
 	res := &pluginapi.InfoResponse{
 		Labels: map[string]string{
-			pluginapi.LPluginName:                           "acb",
-			pluginapi.LLanguage(crd.LanguageKindDockerfile): "",
+			pluginapi.LPluginName:          "acb",
+			pluginapi.LLanguageDockerfile:  "",
+			pluginapi.LRegistryMultiTarget: "",
 		},
 	}
-	for k, v := range cbipluginhelper.Labels {
+	for k, v := range b.Helper.Labels() {
 		res.Labels[k] = v
 	}
 	return res, nil
@@ -88,6 +91,17 @@ func (b *ACB) commonPodSpec(buildJob crd.BuildJob) (*corev1.PodSpec, error) {
 	if err != nil {
 		return nil, err
 	}
+	imageArgs := []string{"--image", image}
+	for _, t := range buildJob.Spec.Registry.AdditionalTargets {
+		additionalReg, additionalImage, err := splitTarget(t)
+		if err != nil {
+			return nil, err
+		}
+		if additionalReg != reg {
+			return nil, fmt.Errorf("ACB plugin requires Spec.Registry.AdditionalTargets to be in the same registry as Spec.Registry.Target: %q", t)
+		}
+		imageArgs = append(imageArgs, "--image", additionalImage)
+	}
 	podSpec := corev1.PodSpec{
 		RestartPolicy: corev1.RestartPolicyNever,
 		Volumes:       []corev1.Volume{rootConfigVol, secretVol},
@@ -109,7 +123,7 @@ func (b *ACB) commonPodSpec(buildJob crd.BuildJob) (*corev1.PodSpec, error) {
 			{
 				Name:    "acb-job",
 				Image:   b.Image,
-				Command: []string{"az", "acr", "build", "--registry", reg, "--image", image},
+				Command: append([]string{"az", "acr", "build", "--registry", reg}, imageArgs...),
 				// ~/.azure/accessTokens.json refers to the PEM in the secret volume.
 				VolumeMounts: []corev1.VolumeMount{rootConfigVolMount, secretVolMount},
 			},
@@ -118,13 +132,18 @@ func (b *ACB) commonPodSpec(buildJob crd.BuildJob) (*corev1.PodSpec, error) {
 	return &podSpec, nil
 }
 
+const acrDomainSuffix = ".azurecr.io"
+
 func splitTarget(target string) (string, string, error) {
-	re := regexp.MustCompile(`(.*)\.azurecr\.io/(.*)`)
-	matches := re.FindStringSubmatch(target)
-	if len(matches) != 3 {
+	ref, err := crd.ParseReference(target)
+	if err != nil {
+		return "", "", err
+	}
+	if !strings.HasSuffix(ref.Registry, acrDomainSuffix) {
 		return "", "", fmt.Errorf("needs to be in *azurecr.io namespace: %q", target)
 	}
-	return matches[1], matches[2], nil
+	// the image is kept as specified, without the defaulted tag
+	return strings.TrimSuffix(ref.Registry, acrDomainSuffix), strings.TrimPrefix(target, ref.Registry+"/"), nil
 }
 
 func (b *ACB) CreatePodTemplateSpec(ctx context.Context, buildJob crd.BuildJob) (*corev1.PodTemplateSpec, error) {
@@ -133,9 +152,18 @@ func (b *ACB) CreatePodTemplateSpec(ctx context.Context, buildJob crd.BuildJob)
 	default:
 		return nil, fmt.Errorf("unsupported Spec.Language: %v", buildJob.Spec.Language)
 	}
+	if err := registryutil.ValidateNoTLSConfig(buildJob.Spec.Registry, "ACB"); err != nil {
+		return nil, err
+	}
+	if err := labelutil.ValidateNoLabels(buildJob.Spec, "ACB"); err != nil {
+		return nil, err
+	}
 	if buildJob.Spec.Registry.SecretRef.Name != "" {
 		return nil, fmt.Errorf("ACB plugin requires Spec.Registry.SecretRef to be empty (use cbi-acb/secret annotation instead with Azure service principal)")
 	}
+	if buildJob.Spec.Registry.PullSecretRef.Name != "" {
+		return nil, fmt.Errorf("ACB plugin requires Spec.Registry.PullSecretRef to be empty (use cbi-acb/secret annotation instead with Azure service principal)")
+	}
 	for _, a := range []string{AnnotationSecret, AnnotationAppID, AnnotationTenant} {
 		if buildJob.Annotations[a] == "" {
 			return nil, fmt.Errorf("ACB plugin requires annotation %q", a)
@@ -159,6 +187,22 @@ func (b *ACB) CreatePodTemplateSpec(ctx context.Context, buildJob crd.BuildJob)
 	if err != nil {
 		return nil, err
 	}
+	dockerfilePath, err := dockerfileutil.Path(ctxPath, buildJob.Spec.Language.Dockerfile)
+	if err != nil {
+		return nil, err
+	}
+	podSpec.Containers[0].Args = append(podSpec.Containers[0].Args, "--file", dockerfilePath)
+	if target := buildJob.Spec.Language.Dockerfile.Target; target != "" {
+		podSpec.Containers[0].Args = append(podSpec.Containers[0].Args, "--target", target)
+	}
+	buildArgs, buildArgsEnv, err := dockerfileutil.BuildArgs(buildJob.Spec.Language.Dockerfile)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range buildArgs {
+		podSpec.Containers[0].Args = append(podSpec.Containers[0].Args, "--build-arg", a)
+	}
+	podSpec.Containers[0].Env = append(podSpec.Containers[0].Env, buildArgsEnv...)
 	podSpec.Containers[0].Args = append(podSpec.Containers[0].Args, ctxPath)
 	return &corev1.PodTemplateSpec{
 		Spec: *podSpec,
@@ -44,10 +44,8 @@ func TestSplitTarget(t *testing.T) {
 			image:    "foo/bar:baz",
 		},
 		{
-			target: "example.azurecr.io/foo/../../bar:baz",
-			// invalid but no need to strictly prohibit here
-			registry: "example",
-			image:    "foo/../../bar:baz",
+			target:  "example.azurecr.io/foo/../../bar:baz",
+			invalid: true,
 		},
 		{
 			target:  "example/foo",
@@ -27,6 +27,8 @@ import (
 	pluginapi "github.com/containerbuilding/cbi/pkg/plugin/api"
 	"github.com/containerbuilding/cbi/pkg/plugin/base"
 	"github.com/containerbuilding/cbi/pkg/plugin/base/cbipluginhelper"
+	"github.com/containerbuilding/cbi/pkg/plugin/base/dockerfileutil"
+	"github.com/containerbuilding/cbi/pkg/plugin/base/labelutil"
 	"github.com/containerbuilding/cbi/pkg/plugin/base/registryutil"
 )
 
@@ -40,73 +42,75 @@ var _ base.Backend = &Buildah{}
 func (b *Buildah) Info(ctx context.Context, req *pluginapi.InfoRequest) (*pluginapi.InfoResponse, error) {
 	res := &pluginapi.InfoResponse{
 		Labels: map[string]string{
-			pluginapi.LPluginName:                           "buildah",
-			pluginapi.LLanguage(crd.LanguageKindDockerfile): "",
+			pluginapi.LPluginName:             "buildah",
+			pluginapi.LLanguageDockerfile:     "",
+			pluginapi.LRegistryInsecure:       "",
+			pluginapi.LRegistryMultiTarget:    "",
+			pluginapi.LBuildExtraArgs:         "",
+			pluginapi.LBuildSquash:            "",
+			pluginapi.LRegistryPushRetry:      "",
+			pluginapi.LRegistryTargetTemplate: "",
 		},
 	}
-	for k, v := range cbipluginhelper.Labels {
+	for k, v := range b.Helper.Labels() {
 		res.Labels[k] = v
 	}
 	return res, nil
 }
 
-func (b *Buildah) commonPodSpec(buildJob crd.BuildJob) corev1.PodSpec {
+func (b *Buildah) commonPodSpec(buildJob crd.BuildJob) (*corev1.PodSpec, error) {
 	push := "0"
 	if buildJob.Spec.Registry.Push {
 		push = "1"
 	}
 	// TODO(AkihiroSuda): support non-privileged
 	privileged := true
-	podSpec := corev1.PodSpec{
-		RestartPolicy: corev1.RestartPolicyNever,
-		Containers: []corev1.Container{
-			{
-				Name:    "buildah-job",
-				Image:   b.Image,
-				Command: []string{
-					// needs to be "docker-build-push.sh", not buildah itself.
-				},
-				Env: []corev1.EnvVar{
-					{
-						Name:  "DBP_DOCKER_BINARY",
-						Value: "buildah",
-					},
-					{
-						Name:  "DBP_IMAGE_NAME",
-						Value: buildJob.Spec.Registry.Target,
-					},
-					{
-						Name:  "DBP_DIALECT",
-						Value: "buildah",
-					},
-					{
-						Name:  "DBP_PUSH",
-						Value: push,
-					},
-				},
-				VolumeMounts: []corev1.VolumeMount{
-					{
-						Name: "buildah-storage-volume",
-						// we need this volume for overlay storage driver.
-						MountPath: "/var/lib/containers/storage",
-					},
-				},
-				SecurityContext: &corev1.SecurityContext{
-					Privileged: &privileged,
-				},
-			},
+	podSpec, idx, err := cbipluginhelper.NewBuildJobPodSpec(&buildJob, b.Helper)
+	if err != nil {
+		return nil, err
+	}
+	c := &podSpec.Containers[idx]
+	c.Name = "buildah-job"
+	c.Image = b.Image
+	// c.Command needs to be "docker-build-push.sh", not buildah itself.
+	c.Env = []corev1.EnvVar{
+		{
+			Name:  "DBP_DOCKER_BINARY",
+			Value: "buildah",
+		},
+		{
+			Name:  "DBP_IMAGE_NAME",
+			Value: buildJob.Spec.Registry.Target,
 		},
-		Volumes: []corev1.Volume{
-			{
-				Name: "buildah-storage-volume",
-				VolumeSource: corev1.VolumeSource{
-					// not persistent until buildah supports preserving cache
-					EmptyDir: &corev1.EmptyDirVolumeSource{},
-				},
-			},
+		{
+			Name:  "DBP_DIALECT",
+			Value: "buildah",
+		},
+		{
+			Name:  "DBP_PUSH",
+			Value: push,
+		},
+		{
+			Name:  "DBP_TERMINATION_MESSAGE_PATH",
+			Value: corev1.TerminationMessagePathDefault,
 		},
 	}
-	return podSpec
+	c.VolumeMounts = append(c.VolumeMounts, corev1.VolumeMount{
+		Name: "buildah-storage-volume",
+		// we need this volume for overlay storage driver.
+		MountPath: "/var/lib/containers/storage",
+	})
+	c.SecurityContext = &corev1.SecurityContext{
+		Privileged: &privileged,
+	}
+	podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+		Name: "buildah-storage-volume",
+		VolumeSource: corev1.VolumeSource{
+			// not persistent until buildah supports preserving cache
+			EmptyDir: &corev1.EmptyDirVolumeSource{},
+		},
+	})
+	return podSpec, nil
 }
 
 func (b *Buildah) CreatePodTemplateSpec(ctx context.Context, buildJob crd.BuildJob) (*corev1.PodTemplateSpec, error) {
@@ -116,15 +120,22 @@ func (b *Buildah) CreatePodTemplateSpec(ctx context.Context, buildJob crd.BuildJ
 	default:
 		return nil, fmt.Errorf("unsupported Spec.Language: %v", buildJob.Spec.Language)
 	}
-	podSpec := b.commonPodSpec(buildJob)
-	if buildJob.Spec.Registry.Push && buildJob.Spec.Registry.SecretRef.Name != "" {
-		if err := registryutil.InjectRegistrySecret(&podSpec, 0, "/root", buildJob.Spec.Registry.SecretRef); err != nil {
-			return nil, err
-		}
+	podSpec, err := b.commonPodSpec(buildJob)
+	if err != nil {
+		return nil, err
 	}
+	targets, err := registryutil.Targets(buildJob.Spec.Registry)
+	if err != nil {
+		return nil, err
+	}
+	podSpec.Containers[0].Env = append(podSpec.Containers[0].Env, corev1.EnvVar{
+		Name:  "DBP_ADDITIONAL_IMAGE_NAMES",
+		Value: strings.Join(targets[1:], " "),
+	})
+	podSpec.Containers[0].Env = append(podSpec.Containers[0].Env, registryutil.PushRetriesEnv(buildJob.Spec.Registry)...)
 	injector := cbipluginhelper.Injector{
 		Helper:        b.Helper,
-		TargetPodSpec: &podSpec,
+		TargetPodSpec: podSpec,
 	}
 	dbpPath, err := injector.InjectFile("/docker-build-push.sh")
 	if err != nil {
@@ -138,10 +149,52 @@ func (b *Buildah) CreatePodTemplateSpec(ctx context.Context, buildJob crd.BuildJ
 	if err != nil {
 		return nil, err
 	}
-	podSpec.Containers[0].Command = append(podSpec.Containers[0].Command, []string{
-		ctxPath,
-	}...)
+	dockerfileFlags, err := dockerfileutil.DockerBuildFlags(ctxPath, buildJob.Spec.Language.Dockerfile)
+	if err != nil {
+		return nil, err
+	}
+	podSpec.Containers[0].Command = append(podSpec.Containers[0].Command, dockerfileFlags...)
+	if buildJob.Spec.Language.Dockerfile.Squash {
+		podSpec.Containers[0].Command = append(podSpec.Containers[0].Command, "--squash")
+	}
+	var tlsFlags []string
+	if buildJob.Spec.Registry.Insecure {
+		tlsFlags = append(tlsFlags, "--tls-verify=false")
+	}
+	// not --cert-dir, so that the certificate is also used for pulling the base images
+	if err := registryutil.InjectRegistryCA(podSpec, 0, buildJob.Spec.Registry, registryutil.CAMountContainersCertsD); err != nil {
+		return nil, err
+	}
+	podSpec.Containers[0].Command = append(podSpec.Containers[0].Command, tlsFlags...)
+	podSpec.Containers[0].Env = append(podSpec.Containers[0].Env, corev1.EnvVar{
+		Name:  "DBP_PUSH_FLAGS",
+		Value: strings.Join(tlsFlags, " "),
+	})
+	buildArgs, buildArgsEnv, err := dockerfileutil.BuildArgs(buildJob.Spec.Language.Dockerfile)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range buildArgs {
+		podSpec.Containers[0].Command = append(podSpec.Containers[0].Command, "--build-arg", a)
+	}
+	podSpec.Containers[0].Env = append(podSpec.Containers[0].Env, buildArgsEnv...)
+	labels, err := labelutil.Labels(buildJob.Spec)
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range labelutil.KeyValues(labels) {
+		podSpec.Containers[0].Command = append(podSpec.Containers[0].Command, "--label", l)
+	}
+	if labelutil.NeedsResolvedRevision(buildJob.Spec, labels) {
+		podSpec.Containers[0].Env = append(podSpec.Containers[0].Env, corev1.EnvVar{
+			Name:  "DBP_REVISION_FILE",
+			Value: ctxInjector.ResolvedRevisionFile(),
+		})
+	}
+	podSpec.Containers[0].Env = append(podSpec.Containers[0].Env, registryutil.TargetTemplateEnv(buildJob.Spec.Registry, ctxInjector.ResolvedRevisionFile())...)
+	podSpec.Containers[0].Command = append(podSpec.Containers[0].Command, buildJob.Spec.ExtraArgs...)
+	podSpec.Containers[0].Command = append(podSpec.Containers[0].Command, ctxPath)
 	return &corev1.PodTemplateSpec{
-		Spec: podSpec,
+		Spec: *podSpec,
 	}, nil
 }
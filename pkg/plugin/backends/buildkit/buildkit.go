@@ -19,6 +19,7 @@ package buildkit
 import (
 	"context"
 	"fmt"
+	"path/filepath"
 	"strings"
 
 	corev1 "k8s.io/api/core/v1"
@@ -27,6 +28,8 @@ import (
 	pluginapi "github.com/containerbuilding/cbi/pkg/plugin/api"
 	"github.com/containerbuilding/cbi/pkg/plugin/base"
 	"github.com/containerbuilding/cbi/pkg/plugin/base/cbipluginhelper"
+	"github.com/containerbuilding/cbi/pkg/plugin/base/dockerfileutil"
+	"github.com/containerbuilding/cbi/pkg/plugin/base/labelutil"
 	"github.com/containerbuilding/cbi/pkg/plugin/base/registryutil"
 )
 
@@ -41,17 +44,29 @@ var _ base.Backend = &BuildKit{}
 func (b *BuildKit) Info(ctx context.Context, req *pluginapi.InfoRequest) (*pluginapi.InfoResponse, error) {
 	res := &pluginapi.InfoResponse{
 		Labels: map[string]string{
-			pluginapi.LPluginName:                           "buildkit",
-			pluginapi.LLanguage(crd.LanguageKindDockerfile): "",
+			pluginapi.LPluginName:                          "buildkit",
+			pluginapi.LLanguageDockerfile:                  "",
+			pluginapi.LRegistryInsecure:                    "",
+			pluginapi.LRegistryMultiTarget:                 "",
+			pluginapi.LBuildExtraArgs:                      "",
+			pluginapi.LRegistryCache:                       "",
+			pluginapi.LOutputArchive:                       "",
+			pluginapi.LPlatformSingle:                      "",
+			pluginapi.LPlatformMulti:                       "",
+			pluginapi.LContextDelivery(crd.ContextKindGit): string(pluginapi.ContextDeliveryStream),
 		},
 	}
-	for k, v := range cbipluginhelper.Labels {
+	// the context size is only limited by the init containers
+	if !b.Helper.MaxContextSize.IsZero() {
+		delete(res.Labels, pluginapi.LContextDelivery(crd.ContextKindGit))
+	}
+	for k, v := range b.Helper.Labels() {
 		res.Labels[k] = v
 	}
 	return res, nil
 }
 
-func (b *BuildKit) commonPodSpec(buildJob crd.BuildJob) corev1.PodSpec {
+func (b *BuildKit) commonPodSpec(buildJob crd.BuildJob, targets []string) corev1.PodSpec {
 	podSpec := corev1.PodSpec{
 		RestartPolicy: corev1.RestartPolicyNever,
 		Containers: []corev1.Container{
@@ -69,9 +84,35 @@ func (b *BuildKit) commonPodSpec(buildJob crd.BuildJob) corev1.PodSpec {
 	if buildJob.Spec.Registry.Push {
 		podSpec.Containers[0].Command = append(podSpec.Containers[0].Command,
 			"--exporter=image",
-			"--exporter-opt", "name="+buildJob.Spec.Registry.Target,
+			"--exporter-opt", "name="+strings.Join(targets, ","),
 			"--exporter-opt", "push=true",
 		)
+		if buildJob.Spec.Registry.Insecure {
+			podSpec.Containers[0].Command = append(podSpec.Containers[0].Command, "--exporter-opt", "registry.insecure=true")
+		}
+		podSpec.Containers[0].Command = append(podSpec.Containers[0].Command,
+			"--metadata-file", corev1.TerminationMessagePathDefault,
+		)
+	}
+	if cacheRef := buildJob.Spec.Registry.CacheRef; cacheRef != "" {
+		podSpec.Containers[0].Command = append(podSpec.Containers[0].Command,
+			"--import-cache", cacheRef,
+			"--export-cache", cacheRef,
+		)
+	}
+	if buildJob.Spec.Output.Kind != crd.OutputKindNone {
+		exporter := "oci"
+		if buildJob.Spec.Output.Format == crd.OutputFormatDocker {
+			exporter = "docker"
+		}
+		podSpec.Containers[0].Command = append(podSpec.Containers[0].Command,
+			"--exporter="+exporter,
+			"--exporter-opt", "output="+cbipluginhelper.OutputArchivePath,
+		)
+		// the docker exporter requires the image name
+		if exporter == "docker" && len(targets) > 0 {
+			podSpec.Containers[0].Command = append(podSpec.Containers[0].Command, "--exporter-opt", "name="+strings.Join(targets, ","))
+		}
 	}
 	return podSpec
 }
@@ -83,28 +124,77 @@ func (b *BuildKit) CreatePodTemplateSpec(ctx context.Context, buildJob crd.Build
 	default:
 		return nil, fmt.Errorf("unsupported Spec.Language: %v", buildJob.Spec.Language)
 	}
-	podSpec := b.commonPodSpec(buildJob)
-	if buildJob.Spec.Registry.Push && buildJob.Spec.Registry.SecretRef.Name != "" {
-		if err := registryutil.InjectRegistrySecret(&podSpec, 0, "/root", buildJob.Spec.Registry.SecretRef); err != nil {
-			return nil, err
-		}
+	if buildJob.Spec.Registry.CASecretRef.Name != "" {
+		// needs to be configured on buildkitd side
+		return nil, fmt.Errorf("BuildKit plugin does not support Spec.Registry.CASecretRef")
+	}
+	targets, err := registryutil.Targets(buildJob.Spec.Registry)
+	if err != nil {
+		return nil, err
+	}
+	podSpec := b.commonPodSpec(buildJob, targets)
+	if err := b.Helper.InjectRegistrySecrets(&podSpec, 0, buildJob.Spec.Registry); err != nil {
+		return nil, err
 	}
 	injector := cbipluginhelper.Injector{
 		Helper:        b.Helper,
 		TargetPodSpec: &podSpec,
 	}
-	ctxInjector := cbipluginhelper.ContextInjector{
-		Injector: injector,
+	if contextURL, ok := buildJob.Annotations[pluginapi.AContextURL]; ok {
+		// BuildKit-native git access; the Dockerfile is also read from the repo
+		dockerfilePath, err := dockerfileutil.Path("/", buildJob.Spec.Language.Dockerfile)
+		if err != nil {
+			return nil, err
+		}
+		podSpec.Containers[0].Command = append(podSpec.Containers[0].Command, []string{
+			"--frontend-opt", "context=" + contextURL,
+			"--frontend-opt", "filename=" + strings.TrimPrefix(dockerfilePath, "/"),
+		}...)
+	} else {
+		ctxInjector := cbipluginhelper.ContextInjector{
+			Injector: injector,
+		}
+		// TODO: allow BuildKit-native git access with ssh key
+		ctxPath, err := ctxInjector.Inject(buildJob.Spec.Context)
+		if err != nil {
+			return nil, err
+		}
+		dockerfilePath, err := dockerfileutil.Path(ctxPath, buildJob.Spec.Language.Dockerfile)
+		if err != nil {
+			return nil, err
+		}
+		podSpec.Containers[0].Command = append(podSpec.Containers[0].Command, []string{
+			"--local", "context=" + ctxPath,
+			"--local", "dockerfile=" + filepath.Dir(dockerfilePath),
+			"--frontend-opt", "filename=" + filepath.Base(dockerfilePath),
+		}...)
+	}
+	if target := buildJob.Spec.Language.Dockerfile.Target; target != "" {
+		podSpec.Containers[0].Command = append(podSpec.Containers[0].Command, "--frontend-opt", "target="+target)
 	}
-	// TODO: allow BuildKit-native git access (with ssh key)
-	ctxPath, err := ctxInjector.Inject(buildJob.Spec.Context)
+	if platforms := buildJob.Spec.Platforms; len(platforms) > 0 {
+		podSpec.Containers[0].Command = append(podSpec.Containers[0].Command, "--frontend-opt", "platform="+strings.Join(platforms, ","))
+	}
+	buildArgs, buildArgsEnv, err := dockerfileutil.BuildArgs(buildJob.Spec.Language.Dockerfile)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range buildArgs {
+		podSpec.Containers[0].Command = append(podSpec.Containers[0].Command, "--frontend-opt", "build-arg:"+a)
+	}
+	podSpec.Containers[0].Env = append(podSpec.Containers[0].Env, buildArgsEnv...)
+	labels, err := labelutil.Labels(buildJob.Spec)
 	if err != nil {
 		return nil, err
 	}
-	podSpec.Containers[0].Command = append(podSpec.Containers[0].Command, []string{
-		"--local", "context=" + ctxPath,
-		"--local", "dockerfile=" + ctxPath,
-	}...)
+	for _, l := range labelutil.KeyValues(labels) {
+		podSpec.Containers[0].Command = append(podSpec.Containers[0].Command, "--frontend-opt", "label:"+l)
+	}
+	podSpec.Containers[0].Command = append(podSpec.Containers[0].Command, buildJob.Spec.ExtraArgs...)
+	// needs to be the last, as the build container is moved to the init containers
+	if err := injector.InjectOutput(buildJob.Spec.Output); err != nil {
+		return nil, err
+	}
 	return &corev1.PodTemplateSpec{
 		Spec: podSpec,
 	}, nil
@@ -19,6 +19,8 @@ package gcb
 import (
 	"context"
 	"fmt"
+	"regexp"
+	"sort"
 	"strings"
 
 	"github.com/cyphar/filepath-securejoin"
@@ -28,6 +30,8 @@ import (
 	pluginapi "github.com/containerbuilding/cbi/pkg/plugin/api"
 	"github.com/containerbuilding/cbi/pkg/plugin/base"
 	"github.com/containerbuilding/cbi/pkg/plugin/base/cbipluginhelper"
+	"github.com/containerbuilding/cbi/pkg/plugin/base/labelutil"
+	"github.com/containerbuilding/cbi/pkg/plugin/base/registryutil"
 )
 
 const (
@@ -47,12 +51,12 @@ var _ base.Backend = &GCB{}
 func (b *GCB) Info(ctx context.Context, req *pluginapi.InfoRequest) (*pluginapi.InfoResponse, error) {
 	res := &pluginapi.InfoResponse{
 		Labels: map[string]string{
-			pluginapi.LPluginName:                           "gcb",
-			pluginapi.LLanguage(crd.LanguageKindDockerfile): "",
-			pluginapi.LLanguage(crd.LanguageKindCloudbuild): "",
+			pluginapi.LPluginName:         "gcb",
+			pluginapi.LLanguageDockerfile: "",
+			pluginapi.LLanguageCloudbuild: "",
 		},
 	}
-	for k, v := range cbipluginhelper.Labels {
+	for k, v := range b.Helper.Labels() {
 		res.Labels[k] = v
 	}
 	return res, nil
@@ -85,16 +89,7 @@ func (b *GCB) commonPodSpec(buildJob crd.BuildJob) corev1.PodSpec {
 	}
 	podSpec := corev1.PodSpec{
 		RestartPolicy: corev1.RestartPolicyNever,
-		Volumes:       []corev1.Volume{rootConfigVol, secretVol},
-		InitContainers: []corev1.Container{
-			{
-				Name:         "cbi-gcb-init",
-				Image:        b.Image,
-				WorkingDir:   secretVolMount.MountPath,
-				Command:      []string{"gcloud", "auth", "activate-service-account", "--key-file=json"},
-				VolumeMounts: []corev1.VolumeMount{rootConfigVolMount, secretVolMount},
-			},
-		},
+		Volumes:       []corev1.Volume{rootConfigVol},
 		Containers: []corev1.Container{
 			{
 				Name:         "gcb-job",
@@ -105,6 +100,18 @@ func (b *GCB) commonPodSpec(buildJob crd.BuildJob) corev1.PodSpec {
 			},
 		},
 	}
+	// without the secret, gcloud uses the credentials of the service account of the pod,
+	// e.g. GKE Workload Identity
+	if buildJob.Annotations[AnnotationSecret] != "" {
+		podSpec.Volumes = append(podSpec.Volumes, secretVol)
+		podSpec.InitContainers = append(podSpec.InitContainers, corev1.Container{
+			Name:         "cbi-gcb-init",
+			Image:        b.Image,
+			WorkingDir:   secretVolMount.MountPath,
+			Command:      []string{"gcloud", "auth", "activate-service-account", "--key-file=json"},
+			VolumeMounts: []corev1.VolumeMount{rootConfigVolMount, secretVolMount},
+		})
+	}
 	return podSpec
 }
 
@@ -112,13 +119,26 @@ func (b *GCB) CreatePodTemplateSpec(ctx context.Context, buildJob crd.BuildJob)
 	if !buildJob.Spec.Registry.Push {
 		return nil, fmt.Errorf("GCB plugin requires Spec.Registry.Push to be true")
 	}
+	if err := registryutil.ValidateNoTLSConfig(buildJob.Spec.Registry, "GCB"); err != nil {
+		return nil, err
+	}
+	if err := labelutil.ValidateNoLabels(buildJob.Spec, "GCB"); err != nil {
+		return nil, err
+	}
+	if len(buildJob.Spec.Registry.AdditionalTargets) != 0 {
+		return nil, fmt.Errorf("GCB plugin does not support Spec.Registry.AdditionalTargets (use Cloudbuild language instead)")
+	}
 	if buildJob.Spec.Registry.SecretRef.Name != "" {
 		return nil, fmt.Errorf("GCB plugin requires Spec.Registry.SecretRef to be empty (use cbi-gcb/secret annotation instead with Google Cloud service account)")
 	}
-	for _, a := range []string{AnnotationSecret, AnnotationProject} {
-		if buildJob.Annotations[a] == "" {
-			return nil, fmt.Errorf("GCB plugin requires annotation %q", a)
-		}
+	if buildJob.Spec.Registry.PullSecretRef.Name != "" {
+		return nil, fmt.Errorf("GCB plugin requires Spec.Registry.PullSecretRef to be empty (use cbi-gcb/secret annotation instead with Google Cloud service account)")
+	}
+	if buildJob.Annotations[AnnotationProject] == "" {
+		return nil, fmt.Errorf("GCB plugin requires annotation %q", AnnotationProject)
+	}
+	if buildJob.Annotations[AnnotationSecret] == "" && buildJob.Spec.ServiceAccountName == "" {
+		return nil, fmt.Errorf("GCB plugin requires annotation %q, or Spec.ServiceAccountName bound to a Google Cloud service account", AnnotationSecret)
 	}
 	podSpec := b.commonPodSpec(buildJob)
 	injector := cbipluginhelper.Injector{
@@ -141,8 +161,19 @@ func (b *GCB) CreatePodTemplateSpec(ctx context.Context, buildJob crd.BuildJob)
 		if err != nil {
 			return nil, err
 		}
-		podSpec.Containers[0].Args = append(podSpec.Containers[0].Args, []string{"--config", yamlPath, ctxPath}...)
+		podSpec.Containers[0].Args = append(podSpec.Containers[0].Args, []string{"--config", yamlPath}...)
+		if subs := buildJob.Spec.Language.Cloudbuild.Substitutions; len(subs) != 0 {
+			flag, err := substitutionsFlag(subs)
+			if err != nil {
+				return nil, err
+			}
+			podSpec.Containers[0].Args = append(podSpec.Containers[0].Args, flag)
+		}
+		podSpec.Containers[0].Args = append(podSpec.Containers[0].Args, ctxPath)
 	case strings.ToLower(string(crd.LanguageKindDockerfile)):
+		if df := buildJob.Spec.Language.Dockerfile; df.Path != "" || df.Target != "" || len(df.BuildArgs) != 0 || len(df.BuildArgsFrom) != 0 {
+			return nil, fmt.Errorf("GCB plugin does not support Spec.Language.Dockerfile.{Path,Target,BuildArgs,BuildArgsFrom} (use Cloudbuild language instead)")
+		}
 		podSpec.Containers[0].Args = append(podSpec.Containers[0].Args, []string{"-t", buildJob.Spec.Registry.Target, ctxPath}...)
 	default:
 		return nil, fmt.Errorf("unsupported Spec.Language: %v", buildJob.Spec.Language)
@@ -151,3 +182,32 @@ func (b *GCB) CreatePodTemplateSpec(ctx context.Context, buildJob crd.BuildJob)
 		Spec: podSpec,
 	}, nil
 }
+
+var substitutionKeyRegexp = regexp.MustCompile(`^_[A-Z0-9_]+$`)
+
+// substitutionsFlag returns the `--substitutions` flag for `gcloud container builds submit`.
+// Keys are sorted so that the generated pod specs are stable.
+func substitutionsFlag(subs map[string]string) (string, error) {
+	keys := make([]string, 0, len(subs))
+	for k := range subs {
+		if !substitutionKeyRegexp.MatchString(k) {
+			return "", fmt.Errorf("invalid Spec.Language.Cloudbuild.Substitutions key %q: user-defined substitutions need to match %s", k, substitutionKeyRegexp.String())
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	kvs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		kvs = append(kvs, k+"="+subs[k])
+	}
+	// gcloud supports an alternative delimiter as "^DELIM^" for values that contain commas (see `gcloud topic escaping`)
+	for _, delim := range []string{",", ";", "|", "~", "#"} {
+		if !strings.Contains(strings.Join(kvs, ""), delim) {
+			if delim == "," {
+				return "--substitutions=" + strings.Join(kvs, delim), nil
+			}
+			return "--substitutions=^" + delim + "^" + strings.Join(kvs, delim), nil
+		}
+	}
+	return "", fmt.Errorf("Spec.Language.Cloudbuild.Substitutions values cannot be escaped")
+}
@@ -0,0 +1,122 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gcb
+
+import (
+	"context"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	crd "github.com/containerbuilding/cbi/pkg/apis/cbi/v1alpha1"
+	"github.com/containerbuilding/cbi/pkg/plugin/base/cbipluginhelper"
+)
+
+func TestSubstitutionsFlag(t *testing.T) {
+	cases := []struct {
+		subs     map[string]string
+		expected string
+		invalid  bool
+	}{
+		{
+			subs:     map[string]string{"_FOO": "foo", "_BAR": "bar", "_BAZ_2": ""},
+			expected: "--substitutions=_BAR=bar,_BAZ_2=,_FOO=foo",
+		},
+		{
+			subs:     map[string]string{"_FOO": "a,b", "_BAR": "c"},
+			expected: "--substitutions=^;^_BAR=c;_FOO=a,b",
+		},
+		{
+			subs:    map[string]string{"FOO": "foo"},
+			invalid: true,
+		},
+		{
+			subs:    map[string]string{"_foo": "foo"},
+			invalid: true,
+		},
+		{
+			subs:    map[string]string{"_": "foo"},
+			invalid: true,
+		},
+	}
+	for _, c := range cases {
+		actual, err := substitutionsFlag(c.subs)
+		if err != nil && !c.invalid {
+			t.Fatalf("%v: %v", c.subs, err)
+		}
+		if err == nil {
+			if c.invalid {
+				t.Fatalf("%v: error is expected", c.subs)
+			} else if c.expected != actual {
+				t.Fatalf("%v: expected %q, got %q", c.subs, c.expected, actual)
+			}
+		}
+	}
+}
+
+func TestCreatePodTemplateSpecCredentials(t *testing.T) {
+	b := &GCB{Image: "gcloud", Helper: cbipluginhelper.Helper{Image: "cbipluginhelper", HomeDir: "/root"}}
+	cases := []struct {
+		annotations        map[string]string
+		serviceAccountName string
+		expectedInit       bool
+		expectedErr        bool
+	}{
+		{
+			annotations:  map[string]string{AnnotationProject: "foo", AnnotationSecret: "my-gcb"},
+			expectedInit: true,
+		},
+		{
+			annotations:        map[string]string{AnnotationProject: "foo"},
+			serviceAccountName: "builder",
+		},
+		{
+			annotations: map[string]string{AnnotationProject: "foo"},
+			expectedErr: true,
+		},
+	}
+	for _, c := range cases {
+		bj := crd.BuildJob{
+			ObjectMeta: metav1.ObjectMeta{Annotations: c.annotations},
+			Spec: crd.BuildJobSpec{
+				Registry:           crd.Registry{Target: "gcr.io/example/foo", Push: true},
+				Language:           crd.Language{Kind: crd.LanguageKindDockerfile},
+				Context:            crd.Context{Kind: crd.ContextKindGit, Git: crd.Git{URL: "https://example.com/foo.git"}},
+				ServiceAccountName: c.serviceAccountName,
+			},
+		}
+		pts, err := b.CreatePodTemplateSpec(context.TODO(), bj)
+		if c.expectedErr {
+			if err == nil {
+				t.Fatalf("%+v: error is expected", c)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		hasInit := false
+		for _, ic := range pts.Spec.InitContainers {
+			if ic.Name == "cbi-gcb-init" {
+				hasInit = true
+			}
+		}
+		if hasInit != c.expectedInit {
+			t.Fatalf("%+v: expected the gcloud auth init container to be %v, got %+v", c, c.expectedInit, pts.Spec.InitContainers)
+		}
+	}
+}
@@ -27,6 +27,8 @@ import (
 	pluginapi "github.com/containerbuilding/cbi/pkg/plugin/api"
 	"github.com/containerbuilding/cbi/pkg/plugin/base"
 	"github.com/containerbuilding/cbi/pkg/plugin/base/cbipluginhelper"
+	"github.com/containerbuilding/cbi/pkg/plugin/base/dockerfileutil"
+	"github.com/containerbuilding/cbi/pkg/plugin/base/labelutil"
 	"github.com/containerbuilding/cbi/pkg/plugin/base/registryutil"
 )
 
@@ -40,57 +42,65 @@ var _ base.Backend = &Img{}
 func (b *Img) Info(ctx context.Context, req *pluginapi.InfoRequest) (*pluginapi.InfoResponse, error) {
 	res := &pluginapi.InfoResponse{
 		Labels: map[string]string{
-			pluginapi.LPluginName:                           "img",
-			pluginapi.LLanguage(crd.LanguageKindDockerfile): "",
+			pluginapi.LPluginName:             "img",
+			pluginapi.LLanguageDockerfile:     "",
+			pluginapi.LRegistryMultiTarget:    "",
+			pluginapi.LBuildExtraArgs:         "",
+			pluginapi.LRegistryPushRetry:      "",
+			pluginapi.LRegistryTargetTemplate: "",
+			pluginapi.LPlatformSingle:         "",
+			pluginapi.LBuildRootless:          "",
 		},
 	}
-	for k, v := range cbipluginhelper.Labels {
+	for k, v := range b.Helper.Labels() {
 		res.Labels[k] = v
 	}
 	return res, nil
 }
 
-func (b *Img) commonPodSpec(buildJob crd.BuildJob) corev1.PodSpec {
+func (b *Img) commonPodSpec(buildJob crd.BuildJob) (*corev1.PodSpec, error) {
 	push := "0"
 	if buildJob.Spec.Registry.Push {
 		push = "1"
 	}
-	// TODO(AkihiroSuda): support non-privileged
 	privileged := true
-	podSpec := corev1.PodSpec{
-		RestartPolicy: corev1.RestartPolicyNever,
-		Containers: []corev1.Container{
-			{
-				Name:    "img-job",
-				Image:   b.Image,
-				Command: []string{
-					// needs to be "docker-build-push.sh", not img itself.
-				},
-				Env: []corev1.EnvVar{
-					{
-						Name:  "DBP_DOCKER_BINARY",
-						Value: "img",
-					},
-					{
-						Name:  "DBP_IMAGE_NAME",
-						Value: buildJob.Spec.Registry.Target,
-					},
-					{
-						Name:  "DBP_DIALECT",
-						Value: "docker",
-					},
-					{
-						Name:  "DBP_PUSH",
-						Value: push,
-					},
-				},
-				SecurityContext: &corev1.SecurityContext{
-					Privileged: &privileged,
-				},
-			},
+	podSpec, idx, err := cbipluginhelper.NewBuildJobPodSpec(&buildJob, b.Helper)
+	if err != nil {
+		return nil, err
+	}
+	c := &podSpec.Containers[idx]
+	c.Name = "img-job"
+	c.Image = b.Image
+	// c.Command needs to be "docker-build-push.sh", not img itself.
+	c.Env = []corev1.EnvVar{
+		{
+			Name:  "DBP_DOCKER_BINARY",
+			Value: "img",
+		},
+		{
+			Name:  "DBP_IMAGE_NAME",
+			Value: buildJob.Spec.Registry.Target,
+		},
+		{
+			Name:  "DBP_DIALECT",
+			Value: "docker",
+		},
+		{
+			Name:  "DBP_PUSH",
+			Value: push,
+		},
+		{
+			Name:  "DBP_TERMINATION_MESSAGE_PATH",
+			Value: corev1.TerminationMessagePathDefault,
 		},
 	}
-	return podSpec
+	// Spec.Rootless is configured by InjectRootless
+	if !buildJob.Spec.Rootless {
+		c.SecurityContext = &corev1.SecurityContext{
+			Privileged: &privileged,
+		}
+	}
+	return podSpec, nil
 }
 
 func (b *Img) CreatePodTemplateSpec(ctx context.Context, buildJob crd.BuildJob) (*corev1.PodTemplateSpec, error) {
@@ -100,15 +110,31 @@ func (b *Img) CreatePodTemplateSpec(ctx context.Context, buildJob crd.BuildJob)
 	default:
 		return nil, fmt.Errorf("unsupported Spec.Language: %v", buildJob.Spec.Language)
 	}
-	podSpec := b.commonPodSpec(buildJob)
-	if buildJob.Spec.Registry.Push && buildJob.Spec.Registry.SecretRef.Name != "" {
-		if err := registryutil.InjectRegistrySecret(&podSpec, 0, "/root", buildJob.Spec.Registry.SecretRef); err != nil {
-			return nil, err
-		}
+	if buildJob.Spec.Registry.Insecure {
+		return nil, fmt.Errorf("img plugin does not support Spec.Registry.Insecure")
+	}
+	if len(buildJob.Spec.Platforms) > 1 {
+		return nil, fmt.Errorf("img plugin does not support multiple Spec.Platforms")
+	}
+	podSpec, err := b.commonPodSpec(buildJob)
+	if err != nil {
+		return nil, err
+	}
+	targets, err := registryutil.Targets(buildJob.Spec.Registry)
+	if err != nil {
+		return nil, err
+	}
+	podSpec.Containers[0].Env = append(podSpec.Containers[0].Env, corev1.EnvVar{
+		Name:  "DBP_ADDITIONAL_IMAGE_NAMES",
+		Value: strings.Join(targets[1:], " "),
+	})
+	podSpec.Containers[0].Env = append(podSpec.Containers[0].Env, registryutil.PushRetriesEnv(buildJob.Spec.Registry)...)
+	if err := registryutil.InjectRegistryCA(podSpec, 0, buildJob.Spec.Registry, registryutil.CAMountSystemCertDir); err != nil {
+		return nil, err
 	}
 	injector := cbipluginhelper.Injector{
 		Helper:        b.Helper,
-		TargetPodSpec: &podSpec,
+		TargetPodSpec: podSpec,
 	}
 	dbpPath, err := injector.InjectFile("/docker-build-push.sh")
 	if err != nil {
@@ -122,10 +148,45 @@ func (b *Img) CreatePodTemplateSpec(ctx context.Context, buildJob crd.BuildJob)
 	if err != nil {
 		return nil, err
 	}
-	podSpec.Containers[0].Command = append(podSpec.Containers[0].Command, []string{
-		ctxPath,
-	}...)
-	return &corev1.PodTemplateSpec{
-		Spec: podSpec,
-	}, nil
+	dockerfileFlags, err := dockerfileutil.DockerBuildFlags(ctxPath, buildJob.Spec.Language.Dockerfile)
+	if err != nil {
+		return nil, err
+	}
+	podSpec.Containers[0].Command = append(podSpec.Containers[0].Command, dockerfileFlags...)
+	for _, p := range buildJob.Spec.Platforms {
+		podSpec.Containers[0].Command = append(podSpec.Containers[0].Command, "--platform", p)
+	}
+	buildArgs, buildArgsEnv, err := dockerfileutil.BuildArgs(buildJob.Spec.Language.Dockerfile)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range buildArgs {
+		podSpec.Containers[0].Command = append(podSpec.Containers[0].Command, "--build-arg", a)
+	}
+	podSpec.Containers[0].Env = append(podSpec.Containers[0].Env, buildArgsEnv...)
+	labels, err := labelutil.Labels(buildJob.Spec)
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range labelutil.KeyValues(labels) {
+		podSpec.Containers[0].Command = append(podSpec.Containers[0].Command, "--label", l)
+	}
+	if labelutil.NeedsResolvedRevision(buildJob.Spec, labels) {
+		podSpec.Containers[0].Env = append(podSpec.Containers[0].Env, corev1.EnvVar{
+			Name:  "DBP_REVISION_FILE",
+			Value: ctxInjector.ResolvedRevisionFile(),
+		})
+	}
+	podSpec.Containers[0].Env = append(podSpec.Containers[0].Env, registryutil.TargetTemplateEnv(buildJob.Spec.Registry, ctxInjector.ResolvedRevisionFile())...)
+	podSpec.Containers[0].Command = append(podSpec.Containers[0].Command, buildJob.Spec.ExtraArgs...)
+	podSpec.Containers[0].Command = append(podSpec.Containers[0].Command, ctxPath)
+	pts := &corev1.PodTemplateSpec{
+		Spec: *podSpec,
+	}
+	if buildJob.Spec.Rootless {
+		if err := cbipluginhelper.InjectRootless(pts, 0, cbipluginhelper.RootlessOptions{}); err != nil {
+			return nil, err
+		}
+	}
+	return pts, nil
 }
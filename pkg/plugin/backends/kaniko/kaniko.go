@@ -27,6 +27,8 @@ import (
 	pluginapi "github.com/containerbuilding/cbi/pkg/plugin/api"
 	"github.com/containerbuilding/cbi/pkg/plugin/base"
 	"github.com/containerbuilding/cbi/pkg/plugin/base/cbipluginhelper"
+	"github.com/containerbuilding/cbi/pkg/plugin/base/dockerfileutil"
+	"github.com/containerbuilding/cbi/pkg/plugin/base/labelutil"
 	"github.com/containerbuilding/cbi/pkg/plugin/base/registryutil"
 )
 
@@ -40,11 +42,22 @@ var _ base.Backend = &Kaniko{}
 func (b *Kaniko) Info(ctx context.Context, req *pluginapi.InfoRequest) (*pluginapi.InfoResponse, error) {
 	res := &pluginapi.InfoResponse{
 		Labels: map[string]string{
-			pluginapi.LPluginName:                           "kaniko",
-			pluginapi.LLanguage(crd.LanguageKindDockerfile): "",
+			pluginapi.LPluginName:          "kaniko",
+			pluginapi.LLanguageDockerfile:  "",
+			pluginapi.LRegistryInsecure:    "",
+			pluginapi.LRegistryMultiTarget: "",
+			pluginapi.LBuildExtraArgs:      "",
+			pluginapi.LOutputArchive:       "",
+			pluginapi.LPlatformSingle:      "",
+			pluginapi.LBuildSecrets:        "",
+			pluginapi.LBuildNetrc:          "",
 		},
 	}
-	for k, v := range cbipluginhelper.Labels {
+	// the helpers shipped in the kaniko executor image
+	for _, h := range []string{"ecr-login", "gcr", "acr-env"} {
+		res.Labels[pluginapi.LRegistryCredentialHelper(h)] = ""
+	}
+	for k, v := range b.Helper.Labels() {
 		res.Labels[k] = v
 	}
 	return res, nil
@@ -70,12 +83,30 @@ func (b *Kaniko) CreatePodTemplateSpec(ctx context.Context, buildJob crd.BuildJo
 	default:
 		return nil, fmt.Errorf("unsupported Spec.Language: %v", buildJob.Spec.Language)
 	}
-	podSpec := b.commonPodSpec(buildJob)
-	if buildJob.Spec.Registry.Push && buildJob.Spec.Registry.SecretRef.Name != "" {
-		if err := registryutil.InjectRegistrySecret(&podSpec, 0, "/root", buildJob.Spec.Registry.SecretRef); err != nil {
-			return nil, err
+	output := buildJob.Spec.Output
+	if output.Kind != crd.OutputKindNone {
+		if output.Format != crd.OutputFormatDefault && output.Format != crd.OutputFormatDocker {
+			return nil, fmt.Errorf("kaniko plugin supports only %q format for Spec.Output, got %q", crd.OutputFormatDocker, output.Format)
+		}
+		if buildJob.Spec.Registry.Target == "" {
+			// the image name in the archive
+			return nil, fmt.Errorf("kaniko plugin requires Spec.Registry.Target for Spec.Output")
 		}
 	}
+	if len(buildJob.Spec.Platforms) > 1 {
+		return nil, fmt.Errorf("kaniko plugin does not support multiple Spec.Platforms")
+	}
+	podSpec := b.commonPodSpec(buildJob)
+	if err := b.Helper.InjectRegistrySecrets(&podSpec, 0, buildJob.Spec.Registry); err != nil {
+		return nil, err
+	}
+	// RUN instructions see the secrets, while kaniko excludes the mounted volumes from the snapshots
+	if err := cbipluginhelper.InjectBuildSecrets(&podSpec, 0, buildJob.Spec.BuildSecrets); err != nil {
+		return nil, err
+	}
+	if err := b.Helper.InjectNetrc(&podSpec, 0, buildJob.Spec.NetrcSecretRef); err != nil {
+		return nil, err
+	}
 	injector := cbipluginhelper.Injector{
 		Helper:        b.Helper,
 		TargetPodSpec: &podSpec,
@@ -88,14 +119,61 @@ func (b *Kaniko) CreatePodTemplateSpec(ctx context.Context, buildJob crd.BuildJo
 	if err != nil {
 		return nil, err
 	}
+	dockerfilePath, err := dockerfileutil.Path(ctxPath, buildJob.Spec.Language.Dockerfile)
+	if err != nil {
+		return nil, err
+	}
 	podSpec.Containers[0].Args = append(podSpec.Containers[0].Args, []string{
-		"--dockerfile=" + ctxPath + "/Dockerfile",
+		"--dockerfile=" + dockerfilePath,
 		"--context=" + ctxPath,
-		"--destination=" + buildJob.Spec.Registry.Target,
 	}...)
-	if !buildJob.Spec.Registry.Push {
+	targets, err := registryutil.Targets(buildJob.Spec.Registry)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range targets {
+		podSpec.Containers[0].Args = append(podSpec.Containers[0].Args, "--destination="+t)
+	}
+	if target := buildJob.Spec.Language.Dockerfile.Target; target != "" {
+		podSpec.Containers[0].Args = append(podSpec.Containers[0].Args, "--target="+target)
+	}
+	for _, p := range buildJob.Spec.Platforms {
+		podSpec.Containers[0].Args = append(podSpec.Containers[0].Args, "--customPlatform="+p)
+	}
+	buildArgs, buildArgsEnv, err := dockerfileutil.BuildArgs(buildJob.Spec.Language.Dockerfile)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range buildArgs {
+		podSpec.Containers[0].Args = append(podSpec.Containers[0].Args, "--build-arg="+a)
+	}
+	podSpec.Containers[0].Env = append(podSpec.Containers[0].Env, buildArgsEnv...)
+	labels, err := labelutil.Labels(buildJob.Spec)
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range labelutil.KeyValues(labels) {
+		podSpec.Containers[0].Args = append(podSpec.Containers[0].Args, "--label="+l)
+	}
+	if buildJob.Spec.Registry.Insecure {
+		podSpec.Containers[0].Args = append(podSpec.Containers[0].Args, "--insecure", "--skip-tls-verify")
+	}
+	if err := registryutil.InjectRegistryCA(&podSpec, 0, buildJob.Spec.Registry, registryutil.CAMountKaniko); err != nil {
+		return nil, err
+	}
+	switch {
+	case buildJob.Spec.Registry.Push:
+		podSpec.Containers[0].Args = append(podSpec.Containers[0].Args, "--digest-file="+corev1.TerminationMessagePathDefault)
+	case output.Kind != crd.OutputKindNone:
+		podSpec.Containers[0].Args = append(podSpec.Containers[0].Args, "--tarPath="+cbipluginhelper.OutputArchivePath)
+	default:
 		podSpec.Containers[0].Args = append(podSpec.Containers[0].Args, "--tarPath=/dev/null")
 	}
+	podSpec.Containers[0].Args = append(podSpec.Containers[0].Args, buildJob.Spec.ExtraArgs...)
+	// needs to be the last, as the build container is moved to the init containers
+	if err := injector.InjectOutput(output); err != nil {
+		return nil, err
+	}
 	return &corev1.PodTemplateSpec{
 		Spec: podSpec,
 	}, nil
@@ -27,6 +27,8 @@ import (
 	pluginapi "github.com/containerbuilding/cbi/pkg/plugin/api"
 	"github.com/containerbuilding/cbi/pkg/plugin/base"
 	"github.com/containerbuilding/cbi/pkg/plugin/base/cbipluginhelper"
+	"github.com/containerbuilding/cbi/pkg/plugin/base/envutil"
+	"github.com/containerbuilding/cbi/pkg/plugin/base/labelutil"
 	"github.com/containerbuilding/cbi/pkg/plugin/base/registryutil"
 )
 
@@ -37,14 +39,18 @@ type S2I struct {
 
 var _ base.Backend = &S2I{}
 
+// EnvPrefix is the prefix of the environment variables that hold the values of Spec.Language.S2I.Env sourced via ValueFrom.
+const EnvPrefix = "CBI_S2I_ENV_"
+
 func (b *S2I) Info(ctx context.Context, req *pluginapi.InfoRequest) (*pluginapi.InfoResponse, error) {
 	res := &pluginapi.InfoResponse{
 		Labels: map[string]string{
-			pluginapi.LPluginName:                    "s2i",
-			pluginapi.LLanguage(crd.LanguageKindS2I): "",
+			pluginapi.LPluginName:          "s2i",
+			pluginapi.LLanguageS2I:         "",
+			pluginapi.LRegistryMultiTarget: "",
 		},
 	}
-	for k, v := range cbipluginhelper.Labels {
+	for k, v := range b.Helper.Labels() {
 		res.Labels[k] = v
 	}
 	return res, nil
@@ -56,7 +62,7 @@ func (b *S2I) commonPodSpec(buildJob crd.BuildJob) corev1.PodSpec {
 		push = "1"
 	}
 	hostPathFile := corev1.HostPathFile
-	// TODO(AkihiroSuda): support NodeSelector
+	// Spec.NodeSelector, Spec.Tolerations, and Spec.Affinity are applied by the controller (see pkg/cbid/controller/scheduling.go)
 	podSpec := corev1.PodSpec{
 		RestartPolicy: corev1.RestartPolicyNever,
 		Containers: []corev1.Container{
@@ -113,11 +119,23 @@ func (b *S2I) CreatePodTemplateSpec(ctx context.Context, buildJob crd.BuildJob)
 	if buildJob.Spec.Registry.Target == "" {
 		return nil, fmt.Errorf("Spec.Registry.Target is required")
 	}
+	if err := registryutil.ValidateNoTLSConfig(buildJob.Spec.Registry, "S2I"); err != nil {
+		return nil, err
+	}
+	if err := labelutil.ValidateNoLabels(buildJob.Spec, "S2I"); err != nil {
+		return nil, err
+	}
 	podSpec := b.commonPodSpec(buildJob)
-	if buildJob.Spec.Registry.Push && buildJob.Spec.Registry.SecretRef.Name != "" {
-		if err := registryutil.InjectRegistrySecret(&podSpec, 0, "/root", buildJob.Spec.Registry.SecretRef); err != nil {
-			return nil, err
-		}
+	targets, err := registryutil.Targets(buildJob.Spec.Registry)
+	if err != nil {
+		return nil, err
+	}
+	podSpec.Containers[0].Env = append(podSpec.Containers[0].Env, corev1.EnvVar{
+		Name:  "SBP_ADDITIONAL_IMAGE_NAMES",
+		Value: strings.Join(targets[1:], " "),
+	})
+	if err := b.Helper.InjectRegistrySecrets(&podSpec, 0, buildJob.Spec.Registry); err != nil {
+		return nil, err
 	}
 	injector := cbipluginhelper.Injector{
 		Helper:        b.Helper,
@@ -135,6 +153,14 @@ func (b *S2I) CreatePodTemplateSpec(ctx context.Context, buildJob crd.BuildJob)
 		return nil, err
 	}
 	podSpec.Containers[0].Command = []string{sbpPath, ctxPath, buildJob.Spec.Language.S2I.BaseImage, buildJob.Spec.Registry.Target}
+	envArgs, envArgsEnv, err := envutil.KeyValueArgs(EnvPrefix, buildJob.Spec.Language.S2I.Env)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range envArgs {
+		podSpec.Containers[0].Command = append(podSpec.Containers[0].Command, "-e", a)
+	}
+	podSpec.Containers[0].Env = append(podSpec.Containers[0].Env, envArgsEnv...)
 	return &corev1.PodTemplateSpec{
 		Spec: podSpec,
 	}, nil
@@ -0,0 +1,86 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package s2i
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+
+	crd "github.com/containerbuilding/cbi/pkg/apis/cbi/v1alpha1"
+	"github.com/containerbuilding/cbi/pkg/plugin/base/cbipluginhelper"
+)
+
+func TestCreatePodTemplateSpecEnv(t *testing.T) {
+	b := &S2I{
+		Image: "s2i",
+		Helper: cbipluginhelper.Helper{
+			Image:   "cbipluginhelper",
+			HomeDir: "/root",
+		},
+	}
+	valueFrom := &corev1.EnvVarSource{
+		SecretKeyRef: &corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: "secret"},
+			Key:                  "token",
+		},
+	}
+	buildJob := crd.BuildJob{
+		Spec: crd.BuildJobSpec{
+			Registry: crd.Registry{
+				Target: "example.com/foo",
+			},
+			Language: crd.Language{
+				Kind: crd.LanguageKindS2I,
+				S2I: crd.S2I{
+					BaseImage: "centos/ruby-22-centos7",
+					Env: []corev1.EnvVar{
+						{Name: "UPGRADE_PIP_TO_LATEST", Value: "1"},
+						{Name: "TOKEN", ValueFrom: valueFrom},
+					},
+				},
+			},
+			Context: crd.Context{
+				Kind: crd.ContextKindGit,
+				Git: crd.Git{
+					URL: "https://example.com/foo.git",
+				},
+			},
+		},
+	}
+	podTemplateSpec, err := b.CreatePodTemplateSpec(context.TODO(), buildJob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	container := podTemplateSpec.Spec.Containers[0]
+	expectedArgs := []string{"-e", "UPGRADE_PIP_TO_LATEST=1", "-e", "TOKEN=$(CBI_S2I_ENV_TOKEN)"}
+	actualArgs := container.Command[len(container.Command)-len(expectedArgs):]
+	if !reflect.DeepEqual(expectedArgs, actualArgs) {
+		t.Fatalf("expected %v, got %v", expectedArgs, container.Command)
+	}
+	found := false
+	for _, e := range container.Env {
+		if e.Name == "CBI_S2I_ENV_TOKEN" {
+			found = reflect.DeepEqual(valueFrom, e.ValueFrom)
+		}
+	}
+	if !found {
+		t.Fatalf("CBI_S2I_ENV_TOKEN not found in %+v", container.Env)
+	}
+}
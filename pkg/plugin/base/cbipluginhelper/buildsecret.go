@@ -0,0 +1,62 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cbipluginhelper
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+
+	crd "github.com/containerbuilding/cbi/pkg/apis/cbi/v1alpha1"
+)
+
+// InjectBuildSecrets mounts BuildJobSpec.BuildSecrets read-only on the target container.
+// The secrets are not mounted on the init containers.
+func InjectBuildSecrets(podSpec *corev1.PodSpec, containerIdx int, secrets []crd.SecretMount) error {
+	if containerIdx < 0 || containerIdx >= len(podSpec.Containers) {
+		return fmt.Errorf("invalid container index %d", containerIdx)
+	}
+	for i, s := range secrets {
+		if s.SecretRef.Name == "" || s.MountPath == "" {
+			return fmt.Errorf("invalid build secret %+v", s)
+		}
+		volName := fmt.Sprintf("cbi-buildsecret-%d", i)
+		vol := corev1.Volume{
+			Name: volName,
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{
+					SecretName:  s.SecretRef.Name,
+					Items:       s.Items,
+					DefaultMode: s.DefaultMode,
+				},
+			},
+		}
+		if s.Optional {
+			optional := true
+			vol.Secret.Optional = &optional
+		}
+		podSpec.Volumes = append(podSpec.Volumes, vol)
+		podSpec.Containers[containerIdx].VolumeMounts = append(podSpec.Containers[containerIdx].VolumeMounts,
+			corev1.VolumeMount{
+				Name:      volName,
+				MountPath: s.MountPath,
+				ReadOnly:  true,
+			},
+		)
+	}
+	return nil
+}
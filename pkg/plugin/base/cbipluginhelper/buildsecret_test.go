@@ -0,0 +1,89 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cbipluginhelper
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+
+	crd "github.com/containerbuilding/cbi/pkg/apis/cbi/v1alpha1"
+)
+
+func TestInjectBuildSecrets(t *testing.T) {
+	mode := int32(0400)
+	secrets := []crd.SecretMount{
+		{
+			SecretRef: corev1.LocalObjectReference{Name: "npmrc"},
+			MountPath: "/cbi-secrets/npm",
+		},
+		{
+			SecretRef:   corev1.LocalObjectReference{Name: "maven"},
+			MountPath:   "/root/.m2",
+			Items:       []corev1.KeyToPath{{Key: "settings.xml", Path: "settings.xml"}},
+			DefaultMode: &mode,
+			Optional:    true,
+		},
+	}
+	podSpec := &corev1.PodSpec{
+		InitContainers: []corev1.Container{{Name: "cbi-init"}},
+		Containers:     []corev1.Container{{Name: DefaultBuildContainerName}},
+	}
+	if err := InjectBuildSecrets(podSpec, 0, secrets); err != nil {
+		t.Fatal(err)
+	}
+	expectedMounts := []corev1.VolumeMount{
+		{Name: "cbi-buildsecret-0", MountPath: "/cbi-secrets/npm", ReadOnly: true},
+		{Name: "cbi-buildsecret-1", MountPath: "/root/.m2", ReadOnly: true},
+	}
+	if mounts := podSpec.Containers[0].VolumeMounts; !reflect.DeepEqual(mounts, expectedMounts) {
+		t.Fatalf("expected %+v, got %+v", expectedMounts, mounts)
+	}
+	if mounts := podSpec.InitContainers[0].VolumeMounts; len(mounts) != 0 {
+		t.Fatalf("build secrets should not be mounted on the init containers, got %+v", mounts)
+	}
+	optional := true
+	expectedVolumes := []corev1.Volume{
+		{
+			Name: "cbi-buildsecret-0",
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{SecretName: "npmrc"},
+			},
+		},
+		{
+			Name: "cbi-buildsecret-1",
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{
+					SecretName:  "maven",
+					Items:       []corev1.KeyToPath{{Key: "settings.xml", Path: "settings.xml"}},
+					DefaultMode: &mode,
+					Optional:    &optional,
+				},
+			},
+		},
+	}
+	if !reflect.DeepEqual(podSpec.Volumes, expectedVolumes) {
+		t.Fatalf("expected %+v, got %+v", expectedVolumes, podSpec.Volumes)
+	}
+	if err := InjectBuildSecrets(podSpec, 0, []crd.SecretMount{{MountPath: "/secrets"}}); err == nil {
+		t.Fatal("error is expected for empty secret name")
+	}
+	if err := InjectBuildSecrets(podSpec, 1, secrets); err == nil {
+		t.Fatal("error is expected for invalid container index")
+	}
+}
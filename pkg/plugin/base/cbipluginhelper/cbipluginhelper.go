@@ -18,13 +18,19 @@ package cbipluginhelper
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"os"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/cyphar/filepath-securejoin"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 
 	crd "github.com/containerbuilding/cbi/pkg/apis/cbi/v1alpha1"
 	pluginapi "github.com/containerbuilding/cbi/pkg/plugin/api"
@@ -40,8 +46,136 @@ func genRandomString() string {
 }
 
 type Helper struct {
-	Image   string
+	Image string
+	// HomeDir is the home directory of the user of the build container, e.g. /root.
+	// Needs to be an absolute path.
 	HomeDir string
+	// Resources is applied to the init containers that use the helper image.
+	Resources corev1.ResourceRequirements
+	// ImagePullPolicy is applied to the init containers that use the helper image.
+	// When empty, the Kubernetes default applies.
+	ImagePullPolicy corev1.PullPolicy
+	// SecurityContext is applied to the init containers that use the helper image.
+	// When nil, the field is left unset.
+	SecurityContext *corev1.SecurityContext
+	// Env is appended to the init containers that use the helper image, e.g. HTTP_PROXY.
+	Env []corev1.EnvVar
+	// LogFormat is the log format of the init containers that use the helper image, e.g. "json".
+	// When empty, the default of the helper image applies.
+	LogFormat string
+	// AllowLocalContext enables Local context, which uses hostPath volumes.
+	// Local context is only for local development.
+	AllowLocalContext bool
+	// MaxContextSize limits the size of the contexts populated by the init containers.
+	// The limit is applied as the sizeLimit of the emptyDir volumes, and the init containers
+	// fail when the populated context exceeds the limit.
+	// When zero, the size is not limited.
+	MaxContextSize resource.Quantity
+}
+
+// NewHelper returns a Helper with validated image and homeDir.
+func NewHelper(image, homeDir string) (Helper, error) {
+	h := Helper{
+		Image:   image,
+		HomeDir: homeDir,
+	}
+	if image == "" {
+		return h, fmt.Errorf("helper image needs to be specified")
+	}
+	if err := h.validateHomeDir(); err != nil {
+		return h, err
+	}
+	return h, nil
+}
+
+func (h *Helper) validateHomeDir() error {
+	if h.HomeDir == "" {
+		return fmt.Errorf("Helper.HomeDir needs to be specified")
+	}
+	if !filepath.IsAbs(h.HomeDir) {
+		return fmt.Errorf("Helper.HomeDir needs to be an absolute path, got %q", h.HomeDir)
+	}
+	return nil
+}
+
+// ProxyEnv returns the proxy environment variables (e.g. HTTP_PROXY) of the current process.
+func ProxyEnv() []corev1.EnvVar {
+	var env []corev1.EnvVar
+	for _, k := range []string{"HTTP_PROXY", "HTTPS_PROXY", "NO_PROXY", "http_proxy", "https_proxy", "no_proxy"} {
+		if v, ok := os.LookupEnv(k); ok {
+			env = append(env, corev1.EnvVar{Name: k, Value: v})
+		}
+	}
+	return env
+}
+
+// RestrictedSecurityContext returns a security context that drops all the capabilities and runs as non-root.
+// The secrets are mounted group-readable for the pod FSGroup under this security context,
+// and the SSH secrets are not supported, as ssh looks up $HOME/.ssh from the passwd entry.
+func RestrictedSecurityContext() *corev1.SecurityContext {
+	runAsNonRoot := true
+	runAsUser := int64(65534)
+	allowPrivilegeEscalation := false
+	return &corev1.SecurityContext{
+		Capabilities: &corev1.Capabilities{
+			Drop: []corev1.Capability{"ALL"},
+		},
+		RunAsNonRoot:             &runAsNonRoot,
+		RunAsUser:                &runAsUser,
+		AllowPrivilegeEscalation: &allowPrivilegeEscalation,
+	}
+}
+
+// runsAsNonRoot returns true if the helper containers run as a non-root user.
+func (h *Helper) runsAsNonRoot() bool {
+	sc := h.SecurityContext
+	return sc != nil && sc.RunAsUser != nil && *sc.RunAsUser != 0
+}
+
+// secretMode returns the mode of the secret volumes mounted on the helper containers in podSpec.
+// For non-root helpers, the pod FSGroup is set to the helper user unless already set,
+// so that the secrets owned by root are readable via the group.
+func (h *Helper) secretMode(podSpec *corev1.PodSpec) *int32 {
+	mode := int32(0400)
+	if !h.runsAsNonRoot() {
+		return &mode
+	}
+	if podSpec.SecurityContext == nil {
+		podSpec.SecurityContext = &corev1.PodSecurityContext{}
+	}
+	if podSpec.SecurityContext.FSGroup == nil {
+		fsGroup := *h.SecurityContext.RunAsUser
+		podSpec.SecurityContext.FSGroup = &fsGroup
+	}
+	mode = 0440
+	return &mode
+}
+
+// configureInitContainer applies the helper configuration to an init container that uses the helper image.
+func (h *Helper) configureInitContainer(c *corev1.Container) {
+	c.Resources = *h.Resources.DeepCopy()
+	c.ImagePullPolicy = h.ImagePullPolicy
+	c.SecurityContext = h.SecurityContext.DeepCopy()
+	for _, e := range h.Env {
+		c.Env = append(c.Env, *e.DeepCopy())
+	}
+	// the global flag needs to precede the subcommand of the entrypoint
+	if h.LogFormat != "" && len(c.Command) == 0 {
+		c.Args = append([]string{"--log-format=" + h.LogFormat}, c.Args...)
+	}
+	if !h.MaxContextSize.IsZero() && len(c.Command) == 0 {
+		c.Args = append([]string{"--max-context-size=" + strconv.FormatInt(h.MaxContextSize.Value(), 10)}, c.Args...)
+	}
+}
+
+// contextEmptyDir returns the emptyDir volume source for populating a context, limited by MaxContextSize.
+func (h *Helper) contextEmptyDir() *corev1.EmptyDirVolumeSource {
+	v := &corev1.EmptyDirVolumeSource{}
+	if !h.MaxContextSize.IsZero() {
+		sizeLimit := h.MaxContextSize.DeepCopy()
+		v.SizeLimit = &sizeLimit
+	}
+	return v
 }
 
 // Injector injects files using `cbipluginhelper` image.
@@ -85,58 +219,288 @@ func (ci *Injector) InjectFile(srcPath string) (string, error) {
 			},
 		},
 	}
+	ci.Helper.configureInitContainer(&initContainer)
 	ci.TargetPodSpec.InitContainers = append(ci.TargetPodSpec.InitContainers, initContainer)
 	return targetPath, nil
 }
 
+// DefaultNamePrefix is the default ContextInjector.NamePrefix.
+const DefaultNamePrefix = "cbi-"
+
 // ContextInjector injects build contexts using `cbipluginhelper` image.
 type ContextInjector struct {
 	Injector
+	// NamePrefix is prepended to the names of the volumes and the init containers,
+	// and to the mount paths. Defaults to DefaultNamePrefix.
+	// A distinct prefix is needed for injecting multiple contexts into the same pod spec.
+	NamePrefix string
+	// MountDir is the directory for mounting the volumes, in both the init containers
+	// and the target container. Defaults to "/".
+	// The secret volumes mounted on HomeDir are not affected.
+	MountDir string
+	// SkipConfigMapCopy mounts the ConfigMap context directly on the target container,
+	// without the init container that copies the files for eliminating symlinks.
+	// Only for plugins that can consume the symlinks of the ConfigMap volume.
+	// Ignored when ConfigMapArchiveKey is set.
+	SkipConfigMapCopy bool
+	// additional is true for injecting crd.Context.Additional.
+	// The additional contexts do not report the results (e.g. the resolved Git revision),
+	// so as not to override the results of the main context.
+	additional bool
+}
+
+// name returns the name of a volume or an init container, e.g. "cbi-gitcontext".
+func (ci *ContextInjector) name(s string) string {
+	prefix := ci.NamePrefix
+	if prefix == "" {
+		prefix = DefaultNamePrefix
+	}
+	return prefix + s
+}
+
+// mountPath returns the mount path of the volume.
+func (ci *ContextInjector) mountPath(volName string) string {
+	dir := ci.MountDir
+	if dir == "" {
+		dir = "/"
+	}
+	return filepath.Join(dir, volName)
+}
+
+var namePrefixRegexp = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[-a-z0-9])?$`)
+
+func (ci *ContextInjector) validate() error {
+	if ci.NamePrefix != "" && !namePrefixRegexp.MatchString(ci.NamePrefix) {
+		return fmt.Errorf("ContextInjector.NamePrefix needs to consist of lower case alphanumeric characters or '-', got %q", ci.NamePrefix)
+	}
+	if ci.MountDir != "" && !filepath.IsAbs(ci.MountDir) {
+		return fmt.Errorf("ContextInjector.MountDir needs to be an absolute path, got %q", ci.MountDir)
+	}
+	return nil
 }
 
-// Inject injects a context to podSpec and returns the context path
+// Inject injects a context to podSpec and returns the context path.
+// The additional contexts are merged into the context path in order.
+// When bjContext.DestPath is set, the context is also mounted on DestPath of the target container,
+// and DestPath is returned.
+// The returned error is *InjectError.
 func (ci *ContextInjector) Inject(bjContext crd.Context) (string, error) {
+	if err := ci.validate(); err != nil {
+		return "", newInjectError(bjContext.Kind, InjectErrorInvalidInjector, err)
+	}
+	if len(bjContext.Additional) != 0 && strings.EqualFold(string(bjContext.Kind), string(crd.ContextKindLocal)) {
+		// merging would modify the host directory
+		return "", newInjectError(bjContext.Kind, InjectErrorInvalidSpec, fmt.Errorf("Spec.Context.Additional is not supported for Local context"))
+	}
+	if len(bjContext.Additional) != 0 && strings.EqualFold(string(bjContext.Kind), string(crd.ContextKindPVC)) {
+		// merging would modify the volume
+		return "", newInjectError(bjContext.Kind, InjectErrorInvalidSpec, fmt.Errorf("Spec.Context.Additional is not supported for PVC context"))
+	}
+	idx := ci.TargetContainerIdx
+	nMounts := len(ci.TargetPodSpec.Containers[idx].VolumeMounts)
+	contextPath, err := ci.inject(bjContext)
+	if err != nil {
+		return "", err
+	}
+	// the volumes of the main context, to be mounted on the merging init containers
+	mounts := append([]corev1.VolumeMount(nil), ci.TargetPodSpec.Containers[idx].VolumeMounts[nMounts:]...)
+	for i, a := range bjContext.Additional {
+		if err := ci.injectAdditional(contextPath, mounts, i, a); err != nil {
+			return "", err
+		}
+	}
+	if bjContext.DestPath != "" {
+		destPath, err := ci.mountDestPath(contextPath, mounts, bjContext.DestPath)
+		return destPath, newInjectError(bjContext.Kind, InjectErrorInvalidSpec, err)
+	}
+	return contextPath, nil
+}
+
+// mountDestPath mounts contextPath on destPath of the target container, using the subPath of the
+// volume in mounts that contains contextPath.
+func (ci *ContextInjector) mountDestPath(contextPath string, mounts []corev1.VolumeMount, destPath string) (string, error) {
+	if !filepath.IsAbs(destPath) {
+		return "", fmt.Errorf("Spec.Context.DestPath needs to be an absolute path, got %q", destPath)
+	}
+	// the path is in the build container, so the symlinks on the plugin host are not evaluated
+	dest, err := securejoin.SecureJoinVFS("/", destPath, lexicalVFS{})
+	if err != nil {
+		return "", err
+	}
+	if dest == "/" {
+		return "", fmt.Errorf("Spec.Context.DestPath cannot be %q", destPath)
+	}
+	var (
+		found *corev1.VolumeMount
+		rel   string
+	)
+	for i, m := range mounts {
+		r, err := filepath.Rel(m.MountPath, contextPath)
+		if err != nil || r == ".." || strings.HasPrefix(r, "../") {
+			continue
+		}
+		// prefer the innermost mount
+		if found == nil || len(m.MountPath) > len(found.MountPath) {
+			found, rel = &mounts[i], r
+		}
+	}
+	if found == nil {
+		return "", fmt.Errorf("Spec.Context.DestPath is not supported for the context at %q", contextPath)
+	}
+	mount := corev1.VolumeMount{
+		Name:      found.Name,
+		MountPath: dest,
+		ReadOnly:  found.ReadOnly,
+	}
+	if rel != "." {
+		mount.SubPath = filepath.Join(found.SubPath, rel)
+	} else {
+		mount.SubPath = found.SubPath
+	}
+	idx := ci.TargetContainerIdx
+	ci.TargetPodSpec.Containers[idx].VolumeMounts = append(ci.TargetPodSpec.Containers[idx].VolumeMounts, mount)
+	return dest, nil
+}
+
+// lexicalVFS is a securejoin.VFS that regards all the paths as non-existent,
+// so that securejoin.SecureJoinVFS only cleans the paths lexically.
+type lexicalVFS struct{}
+
+func (lexicalVFS) Lstat(name string) (os.FileInfo, error) {
+	return nil, &os.PathError{Op: "lstat", Path: name, Err: os.ErrNotExist}
+}
+
+func (lexicalVFS) Readlink(name string) (string, error) {
+	return "", &os.PathError{Op: "readlink", Path: name, Err: os.ErrNotExist}
+}
+
+// inject injects bjContext without the additional contexts.
+// The returned error is *InjectError.
+func (ci *ContextInjector) inject(bjContext crd.Context) (string, error) {
+	if strings.EqualFold(string(bjContext.Kind), string(crd.ContextKindLocal)) && !ci.Helper.AllowLocalContext {
+		return "", newInjectError(bjContext.Kind, InjectErrorNotEnabled, fmt.Errorf("Local context is not enabled"))
+	}
+	contextPath, err := ci.injectKind(bjContext)
+	if err != nil {
+		return "", newInjectError(bjContext.Kind, InjectErrorInvalidSpec, err)
+	}
+	return contextPath, nil
+}
+
+func (ci *ContextInjector) injectKind(bjContext crd.Context) (string, error) {
 	switch k := strings.ToLower(string(bjContext.Kind)); k {
 	case strings.ToLower(string(crd.ContextKindConfigMap)):
-		return ci.injectConfigMap(bjContext.ConfigMapRef)
+		return ci.injectConfigMap(bjContext)
 	case strings.ToLower(string(crd.ContextKindGit)):
 		return ci.injectGit(bjContext.Git)
 	case strings.ToLower(string(crd.ContextKindHTTP)):
 		return ci.injectHTTP(bjContext.HTTP)
 	case strings.ToLower(string(crd.ContextKindRclone)):
 		return ci.injectRclone(bjContext.Rclone)
+	case strings.ToLower(string(crd.ContextKindLocal)):
+		return ci.injectLocal(bjContext.Local)
+	case strings.ToLower(string(crd.ContextKindS3)):
+		return ci.injectS3(bjContext.S3)
+	case strings.ToLower(string(crd.ContextKindGCS)):
+		return ci.injectGCS(bjContext.GCS)
+	case strings.ToLower(string(crd.ContextKindAzureBlob)):
+		return ci.injectAzureBlob(bjContext.AzureBlob)
+	case strings.ToLower(string(crd.ContextKindPVC)):
+		return ci.injectPVC(bjContext.PVC)
+	case strings.ToLower(string(crd.ContextKindOCI)):
+		return ci.injectOCI(bjContext.OCI)
 	default:
-		return "", fmt.Errorf("unsupported Spec.Context: %v", k)
+		return "", newInjectError(bjContext.Kind, InjectErrorUnsupportedKind, fmt.Errorf("unsupported Spec.Context: %v", k))
+	}
+}
+
+// injectAdditional injects the i-th additional context and an init container that copies
+// the additional context into contextPath, overwriting the existing files.
+// mounts are the volume mounts that contain contextPath.
+func (ci *ContextInjector) injectAdditional(contextPath string, mounts []corev1.VolumeMount, i int, bjContext crd.Context) error {
+	if len(bjContext.Additional) != 0 {
+		return newInjectError(bjContext.Kind, InjectErrorInvalidSpec, fmt.Errorf("Spec.Context.Additional[%d].Additional is not supported", i))
+	}
+	// the additional context is injected into a scratch pod spec, so that the
+	// volumes are mounted only on the init containers, not on the target container.
+	scratch := &corev1.PodSpec{
+		Containers: []corev1.Container{{}},
+	}
+	sub := *ci
+	sub.TargetPodSpec = scratch
+	sub.TargetContainerIdx = 0
+	sub.NamePrefix = ci.name(strconv.Itoa(i+1) + "-")
+	sub.additional = true
+	additionalPath, err := sub.inject(bjContext)
+	if err != nil {
+		// keep the kind and the reason of the additional context
+		ie := *err.(*InjectError)
+		ie.Err = fmt.Errorf("Spec.Context.Additional[%d]: %v", i, ie.Err)
+		return &ie
+	}
+	ci.TargetPodSpec.Volumes = append(ci.TargetPodSpec.Volumes, scratch.Volumes...)
+	ci.TargetPodSpec.InitContainers = append(ci.TargetPodSpec.InitContainers, scratch.InitContainers...)
+	initContainer := corev1.Container{
+		Name:  sub.name("merge"),
+		Image: ci.Helper.Image,
+		// "/." copies the content of the directory, including the dot files
+		Command:      []string{"cp", "-R", additionalPath + "/.", contextPath},
+		VolumeMounts: append(append([]corev1.VolumeMount(nil), mounts...), scratch.Containers[0].VolumeMounts...),
 	}
+	ci.Helper.configureInitContainer(&initContainer)
+	ci.TargetPodSpec.InitContainers = append(ci.TargetPodSpec.InitContainers, initContainer)
+	return nil
 }
 
 // injectConfigMap injects a config map to podSpec and returns the context path
-func (ci *ContextInjector) injectConfigMap(configMapRef corev1.LocalObjectReference) (string, error) {
-	const (
+func (ci *ContextInjector) injectConfigMap(spec crd.Context) (string, error) {
+	var (
 		// cmVol is a configmap volume (with symlinks)
-		cmVolName      = "cbi-cmcontext-tmp"
-		cmVolMountPath = "/cbi-cmcontext-tmp"
+		cmVolName      = ci.name("cmcontext-tmp")
+		cmVolMountPath = ci.mountPath(cmVolName)
 		// vol is an emptyDir volume (without symlinks)
-		volName           = "cbi-cmcontext"
-		volMountPath      = "/cbi-cmcontext"
+		volName           = ci.name("cmcontext")
+		volMountPath      = ci.mountPath(volName)
 		volContextSubpath = "context"
 		// initContainer is used for converting cmVol to vol so as to eliminate symlinks
-		initContainerName = "cbi-cmcontext-init"
+		// (or extracting the archive entry in cmVol to vol)
+		initContainerName = ci.name("cmcontext-init")
 	)
 	idx := ci.TargetContainerIdx
-	contextPath, _ := securejoin.SecureJoin(volMountPath, volContextSubpath)
 	cmVol := corev1.Volume{
 		Name: cmVolName,
 		VolumeSource: corev1.VolumeSource{
 			ConfigMap: &corev1.ConfigMapVolumeSource{
-				LocalObjectReference: configMapRef,
+				LocalObjectReference: spec.ConfigMapRef,
+				Items:                spec.ConfigMapItems,
+				DefaultMode:          spec.ConfigMapDefaultMode,
 			},
 		},
 	}
+	if ci.SkipConfigMapCopy && spec.ConfigMapArchiveKey == "" {
+		cmVol.Name = volName
+		ci.TargetPodSpec.Volumes = append(ci.TargetPodSpec.Volumes, cmVol)
+		ci.TargetPodSpec.Containers[idx].VolumeMounts = append(ci.TargetPodSpec.Containers[idx].VolumeMounts,
+			corev1.VolumeMount{
+				Name:      volName,
+				MountPath: volMountPath,
+				ReadOnly:  true,
+			},
+		)
+		return configMapSubPath(volMountPath, spec.ConfigMapSubPath)
+	}
+	// the main context with the additional contexts is modified by merging, so it cannot be shared
+	if spec.ContextCacheClaimRef.Name != "" && spec.ConfigMapResourceVersion != "" && len(spec.Additional) == 0 {
+		return ci.injectCachedConfigMap(spec, cmVol, cmVolMountPath, initContainerName)
+	}
+	contextPath, err := securejoin.SecureJoin(volMountPath, volContextSubpath)
+	if err != nil {
+		return "", err
+	}
 	vol := corev1.Volume{
 		Name: volName,
 		VolumeSource: corev1.VolumeSource{
-			EmptyDir: &corev1.EmptyDirVolumeSource{},
+			EmptyDir: ci.Helper.contextEmptyDir(),
 		},
 	}
 	ci.TargetPodSpec.Volumes = append(ci.TargetPodSpec.Volumes, cmVol, vol)
@@ -146,10 +510,16 @@ func (ci *ContextInjector) injectConfigMap(configMapRef corev1.LocalObjectRefere
 			MountPath: volMountPath,
 		},
 	)
+	// flags need to precede the positional args
+	args := []string{"populate-configmap"}
+	if spec.ConfigMapArchiveKey != "" {
+		args = append(args, "--archive-key", spec.ConfigMapArchiveKey)
+	}
+	args = append(args, cmVolMountPath, contextPath)
 	initContainer := corev1.Container{
-		Name:    initContainerName,
-		Image:   ci.Helper.Image,
-		Command: []string{"cp", "-rL", cmVolMountPath, contextPath},
+		Name:  initContainerName,
+		Image: ci.Helper.Image,
+		Args:  args,
 		VolumeMounts: []corev1.VolumeMount{
 			{
 				Name:      volName,
@@ -161,26 +531,121 @@ func (ci *ContextInjector) injectConfigMap(configMapRef corev1.LocalObjectRefere
 			},
 		},
 	}
+	ci.Helper.configureInitContainer(&initContainer)
 	ci.TargetPodSpec.InitContainers = append(ci.TargetPodSpec.InitContainers, initContainer)
-	return contextPath, nil
+	return configMapSubPath(contextPath, spec.ConfigMapSubPath)
+}
+
+// injectCachedConfigMap materializes the ConfigMap into Spec.Context.ContextCacheClaimRef keyed by
+// configMapCacheKey, unless already materialized by another BuildJob, and mounts the cache read-only
+// on the target container.
+func (ci *ContextInjector) injectCachedConfigMap(spec crd.Context, cmVol corev1.Volume, cmVolMountPath, initContainerName string) (string, error) {
+	var (
+		volName      = ci.name("contextcache")
+		volMountPath = ci.mountPath(volName)
+	)
+	idx := ci.TargetContainerIdx
+	contextPath, err := securejoin.SecureJoin(volMountPath, filepath.Join("configmap", configMapCacheKey(spec)))
+	if err != nil {
+		return "", err
+	}
+	ci.TargetPodSpec.Volumes = append(ci.TargetPodSpec.Volumes, cmVol, corev1.Volume{
+		Name: volName,
+		VolumeSource: corev1.VolumeSource{
+			PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+				ClaimName: spec.ContextCacheClaimRef.Name,
+			},
+		},
+	})
+	// read-only, as the context is shared with the other BuildJobs
+	ci.TargetPodSpec.Containers[idx].VolumeMounts = append(ci.TargetPodSpec.Containers[idx].VolumeMounts,
+		corev1.VolumeMount{
+			Name:      volName,
+			MountPath: volMountPath,
+			ReadOnly:  true,
+		},
+	)
+	args := []string{"populate-configmap", "--reuse"}
+	if spec.ConfigMapArchiveKey != "" {
+		args = append(args, "--archive-key", spec.ConfigMapArchiveKey)
+	}
+	args = append(args, cmVolMountPath, contextPath)
+	initContainer := corev1.Container{
+		Name:  initContainerName,
+		Image: ci.Helper.Image,
+		Args:  args,
+		VolumeMounts: []corev1.VolumeMount{
+			{
+				Name:      volName,
+				MountPath: volMountPath,
+			},
+			{
+				Name:      cmVol.Name,
+				MountPath: cmVolMountPath,
+			},
+		},
+	}
+	ci.Helper.configureInitContainer(&initContainer)
+	ci.TargetPodSpec.InitContainers = append(ci.TargetPodSpec.InitContainers, initContainer)
+	return configMapSubPath(contextPath, spec.ConfigMapSubPath)
+}
+
+// configMapCacheKey returns the key of the materialized ConfigMap in the cache.
+// Besides the resource version, the key covers the fields that affect the materialized files.
+func configMapCacheKey(spec crd.Context) string {
+	b, _ := json.Marshal([]interface{}{
+		spec.ConfigMapRef.Name,
+		spec.ConfigMapResourceVersion,
+		spec.ConfigMapItems,
+		spec.ConfigMapDefaultMode,
+		spec.ConfigMapArchiveKey,
+	})
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// configMapSubPath returns the path of Spec.Context.ConfigMapSubPath in contextPath.
+func configMapSubPath(contextPath, subPath string) (string, error) {
+	if subPath == "" {
+		return contextPath, nil
+	}
+	// SecureJoin confines the path, but an escaping subPath is likely to be a mistake
+	if cleaned := filepath.Clean(subPath); filepath.IsAbs(cleaned) || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", fmt.Errorf("Spec.Context.ConfigMapSubPath needs to be a relative path within the context, got %q", subPath)
+	}
+	return securejoin.SecureJoin(contextPath, subPath)
+}
+
+// GitResolvedRevisionFile contains the commit SHA resolved by the Git context init container.
+// The file is visible to the target container, and is located outside of the context directory.
+// GitResolvedRevisionFile is the path for the default NamePrefix and MountDir; see ResolvedRevisionFile.
+const GitResolvedRevisionFile = "/cbi-gitcontext/resolved-revision"
+
+// ResolvedRevisionFile returns the path of GitResolvedRevisionFile for the NamePrefix and MountDir of ci.
+func (ci *ContextInjector) ResolvedRevisionFile() string {
+	return filepath.Join(ci.mountPath(ci.name("gitcontext")), "resolved-revision")
 }
 
 // injectGit injects a git repo to podSpec and returns the context path
 func (ci *ContextInjector) injectGit(spec crd.Git) (string, error) {
-	const (
+	var (
 		// vol is an emptyDir volume
-		volName           = "cbi-gitcontext"
-		volMountPath      = "/cbi-gitcontext"
+		volName           = ci.name("gitcontext")
+		volMountPath      = ci.mountPath(volName)
 		volContextSubpath = "context"
 		// initContainer is used for converting cmVol to vol so as to eliminate symlinks
-		initContainerName = "cbi-gitcontext-init"
+		initContainerName = ci.name("gitcontext-init")
 	)
+	// HomeDir is used for mounting the SSH secret
+	if err := ci.Helper.validateHomeDir(); err != nil {
+		return "", err
+	}
 	idx := ci.TargetContainerIdx
 
 	ci.TargetPodSpec.Volumes = append(ci.TargetPodSpec.Volumes, corev1.Volume{
 		Name: volName,
 		VolumeSource: corev1.VolumeSource{
-			EmptyDir: &corev1.EmptyDirVolumeSource{},
+			EmptyDir: ci.Helper.contextEmptyDir(),
 		},
 	})
 	ci.TargetPodSpec.Containers[idx].VolumeMounts = append(ci.TargetPodSpec.Containers[idx].VolumeMounts,
@@ -190,11 +655,125 @@ func (ci *ContextInjector) injectGit(spec crd.Git) (string, error) {
 		},
 	)
 
-	contextPath, _ := securejoin.SecureJoin(volMountPath, volContextSubpath)
+	contextPath, err := securejoin.SecureJoin(volMountPath, volContextSubpath)
+	if err != nil {
+		return "", err
+	}
+	// flags need to precede the positional args
+	args := []string{"populate-git"}
+	if !ci.additional {
+		args = append(args,
+			"--resolved-revision-file", ci.ResolvedRevisionFile(),
+			"--termination-message-path", corev1.TerminationMessagePathDefault,
+		)
+	}
+	// empty revision is not passed, so that the default branch of the remote is used
+	if spec.FetchRefspec != "" {
+		// FetchRefspec takes precedence over Revision and RevisionType
+		args = append(args, "--fetch-refspec", spec.FetchRefspec)
+	} else if spec.Revision != "" {
+		args = append(args, "--revision", spec.Revision)
+	}
+	switch spec.RevisionType {
+	case "", crd.GitRevisionTypeAuto:
+	case crd.GitRevisionTypeBranch, crd.GitRevisionTypeTag, crd.GitRevisionTypeCommit:
+		if spec.FetchRefspec != "" {
+			break
+		}
+		if spec.Revision == "" {
+			return "", fmt.Errorf("Spec.Context.Git.RevisionType %q requires Spec.Context.Git.Revision", spec.RevisionType)
+		}
+		args = append(args, "--revision-type", strings.ToLower(string(spec.RevisionType)))
+	default:
+		return "", fmt.Errorf("unsupported Spec.Context.Git.RevisionType: %q", spec.RevisionType)
+	}
+	if spec.Depth > 0 {
+		args = append(args, "--depth", strconv.Itoa(spec.Depth))
+	}
+	if spec.SingleCommit {
+		if spec.Depth > 0 {
+			return "", fmt.Errorf("Spec.Context.Git.SingleCommit may not be set together with Spec.Context.Git.Depth")
+		}
+		args = append(args, "--single-commit")
+	}
+	// a refspec is fetched alone anyway
+	if spec.SingleBranch && spec.FetchRefspec == "" {
+		if spec.RevisionType == crd.GitRevisionTypeCommit {
+			return "", fmt.Errorf("Spec.Context.Git.SingleBranch may not be set together with Spec.Context.Git.RevisionType %q", spec.RevisionType)
+		}
+		args = append(args, "--single-branch")
+	}
+	if spec.Submodules {
+		args = append(args, "--recursive")
+	}
+	if spec.LFS {
+		args = append(args, "--lfs")
+	}
+	for _, p := range spec.SparsePaths {
+		if cleaned := filepath.Clean(p); filepath.IsAbs(cleaned) || cleaned == "." || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+			return "", fmt.Errorf("Spec.Context.Git.SparsePaths needs to contain relative directories within the repo, got %q", p)
+		}
+		args = append(args, "--sparse-path", p)
+	}
+	if spec.Retries < 0 {
+		return "", fmt.Errorf("Spec.Context.Git.Retries needs to be non-negative, got %d", spec.Retries)
+	}
+	if spec.Retries > 0 {
+		args = append(args, "--retries", strconv.Itoa(spec.Retries))
+	}
+	if spec.StrictHostKeyChecking {
+		if spec.SSHSecretRef.Name == "" {
+			return "", fmt.Errorf("Spec.Context.Git.StrictHostKeyChecking requires Spec.Context.Git.SSHSecretRef")
+		}
+		args = append(args, "--strict-host-key-checking")
+	}
+	var sshVolMountPath string
+	if spec.SSHSecretRef.Name != "" {
+		if ci.Helper.runsAsNonRoot() {
+			return "", fmt.Errorf("Spec.Context.Git.SSHSecretRef is not supported with the non-root helper security context")
+		}
+		sshVolMountPath, err = securejoin.SecureJoin(ci.Helper.HomeDir, ".ssh")
+		if err != nil {
+			return "", err
+		}
+		args = append(args, "--ssh-known-hosts", filepath.Join(sshVolMountPath, "known_hosts"))
+	}
+	var (
+		httpsAuthVolName      = ci.name("githttpsauthsecret")
+		httpsAuthVolMountPath = ci.mountPath(httpsAuthVolName)
+	)
+	if spec.HTTPSAuthSecretRef.Name != "" {
+		if !strings.HasPrefix(strings.ToLower(spec.URL), "https://") {
+			return "", fmt.Errorf("Spec.Context.Git.HTTPSAuthSecretRef requires https:// URL, got %q", spec.URL)
+		}
+		// the credentials are read by the credential helper, so as not to expose them in the args or the URL
+		args = append(args, "--https-auth-dir", httpsAuthVolMountPath)
+	}
+	var (
+		githubAppVolName      = ci.name("githubappsecret")
+		githubAppVolMountPath = ci.mountPath(githubAppVolName)
+	)
+	if spec.GitHubAppSecretRef.Name != "" {
+		if !strings.HasPrefix(strings.ToLower(spec.URL), "https://") {
+			return "", fmt.Errorf("Spec.Context.Git.GitHubAppSecretRef requires https:// URL, got %q", spec.URL)
+		}
+		if spec.HTTPSAuthSecretRef.Name != "" {
+			return "", fmt.Errorf("Spec.Context.Git.GitHubAppSecretRef may not be set together with Spec.Context.Git.HTTPSAuthSecretRef")
+		}
+		args = append(args, "--github-app-dir", githubAppVolMountPath)
+	}
+	var (
+		cacheVolName      = ci.name("gitcache")
+		cacheVolMountPath = ci.mountPath(cacheVolName)
+	)
+	if spec.CacheVolumeClaimRef.Name != "" {
+		args = append(args, "--cache-dir", cacheVolMountPath)
+	}
+	args = append(args, spec.URL, contextPath)
 	initContainer := corev1.Container{
 		Name:  initContainerName,
 		Image: ci.Helper.Image,
-		Args:  []string{"populate-git", spec.URL, contextPath, "--revision", spec.Revision},
+		Args:  args,
 		VolumeMounts: []corev1.VolumeMount{
 			{
 				Name:      volName,
@@ -203,53 +782,83 @@ func (ci *ContextInjector) injectGit(spec crd.Git) (string, error) {
 		},
 	}
 	if spec.SubPath != "" {
-		var err error
 		contextPath, err = securejoin.SecureJoin(contextPath, spec.SubPath)
 		if err != nil {
 			return "", err
 		}
 	}
 	if secretName := spec.SSHSecretRef.Name; secretName != "" {
-		const sshVolName = "cbi-gitsshsecret"
-		sshVolMountPath, err := securejoin.SecureJoin(ci.Helper.HomeDir, ".ssh")
-		if err != nil {
-			return "", err
-		}
-		defaultMode := int32(0400)
-		sshVol := corev1.Volume{
-			Name: sshVolName,
+		ci.injectInitSecret(&initContainer, ci.name("gitsshsecret"), secretName, sshVolMountPath)
+	}
+	if secretName := spec.HTTPSAuthSecretRef.Name; secretName != "" {
+		// same as the SSH secret: the init container only, read-only for the owner
+		ci.injectInitSecret(&initContainer, httpsAuthVolName, secretName, httpsAuthVolMountPath)
+	}
+	if secretName := spec.GitHubAppSecretRef.Name; secretName != "" {
+		ci.injectInitSecret(&initContainer, githubAppVolName, secretName, githubAppVolMountPath)
+	}
+	if claimName := spec.CacheVolumeClaimRef.Name; claimName != "" {
+		// the cache is only mounted on the init container
+		ci.TargetPodSpec.Volumes = append(ci.TargetPodSpec.Volumes, corev1.Volume{
+			Name: cacheVolName,
 			VolumeSource: corev1.VolumeSource{
-				Secret: &corev1.SecretVolumeSource{
-					SecretName:  spec.SSHSecretRef.Name,
-					DefaultMode: &defaultMode,
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+					ClaimName: claimName,
 				},
 			},
-		}
-		ci.TargetPodSpec.Volumes = append(ci.TargetPodSpec.Volumes, sshVol)
+		})
 		initContainer.VolumeMounts = append(initContainer.VolumeMounts, corev1.VolumeMount{
-			Name:      sshVolName,
-			MountPath: sshVolMountPath,
+			Name:      cacheVolName,
+			MountPath: cacheVolMountPath,
 		})
 	}
+	ci.Helper.configureInitContainer(&initContainer)
 	ci.TargetPodSpec.InitContainers = append(ci.TargetPodSpec.InitContainers, initContainer)
 	return contextPath, nil
 }
 
+// GitHTTPSAuthSecretKeys are the keys of the credentials in Git.HTTPSAuthSecretRef.
+// Either GitHTTPSAuthPasswordKey (with GitHTTPSAuthUsernameKey) or GitHTTPSAuthTokenKey is required.
+const (
+	GitHTTPSAuthUsernameKey = corev1.BasicAuthUsernameKey
+	GitHTTPSAuthPasswordKey = corev1.BasicAuthPasswordKey
+	GitHTTPSAuthTokenKey    = "token"
+)
+
+// GitHubAppSecretKeys are the keys of the credentials in Git.GitHubAppSecretRef.
+// All of them are required.
+const (
+	GitHubAppIDKey             = "appID"
+	GitHubAppInstallationIDKey = "installationID"
+	GitHubAppPrivateKeyKey     = "privateKey"
+)
+
+// HTTPCASecretKey is the key of the CA bundle in HTTP.CASecretRef.
+const HTTPCASecretKey = "ca.crt"
+
+// HTTPBasicAuthSecretKeys are the keys of the credentials in HTTP.BasicAuthSecretRef.
+const (
+	HTTPBasicAuthUsernameKey = corev1.BasicAuthUsernameKey
+	HTTPBasicAuthPasswordKey = corev1.BasicAuthPasswordKey
+)
+
+var sha256Regexp = regexp.MustCompile(`^[0-9a-fA-F]{64}$`)
+
 // injectHTTP injects a tar archive on HTTP site to podSpec and returns the context path
 func (ci *ContextInjector) injectHTTP(spec crd.HTTP) (string, error) {
-	const (
+	var (
 		// vol is an emptyDir volume
-		volName           = "cbi-httpcontext"
-		volMountPath      = "/cbi-httpcontext"
+		volName           = ci.name("httpcontext")
+		volMountPath      = ci.mountPath(volName)
 		volContextSubpath = "context"
-		initContainerName = "cbi-httpcontext-init"
+		initContainerName = ci.name("httpcontext-init")
 	)
 	idx := ci.TargetContainerIdx
 
 	ci.TargetPodSpec.Volumes = append(ci.TargetPodSpec.Volumes, corev1.Volume{
 		Name: volName,
 		VolumeSource: corev1.VolumeSource{
-			EmptyDir: &corev1.EmptyDirVolumeSource{},
+			EmptyDir: ci.Helper.contextEmptyDir(),
 		},
 	})
 	ci.TargetPodSpec.Containers[idx].VolumeMounts = append(ci.TargetPodSpec.Containers[idx].VolumeMounts,
@@ -259,11 +868,83 @@ func (ci *ContextInjector) injectHTTP(spec crd.HTTP) (string, error) {
 		},
 	)
 
-	contextPath, _ := securejoin.SecureJoin(volMountPath, volContextSubpath)
+	contextPath, err := securejoin.SecureJoin(volMountPath, volContextSubpath)
+	if err != nil {
+		return "", err
+	}
+	// flags need to precede the positional args
+	args := []string{"populate-http"}
+	if spec.SHA256 != "" {
+		if !sha256Regexp.MatchString(spec.SHA256) {
+			return "", fmt.Errorf("Spec.Context.HTTP.SHA256 needs to be a hex-encoded SHA-256 digest: %q", spec.SHA256)
+		}
+		args = append(args, "--sha256", spec.SHA256)
+	}
+	switch spec.MediaType {
+	case "":
+	case crd.HTTPMediaTypeTar, crd.HTTPMediaTypeGzip, crd.HTTPMediaTypeZstd, crd.HTTPMediaTypeZip:
+		args = append(args, "--media-type", spec.MediaType)
+	default:
+		return "", fmt.Errorf("unsupported Spec.Context.HTTP.MediaType: %q", spec.MediaType)
+	}
+	if spec.Insecure {
+		args = append(args, "--insecure")
+	}
+	var caVolMount *corev1.VolumeMount
+	if caSecretName := spec.CASecretRef.Name; caSecretName != "" {
+		var (
+			caVolName      = ci.name("httpcasecret")
+			caVolMountPath = ci.mountPath(caVolName)
+		)
+		defaultMode := int32(0444)
+		ci.TargetPodSpec.Volumes = append(ci.TargetPodSpec.Volumes, corev1.Volume{
+			Name: caVolName,
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{
+					SecretName:  caSecretName,
+					DefaultMode: &defaultMode,
+				},
+			},
+		})
+		caVolMount = &corev1.VolumeMount{
+			Name:      caVolName,
+			MountPath: caVolMountPath,
+		}
+		args = append(args, "--ca-file", filepath.Join(caVolMountPath, HTTPCASecretKey))
+	}
+	var authVolMount *corev1.VolumeMount
+	if authSecretName := spec.BasicAuthSecretRef.Name; authSecretName != "" {
+		if !spec.Insecure && !strings.HasPrefix(strings.ToLower(spec.URL), "https://") {
+			return "", fmt.Errorf("Spec.Context.HTTP.BasicAuthSecretRef requires https:// URL unless Spec.Context.HTTP.Insecure is set, got %q", spec.URL)
+		}
+		var (
+			authVolName      = ci.name("httpauthsecret")
+			authVolMountPath = ci.mountPath(authVolName)
+		)
+		ci.TargetPodSpec.Volumes = append(ci.TargetPodSpec.Volumes, corev1.Volume{
+			Name: authVolName,
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{
+					SecretName:  authSecretName,
+					DefaultMode: ci.Helper.secretMode(ci.TargetPodSpec),
+				},
+			},
+		})
+		authVolMount = &corev1.VolumeMount{
+			Name:      authVolName,
+			MountPath: authVolMountPath,
+		}
+		// the credentials are read from the files, so as not to expose them in the args
+		args = append(args,
+			"--basic-auth-username-file", filepath.Join(authVolMountPath, HTTPBasicAuthUsernameKey),
+			"--basic-auth-password-file", filepath.Join(authVolMountPath, HTTPBasicAuthPasswordKey),
+		)
+	}
+	args = append(args, spec.URL, contextPath)
 	initContainer := corev1.Container{
 		Name:  initContainerName,
 		Image: ci.Helper.Image,
-		Args:  []string{"populate-http", spec.URL, contextPath},
+		Args:  args,
 		VolumeMounts: []corev1.VolumeMount{
 			{
 				Name:      volName,
@@ -271,9 +952,15 @@ func (ci *ContextInjector) injectHTTP(spec crd.HTTP) (string, error) {
 			},
 		},
 	}
+	if caVolMount != nil {
+		initContainer.VolumeMounts = append(initContainer.VolumeMounts, *caVolMount)
+	}
+	if authVolMount != nil {
+		initContainer.VolumeMounts = append(initContainer.VolumeMounts, *authVolMount)
+	}
+	ci.Helper.configureInitContainer(&initContainer)
 	ci.TargetPodSpec.InitContainers = append(ci.TargetPodSpec.InitContainers, initContainer)
 	if spec.SubPath != "" {
-		var err error
 		contextPath, err = securejoin.SecureJoin(contextPath, spec.SubPath)
 		if err != nil {
 			return "", err
@@ -282,15 +969,33 @@ func (ci *ContextInjector) injectHTTP(spec crd.HTTP) (string, error) {
 	return contextPath, nil
 }
 
+// injectInitSecret mounts the credential secret, e.g. the SSH secret on $HOME/.ssh, on the init container.
+// The secret is not mounted on the target container.
+func (ci *ContextInjector) injectInitSecret(initContainer *corev1.Container, volName, secretName, mountPath string) {
+	ci.TargetPodSpec.Volumes = append(ci.TargetPodSpec.Volumes, corev1.Volume{
+		Name: volName,
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{
+				SecretName:  secretName,
+				DefaultMode: ci.Helper.secretMode(ci.TargetPodSpec),
+			},
+		},
+	})
+	initContainer.VolumeMounts = append(initContainer.VolumeMounts, corev1.VolumeMount{
+		Name:      volName,
+		MountPath: mountPath,
+	})
+}
+
 // injectRclone injects rclone to podSpec and returns the context path
 func (ci *ContextInjector) injectRclone(spec crd.Rclone) (string, error) {
-	const (
+	var (
 		// vol is an emptyDir volume
-		volName           = "cbi-rclonecontext"
-		volMountPath      = "/cbi-rclonecontext"
+		volName           = ci.name("rclonecontext")
+		volMountPath      = ci.mountPath(volName)
 		volContextSubpath = "context"
-		secretVolName     = "cbi-rclonesecret"
-		initContainerName = "cbi-rclonecontext-init"
+		secretVolName     = ci.name("rclonesecret")
+		initContainerName = ci.name("rclonecontext-init")
 	)
 	idx := ci.TargetContainerIdx
 
@@ -298,19 +1003,17 @@ func (ci *ContextInjector) injectRclone(spec crd.Rclone) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	secretVolDefaultMode := int32(0400)
-
 	ci.TargetPodSpec.Volumes = append(ci.TargetPodSpec.Volumes, corev1.Volume{
 		Name: volName,
 		VolumeSource: corev1.VolumeSource{
-			EmptyDir: &corev1.EmptyDirVolumeSource{},
+			EmptyDir: ci.Helper.contextEmptyDir(),
 		},
 	}, corev1.Volume{
 		Name: secretVolName,
 		VolumeSource: corev1.VolumeSource{
 			Secret: &corev1.SecretVolumeSource{
 				SecretName:  spec.SecretRef.Name,
-				DefaultMode: &secretVolDefaultMode,
+				DefaultMode: ci.Helper.secretMode(ci.TargetPodSpec),
 			},
 		},
 	})
@@ -321,11 +1024,22 @@ func (ci *ContextInjector) injectRclone(spec crd.Rclone) (string, error) {
 		},
 	)
 
-	contextPath, _ := securejoin.SecureJoin(volMountPath, volContextSubpath)
+	contextPath, err := securejoin.SecureJoin(volMountPath, volContextSubpath)
+	if err != nil {
+		return "", err
+	}
+	args := []string{"populate-rclone"}
+	for _, f := range spec.Flags {
+		if err := crd.ValidateRcloneFlag(f); err != nil {
+			return "", err
+		}
+		args = append(args, "--rclone-flag="+f)
+	}
+	args = append(args, spec.Remote+":"+spec.Path, contextPath)
 	initContainer := corev1.Container{
-		Name:    initContainerName,
-		Image:   ci.Helper.Image,
-		Command: []string{"/rclone", "sync", spec.Remote + ":" + spec.Path, contextPath},
+		Name:  initContainerName,
+		Image: ci.Helper.Image,
+		Args:  args,
 		VolumeMounts: []corev1.VolumeMount{
 			{
 				Name:      volName,
@@ -337,34 +1051,346 @@ func (ci *ContextInjector) injectRclone(spec crd.Rclone) (string, error) {
 			},
 		},
 	}
-	if sshSecretName := spec.SSHSecretRef.Name; sshSecretName != "" {
-		const sshVolName = "cbi-rclonesshsecret"
+	remoteType := spec.EffectiveRemoteType()
+	if remoteType == crd.RcloneRemoteTypeSFTP && spec.SSHSecretRef.Name == "" {
+		return "", fmt.Errorf("SFTP remote requires Spec.Context.Rclone.SSHSecretRef")
+	}
+	// the SSH secret is skipped for non-SFTP remotes, but mounted for unknown ones
+	if sshSecretName := spec.SSHSecretRef.Name; sshSecretName != "" && (remoteType == "" || remoteType == crd.RcloneRemoteTypeSFTP) {
+		if ci.Helper.runsAsNonRoot() {
+			return "", fmt.Errorf("Spec.Context.Rclone.SSHSecretRef is not supported with the non-root helper security context")
+		}
 		sshVolMountPath, err := securejoin.SecureJoin(ci.Helper.HomeDir, ".ssh")
 		if err != nil {
 			return "", err
 		}
-		sshVol := corev1.Volume{
-			Name: sshVolName,
-			VolumeSource: corev1.VolumeSource{
-				Secret: &corev1.SecretVolumeSource{
-					SecretName:  sshSecretName,
-					DefaultMode: &secretVolDefaultMode,
-				},
+		ci.injectInitSecret(&initContainer, ci.name("rclonesshsecret"), sshSecretName, sshVolMountPath)
+	}
+	ci.Helper.configureInitContainer(&initContainer)
+	ci.TargetPodSpec.InitContainers = append(ci.TargetPodSpec.InitContainers, initContainer)
+	return contextPath, nil
+}
+
+// injectLocal injects a directory on the node to podSpec and returns the context path
+func (ci *ContextInjector) injectLocal(spec crd.Local) (string, error) {
+	var (
+		// vol is a hostPath volume
+		volName      = ci.name("localcontext")
+		volMountPath = ci.mountPath(volName)
+	)
+	// Helper.AllowLocalContext is checked by inject
+	if !filepath.IsAbs(spec.Path) {
+		return "", fmt.Errorf("Spec.Context.Local.Path needs to be an absolute path: %q", spec.Path)
+	}
+	idx := ci.TargetContainerIdx
+	hostPathDirectory := corev1.HostPathDirectory
+	ci.TargetPodSpec.Volumes = append(ci.TargetPodSpec.Volumes, corev1.Volume{
+		Name: volName,
+		VolumeSource: corev1.VolumeSource{
+			HostPath: &corev1.HostPathVolumeSource{
+				Path: spec.Path,
+				Type: &hostPathDirectory,
 			},
-		}
-		ci.TargetPodSpec.Volumes = append(ci.TargetPodSpec.Volumes, sshVol)
-		initContainer.VolumeMounts = append(initContainer.VolumeMounts, corev1.VolumeMount{
-			Name:      sshVolName,
-			MountPath: sshVolMountPath,
-		})
+		},
+	})
+	ci.TargetPodSpec.Containers[idx].VolumeMounts = append(ci.TargetPodSpec.Containers[idx].VolumeMounts,
+		corev1.VolumeMount{
+			Name:      volName,
+			MountPath: volMountPath,
+			ReadOnly:  true,
+		},
+	)
+	return volMountPath, nil
+}
+
+// injectOCI injects an init container that fetches spec.Image into an OCI image layout directory,
+// and returns the path of the layout directory.
+func (ci *ContextInjector) injectOCI(spec crd.OCI) (string, error) {
+	var (
+		// vol is an emptyDir volume
+		volName           = ci.name("ocicontext")
+		volMountPath      = ci.mountPath(volName)
+		volContextSubpath = "context"
+		secretVolName     = ci.name("ocisecret")
+		secretMountPath   = ci.mountPath(secretVolName)
+		initContainerName = ci.name("ocicontext-init")
+	)
+	if spec.Image == "" {
+		return "", fmt.Errorf("Spec.Context.OCI.Image is required")
+	}
+	idx := ci.TargetContainerIdx
+
+	ci.TargetPodSpec.Volumes = append(ci.TargetPodSpec.Volumes, corev1.Volume{
+		Name: volName,
+		VolumeSource: corev1.VolumeSource{
+			EmptyDir: ci.Helper.contextEmptyDir(),
+		},
+	})
+	ci.TargetPodSpec.Containers[idx].VolumeMounts = append(ci.TargetPodSpec.Containers[idx].VolumeMounts,
+		corev1.VolumeMount{
+			Name:      volName,
+			MountPath: volMountPath,
+		},
+	)
+
+	contextPath, err := securejoin.SecureJoin(volMountPath, volContextSubpath)
+	if err != nil {
+		return "", err
+	}
+	// flags need to precede the positional args
+	args := []string{"populate-oci"}
+	if spec.SecretRef.Name != "" {
+		args = append(args, "--docker-config", filepath.Join(secretMountPath, ".dockerconfigjson"))
+	}
+	if spec.Platform != "" {
+		args = append(args, "--platform", spec.Platform)
+	}
+	args = append(args, spec.Image, contextPath)
+	initContainer := corev1.Container{
+		Name:  initContainerName,
+		Image: ci.Helper.Image,
+		Args:  args,
+		VolumeMounts: []corev1.VolumeMount{
+			{
+				Name:      volName,
+				MountPath: volMountPath,
+			},
+		},
+	}
+	if spec.SecretRef.Name != "" {
+		ci.injectInitSecret(&initContainer, secretVolName, spec.SecretRef.Name, secretMountPath)
 	}
+	ci.Helper.configureInitContainer(&initContainer)
 	ci.TargetPodSpec.InitContainers = append(ci.TargetPodSpec.InitContainers, initContainer)
 	return contextPath, nil
 }
 
+// injectPVC injects a PersistentVolumeClaim to podSpec and returns the context path,
+// i.e. SubPath within the volume. No init container is needed, as the volume already contains the context.
+func (ci *ContextInjector) injectPVC(spec crd.PVC) (string, error) {
+	var (
+		// vol is a persistentVolumeClaim volume
+		volName      = ci.name("pvccontext")
+		volMountPath = ci.mountPath(volName)
+	)
+	if spec.ClaimName == "" {
+		return "", fmt.Errorf("Spec.Context.PVC.ClaimName needs to be specified")
+	}
+	if filepath.IsAbs(spec.SubPath) {
+		return "", fmt.Errorf("Spec.Context.PVC.SubPath needs to be a relative path: %q", spec.SubPath)
+	}
+	// SecureJoin also confines ".." within the volume
+	contextPath, err := securejoin.SecureJoin(volMountPath, spec.SubPath)
+	if err != nil {
+		return "", err
+	}
+	idx := ci.TargetContainerIdx
+	ci.TargetPodSpec.Volumes = append(ci.TargetPodSpec.Volumes, corev1.Volume{
+		Name: volName,
+		VolumeSource: corev1.VolumeSource{
+			PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+				ClaimName: spec.ClaimName,
+				ReadOnly:  spec.ReadOnly,
+			},
+		},
+	})
+	ci.TargetPodSpec.Containers[idx].VolumeMounts = append(ci.TargetPodSpec.Containers[idx].VolumeMounts,
+		corev1.VolumeMount{
+			Name:      volName,
+			MountPath: volMountPath,
+			ReadOnly:  spec.ReadOnly,
+		},
+	)
+	return contextPath, nil
+}
+
+// injectS3 injects an archive on S3 to podSpec and returns the context path
+func (ci *ContextInjector) injectS3(spec crd.S3) (string, error) {
+	if spec.Bucket == "" || spec.Key == "" {
+		return "", fmt.Errorf("Spec.Context.S3.Bucket and Spec.Context.S3.Key are required")
+	}
+	// flags need to precede the positional args
+	args := []string{"populate-s3"}
+	if spec.Endpoint != "" {
+		args = append(args, "--endpoint", spec.Endpoint)
+	}
+	if spec.Region != "" {
+		args = append(args, "--region", spec.Region)
+	}
+	args = append(args, spec.Bucket, spec.Key)
+	return ci.injectObjectArchive("s3context", args, s3SecretEnv(spec.SecretRef), spec.SubPath)
+}
+
+// injectGCS injects an archive on Google Cloud Storage to podSpec and returns the context path
+func (ci *ContextInjector) injectGCS(spec crd.GCS) (string, error) {
+	if spec.Bucket == "" || spec.Object == "" {
+		return "", fmt.Errorf("Spec.Context.GCS.Bucket and Spec.Context.GCS.Object are required")
+	}
+	args := []string{"populate-gcs", spec.Bucket, spec.Object}
+	return ci.injectObjectArchive("gcscontext", args, gcsSecretEnv(spec.SecretRef), spec.SubPath)
+}
+
+// injectAzureBlob injects an archive on Azure Blob Storage to podSpec and returns the context path
+func (ci *ContextInjector) injectAzureBlob(spec crd.AzureBlob) (string, error) {
+	if spec.Account == "" || spec.Container == "" || spec.Blob == "" {
+		return "", fmt.Errorf("Spec.Context.AzureBlob.Account, Spec.Context.AzureBlob.Container, and Spec.Context.AzureBlob.Blob are required")
+	}
+	// flags need to precede the positional args
+	args := []string{"populate-azure"}
+	if spec.Endpoint != "" {
+		args = append(args, "--endpoint", spec.Endpoint)
+	}
+	args = append(args, spec.Account, spec.Container, spec.Blob)
+	return ci.injectObjectArchive("azurecontext", args, azureSecretEnv(spec.SecretRef), spec.SubPath)
+}
+
+// injectObjectArchive injects an emptyDir volume and an init container that runs the helper with args
+// followed by the directory, for extracting an archive object into the volume.
+// The returned context path is subPath within the extracted archive.
+func (ci *ContextInjector) injectObjectArchive(name string, args []string, env []corev1.EnvVar, subPath string) (string, error) {
+	var (
+		// vol is an emptyDir volume
+		volName           = ci.name(name)
+		volMountPath      = ci.mountPath(volName)
+		volContextSubpath = "context"
+		initContainerName = ci.name(name + "-init")
+	)
+	idx := ci.TargetContainerIdx
+
+	ci.TargetPodSpec.Volumes = append(ci.TargetPodSpec.Volumes, corev1.Volume{
+		Name: volName,
+		VolumeSource: corev1.VolumeSource{
+			EmptyDir: ci.Helper.contextEmptyDir(),
+		},
+	})
+	ci.TargetPodSpec.Containers[idx].VolumeMounts = append(ci.TargetPodSpec.Containers[idx].VolumeMounts,
+		corev1.VolumeMount{
+			Name:      volName,
+			MountPath: volMountPath,
+		},
+	)
+
+	contextPath, err := securejoin.SecureJoin(volMountPath, volContextSubpath)
+	if err != nil {
+		return "", err
+	}
+	initContainer := corev1.Container{
+		Name:  initContainerName,
+		Image: ci.Helper.Image,
+		Args:  append(args, contextPath),
+		VolumeMounts: []corev1.VolumeMount{
+			{
+				Name:      volName,
+				MountPath: volMountPath,
+			},
+		},
+		Env: env,
+	}
+	ci.Helper.configureInitContainer(&initContainer)
+	ci.TargetPodSpec.InitContainers = append(ci.TargetPodSpec.InitContainers, initContainer)
+	if subPath != "" {
+		contextPath, err = securejoin.SecureJoin(contextPath, subPath)
+		if err != nil {
+			return "", err
+		}
+	}
+	return contextPath, nil
+}
+
+// s3SecretEnv returns the environment variables for the S3 credentials in secretRef.
+// Nil is returned for empty secretRef, so that the credentials are obtained from the environment.
+func s3SecretEnv(secretRef corev1.LocalObjectReference) []corev1.EnvVar {
+	if secretRef.Name == "" {
+		return nil
+	}
+	var env []corev1.EnvVar
+	for _, k := range []string{"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY"} {
+		env = append(env, corev1.EnvVar{
+			Name: k,
+			ValueFrom: &corev1.EnvVarSource{
+				SecretKeyRef: &corev1.SecretKeySelector{
+					LocalObjectReference: secretRef,
+					Key:                  k,
+				},
+			},
+		})
+	}
+	return env
+}
+
+// gcsSecretEnv returns the environment variable for the service account key in secretRef.
+// Nil is returned for empty secretRef, so that the credentials are obtained from the environment.
+func gcsSecretEnv(secretRef corev1.LocalObjectReference) []corev1.EnvVar {
+	if secretRef.Name == "" {
+		return nil
+	}
+	return []corev1.EnvVar{
+		{
+			Name: "GCS_SERVICE_ACCOUNT_CREDENTIALS",
+			ValueFrom: &corev1.EnvVarSource{
+				SecretKeyRef: &corev1.SecretKeySelector{
+					LocalObjectReference: secretRef,
+					Key:                  "service-account.json",
+				},
+			},
+		},
+	}
+}
+
+// azureSecretEnv returns the environment variables for the Azure credentials in secretRef.
+// The secret needs to contain either of the keys, so both are optional.
+// Nil is returned for empty secretRef, so that the credentials are obtained from the environment.
+func azureSecretEnv(secretRef corev1.LocalObjectReference) []corev1.EnvVar {
+	if secretRef.Name == "" {
+		return nil
+	}
+	optional := true
+	var env []corev1.EnvVar
+	for _, k := range []string{"AZURE_STORAGE_KEY", "AZURE_STORAGE_SAS_URL"} {
+		env = append(env, corev1.EnvVar{
+			Name: k,
+			ValueFrom: &corev1.EnvVarSource{
+				SecretKeyRef: &corev1.SecretKeySelector{
+					LocalObjectReference: secretRef,
+					Key:                  k,
+					Optional:             &optional,
+				},
+			},
+		})
+	}
+	return env
+}
+
+// Labels contains the labels for the contexts supported by ContextInjector.
+// Labels does not contain the label for Local context; use Helper.Labels() instead.
 var Labels = map[string]string{
-	pluginapi.LContext(crd.ContextKindConfigMap): "",
-	pluginapi.LContext(crd.ContextKindGit):       "",
-	pluginapi.LContext(crd.ContextKindHTTP):      "",
-	pluginapi.LContext(crd.ContextKindRclone):    "",
+	pluginapi.LContextConfigMap: "",
+	pluginapi.LContextGit:       "",
+	pluginapi.LContextHTTP:      "",
+	pluginapi.LContextRclone:    "",
+	pluginapi.LContextS3:        "",
+	pluginapi.LContextPVC:       "",
+	pluginapi.LContextOCI:       "",
+	pluginapi.LContextGCS:       "",
+	pluginapi.LContextAzureBlob: "",
+}
+
+// SupportedCompressions are the compressions of the archive contexts supported by the helper image,
+// in addition to uncompressed archives.
+var SupportedCompressions = []string{"gzip", "zstd"}
+
+// Labels returns the labels for the contexts supported by ContextInjector with h,
+// including the LContextCompression labels for SupportedCompressions.
+func (h *Helper) Labels() map[string]string {
+	labels := make(map[string]string, len(Labels)+len(SupportedCompressions)+1)
+	for k, v := range Labels {
+		labels[k] = v
+	}
+	for _, c := range SupportedCompressions {
+		labels[pluginapi.LContextCompression(c)] = ""
+	}
+	if h.AllowLocalContext {
+		labels[pluginapi.LContextLocal] = ""
+	}
+	return labels
 }
@@ -0,0 +1,1626 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cbipluginhelper
+
+import (
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ghodss/yaml"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	crd "github.com/containerbuilding/cbi/pkg/apis/cbi/v1alpha1"
+	"github.com/containerbuilding/cbi/pkg/plugin/base/cbipluginhelper/cbipluginhelpertest"
+)
+
+var updateGolden = flag.Bool("update-golden", false, "update the golden files in testdata")
+
+func newTestContextInjector() *ContextInjector {
+	return &ContextInjector{
+		Injector: Injector{
+			Helper: Helper{
+				Image:   "cbipluginhelper",
+				HomeDir: "/root",
+			},
+			TargetPodSpec: &corev1.PodSpec{
+				Containers: []corev1.Container{
+					{
+						Name: "job",
+					},
+				},
+			},
+		},
+	}
+}
+
+func hasArg(args []string, arg string) bool {
+	for _, a := range args {
+		if a == arg {
+			return true
+		}
+	}
+	return false
+}
+
+func TestInjectGitSubmodules(t *testing.T) {
+	for _, submodules := range []bool{false, true} {
+		ci := newTestContextInjector()
+		_, err := ci.Inject(crd.Context{
+			Kind: crd.ContextKindGit,
+			Git: crd.Git{
+				URL:        "https://example.com/foo.git",
+				Submodules: submodules,
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ci.TargetPodSpec.InitContainers) != 1 {
+			t.Fatalf("expected 1 init container, got %d", len(ci.TargetPodSpec.InitContainers))
+		}
+		args := ci.TargetPodSpec.InitContainers[0].Args
+		if hasArg(args, "--recursive") != submodules {
+			t.Fatalf("submodules=%v: unexpected args %v", submodules, args)
+		}
+	}
+}
+
+// injectAll injects a file and all kinds of contexts into ci.TargetPodSpec.
+func injectAll(t *testing.T, ci *ContextInjector) {
+	if _, err := ci.InjectFile("/foo"); err != nil {
+		t.Fatal(err)
+	}
+	contexts := []crd.Context{
+		{
+			Kind:         crd.ContextKindConfigMap,
+			ConfigMapRef: corev1.LocalObjectReference{Name: "cm"},
+		},
+		{
+			Kind: crd.ContextKindGit,
+			Git:  crd.Git{URL: "https://example.com/foo.git"},
+		},
+		{
+			Kind: crd.ContextKindHTTP,
+			HTTP: crd.HTTP{URL: "https://example.com/foo.tar"},
+		},
+		{
+			Kind:   crd.ContextKindRclone,
+			Rclone: crd.Rclone{Remote: "remote", Path: "foo"},
+		},
+		{
+			Kind: crd.ContextKindS3,
+			S3:   crd.S3{Bucket: "bucket", Key: "foo.tar"},
+		},
+	}
+	for _, c := range contexts {
+		if _, err := ci.Inject(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(ci.TargetPodSpec.InitContainers) != len(contexts)+1 {
+		t.Fatalf("expected %d init containers, got %d", len(contexts)+1, len(ci.TargetPodSpec.InitContainers))
+	}
+}
+
+func TestInitContainerResources(t *testing.T) {
+	resources := corev1.ResourceRequirements{
+		Requests: corev1.ResourceList{
+			corev1.ResourceMemory: resource.MustParse("256Mi"),
+		},
+		Limits: corev1.ResourceList{
+			corev1.ResourceMemory: resource.MustParse("1Gi"),
+		},
+	}
+	ci := newTestContextInjector()
+	ci.Helper.Resources = resources
+	injectAll(t, ci)
+	for _, c := range ci.TargetPodSpec.InitContainers {
+		if !reflect.DeepEqual(resources, c.Resources) {
+			t.Fatalf("%s: expected %+v, got %+v", c.Name, resources, c.Resources)
+		}
+	}
+
+	ci = newTestContextInjector()
+	injectAll(t, ci)
+	for _, c := range ci.TargetPodSpec.InitContainers {
+		if !reflect.DeepEqual(corev1.ResourceRequirements{}, c.Resources) {
+			t.Fatalf("%s: expected empty resources, got %+v", c.Name, c.Resources)
+		}
+	}
+}
+
+func TestInitContainerImagePullPolicy(t *testing.T) {
+	for _, policy := range []corev1.PullPolicy{"", corev1.PullAlways} {
+		ci := newTestContextInjector()
+		ci.Helper.ImagePullPolicy = policy
+		injectAll(t, ci)
+		for _, c := range ci.TargetPodSpec.InitContainers {
+			if c.ImagePullPolicy != policy {
+				t.Fatalf("%s: expected %q, got %q", c.Name, policy, c.ImagePullPolicy)
+			}
+		}
+	}
+}
+
+func TestMaxContextSize(t *testing.T) {
+	for _, size := range []string{"0", "1Gi"} {
+		ci := newTestContextInjector()
+		ci.Helper.MaxContextSize = resource.MustParse(size)
+		injectAll(t, ci)
+		for _, v := range ci.TargetPodSpec.Volumes {
+			if v.EmptyDir == nil || strings.HasPrefix(v.Name, "cbi-file-") {
+				continue
+			}
+			if size == "0" {
+				if v.EmptyDir.SizeLimit != nil {
+					t.Fatalf("%s: unexpected sizeLimit %v", v.Name, v.EmptyDir.SizeLimit)
+				}
+			} else if v.EmptyDir.SizeLimit == nil || v.EmptyDir.SizeLimit.Cmp(ci.Helper.MaxContextSize) != 0 {
+				t.Fatalf("%s: expected sizeLimit %s, got %v", v.Name, size, v.EmptyDir.SizeLimit)
+			}
+		}
+		for _, c := range ci.TargetPodSpec.InitContainers {
+			if len(c.Command) != 0 {
+				continue
+			}
+			if expected := size != "0"; hasArg(c.Args, "--max-context-size=1073741824") != expected {
+				t.Fatalf("%s: unexpected args %v", c.Name, c.Args)
+			}
+		}
+	}
+}
+
+func TestInitContainerSecurityContext(t *testing.T) {
+	ci := newTestContextInjector()
+	ci.Helper.SecurityContext = RestrictedSecurityContext()
+	injectAll(t, ci)
+	for _, c := range ci.TargetPodSpec.InitContainers {
+		if !reflect.DeepEqual(RestrictedSecurityContext(), c.SecurityContext) {
+			t.Fatalf("%s: expected %+v, got %+v", c.Name, RestrictedSecurityContext(), c.SecurityContext)
+		}
+	}
+
+	ci = newTestContextInjector()
+	injectAll(t, ci)
+	for _, c := range ci.TargetPodSpec.InitContainers {
+		if c.SecurityContext != nil {
+			t.Fatalf("%s: expected nil, got %+v", c.Name, c.SecurityContext)
+		}
+	}
+}
+
+func TestRestrictedSecurityContextSecrets(t *testing.T) {
+	cases := []struct {
+		context    crd.Context
+		restricted bool
+		invalid    bool
+	}{
+		{
+			context: crd.Context{Kind: crd.ContextKindHTTP, HTTP: crd.HTTP{URL: "https://example.com/foo.tar", BasicAuthSecretRef: corev1.LocalObjectReference{Name: "auth"}}},
+		},
+		{
+			context:    crd.Context{Kind: crd.ContextKindHTTP, HTTP: crd.HTTP{URL: "https://example.com/foo.tar", BasicAuthSecretRef: corev1.LocalObjectReference{Name: "auth"}}},
+			restricted: true,
+		},
+		{
+			context:    crd.Context{Kind: crd.ContextKindRclone, Rclone: crd.Rclone{Remote: "s3", Path: "foo", SecretRef: corev1.LocalObjectReference{Name: "rclone"}}},
+			restricted: true,
+		},
+		{
+			context:    crd.Context{Kind: crd.ContextKindGit, Git: crd.Git{URL: "https://example.com/foo.git", HTTPSAuthSecretRef: corev1.LocalObjectReference{Name: "auth"}}},
+			restricted: true,
+		},
+		{
+			context: crd.Context{Kind: crd.ContextKindGit, Git: crd.Git{URL: "ssh://example.com/foo.git", SSHSecretRef: corev1.LocalObjectReference{Name: "ssh"}}},
+		},
+		{
+			context:    crd.Context{Kind: crd.ContextKindGit, Git: crd.Git{URL: "ssh://example.com/foo.git", SSHSecretRef: corev1.LocalObjectReference{Name: "ssh"}}},
+			restricted: true,
+			invalid:    true,
+		},
+		{
+			context:    crd.Context{Kind: crd.ContextKindRclone, Rclone: crd.Rclone{Remote: "sftp", Path: "foo", SecretRef: corev1.LocalObjectReference{Name: "rclone"}, SSHSecretRef: corev1.LocalObjectReference{Name: "ssh"}}},
+			restricted: true,
+			invalid:    true,
+		},
+	}
+	for _, c := range cases {
+		ci := newTestContextInjector()
+		if c.restricted {
+			ci.Helper.SecurityContext = RestrictedSecurityContext()
+		}
+		_, err := ci.Inject(c.context)
+		if err != nil && !c.invalid {
+			t.Fatalf("%+v: %v", c, err)
+		}
+		if err == nil && c.invalid {
+			t.Fatalf("%+v: error is expected", c)
+		}
+		if c.invalid {
+			continue
+		}
+		expectedMode := int32(0400)
+		if c.restricted {
+			expectedMode = 0440
+			if sc := ci.TargetPodSpec.SecurityContext; sc == nil || sc.FSGroup == nil || *sc.FSGroup != 65534 {
+				t.Fatalf("%+v: unexpected pod security context: %+v", c, sc)
+			}
+		} else if ci.TargetPodSpec.SecurityContext != nil {
+			t.Fatalf("%+v: unexpected pod security context: %+v", c, ci.TargetPodSpec.SecurityContext)
+		}
+		secrets := 0
+		for _, v := range ci.TargetPodSpec.Volumes {
+			if v.Secret == nil {
+				continue
+			}
+			secrets++
+			if m := v.Secret.DefaultMode; m == nil || *m != expectedMode {
+				t.Fatalf("%+v: %s: expected mode %o, got %v", c, v.Name, expectedMode, m)
+			}
+		}
+		if secrets == 0 {
+			t.Fatalf("%+v: no secret volume", c)
+		}
+	}
+}
+
+func TestInjectGitStrictHostKeyChecking(t *testing.T) {
+	cases := []struct {
+		git        crd.Git
+		knownHosts bool
+		strict     bool
+		invalid    bool
+	}{
+		{
+			git: crd.Git{URL: "https://example.com/foo.git"},
+		},
+		{
+			git:        crd.Git{URL: "ssh://example.com/foo.git", SSHSecretRef: corev1.LocalObjectReference{Name: "ssh"}},
+			knownHosts: true,
+		},
+		{
+			git:        crd.Git{URL: "ssh://example.com/foo.git", SSHSecretRef: corev1.LocalObjectReference{Name: "ssh"}, StrictHostKeyChecking: true},
+			knownHosts: true,
+			strict:     true,
+		},
+		{
+			git:     crd.Git{URL: "ssh://example.com/foo.git", StrictHostKeyChecking: true},
+			invalid: true,
+		},
+	}
+	for _, c := range cases {
+		ci := newTestContextInjector()
+		_, err := ci.Inject(crd.Context{Kind: crd.ContextKindGit, Git: c.git})
+		if err != nil && !c.invalid {
+			t.Fatalf("%+v: %v", c.git, err)
+		}
+		if err == nil {
+			if c.invalid {
+				t.Fatalf("%+v: error is expected", c.git)
+			}
+			args := ci.TargetPodSpec.InitContainers[0].Args
+			if hasArg(args, "/root/.ssh/known_hosts") != c.knownHosts {
+				t.Fatalf("%+v: unexpected args %v", c.git, args)
+			}
+			if hasArg(args, "--strict-host-key-checking") != c.strict {
+				t.Fatalf("%+v: unexpected args %v", c.git, args)
+			}
+		}
+	}
+}
+
+func TestInjectHTTPTLS(t *testing.T) {
+	ci := newTestContextInjector()
+	ci.Helper.Env = []corev1.EnvVar{{Name: "HTTPS_PROXY", Value: "http://proxy:3128"}}
+	_, err := ci.Inject(crd.Context{
+		Kind: crd.ContextKindHTTP,
+		HTTP: crd.HTTP{
+			URL:         "https://example.com/foo.tar",
+			CASecretRef: corev1.LocalObjectReference{Name: "ca"},
+			Insecure:    true,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := ci.TargetPodSpec.InitContainers[0]
+	for _, arg := range []string{"--insecure", "--ca-file", "/cbi-httpcasecret/ca.crt"} {
+		if !hasArg(c.Args, arg) {
+			t.Fatalf("%q not found in %v", arg, c.Args)
+		}
+	}
+	if len(c.VolumeMounts) != 2 || c.VolumeMounts[1].MountPath != "/cbi-httpcasecret" {
+		t.Fatalf("unexpected volume mounts: %+v", c.VolumeMounts)
+	}
+	if !reflect.DeepEqual(ci.Helper.Env, c.Env) {
+		t.Fatalf("expected %+v, got %+v", ci.Helper.Env, c.Env)
+	}
+}
+
+func TestInjectHTTPMediaType(t *testing.T) {
+	for _, mediaType := range []string{crd.HTTPMediaTypeTar, crd.HTTPMediaTypeGzip, crd.HTTPMediaTypeZstd, crd.HTTPMediaTypeZip} {
+		ci := newTestContextInjector()
+		if _, err := ci.Inject(crd.Context{
+			Kind: crd.ContextKindHTTP,
+			HTTP: crd.HTTP{URL: "https://example.com/foo", MediaType: mediaType},
+		}); err != nil {
+			t.Fatalf("%s: %v", mediaType, err)
+		}
+		if args := ci.TargetPodSpec.InitContainers[0].Args; !hasArg(args, "--media-type") || !hasArg(args, mediaType) {
+			t.Fatalf("%s: unexpected args %v", mediaType, args)
+		}
+	}
+	ci := newTestContextInjector()
+	if _, err := ci.Inject(crd.Context{
+		Kind: crd.ContextKindHTTP,
+		HTTP: crd.HTTP{URL: "https://example.com/foo", MediaType: "application/x-foo"},
+	}); err == nil {
+		t.Fatal("error is expected")
+	}
+}
+
+func TestInjectLocal(t *testing.T) {
+	bjContext := crd.Context{
+		Kind:  crd.ContextKindLocal,
+		Local: crd.Local{Path: "/home/user/src"},
+	}
+	ci := newTestContextInjector()
+	if _, err := ci.Inject(bjContext); err == nil {
+		t.Fatal("error is expected when Local context is not enabled")
+	}
+	if _, ok := ci.Helper.Labels()["context.local"]; ok {
+		t.Fatal("context.local label is not expected")
+	}
+	if _, ok := ci.Helper.Labels()["context.compression.zstd"]; !ok {
+		t.Fatal("context.compression.zstd label is expected")
+	}
+
+	ci = newTestContextInjector()
+	ci.Helper.AllowLocalContext = true
+	if _, ok := ci.Helper.Labels()["context.local"]; !ok {
+		t.Fatal("context.local label is expected")
+	}
+	contextPath, err := ci.Inject(bjContext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ci.TargetPodSpec.Volumes) != 1 || ci.TargetPodSpec.Volumes[0].HostPath == nil || ci.TargetPodSpec.Volumes[0].HostPath.Path != "/home/user/src" {
+		t.Fatalf("unexpected volumes: %+v", ci.TargetPodSpec.Volumes)
+	}
+	mounts := ci.TargetPodSpec.Containers[0].VolumeMounts
+	if len(mounts) != 1 || mounts[0].MountPath != contextPath || !mounts[0].ReadOnly {
+		t.Fatalf("unexpected volume mounts: %+v", mounts)
+	}
+
+	ci = newTestContextInjector()
+	ci.Helper.AllowLocalContext = true
+	if _, err := ci.Inject(crd.Context{Kind: crd.ContextKindLocal, Local: crd.Local{Path: "relative"}}); err == nil {
+		t.Fatal("error is expected for relative path")
+	}
+}
+
+func TestInjectOCI(t *testing.T) {
+	cases := []struct {
+		spec               crd.OCI
+		expectedArgs       []string
+		expectedInitMounts int
+	}{
+		{
+			spec:               crd.OCI{Image: "example.com/foo:bar"},
+			expectedArgs:       []string{"populate-oci", "example.com/foo:bar", "/cbi-ocicontext/context"},
+			expectedInitMounts: 1,
+		},
+		{
+			spec: crd.OCI{Image: "example.com/foo:bar", Platform: "linux/arm64", SecretRef: corev1.LocalObjectReference{Name: "regcred"}},
+			expectedArgs: []string{"populate-oci", "--docker-config", "/cbi-ocisecret/.dockerconfigjson", "--platform", "linux/arm64",
+				"example.com/foo:bar", "/cbi-ocicontext/context"},
+			expectedInitMounts: 2,
+		},
+	}
+	for _, c := range cases {
+		ci := newTestContextInjector()
+		contextPath, err := ci.Inject(crd.Context{Kind: crd.ContextKindOCI, OCI: c.spec})
+		if err != nil {
+			t.Fatalf("%+v: %v", c.spec, err)
+		}
+		if contextPath != "/cbi-ocicontext/context" {
+			t.Fatalf("%+v: unexpected context path %q", c.spec, contextPath)
+		}
+		initContainers := ci.TargetPodSpec.InitContainers
+		if len(initContainers) != 1 {
+			t.Fatalf("%+v: expected 1 init container, got %+v", c.spec, initContainers)
+		}
+		if !reflect.DeepEqual(initContainers[0].Args, c.expectedArgs) {
+			t.Fatalf("%+v: expected %v, got %v", c.spec, c.expectedArgs, initContainers[0].Args)
+		}
+		mounts := ci.TargetPodSpec.Containers[0].VolumeMounts
+		if len(mounts) != 1 || mounts[0].MountPath != "/cbi-ocicontext" {
+			t.Fatalf("%+v: unexpected volume mounts: %+v", c.spec, mounts)
+		}
+		// the secret is mounted only on the init container
+		if len(initContainers[0].VolumeMounts) != c.expectedInitMounts {
+			t.Fatalf("%+v: unexpected volume mounts of the init container: %+v", c.spec, initContainers[0].VolumeMounts)
+		}
+	}
+	ci := newTestContextInjector()
+	if _, err := ci.Inject(crd.Context{Kind: crd.ContextKindOCI}); err == nil {
+		t.Fatal("error is expected for empty Image")
+	}
+}
+
+func TestInjectDestPath(t *testing.T) {
+	cases := []struct {
+		context       crd.Context
+		expectedMount corev1.VolumeMount
+		invalid       bool
+	}{
+		{
+			context: crd.Context{Kind: crd.ContextKindGit, Git: crd.Git{URL: "https://github.com/foo/bar.git"},
+				DestPath: "/go/src/github.com/foo/bar"},
+			expectedMount: corev1.VolumeMount{Name: "cbi-gitcontext", MountPath: "/go/src/github.com/foo/bar", SubPath: "context"},
+		},
+		{
+			context: crd.Context{Kind: crd.ContextKindGit, Git: crd.Git{URL: "https://github.com/foo/bar.git", SubPath: "app"},
+				DestPath: "/workspace/"},
+			expectedMount: corev1.VolumeMount{Name: "cbi-gitcontext", MountPath: "/workspace", SubPath: "context/app"},
+		},
+		{
+			context: crd.Context{Kind: crd.ContextKindPVC, PVC: crd.PVC{ClaimName: "artifacts", ReadOnly: true},
+				DestPath: "/workspace"},
+			expectedMount: corev1.VolumeMount{Name: "cbi-pvccontext", MountPath: "/workspace", ReadOnly: true},
+		},
+		{
+			// confined lexically, the symlinks on the plugin host are not evaluated
+			context: crd.Context{Kind: crd.ContextKindPVC, PVC: crd.PVC{ClaimName: "artifacts", SubPath: "builds/1"},
+				DestPath: "/go/../../var/run/src"},
+			expectedMount: corev1.VolumeMount{Name: "cbi-pvccontext", MountPath: "/var/run/src", SubPath: "builds/1"},
+		},
+		{
+			context: crd.Context{Kind: crd.ContextKindGit, Git: crd.Git{URL: "https://github.com/foo/bar.git"},
+				DestPath:   "/go/src/github.com/foo/bar",
+				Additional: []crd.Context{{Kind: crd.ContextKindConfigMap, ConfigMapRef: corev1.LocalObjectReference{Name: "overlay"}}}},
+			expectedMount: corev1.VolumeMount{Name: "cbi-gitcontext", MountPath: "/go/src/github.com/foo/bar", SubPath: "context"},
+		},
+		{
+			context: crd.Context{Kind: crd.ContextKindGit, Git: crd.Git{URL: "https://github.com/foo/bar.git"},
+				DestPath: "workspace"},
+			invalid: true,
+		},
+		{
+			context: crd.Context{Kind: crd.ContextKindGit, Git: crd.Git{URL: "https://github.com/foo/bar.git"},
+				DestPath: "/.."},
+			invalid: true,
+		},
+	}
+	for _, c := range cases {
+		ci := newTestContextInjector()
+		contextPath, err := ci.Inject(c.context)
+		if c.invalid {
+			if err == nil {
+				t.Fatalf("%+v: error is expected", c.context)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%+v: %v", c.context, err)
+		}
+		if contextPath != c.expectedMount.MountPath {
+			t.Fatalf("%+v: expected %q, got %q", c.context, c.expectedMount.MountPath, contextPath)
+		}
+		mounts := ci.TargetPodSpec.Containers[0].VolumeMounts
+		if actual := mounts[len(mounts)-1]; !reflect.DeepEqual(actual, c.expectedMount) {
+			t.Fatalf("%+v: expected %+v, got %+v", c.context, c.expectedMount, actual)
+		}
+	}
+}
+
+func TestInjectPVC(t *testing.T) {
+	cases := []struct {
+		subPath  string
+		readOnly bool
+		expected string
+		invalid  bool
+	}{
+		{expected: "/cbi-pvccontext"},
+		{subPath: "artifacts/app", readOnly: true, expected: "/cbi-pvccontext/artifacts/app"},
+		{subPath: "./artifacts/../app/", expected: "/cbi-pvccontext/app"},
+		// confined within the volume
+		{subPath: "../../etc", expected: "/cbi-pvccontext/etc"},
+		{subPath: "/etc", invalid: true},
+	}
+	for _, c := range cases {
+		ci := newTestContextInjector()
+		contextPath, err := ci.Inject(crd.Context{
+			Kind: crd.ContextKindPVC,
+			PVC:  crd.PVC{ClaimName: "artifacts", SubPath: c.subPath, ReadOnly: c.readOnly},
+		})
+		if c.invalid {
+			if err == nil {
+				t.Fatalf("%+v: error is expected", c)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%+v: %v", c, err)
+		}
+		if contextPath != c.expected {
+			t.Fatalf("%+v: expected %q, got %q", c, c.expected, contextPath)
+		}
+		if len(ci.TargetPodSpec.InitContainers) != 0 {
+			t.Fatalf("%+v: no init container is expected", c)
+		}
+		vols := ci.TargetPodSpec.Volumes
+		if len(vols) != 1 || vols[0].PersistentVolumeClaim == nil || vols[0].PersistentVolumeClaim.ClaimName != "artifacts" ||
+			vols[0].PersistentVolumeClaim.ReadOnly != c.readOnly {
+			t.Fatalf("%+v: unexpected volumes: %+v", c, vols)
+		}
+		mounts := ci.TargetPodSpec.Containers[0].VolumeMounts
+		if len(mounts) != 1 || mounts[0].MountPath != "/cbi-pvccontext" || mounts[0].ReadOnly != c.readOnly {
+			t.Fatalf("%+v: unexpected volume mounts: %+v", c, mounts)
+		}
+	}
+	ci := newTestContextInjector()
+	if _, err := ci.Inject(crd.Context{Kind: crd.ContextKindPVC}); err == nil {
+		t.Fatal("error is expected for empty ClaimName")
+	}
+}
+
+func TestInjectS3(t *testing.T) {
+	ci := newTestContextInjector()
+	_, err := ci.Inject(crd.Context{
+		Kind: crd.ContextKindS3,
+		S3: crd.S3{
+			Endpoint:  "https://minio.example.com",
+			Bucket:    "bucket",
+			Key:       "foo.tar.gz",
+			SecretRef: corev1.LocalObjectReference{Name: "s3"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := ci.TargetPodSpec.InitContainers[0]
+	expectedArgs := []string{"populate-s3", "--endpoint", "https://minio.example.com", "bucket", "foo.tar.gz", "/cbi-s3context/context"}
+	if !reflect.DeepEqual(expectedArgs, c.Args) {
+		t.Fatalf("expected %v, got %v", expectedArgs, c.Args)
+	}
+	if len(c.Env) != 2 || c.Env[0].ValueFrom.SecretKeyRef.Name != "s3" || c.Env[1].ValueFrom.SecretKeyRef.Key != "AWS_SECRET_ACCESS_KEY" {
+		t.Fatalf("unexpected env: %+v", c.Env)
+	}
+
+	ci = newTestContextInjector()
+	if _, err := ci.Inject(crd.Context{Kind: crd.ContextKindS3, S3: crd.S3{Bucket: "bucket"}}); err == nil {
+		t.Fatal("error is expected for empty key")
+	}
+}
+
+func TestInjectGCS(t *testing.T) {
+	cases := []struct {
+		subPath             string
+		expectedContextPath string
+	}{
+		{expectedContextPath: "/cbi-gcscontext/context"},
+		{subPath: "foo/bar", expectedContextPath: "/cbi-gcscontext/context/foo/bar"},
+		// SecureJoin does not allow escaping the context
+		{subPath: "../../etc", expectedContextPath: "/cbi-gcscontext/context/etc"},
+	}
+	for _, c := range cases {
+		ci := newTestContextInjector()
+		contextPath, err := ci.Inject(crd.Context{
+			Kind: crd.ContextKindGCS,
+			GCS: crd.GCS{
+				Bucket:    "bucket",
+				Object:    "foo.tar.gz",
+				SecretRef: corev1.LocalObjectReference{Name: "gcs"},
+				SubPath:   c.subPath,
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if contextPath != c.expectedContextPath {
+			t.Fatalf("%q: expected %q, got %q", c.subPath, c.expectedContextPath, contextPath)
+		}
+		ic := ci.TargetPodSpec.InitContainers[0]
+		expectedArgs := []string{"populate-gcs", "bucket", "foo.tar.gz", "/cbi-gcscontext/context"}
+		if !reflect.DeepEqual(expectedArgs, ic.Args) {
+			t.Fatalf("expected %v, got %v", expectedArgs, ic.Args)
+		}
+		if len(ic.Env) != 1 || ic.Env[0].ValueFrom.SecretKeyRef.Name != "gcs" || ic.Env[0].ValueFrom.SecretKeyRef.Key != "service-account.json" {
+			t.Fatalf("unexpected env: %+v", ic.Env)
+		}
+	}
+
+	ci := newTestContextInjector()
+	if _, err := ci.Inject(crd.Context{Kind: crd.ContextKindGCS, GCS: crd.GCS{Bucket: "bucket"}}); err == nil {
+		t.Fatal("error is expected for empty object")
+	}
+}
+
+func TestInjectAzureBlob(t *testing.T) {
+	cases := []struct {
+		subPath             string
+		expectedContextPath string
+	}{
+		{expectedContextPath: "/cbi-azurecontext/context"},
+		{subPath: "foo/", expectedContextPath: "/cbi-azurecontext/context/foo"},
+		{subPath: "/foo/../../bar", expectedContextPath: "/cbi-azurecontext/context/bar"},
+	}
+	for _, c := range cases {
+		ci := newTestContextInjector()
+		contextPath, err := ci.Inject(crd.Context{
+			Kind: crd.ContextKindAzureBlob,
+			AzureBlob: crd.AzureBlob{
+				Account:   "account",
+				Endpoint:  "http://azurite.example.com:10000/account",
+				Container: "container",
+				Blob:      "contexts/foo.tar.gz",
+				SecretRef: corev1.LocalObjectReference{Name: "azure"},
+				SubPath:   c.subPath,
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if contextPath != c.expectedContextPath {
+			t.Fatalf("%q: expected %q, got %q", c.subPath, c.expectedContextPath, contextPath)
+		}
+		ic := ci.TargetPodSpec.InitContainers[0]
+		expectedArgs := []string{"populate-azure", "--endpoint", "http://azurite.example.com:10000/account",
+			"account", "container", "contexts/foo.tar.gz", "/cbi-azurecontext/context"}
+		if !reflect.DeepEqual(expectedArgs, ic.Args) {
+			t.Fatalf("expected %v, got %v", expectedArgs, ic.Args)
+		}
+		if len(ic.Env) != 2 || ic.Env[0].ValueFrom.SecretKeyRef.Key != "AZURE_STORAGE_KEY" || ic.Env[1].ValueFrom.SecretKeyRef.Key != "AZURE_STORAGE_SAS_URL" ||
+			!*ic.Env[1].ValueFrom.SecretKeyRef.Optional {
+			t.Fatalf("unexpected env: %+v", ic.Env)
+		}
+	}
+
+	ci := newTestContextInjector()
+	if _, err := ci.Inject(crd.Context{Kind: crd.ContextKindAzureBlob, AzureBlob: crd.AzureBlob{Container: "container", Blob: "foo.tar"}}); err == nil {
+		t.Fatal("error is expected for empty account")
+	}
+}
+
+func TestNewHelper(t *testing.T) {
+	cases := []struct {
+		image   string
+		homeDir string
+		invalid bool
+	}{
+		{image: "cbipluginhelper", homeDir: "/root"},
+		{image: "cbipluginhelper", homeDir: "/home/builder"},
+		{image: "cbipluginhelper", homeDir: "", invalid: true},
+		{image: "cbipluginhelper", homeDir: "root", invalid: true},
+		{image: "", homeDir: "/root", invalid: true},
+	}
+	for _, c := range cases {
+		_, err := NewHelper(c.image, c.homeDir)
+		if err != nil && !c.invalid {
+			t.Fatalf("%+v: %v", c, err)
+		}
+		if err == nil && c.invalid {
+			t.Fatalf("%+v: error is expected", c)
+		}
+	}
+}
+
+func TestInjectGitHomeDir(t *testing.T) {
+	for _, homeDir := range []string{"", "root"} {
+		ci := newTestContextInjector()
+		ci.Helper.HomeDir = homeDir
+		_, err := ci.Inject(crd.Context{
+			Kind: crd.ContextKindGit,
+			Git: crd.Git{
+				URL:          "ssh://example.com/foo.git",
+				SSHSecretRef: corev1.LocalObjectReference{Name: "ssh"},
+			},
+		})
+		if err == nil {
+			t.Fatalf("%q: error is expected", homeDir)
+		}
+		if len(ci.TargetPodSpec.Volumes) != 0 {
+			t.Fatalf("%q: expected no volumes, got %v", homeDir, ci.TargetPodSpec.Volumes)
+		}
+	}
+}
+
+func TestInjectBadSubPath(t *testing.T) {
+	const badSubPath = "foo\x00bar"
+	contexts := []crd.Context{
+		{
+			Kind: crd.ContextKindGit,
+			Git:  crd.Git{URL: "https://example.com/foo.git", SubPath: badSubPath},
+		},
+		{
+			Kind: crd.ContextKindHTTP,
+			HTTP: crd.HTTP{URL: "https://example.com/foo.tar", SubPath: badSubPath},
+		},
+	}
+	for _, c := range contexts {
+		ci := newTestContextInjector()
+		contextPath, err := ci.Inject(c)
+		if err == nil {
+			t.Fatalf("%+v: error is expected, got context path %q", c, contextPath)
+		}
+	}
+}
+
+func TestInjectConfigMapSubPath(t *testing.T) {
+	cases := []struct {
+		subPath  string
+		expected string
+		invalid  bool
+	}{
+		{subPath: "", expected: "/cbi-cmcontext/context"},
+		{subPath: "foo", expected: "/cbi-cmcontext/context/foo"},
+		{subPath: "foo/../bar", expected: "/cbi-cmcontext/context/bar"},
+		{subPath: "../foo", invalid: true},
+		{subPath: "/foo", invalid: true},
+	}
+	for _, c := range cases {
+		ci := newTestContextInjector()
+		actual, err := ci.Inject(crd.Context{
+			Kind:         crd.ContextKindConfigMap,
+			ConfigMapRef: corev1.LocalObjectReference{Name: "cm"},
+			ConfigMapItems: []corev1.KeyToPath{
+				{Key: "Dockerfile", Path: "foo/Dockerfile"},
+			},
+			ConfigMapSubPath: c.subPath,
+		})
+		if err != nil && !c.invalid {
+			t.Fatalf("%q: %v", c.subPath, err)
+		}
+		if err == nil {
+			if c.invalid {
+				t.Fatalf("%q: error is expected", c.subPath)
+			} else if actual != c.expected {
+				t.Fatalf("%q: expected %q, got %q", c.subPath, c.expected, actual)
+			}
+			if items := ci.TargetPodSpec.Volumes[0].ConfigMap.Items; len(items) != 1 {
+				t.Fatalf("%q: expected 1 item, got %v", c.subPath, items)
+			}
+		}
+	}
+}
+
+func TestInjectConfigMapDefaultMode(t *testing.T) {
+	ci := newTestContextInjector()
+	mode := int32(0755)
+	if _, err := ci.Inject(crd.Context{
+		Kind:                 crd.ContextKindConfigMap,
+		ConfigMapRef:         corev1.LocalObjectReference{Name: "cm"},
+		ConfigMapDefaultMode: &mode,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if m := ci.TargetPodSpec.Volumes[0].ConfigMap.DefaultMode; m == nil || *m != 0755 {
+		t.Fatalf("expected 0755, got %v", m)
+	}
+}
+
+func TestInjectConfigMapSkipCopy(t *testing.T) {
+	cases := []struct {
+		skip               bool
+		archiveKey         string
+		expected           string
+		expectedInitCount  int
+		expectedVolumeName string
+	}{
+		{expected: "/cbi-cmcontext/context/foo", expectedInitCount: 1, expectedVolumeName: "cbi-cmcontext-tmp"},
+		{skip: true, expected: "/cbi-cmcontext/foo", expectedVolumeName: "cbi-cmcontext"},
+		{skip: true, archiveKey: "context.tar", expected: "/cbi-cmcontext/context/foo", expectedInitCount: 1, expectedVolumeName: "cbi-cmcontext-tmp"},
+	}
+	for _, c := range cases {
+		ci := newTestContextInjector()
+		ci.SkipConfigMapCopy = c.skip
+		actual, err := ci.Inject(crd.Context{
+			Kind:                crd.ContextKindConfigMap,
+			ConfigMapRef:        corev1.LocalObjectReference{Name: "cm"},
+			ConfigMapArchiveKey: c.archiveKey,
+			ConfigMapSubPath:    "foo",
+		})
+		if err != nil {
+			t.Fatalf("%+v: %v", c, err)
+		}
+		if actual != c.expected {
+			t.Fatalf("%+v: expected %q, got %q", c, c.expected, actual)
+		}
+		if n := len(ci.TargetPodSpec.InitContainers); n != c.expectedInitCount {
+			t.Fatalf("%+v: expected %d init containers, got %d", c, c.expectedInitCount, n)
+		}
+		if vol := ci.TargetPodSpec.Volumes[0]; vol.Name != c.expectedVolumeName || vol.ConfigMap == nil {
+			t.Fatalf("%+v: unexpected volume %+v", c, vol)
+		}
+		mounts := ci.TargetPodSpec.Containers[0].VolumeMounts
+		if len(mounts) != 1 || mounts[0].Name != "cbi-cmcontext" || mounts[0].ReadOnly != (c.expectedInitCount == 0) {
+			t.Fatalf("%+v: unexpected mounts %+v", c, mounts)
+		}
+	}
+}
+
+func TestInjectConfigMapContextCache(t *testing.T) {
+	cache := corev1.LocalObjectReference{Name: "cache"}
+	base := crd.Context{
+		Kind:                     crd.ContextKindConfigMap,
+		ConfigMapRef:             corev1.LocalObjectReference{Name: "cm"},
+		ContextCacheClaimRef:     cache,
+		ConfigMapResourceVersion: "42",
+	}
+	inject := func(c crd.Context) (*ContextInjector, string) {
+		ci := newTestContextInjector()
+		contextPath, err := ci.Inject(c)
+		if err != nil {
+			t.Fatalf("%+v: %v", c, err)
+		}
+		return ci, contextPath
+	}
+	ci, contextPath := inject(base)
+	if !strings.HasPrefix(contextPath, "/cbi-contextcache/configmap/") {
+		t.Fatalf("unexpected context path %q", contextPath)
+	}
+	mounts := ci.TargetPodSpec.Containers[0].VolumeMounts
+	if len(mounts) != 1 || mounts[0].Name != "cbi-contextcache" || !mounts[0].ReadOnly {
+		t.Fatalf("unexpected mounts %+v", mounts)
+	}
+	if vol := ci.TargetPodSpec.Volumes[1]; vol.PersistentVolumeClaim == nil || vol.PersistentVolumeClaim.ClaimName != "cache" {
+		t.Fatalf("unexpected volume %+v", vol)
+	}
+	expectedArgs := []string{"populate-configmap", "--reuse", "/cbi-cmcontext-tmp", contextPath}
+	if args := ci.TargetPodSpec.InitContainers[0].Args; !reflect.DeepEqual(args, expectedArgs) {
+		t.Fatalf("expected %v, got %v", expectedArgs, args)
+	}
+
+	// the same version shares the path, and the other versions do not
+	if _, p := inject(base); p != contextPath {
+		t.Fatalf("expected %q for the same resource version, got %q", contextPath, p)
+	}
+	updated := base
+	updated.ConfigMapResourceVersion = "43"
+	if _, p := inject(updated); p == contextPath {
+		t.Fatalf("expected another path for another resource version, got %q", p)
+	}
+	archive := base
+	archive.ConfigMapArchiveKey = "context.tar"
+	if _, p := inject(archive); p == contextPath {
+		t.Fatalf("expected another path for ConfigMapArchiveKey, got %q", p)
+	}
+
+	// fall back to the copy without the resource version, or with the additional contexts
+	unresolved := base
+	unresolved.ConfigMapResourceVersion = ""
+	withAdditional := base
+	withAdditional.Additional = []crd.Context{{Kind: crd.ContextKindConfigMap, ConfigMapRef: corev1.LocalObjectReference{Name: "cm2"}}}
+	for _, c := range []crd.Context{unresolved, withAdditional} {
+		if _, p := inject(c); p != "/cbi-cmcontext/context" {
+			t.Fatalf("%+v: expected the fallback path, got %q", c, p)
+		}
+	}
+}
+
+func TestInjectGitRetries(t *testing.T) {
+	cases := []struct {
+		retries  int
+		expected bool
+		invalid  bool
+	}{
+		{retries: 0},
+		{retries: 3, expected: true},
+		{retries: -1, invalid: true},
+	}
+	for _, c := range cases {
+		ci := newTestContextInjector()
+		_, err := ci.Inject(crd.Context{
+			Kind: crd.ContextKindGit,
+			Git:  crd.Git{URL: "https://example.com/foo.git", Retries: c.retries},
+		})
+		if err != nil && !c.invalid {
+			t.Fatalf("%+v: %v", c, err)
+		}
+		if err == nil {
+			if c.invalid {
+				t.Fatalf("%+v: error is expected", c)
+			}
+			if args := ci.TargetPodSpec.InitContainers[0].Args; hasArg(args, "--retries") != c.expected {
+				t.Fatalf("%+v: unexpected args %v", c, args)
+			}
+		}
+	}
+}
+
+func TestInjectGitSparsePaths(t *testing.T) {
+	cases := []struct {
+		sparsePaths []string
+		invalid     bool
+	}{
+		{},
+		{sparsePaths: []string{"foo", "bar/baz"}},
+		{sparsePaths: []string{"../foo"}, invalid: true},
+		{sparsePaths: []string{"/foo"}, invalid: true},
+	}
+	for _, c := range cases {
+		ci := newTestContextInjector()
+		_, err := ci.Inject(crd.Context{
+			Kind: crd.ContextKindGit,
+			Git:  crd.Git{URL: "https://example.com/foo.git", Depth: 1, SparsePaths: c.sparsePaths},
+		})
+		if err != nil && !c.invalid {
+			t.Fatalf("%+v: %v", c, err)
+		}
+		if err == nil {
+			if c.invalid {
+				t.Fatalf("%+v: error is expected", c)
+			}
+			args := ci.TargetPodSpec.InitContainers[0].Args
+			n := 0
+			for i, a := range args {
+				if a == "--sparse-path" {
+					if args[i+1] != c.sparsePaths[n] {
+						t.Fatalf("%+v: unexpected args %v", c, args)
+					}
+					n++
+				}
+			}
+			if n != len(c.sparsePaths) {
+				t.Fatalf("%+v: unexpected args %v", c, args)
+			}
+		}
+	}
+}
+
+func TestInjectGitCache(t *testing.T) {
+	ci := newTestContextInjector()
+	_, err := ci.Inject(crd.Context{
+		Kind: crd.ContextKindGit,
+		Git: crd.Git{
+			URL:                 "https://example.com/foo.git",
+			CacheVolumeClaimRef: corev1.LocalObjectReference{Name: "gitcache"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	initContainer := ci.TargetPodSpec.InitContainers[0]
+	if !hasArg(initContainer.Args, "--cache-dir") {
+		t.Fatalf("unexpected args %v", initContainer.Args)
+	}
+	found := false
+	for _, v := range ci.TargetPodSpec.Volumes {
+		if v.PersistentVolumeClaim != nil && v.PersistentVolumeClaim.ClaimName == "gitcache" {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("cache volume not found: %v", ci.TargetPodSpec.Volumes)
+	}
+	for _, m := range ci.TargetPodSpec.Containers[0].VolumeMounts {
+		if m.Name == "cbi-gitcache" {
+			t.Fatalf("cache should not be mounted on the build container")
+		}
+	}
+}
+
+func TestInjectGitRevision(t *testing.T) {
+	for _, revision := range []string{"", "master", "v1.0.0"} {
+		ci := newTestContextInjector()
+		if _, err := ci.Inject(crd.Context{
+			Kind: crd.ContextKindGit,
+			Git:  crd.Git{URL: "https://example.com/foo.git", Revision: revision},
+		}); err != nil {
+			t.Fatal(err)
+		}
+		args := ci.TargetPodSpec.InitContainers[0].Args
+		if revision == "" {
+			if hasArg(args, "--revision") {
+				t.Fatalf("%q: unexpected args %v", revision, args)
+			}
+			continue
+		}
+		if !hasArg(args, "--revision") || !hasArg(args, revision) {
+			t.Fatalf("%q: unexpected args %v", revision, args)
+		}
+	}
+}
+
+func TestInjectGitRevisionType(t *testing.T) {
+	cases := []struct {
+		revision     string
+		revisionType crd.GitRevisionType
+		expected     string
+		invalid      bool
+	}{
+		{revision: "v1"},
+		{revision: "v1", revisionType: crd.GitRevisionTypeAuto},
+		{revision: "v1", revisionType: crd.GitRevisionTypeBranch, expected: "branch"},
+		{revision: "v1", revisionType: crd.GitRevisionTypeTag, expected: "tag"},
+		{revision: "deadbeef", revisionType: crd.GitRevisionTypeCommit, expected: "commit"},
+		{revisionType: crd.GitRevisionTypeTag, invalid: true},
+		{revision: "v1", revisionType: "Ref", invalid: true},
+	}
+	for _, c := range cases {
+		ci := newTestContextInjector()
+		_, err := ci.Inject(crd.Context{
+			Kind: crd.ContextKindGit,
+			Git:  crd.Git{URL: "https://example.com/foo.git", Revision: c.revision, RevisionType: c.revisionType},
+		})
+		if err != nil && !c.invalid {
+			t.Fatalf("%+v: %v", c, err)
+		}
+		if err == nil {
+			if c.invalid {
+				t.Fatalf("%+v: error is expected", c)
+			}
+			args := ci.TargetPodSpec.InitContainers[0].Args
+			if hasArg(args, "--revision-type") != (c.expected != "") || (c.expected != "" && !hasArg(args, c.expected)) {
+				t.Fatalf("%+v: unexpected args %v", c, args)
+			}
+		}
+	}
+}
+
+func TestInjectGitFetchRefspec(t *testing.T) {
+	ci := newTestContextInjector()
+	if _, err := ci.Inject(crd.Context{
+		Kind: crd.ContextKindGit,
+		Git: crd.Git{URL: "https://example.com/foo.git", FetchRefspec: "refs/pull/42/head",
+			Revision: "master", RevisionType: crd.GitRevisionTypeBranch},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	args := ci.TargetPodSpec.InitContainers[0].Args
+	if !hasArg(args, "--fetch-refspec") || !hasArg(args, "refs/pull/42/head") ||
+		hasArg(args, "--revision") || hasArg(args, "--revision-type") {
+		t.Fatalf("unexpected args %v", args)
+	}
+}
+
+func TestInjectGitLFS(t *testing.T) {
+	for _, lfs := range []bool{false, true} {
+		ci := newTestContextInjector()
+		if _, err := ci.Inject(crd.Context{
+			Kind: crd.ContextKindGit,
+			Git:  crd.Git{URL: "https://example.com/foo.git", LFS: lfs},
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if args := ci.TargetPodSpec.InitContainers[0].Args; hasArg(args, "--lfs") != lfs {
+			t.Fatalf("lfs=%v: unexpected args %v", lfs, args)
+		}
+	}
+}
+
+func TestInjectGitSingleCommit(t *testing.T) {
+	for _, singleCommit := range []bool{false, true} {
+		ci := newTestContextInjector()
+		if _, err := ci.Inject(crd.Context{
+			Kind: crd.ContextKindGit,
+			Git:  crd.Git{URL: "https://example.com/foo.git", SingleCommit: singleCommit},
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if args := ci.TargetPodSpec.InitContainers[0].Args; hasArg(args, "--single-commit") != singleCommit {
+			t.Fatalf("singleCommit=%v: unexpected args %v", singleCommit, args)
+		}
+	}
+	ci := newTestContextInjector()
+	if _, err := ci.Inject(crd.Context{
+		Kind: crd.ContextKindGit,
+		Git:  crd.Git{URL: "https://example.com/foo.git", SingleCommit: true, Depth: 1},
+	}); err == nil {
+		t.Fatal("error is expected")
+	}
+}
+
+func TestInjectGitSingleBranch(t *testing.T) {
+	for _, singleBranch := range []bool{false, true} {
+		ci := newTestContextInjector()
+		if _, err := ci.Inject(crd.Context{
+			Kind: crd.ContextKindGit,
+			Git:  crd.Git{URL: "https://example.com/foo.git", Revision: "release-1.0", RevisionType: crd.GitRevisionTypeBranch, SingleBranch: singleBranch},
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if args := ci.TargetPodSpec.InitContainers[0].Args; hasArg(args, "--single-branch") != singleBranch {
+			t.Fatalf("singleBranch=%v: unexpected args %v", singleBranch, args)
+		}
+	}
+	ci := newTestContextInjector()
+	if _, err := ci.Inject(crd.Context{
+		Kind: crd.ContextKindGit,
+		Git:  crd.Git{URL: "https://github.com/foo/bar.git", FetchRefspec: "refs/pull/42/head", SingleBranch: true},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if args := ci.TargetPodSpec.InitContainers[0].Args; hasArg(args, "--single-branch") {
+		t.Fatalf("--single-branch is not expected with FetchRefspec: %v", args)
+	}
+	ci = newTestContextInjector()
+	if _, err := ci.Inject(crd.Context{
+		Kind: crd.ContextKindGit,
+		Git:  crd.Git{URL: "https://example.com/foo.git", Revision: "deadbeef", RevisionType: crd.GitRevisionTypeCommit, SingleBranch: true},
+	}); err == nil {
+		t.Fatal("error is expected")
+	}
+}
+
+func TestInjectNamePrefixAndMountDir(t *testing.T) {
+	cases := []struct {
+		namePrefix           string
+		mountDir             string
+		expectedVolume       string
+		expectedContextPath  string
+		expectedRevisionFile string
+		invalid              bool
+	}{
+		{
+			expectedVolume:       "cbi-gitcontext",
+			expectedContextPath:  "/cbi-gitcontext/context",
+			expectedRevisionFile: GitResolvedRevisionFile,
+		},
+		{
+			namePrefix:           "cbi-1-",
+			mountDir:             "/var/run/cbi",
+			expectedVolume:       "cbi-1-gitcontext",
+			expectedContextPath:  "/var/run/cbi/cbi-1-gitcontext/context",
+			expectedRevisionFile: "/var/run/cbi/cbi-1-gitcontext/resolved-revision",
+		},
+		{namePrefix: "CBI_", invalid: true},
+		{mountDir: "var/run/cbi", invalid: true},
+	}
+	for _, c := range cases {
+		ci := newTestContextInjector()
+		ci.NamePrefix = c.namePrefix
+		ci.MountDir = c.mountDir
+		contextPath, err := ci.Inject(crd.Context{
+			Kind: crd.ContextKindGit,
+			Git:  crd.Git{URL: "https://example.com/foo.git"},
+		})
+		if err != nil && !c.invalid {
+			t.Fatalf("%+v: %v", c, err)
+		}
+		if err == nil && c.invalid {
+			t.Fatalf("%+v: error is expected", c)
+		}
+		if c.invalid {
+			continue
+		}
+		if contextPath != c.expectedContextPath {
+			t.Fatalf("%+v: unexpected context path %q", c, contextPath)
+		}
+		if actual := ci.ResolvedRevisionFile(); actual != c.expectedRevisionFile {
+			t.Fatalf("%+v: unexpected resolved revision file %q", c, actual)
+		}
+		initContainer := ci.TargetPodSpec.InitContainers[0]
+		if initContainer.Name != c.expectedVolume+"-init" {
+			t.Fatalf("%+v: unexpected init container name %q", c, initContainer.Name)
+		}
+		if !hasArg(initContainer.Args, c.expectedRevisionFile) {
+			t.Fatalf("%+v: unexpected args %v", c, initContainer.Args)
+		}
+		mount := ci.TargetPodSpec.Containers[0].VolumeMounts[0]
+		if mount.Name != c.expectedVolume || mount.MountPath != filepath.Dir(c.expectedContextPath) {
+			t.Fatalf("%+v: unexpected volume mount %+v", c, mount)
+		}
+	}
+}
+
+func TestInjectMultipleContexts(t *testing.T) {
+	ci := newTestContextInjector()
+	if _, err := ci.Inject(crd.Context{Kind: crd.ContextKindGit, Git: crd.Git{URL: "https://example.com/foo.git"}}); err != nil {
+		t.Fatal(err)
+	}
+	ci.NamePrefix = "cbi-1-"
+	if _, err := ci.Inject(crd.Context{Kind: crd.ContextKindGit, Git: crd.Git{URL: "https://example.com/bar.git"}}); err != nil {
+		t.Fatal(err)
+	}
+	seen := make(map[string]struct{})
+	for _, v := range ci.TargetPodSpec.Volumes {
+		if _, ok := seen[v.Name]; ok {
+			t.Fatalf("duplicate volume %q", v.Name)
+		}
+		seen[v.Name] = struct{}{}
+	}
+	if len(ci.TargetPodSpec.InitContainers) != 2 || ci.TargetPodSpec.InitContainers[0].Name == ci.TargetPodSpec.InitContainers[1].Name {
+		t.Fatalf("unexpected init containers: %+v", ci.TargetPodSpec.InitContainers)
+	}
+}
+
+func TestInjectAdditionalContexts(t *testing.T) {
+	ci := newTestContextInjector()
+	contextPath, err := ci.Inject(crd.Context{
+		Kind: crd.ContextKindGit,
+		Git:  crd.Git{URL: "https://example.com/foo.git", SubPath: "bar"},
+		Additional: []crd.Context{
+			{Kind: crd.ContextKindConfigMap, ConfigMapRef: corev1.LocalObjectReference{Name: "overlay"}},
+			{Kind: crd.ContextKindGit, Git: crd.Git{URL: "https://example.com/baz.git"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if contextPath != "/cbi-gitcontext/context/bar" {
+		t.Fatalf("unexpected context path %q", contextPath)
+	}
+	var names []string
+	for _, c := range ci.TargetPodSpec.InitContainers {
+		names = append(names, c.Name)
+	}
+	expected := []string{"cbi-gitcontext-init", "cbi-1-cmcontext-init", "cbi-1-merge", "cbi-2-gitcontext-init", "cbi-2-merge"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Fatalf("expected %v, got %v", expected, names)
+	}
+	// the additional volumes are not mounted on the target container
+	if mounts := ci.TargetPodSpec.Containers[0].VolumeMounts; len(mounts) != 1 || mounts[0].Name != "cbi-gitcontext" {
+		t.Fatalf("unexpected volume mounts: %+v", mounts)
+	}
+	merge := ci.TargetPodSpec.InitContainers[2]
+	if cmd := merge.Command; !reflect.DeepEqual(cmd, []string{"cp", "-R", "/cbi-1-cmcontext/context/.", contextPath}) {
+		t.Fatalf("unexpected command %v", cmd)
+	}
+	var mountNames []string
+	for _, m := range merge.VolumeMounts {
+		mountNames = append(mountNames, m.Name)
+	}
+	if !reflect.DeepEqual(mountNames, []string{"cbi-gitcontext", "cbi-1-cmcontext"}) {
+		t.Fatalf("unexpected volume mounts: %v", mountNames)
+	}
+	// only the main context reports the resolved revision
+	if args := ci.TargetPodSpec.InitContainers[3].Args; hasArg(args, "--termination-message-path") {
+		t.Fatalf("unexpected args %v", args)
+	}
+
+	ci = newTestContextInjector()
+	if _, err := ci.Inject(crd.Context{
+		Kind: crd.ContextKindGit,
+		Git:  crd.Git{URL: "https://example.com/foo.git"},
+		Additional: []crd.Context{
+			{Kind: crd.ContextKindGit, Git: crd.Git{URL: "https://example.com/bar.git"},
+				Additional: []crd.Context{{Kind: crd.ContextKindGit, Git: crd.Git{URL: "https://example.com/baz.git"}}}},
+		},
+	}); err == nil {
+		t.Fatal("error is expected for nested additional contexts")
+	}
+}
+
+func TestInjectAdditionalContextsIntoLocal(t *testing.T) {
+	ci := newTestContextInjector()
+	ci.AllowLocalContext = true
+	if _, err := ci.Inject(crd.Context{
+		Kind:       crd.ContextKindLocal,
+		Local:      crd.Local{Path: "/home/user/src/foo"},
+		Additional: []crd.Context{{Kind: crd.ContextKindGit, Git: crd.Git{URL: "https://example.com/bar.git"}}},
+	}); err == nil {
+		t.Fatal("error is expected")
+	}
+}
+
+func TestInjectHTTPBasicAuth(t *testing.T) {
+	cases := []struct {
+		url      string
+		insecure bool
+		invalid  bool
+	}{
+		{url: "https://example.com/foo.tar"},
+		{url: "HTTPS://example.com/foo.tar"},
+		{url: "http://example.com/foo.tar", invalid: true},
+		{url: "http://example.com/foo.tar", insecure: true},
+	}
+	for _, c := range cases {
+		ci := newTestContextInjector()
+		_, err := ci.Inject(crd.Context{
+			Kind: crd.ContextKindHTTP,
+			HTTP: crd.HTTP{
+				URL:                c.url,
+				Insecure:           c.insecure,
+				BasicAuthSecretRef: corev1.LocalObjectReference{Name: "auth"},
+			},
+		})
+		if err != nil && !c.invalid {
+			t.Fatalf("%+v: %v", c, err)
+		}
+		if err == nil && c.invalid {
+			t.Fatalf("%+v: error is expected", c)
+		}
+		if c.invalid {
+			continue
+		}
+		initContainer := ci.TargetPodSpec.InitContainers[0]
+		for _, arg := range []string{"/cbi-httpauthsecret/username", "/cbi-httpauthsecret/password"} {
+			if !hasArg(initContainer.Args, arg) {
+				t.Fatalf("%+v: %q not found in %v", c, arg, initContainer.Args)
+			}
+		}
+		if m := initContainer.VolumeMounts; len(m) != 2 || m[1].Name != "cbi-httpauthsecret" {
+			t.Fatalf("%+v: unexpected volume mounts: %+v", c, m)
+		}
+		// the secret is not mounted on the target container
+		if m := ci.TargetPodSpec.Containers[0].VolumeMounts; len(m) != 1 {
+			t.Fatalf("%+v: unexpected volume mounts: %+v", c, m)
+		}
+	}
+}
+
+func TestInjectGitHTTPSAuth(t *testing.T) {
+	cases := []struct {
+		url     string
+		invalid bool
+	}{
+		{url: "https://bitbucket.example.com/foo/bar.git"},
+		{url: "HTTPS://github.example.com/foo/bar.git"},
+		{url: "http://example.com/foo.git", invalid: true},
+		{url: "ssh://git@example.com/foo.git", invalid: true},
+	}
+	for _, c := range cases {
+		ci := newTestContextInjector()
+		_, err := ci.Inject(crd.Context{
+			Kind: crd.ContextKindGit,
+			Git: crd.Git{
+				URL:                c.url,
+				HTTPSAuthSecretRef: corev1.LocalObjectReference{Name: "auth"},
+			},
+		})
+		if err != nil && !c.invalid {
+			t.Fatalf("%+v: %v", c, err)
+		}
+		if err == nil && c.invalid {
+			t.Fatalf("%+v: error is expected", c)
+		}
+		if c.invalid {
+			continue
+		}
+		initContainer := ci.TargetPodSpec.InitContainers[0]
+		if !hasArg(initContainer.Args, "--https-auth-dir") || !hasArg(initContainer.Args, "/cbi-githttpsauthsecret") {
+			t.Fatalf("%+v: unexpected args %v", c, initContainer.Args)
+		}
+		if m := initContainer.VolumeMounts; len(m) != 2 || m[1].Name != "cbi-githttpsauthsecret" {
+			t.Fatalf("%+v: unexpected volume mounts: %+v", c, m)
+		}
+		// the secret is not mounted on the target container
+		if m := ci.TargetPodSpec.Containers[0].VolumeMounts; len(m) != 1 {
+			t.Fatalf("%+v: unexpected volume mounts: %+v", c, m)
+		}
+	}
+}
+
+func TestInjectGitHubApp(t *testing.T) {
+	cases := []struct {
+		git     crd.Git
+		invalid bool
+	}{
+		{git: crd.Git{URL: "https://github.com/foo/bar.git"}},
+		{git: crd.Git{URL: "ssh://git@github.com/foo/bar.git"}, invalid: true},
+		{
+			git:     crd.Git{URL: "https://github.com/foo/bar.git", HTTPSAuthSecretRef: corev1.LocalObjectReference{Name: "auth"}},
+			invalid: true,
+		},
+	}
+	for _, c := range cases {
+		ci := newTestContextInjector()
+		c.git.GitHubAppSecretRef = corev1.LocalObjectReference{Name: "app"}
+		_, err := ci.Inject(crd.Context{Kind: crd.ContextKindGit, Git: c.git})
+		if err != nil && !c.invalid {
+			t.Fatalf("%+v: %v", c, err)
+		}
+		if err == nil && c.invalid {
+			t.Fatalf("%+v: error is expected", c)
+		}
+		if c.invalid {
+			continue
+		}
+		initContainer := ci.TargetPodSpec.InitContainers[0]
+		if !hasArg(initContainer.Args, "--github-app-dir") || !hasArg(initContainer.Args, "/cbi-githubappsecret") {
+			t.Fatalf("%+v: unexpected args %v", c, initContainer.Args)
+		}
+		if m := initContainer.VolumeMounts; len(m) != 2 || m[1].Name != "cbi-githubappsecret" {
+			t.Fatalf("%+v: unexpected volume mounts: %+v", c, m)
+		}
+		// the private key is not mounted on the target container
+		if m := ci.TargetPodSpec.Containers[0].VolumeMounts; len(m) != 1 {
+			t.Fatalf("%+v: unexpected volume mounts: %+v", c, m)
+		}
+	}
+}
+
+func TestInjectRcloneFlags(t *testing.T) {
+	cases := []struct {
+		flags    []string
+		expected []string
+		invalid  bool
+	}{
+		{
+			expected: []string{"populate-rclone", "remote:foo", "/cbi-rclonecontext/context"},
+		},
+		{
+			flags:    []string{"--bwlimit=10M", "--transfers=2"},
+			expected: []string{"populate-rclone", "--rclone-flag=--bwlimit=10M", "--rclone-flag=--transfers=2", "remote:foo", "/cbi-rclonecontext/context"},
+		},
+		{
+			flags:   []string{"--config=/etc/passwd"},
+			invalid: true,
+		},
+		{
+			flags:   []string{"--bwlimit", "10M"},
+			invalid: true,
+		},
+		{
+			flags:   []string{"--bwlimit=10M", "--log-file=/tmp/foo"},
+			invalid: true,
+		},
+	}
+	for _, c := range cases {
+		ci := newTestContextInjector()
+		_, err := ci.Inject(crd.Context{
+			Kind:   crd.ContextKindRclone,
+			Rclone: crd.Rclone{Remote: "remote", Path: "foo", Flags: c.flags},
+		})
+		if err != nil && !c.invalid {
+			t.Fatalf("%v: %v", c.flags, err)
+		}
+		if err == nil && c.invalid {
+			t.Fatalf("%v: error is expected", c.flags)
+		}
+		if c.invalid {
+			continue
+		}
+		if args := ci.TargetPodSpec.InitContainers[0].Args; !reflect.DeepEqual(c.expected, args) {
+			t.Fatalf("%v: expected %v, got %v", c.flags, c.expected, args)
+		}
+	}
+}
+
+func TestInjectRcloneSSHSecret(t *testing.T) {
+	cases := []struct {
+		rclone   crd.Rclone
+		mountSSH bool
+		invalid  bool
+	}{
+		{
+			rclone:   crd.Rclone{Remote: "remote", RemoteType: "sftp", SSHSecretRef: corev1.LocalObjectReference{Name: "ssh"}},
+			mountSSH: true,
+		},
+		{
+			rclone:   crd.Rclone{Remote: ":sftp,host=example.com", SSHSecretRef: corev1.LocalObjectReference{Name: "ssh"}},
+			mountSSH: true,
+		},
+		{
+			rclone:  crd.Rclone{Remote: "remote", RemoteType: "SFTP"},
+			invalid: true,
+		},
+		{
+			rclone:  crd.Rclone{Remote: ":sftp,host=example.com"},
+			invalid: true,
+		},
+		{
+			rclone:   crd.Rclone{Remote: "remote", RemoteType: "s3", SSHSecretRef: corev1.LocalObjectReference{Name: "ssh"}},
+			mountSSH: false,
+		},
+		{
+			rclone:   crd.Rclone{Remote: "remote", RemoteType: "s3"},
+			mountSSH: false,
+		},
+		{
+			// unknown type
+			rclone:   crd.Rclone{Remote: "remote", SSHSecretRef: corev1.LocalObjectReference{Name: "ssh"}},
+			mountSSH: true,
+		},
+	}
+	for _, c := range cases {
+		c.rclone.SecretRef = corev1.LocalObjectReference{Name: "rclone"}
+		ci := newTestContextInjector()
+		_, err := ci.Inject(crd.Context{
+			Kind:   crd.ContextKindRclone,
+			Rclone: c.rclone,
+		})
+		if err != nil && !c.invalid {
+			t.Fatalf("%+v: %v", c.rclone, err)
+		}
+		if err == nil && c.invalid {
+			t.Fatalf("%+v: error is expected", c.rclone)
+		}
+		if c.invalid {
+			continue
+		}
+		var mounted bool
+		for _, m := range ci.TargetPodSpec.InitContainers[0].VolumeMounts {
+			if m.Name == "cbi-rclonesshsecret" {
+				mounted = true
+				if m.MountPath != "/root/.ssh" {
+					t.Fatalf("%+v: unexpected mount path %q", c.rclone, m.MountPath)
+				}
+			}
+		}
+		if mounted != c.mountSSH {
+			t.Fatalf("%+v: expected SSH secret mounted=%v, got %v", c.rclone, c.mountSSH, mounted)
+		}
+	}
+}
+
+// TestInjectGolden compares the pod specs generated for the contexts with testdata/*.golden.yaml.
+// Run `go test -update-golden` to update the golden files after intended changes.
+func TestInjectGolden(t *testing.T) {
+	mode := int32(0755)
+	cases := []struct {
+		golden  string
+		context crd.Context
+	}{
+		{
+			golden: "git",
+			context: crd.Context{
+				Kind: crd.ContextKindGit,
+				Git:  crd.Git{URL: "https://github.com/foo/bar.git", Revision: "v1.0.0"},
+			},
+		},
+		{
+			golden: "git-ssh",
+			context: crd.Context{
+				Kind: crd.ContextKindGit,
+				Git: crd.Git{URL: "git@github.com:foo/bar.git", SubPath: "app",
+					SSHSecretRef: corev1.LocalObjectReference{Name: "ssh"}},
+			},
+		},
+		{
+			golden: "configmap",
+			context: crd.Context{
+				Kind:         crd.ContextKindConfigMap,
+				ConfigMapRef: corev1.LocalObjectReference{Name: "foo"},
+			},
+		},
+		{
+			golden: "configmap-items",
+			context: crd.Context{
+				Kind:                 crd.ContextKindConfigMap,
+				ConfigMapRef:         corev1.LocalObjectReference{Name: "foo"},
+				ConfigMapItems:       []corev1.KeyToPath{{Key: "build.sh", Path: "scripts/build.sh"}},
+				ConfigMapDefaultMode: &mode,
+			},
+		},
+	}
+	for _, c := range cases {
+		ci := newTestContextInjector()
+		if _, err := ci.Inject(c.context); err != nil {
+			t.Fatalf("%s: %v", c.golden, err)
+		}
+		goldenFile := filepath.Join("testdata", c.golden+".golden.yaml")
+		if *updateGolden {
+			b, err := yaml.Marshal(ci.TargetPodSpec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := ioutil.WriteFile(goldenFile, b, 0644); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		b, err := ioutil.ReadFile(goldenFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var golden corev1.PodSpec
+		if err := yaml.Unmarshal(b, &golden); err != nil {
+			t.Fatalf("%s: %v", goldenFile, err)
+		}
+		if diff := cbipluginhelpertest.DiffPodSpecs(&golden, ci.TargetPodSpec); diff != "" {
+			t.Fatalf("%s: unexpected pod spec (- golden, + actual):\n%s", c.golden, diff)
+		}
+	}
+}
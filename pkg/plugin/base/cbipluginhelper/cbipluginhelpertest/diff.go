@@ -0,0 +1,175 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package cbipluginhelpertest provides utilities for testing the pod specs generated by plugins.
+package cbipluginhelpertest
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// DiffPodSpecs returns a human-readable diff of the volumes, the volume mounts, and the init
+// containers of a and b, e.g. for comparing the pod spec generated by an injector with a golden file.
+// Each line is prefixed with "-" for a and "+" for b.
+// An empty string is returned when no difference is found.
+func DiffPodSpecs(a, b *corev1.PodSpec) string {
+	if a == nil {
+		a = &corev1.PodSpec{}
+	}
+	if b == nil {
+		b = &corev1.PodSpec{}
+	}
+	var d differ
+	d.volumes(a.Volumes, b.Volumes)
+	d.containers("initContainers", a.InitContainers, b.InitContainers, true)
+	d.containers("containers", a.Containers, b.Containers, false)
+	return strings.Join(d.lines, "\n")
+}
+
+type differ struct {
+	lines []string
+}
+
+// value appends the lines for key when va and vb differ.
+// A nil value stands for a missing item.
+func (d *differ) value(key string, va, vb interface{}) {
+	sa, sb := render(va), render(vb)
+	if sa == sb {
+		return
+	}
+	if va != nil {
+		d.lines = append(d.lines, fmt.Sprintf("- %s: %s", key, sa))
+	}
+	if vb != nil {
+		d.lines = append(d.lines, fmt.Sprintf("+ %s: %s", key, sb))
+	}
+}
+
+func (d *differ) volumes(a, b []corev1.Volume) {
+	ma, mb := make(map[string]interface{}), make(map[string]interface{})
+	for _, v := range a {
+		ma[v.Name] = v.VolumeSource
+	}
+	for _, v := range b {
+		mb[v.Name] = v.VolumeSource
+	}
+	for _, k := range sortedKeys(ma, mb) {
+		d.value(fmt.Sprintf("volumes[%s]", k), ma[k], mb[k])
+	}
+}
+
+// containers compares the containers by name.
+// When full is false, only the volume mounts are compared.
+func (d *differ) containers(field string, a, b []corev1.Container, full bool) {
+	ma, mb := make(map[string]corev1.Container), make(map[string]corev1.Container)
+	var na, nb []string
+	for _, c := range a {
+		ma[c.Name] = c
+		na = append(na, c.Name)
+	}
+	for _, c := range b {
+		mb[c.Name] = c
+		nb = append(nb, c.Name)
+	}
+	// the order of the init containers matters
+	if full && strings.Join(na, ",") != strings.Join(nb, ",") {
+		d.lines = append(d.lines, fmt.Sprintf("- %s: %v", field, na), fmt.Sprintf("+ %s: %v", field, nb))
+	}
+	keys := make(map[string]interface{})
+	for _, n := range append(na, nb...) {
+		keys[n] = nil
+	}
+	for _, k := range sortedKeys(keys) {
+		ca, okA := ma[k]
+		cb, okB := mb[k]
+		key := fmt.Sprintf("%s[%s]", field, k)
+		if !okA || !okB {
+			if full {
+				d.value(key, optional(ca, okA), optional(cb, okB))
+			}
+			continue
+		}
+		d.mounts(key+".volumeMounts", ca.VolumeMounts, cb.VolumeMounts)
+		if !full {
+			continue
+		}
+		d.value(key+".image", ca.Image, cb.Image)
+		d.value(key+".command", ca.Command, cb.Command)
+		d.value(key+".args", ca.Args, cb.Args)
+		d.value(key+".env", ca.Env, cb.Env)
+		d.value(key+".workingDir", ca.WorkingDir, cb.WorkingDir)
+		// the other fields, e.g. resources
+		ca.VolumeMounts, cb.VolumeMounts = nil, nil
+		ca.Image, cb.Image = "", ""
+		ca.Command, cb.Command = nil, nil
+		ca.Args, cb.Args = nil, nil
+		ca.Env, cb.Env = nil, nil
+		ca.WorkingDir, cb.WorkingDir = "", ""
+		d.value(key, ca, cb)
+	}
+}
+
+// mounts compares the volume mounts by the mount path.
+func (d *differ) mounts(key string, a, b []corev1.VolumeMount) {
+	ma, mb := make(map[string]interface{}), make(map[string]interface{})
+	for _, m := range a {
+		ma[m.MountPath] = m
+	}
+	for _, m := range b {
+		mb[m.MountPath] = m
+	}
+	for _, k := range sortedKeys(ma, mb) {
+		d.value(fmt.Sprintf("%s[%s]", key, k), ma[k], mb[k])
+	}
+}
+
+func optional(c corev1.Container, ok bool) interface{} {
+	if !ok {
+		return nil
+	}
+	return c
+}
+
+func render(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%+v", v)
+	}
+	return string(b)
+}
+
+func sortedKeys(maps ...map[string]interface{}) []string {
+	seen := make(map[string]bool)
+	var keys []string
+	for _, m := range maps {
+		for k := range m {
+			if !seen[k] {
+				seen[k] = true
+				keys = append(keys, k)
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,100 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cbipluginhelpertest
+
+import (
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func testPodSpec() *corev1.PodSpec {
+	return &corev1.PodSpec{
+		Volumes: []corev1.Volume{
+			{Name: "cbi-gitcontext", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}},
+		},
+		InitContainers: []corev1.Container{
+			{
+				Name:         "cbi-gitcontext-init",
+				Image:        "cbipluginhelper",
+				Args:         []string{"populate-git", "https://github.com/foo/bar.git", "/cbi-gitcontext/context"},
+				VolumeMounts: []corev1.VolumeMount{{Name: "cbi-gitcontext", MountPath: "/cbi-gitcontext"}},
+			},
+		},
+		Containers: []corev1.Container{
+			{
+				Name:         "job",
+				Image:        "builder",
+				VolumeMounts: []corev1.VolumeMount{{Name: "cbi-gitcontext", MountPath: "/cbi-gitcontext"}},
+			},
+		},
+	}
+}
+
+func TestDiffPodSpecs(t *testing.T) {
+	cases := []struct {
+		modify   func(*corev1.PodSpec)
+		expected []string
+	}{
+		{
+			modify: func(*corev1.PodSpec) {},
+		},
+		{
+			// the images of the containers are not compared
+			modify: func(p *corev1.PodSpec) { p.Containers[0].Image = "builder2" },
+		},
+		{
+			modify: func(p *corev1.PodSpec) {
+				p.Volumes = append(p.Volumes, corev1.Volume{Name: "cbi-gitsshsecret"})
+			},
+			expected: []string{"+ volumes[cbi-gitsshsecret]: {}"},
+		},
+		{
+			modify: func(p *corev1.PodSpec) { p.InitContainers[0].Args[1] = "https://github.com/foo/baz.git" },
+			expected: []string{
+				`- initContainers[cbi-gitcontext-init].args: ["populate-git","https://github.com/foo/bar.git","/cbi-gitcontext/context"]`,
+				`+ initContainers[cbi-gitcontext-init].args: ["populate-git","https://github.com/foo/baz.git","/cbi-gitcontext/context"]`,
+			},
+		},
+		{
+			modify: func(p *corev1.PodSpec) { p.Containers[0].VolumeMounts[0].ReadOnly = true },
+			expected: []string{
+				`- containers[job].volumeMounts[/cbi-gitcontext]: {"name":"cbi-gitcontext","mountPath":"/cbi-gitcontext"}`,
+				`+ containers[job].volumeMounts[/cbi-gitcontext]: {"name":"cbi-gitcontext","readOnly":true,"mountPath":"/cbi-gitcontext"}`,
+			},
+		},
+		{
+			modify: func(p *corev1.PodSpec) {
+				p.InitContainers = append([]corev1.Container{{Name: "cbi-merge"}}, p.InitContainers...)
+			},
+			expected: []string{
+				"- initContainers: [cbi-gitcontext-init]",
+				"+ initContainers: [cbi-merge cbi-gitcontext-init]",
+				`+ initContainers[cbi-merge]: {"name":"cbi-merge","resources":{}}`,
+			},
+		},
+	}
+	for i, c := range cases {
+		b := testPodSpec()
+		c.modify(b)
+		actual := DiffPodSpecs(testPodSpec(), b)
+		if expected := strings.Join(c.expected, "\n"); actual != expected {
+			t.Fatalf("case %d: expected\n%s\ngot\n%s", i, expected, actual)
+		}
+	}
+}
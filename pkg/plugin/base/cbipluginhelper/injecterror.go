@@ -0,0 +1,70 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cbipluginhelper
+
+import (
+	crd "github.com/containerbuilding/cbi/pkg/apis/cbi/v1alpha1"
+)
+
+// InjectErrorReason is a CamelCase code for InjectError.
+type InjectErrorReason string
+
+const (
+	// InjectErrorUnsupportedKind means the context kind is not supported by ContextInjector.
+	InjectErrorUnsupportedKind InjectErrorReason = "UnsupportedKind"
+	// InjectErrorNotEnabled means the context kind needs to be enabled on the plugin side,
+	// e.g. Helper.AllowLocalContext for Local context.
+	InjectErrorNotEnabled InjectErrorReason = "NotEnabled"
+	// InjectErrorInvalidSpec means the context spec is invalid or not supported in the combination.
+	InjectErrorInvalidSpec InjectErrorReason = "InvalidSpec"
+	// InjectErrorInvalidInjector means the ContextInjector itself is misconfigured by the plugin.
+	InjectErrorInvalidInjector InjectErrorReason = "InvalidInjector"
+)
+
+// InjectError is returned by ContextInjector.Inject.
+// InjectError intentionally does not implement Cause(), so that
+// github.com/pkg/errors.Cause stops at InjectError.
+type InjectError struct {
+	// Kind is the kind of the context, which may be an additional context.
+	Kind   crd.ContextKind
+	Reason InjectErrorReason
+	// Err is the underlying error.
+	Err error
+}
+
+// Error returns the message of the underlying error.
+func (e *InjectError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error, for the standard errors package.
+func (e *InjectError) Unwrap() error {
+	return e.Err
+}
+
+// newInjectError returns err as InjectError for kind.
+// err is returned as-is if it is already InjectError, e.g. for the additional contexts.
+// Nil is returned for nil err.
+func newInjectError(kind crd.ContextKind, reason InjectErrorReason, err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(*InjectError); ok {
+		return err
+	}
+	return &InjectError{Kind: kind, Reason: reason, Err: err}
+}
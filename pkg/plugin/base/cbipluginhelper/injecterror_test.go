@@ -0,0 +1,108 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cbipluginhelper
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+
+	crd "github.com/containerbuilding/cbi/pkg/apis/cbi/v1alpha1"
+)
+
+func TestInjectError(t *testing.T) {
+	testCases := []struct {
+		context        crd.Context
+		allowLocal     bool
+		expectedKind   crd.ContextKind
+		expectedReason InjectErrorReason
+		expectedError  string
+	}{
+		{
+			context:        crd.Context{Kind: "Foo"},
+			expectedKind:   "Foo",
+			expectedReason: InjectErrorUnsupportedKind,
+			expectedError:  "unsupported Spec.Context: foo",
+		},
+		{
+			context:        crd.Context{Kind: crd.ContextKindLocal, Local: crd.Local{Path: "/foo"}},
+			expectedKind:   crd.ContextKindLocal,
+			expectedReason: InjectErrorNotEnabled,
+			expectedError:  "Local context is not enabled",
+		},
+		{
+			context:        crd.Context{Kind: crd.ContextKindS3, S3: crd.S3{Bucket: "bucket"}},
+			expectedKind:   crd.ContextKindS3,
+			expectedReason: InjectErrorInvalidSpec,
+			expectedError:  "Spec.Context.S3.Bucket and Spec.Context.S3.Key are required",
+		},
+		{
+			context: crd.Context{
+				Kind:         crd.ContextKindConfigMap,
+				ConfigMapRef: corev1.LocalObjectReference{Name: "foo"},
+				Additional:   []crd.Context{{Kind: "Foo"}},
+			},
+			expectedKind:   "Foo",
+			expectedReason: InjectErrorUnsupportedKind,
+			expectedError:  "Spec.Context.Additional[0]: unsupported Spec.Context: foo",
+		},
+		{
+			context: crd.Context{
+				Kind:       crd.ContextKindLocal,
+				Local:      crd.Local{Path: "/foo"},
+				Additional: []crd.Context{{Kind: crd.ContextKindConfigMap, ConfigMapRef: corev1.LocalObjectReference{Name: "foo"}}},
+			},
+			allowLocal:     true,
+			expectedKind:   crd.ContextKindLocal,
+			expectedReason: InjectErrorInvalidSpec,
+			expectedError:  "Spec.Context.Additional is not supported for Local context",
+		},
+	}
+	for i, tc := range testCases {
+		ci := newTestContextInjector()
+		ci.Helper.AllowLocalContext = tc.allowLocal
+		_, err := ci.Inject(tc.context)
+		if err == nil {
+			t.Fatalf("case %d: error is expected", i)
+		}
+		ie, ok := err.(*InjectError)
+		if !ok {
+			t.Fatalf("case %d: expected *InjectError, got %T", i, err)
+		}
+		if ie.Kind != tc.expectedKind || ie.Reason != tc.expectedReason {
+			t.Fatalf("case %d: expected %s/%s, got %s/%s", i, tc.expectedKind, tc.expectedReason, ie.Kind, ie.Reason)
+		}
+		if err.Error() != tc.expectedError {
+			t.Fatalf("case %d: expected %q, got %q", i, tc.expectedError, err.Error())
+		}
+	}
+}
+
+func TestInjectErrorCause(t *testing.T) {
+	err := errors.Wrap(newInjectError(crd.ContextKindGit, InjectErrorInvalidSpec, errors.New("foo")), "bar")
+	ie, ok := errors.Cause(err).(*InjectError)
+	if !ok {
+		t.Fatalf("expected *InjectError, got %T", errors.Cause(err))
+	}
+	if ie.Reason != InjectErrorInvalidSpec || ie.Error() != "foo" {
+		t.Fatalf("unexpected cause %+v", ie)
+	}
+	if newInjectError(crd.ContextKindGit, InjectErrorInvalidSpec, nil) != nil {
+		t.Fatal("nil is expected for nil error")
+	}
+}
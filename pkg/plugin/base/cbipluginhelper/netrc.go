@@ -0,0 +1,72 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cbipluginhelper
+
+import (
+	"fmt"
+
+	"github.com/cyphar/filepath-securejoin"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// NetrcSecretKey is the key of the .netrc file in BuildJobSpec.NetrcSecretRef.
+const NetrcSecretKey = ".netrc"
+
+// InjectNetrc mounts the .netrc in secretRef read-only on $HOME/.netrc of the target container, with mode 0400.
+// The .netrc is mounted as a single file, so that the other files in $HOME are not hidden.
+// Nothing is injected for empty secretRef.
+func (h *Helper) InjectNetrc(podSpec *corev1.PodSpec, containerIdx int, secretRef corev1.LocalObjectReference) error {
+	if secretRef.Name == "" {
+		return nil
+	}
+	if containerIdx < 0 || containerIdx >= len(podSpec.Containers) {
+		return fmt.Errorf("invalid container index %d", containerIdx)
+	}
+	if err := h.validateHomeDir(); err != nil {
+		return err
+	}
+	mountPath, err := securejoin.SecureJoin(h.HomeDir, ".netrc")
+	if err != nil {
+		return err
+	}
+	const volName = "cbi-netrc"
+	mode := int32(0400)
+	podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+		Name: volName,
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{
+				SecretName: secretRef.Name,
+				Items: []corev1.KeyToPath{
+					{
+						Key:  NetrcSecretKey,
+						Path: ".netrc",
+						Mode: &mode,
+					},
+				},
+			},
+		},
+	})
+	podSpec.Containers[containerIdx].VolumeMounts = append(podSpec.Containers[containerIdx].VolumeMounts,
+		corev1.VolumeMount{
+			Name:      volName,
+			MountPath: mountPath,
+			SubPath:   ".netrc",
+			ReadOnly:  true,
+		},
+	)
+	return nil
+}
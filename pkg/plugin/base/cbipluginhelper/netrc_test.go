@@ -0,0 +1,77 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cbipluginhelper
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestInjectNetrc(t *testing.T) {
+	h := Helper{Image: "cbipluginhelper", HomeDir: "/home/user"}
+	podSpec := &corev1.PodSpec{
+		InitContainers: []corev1.Container{{Name: "cbi-init"}},
+		Containers:     []corev1.Container{{Name: DefaultBuildContainerName}},
+	}
+	if err := h.InjectNetrc(podSpec, 0, corev1.LocalObjectReference{Name: "netrc"}); err != nil {
+		t.Fatal(err)
+	}
+	expectedMounts := []corev1.VolumeMount{
+		{Name: "cbi-netrc", MountPath: "/home/user/.netrc", SubPath: ".netrc", ReadOnly: true},
+	}
+	if mounts := podSpec.Containers[0].VolumeMounts; !reflect.DeepEqual(mounts, expectedMounts) {
+		t.Fatalf("expected %+v, got %+v", expectedMounts, mounts)
+	}
+	if mounts := podSpec.InitContainers[0].VolumeMounts; len(mounts) != 0 {
+		t.Fatalf(".netrc should not be mounted on the init containers, got %+v", mounts)
+	}
+	mode := int32(0400)
+	expectedVolumes := []corev1.Volume{
+		{
+			Name: "cbi-netrc",
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{
+					SecretName: "netrc",
+					Items:      []corev1.KeyToPath{{Key: ".netrc", Path: ".netrc", Mode: &mode}},
+				},
+			},
+		},
+	}
+	if !reflect.DeepEqual(podSpec.Volumes, expectedVolumes) {
+		t.Fatalf("expected %+v, got %+v", expectedVolumes, podSpec.Volumes)
+	}
+}
+
+func TestInjectNetrcEmpty(t *testing.T) {
+	h := Helper{Image: "cbipluginhelper", HomeDir: "/root"}
+	podSpec := &corev1.PodSpec{Containers: []corev1.Container{{Name: DefaultBuildContainerName}}}
+	if err := h.InjectNetrc(podSpec, 0, corev1.LocalObjectReference{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(podSpec.Volumes) != 0 || len(podSpec.Containers[0].VolumeMounts) != 0 {
+		t.Fatalf("unexpected pod spec %+v", podSpec)
+	}
+	if err := h.InjectNetrc(podSpec, 1, corev1.LocalObjectReference{Name: "netrc"}); err == nil {
+		t.Fatal("error is expected for invalid container index")
+	}
+	h.HomeDir = ""
+	if err := h.InjectNetrc(podSpec, 0, corev1.LocalObjectReference{Name: "netrc"}); err == nil {
+		t.Fatal("error is expected for empty HomeDir")
+	}
+}
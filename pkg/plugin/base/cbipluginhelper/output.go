@@ -0,0 +1,121 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cbipluginhelper
+
+import (
+	"fmt"
+
+	"github.com/cyphar/filepath-securejoin"
+	corev1 "k8s.io/api/core/v1"
+
+	crd "github.com/containerbuilding/cbi/pkg/apis/cbi/v1alpha1"
+	pluginapi "github.com/containerbuilding/cbi/pkg/plugin/api"
+)
+
+const (
+	outputVolName      = "cbi-output"
+	outputVolMountPath = "/" + outputVolName
+	// OutputArchivePath is the path where the target container needs to write the archive
+	// for BuildJobSpec.Output.
+	OutputArchivePath = outputVolMountPath + "/image.tar"
+)
+
+// InjectOutput injects the container that exports the archive at OutputArchivePath to output.
+// NOP for OutputKindNone.
+//
+// The target container is moved to the end of the init containers, so that the archive
+// is complete before being exported. Hence InjectOutput needs to be called after the target
+// container and the contexts are fully configured.
+func (ci *Injector) InjectOutput(output crd.Output) error {
+	if output.Kind == crd.OutputKindNone {
+		return nil
+	}
+	idx := ci.TargetContainerIdx
+	if len(ci.TargetPodSpec.Containers) != 1 {
+		return fmt.Errorf("Spec.Output requires the pod to have only the target container, got %d containers", len(ci.TargetPodSpec.Containers))
+	}
+	mount := corev1.VolumeMount{
+		Name:      outputVolName,
+		MountPath: outputVolMountPath,
+	}
+	exportContainer := corev1.Container{
+		Name:         pluginapi.ExportContainerName,
+		Image:        ci.Helper.Image,
+		VolumeMounts: []corev1.VolumeMount{mount},
+	}
+	switch output.Kind {
+	case crd.OutputKindS3:
+		if output.S3.Bucket == "" || output.S3.Key == "" {
+			return fmt.Errorf("Spec.Output.S3.Bucket and Spec.Output.S3.Key are required")
+		}
+		// flags need to precede the positional args
+		args := []string{"export-s3", "--termination-message-path", corev1.TerminationMessagePathDefault}
+		if output.S3.Endpoint != "" {
+			args = append(args, "--endpoint", output.S3.Endpoint)
+		}
+		if output.S3.Region != "" {
+			args = append(args, "--region", output.S3.Region)
+		}
+		exportContainer.Args = append(args, OutputArchivePath, output.S3.Bucket, output.S3.Key)
+		exportContainer.Env = s3SecretEnv(output.S3.SecretRef)
+	case crd.OutputKindRclone:
+		if output.Rclone.Remote == "" || output.Rclone.Path == "" {
+			return fmt.Errorf("Spec.Output.Rclone.Remote and Spec.Output.Rclone.Path are required")
+		}
+		args := []string{"export-rclone", "--termination-message-path", corev1.TerminationMessagePathDefault}
+		for _, f := range output.Rclone.Flags {
+			if err := crd.ValidateRcloneFlag(f); err != nil {
+				return err
+			}
+			args = append(args, "--rclone-flag="+f)
+		}
+		exportContainer.Args = append(args, OutputArchivePath, output.Rclone.Remote+":"+output.Rclone.Path)
+		secretVolName := "cbi-outputrclonesecret"
+		secretVolMountPath, err := securejoin.SecureJoin(ci.Helper.HomeDir, ".config/rclone")
+		if err != nil {
+			return err
+		}
+		ci.TargetPodSpec.Volumes = append(ci.TargetPodSpec.Volumes, corev1.Volume{
+			Name: secretVolName,
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{
+					SecretName:  output.Rclone.SecretRef.Name,
+					DefaultMode: ci.Helper.secretMode(ci.TargetPodSpec),
+				},
+			},
+		})
+		exportContainer.VolumeMounts = append(exportContainer.VolumeMounts, corev1.VolumeMount{
+			Name:      secretVolName,
+			MountPath: secretVolMountPath,
+		})
+	default:
+		return fmt.Errorf("unsupported Spec.Output.Kind: %q", output.Kind)
+	}
+	ci.Helper.configureInitContainer(&exportContainer)
+
+	ci.TargetPodSpec.Volumes = append(ci.TargetPodSpec.Volumes, corev1.Volume{
+		Name: outputVolName,
+		VolumeSource: corev1.VolumeSource{
+			EmptyDir: &corev1.EmptyDirVolumeSource{},
+		},
+	})
+	target := ci.TargetPodSpec.Containers[idx]
+	target.VolumeMounts = append(target.VolumeMounts, mount)
+	ci.TargetPodSpec.InitContainers = append(ci.TargetPodSpec.InitContainers, target)
+	ci.TargetPodSpec.Containers = []corev1.Container{exportContainer}
+	return nil
+}
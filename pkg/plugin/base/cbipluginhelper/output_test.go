@@ -0,0 +1,88 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cbipluginhelper
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+
+	crd "github.com/containerbuilding/cbi/pkg/apis/cbi/v1alpha1"
+	pluginapi "github.com/containerbuilding/cbi/pkg/plugin/api"
+)
+
+func TestInjectOutput(t *testing.T) {
+	testCases := []struct {
+		output       crd.Output
+		expectedArgs []string
+		expectedEnv  int
+	}{
+		{
+			output: crd.Output{Kind: crd.OutputKindS3, S3: crd.S3{Bucket: "foo", Key: "bar.tar", Region: "us-east-1",
+				SecretRef: corev1.LocalObjectReference{Name: "s3"}}},
+			expectedArgs: []string{"export-s3", "--termination-message-path", corev1.TerminationMessagePathDefault,
+				"--region", "us-east-1", OutputArchivePath, "foo", "bar.tar"},
+			expectedEnv: 2,
+		},
+		{
+			output: crd.Output{Kind: crd.OutputKindRclone, Rclone: crd.Rclone{Remote: "foo", Path: "bar.tar",
+				SecretRef: corev1.LocalObjectReference{Name: "rclone"}, Flags: []string{"--bwlimit=1M"}}},
+			expectedArgs: []string{"export-rclone", "--termination-message-path", corev1.TerminationMessagePathDefault,
+				"--rclone-flag=--bwlimit=1M", OutputArchivePath, "foo:bar.tar"},
+		},
+	}
+	for _, tc := range testCases {
+		podSpec := corev1.PodSpec{
+			InitContainers: []corev1.Container{{Name: "cbi-gitcontext-init"}},
+			Containers:     []corev1.Container{{Name: "build"}},
+		}
+		ij := Injector{
+			Helper:        Helper{Image: "cbipluginhelper", HomeDir: "/root"},
+			TargetPodSpec: &podSpec,
+		}
+		if err := ij.InjectOutput(tc.output); err != nil {
+			t.Fatal(err)
+		}
+		if len(podSpec.InitContainers) != 2 || podSpec.InitContainers[1].Name != "build" {
+			t.Fatalf("%+v: the target container should be the last init container, got %+v", tc.output, podSpec.InitContainers)
+		}
+		if mounts := podSpec.InitContainers[1].VolumeMounts; len(mounts) != 1 || mounts[0].Name != outputVolName {
+			t.Fatalf("%+v: unexpected mounts of the target container %+v", tc.output, mounts)
+		}
+		if len(podSpec.Containers) != 1 || podSpec.Containers[0].Name != pluginapi.ExportContainerName {
+			t.Fatalf("%+v: unexpected containers %+v", tc.output, podSpec.Containers)
+		}
+		c := podSpec.Containers[0]
+		if !reflect.DeepEqual(c.Args, tc.expectedArgs) {
+			t.Fatalf("%+v: expected %v, got %v", tc.output, tc.expectedArgs, c.Args)
+		}
+		if len(c.Env) != tc.expectedEnv {
+			t.Fatalf("%+v: unexpected env %+v", tc.output, c.Env)
+		}
+	}
+
+	// NOP for OutputKindNone
+	podSpec := corev1.PodSpec{Containers: []corev1.Container{{Name: "build"}}}
+	ij := Injector{Helper: Helper{Image: "cbipluginhelper", HomeDir: "/root"}, TargetPodSpec: &podSpec}
+	if err := ij.InjectOutput(crd.Output{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(podSpec.InitContainers) != 0 || len(podSpec.Containers) != 1 || len(podSpec.Volumes) != 0 {
+		t.Fatalf("unexpected pod spec %+v", podSpec)
+	}
+}
@@ -0,0 +1,61 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cbipluginhelper
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+
+	crd "github.com/containerbuilding/cbi/pkg/apis/cbi/v1alpha1"
+)
+
+// DefaultBuildContainerName is the name of the target container in NewBuildJobPodSpec.
+// Plugins may rename the container.
+const DefaultBuildContainerName = "cbi-build"
+
+// NewBuildJobPodSpec returns the base pod spec for bj, along with the index of the target container.
+// The pod is never restarted, and the service account token is not mounted, as the build does not
+// need to access the Kubernetes API.
+// The registry secrets are mounted on $HOME/.docker of the target container
+// (see Helper.InjectRegistrySecrets).
+//
+// Plugins need to set the image and the command of the target container, and then
+// use ContextInjector with the pod spec.
+func NewBuildJobPodSpec(bj *crd.BuildJob, helper Helper) (*corev1.PodSpec, int, error) {
+	if bj == nil {
+		return nil, -1, fmt.Errorf("nil BuildJob")
+	}
+	if err := helper.validateHomeDir(); err != nil {
+		return nil, -1, err
+	}
+	automountServiceAccountToken := false
+	podSpec := &corev1.PodSpec{
+		RestartPolicy:                corev1.RestartPolicyNever,
+		AutomountServiceAccountToken: &automountServiceAccountToken,
+		Containers: []corev1.Container{
+			{
+				Name: DefaultBuildContainerName,
+			},
+		},
+	}
+	idx := 0
+	if err := helper.InjectRegistrySecrets(podSpec, idx, bj.Spec.Registry); err != nil {
+		return nil, -1, err
+	}
+	return podSpec, idx, nil
+}
@@ -0,0 +1,175 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cbipluginhelper
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+
+	crd "github.com/containerbuilding/cbi/pkg/apis/cbi/v1alpha1"
+)
+
+func TestNewBuildJobPodSpec(t *testing.T) {
+	helper := Helper{Image: "cbipluginhelper", HomeDir: "/root"}
+	testCases := []struct {
+		registry      crd.Registry
+		expectedMount bool
+	}{
+		{
+			registry: crd.Registry{Target: "example.com/foo"},
+		},
+		{
+			registry: crd.Registry{Target: "example.com/foo", SecretRef: corev1.LocalObjectReference{Name: "secret"}},
+		},
+		{
+			registry:      crd.Registry{Target: "example.com/foo", Push: true, SecretRef: corev1.LocalObjectReference{Name: "secret"}},
+			expectedMount: true,
+		},
+	}
+	for _, tc := range testCases {
+		bj := &crd.BuildJob{Spec: crd.BuildJobSpec{Registry: tc.registry}}
+		podSpec, idx, err := NewBuildJobPodSpec(bj, helper)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if idx != 0 || len(podSpec.Containers) != 1 || podSpec.Containers[idx].Name != DefaultBuildContainerName {
+			t.Fatalf("%+v: unexpected containers %+v", tc.registry, podSpec.Containers)
+		}
+		if podSpec.RestartPolicy != corev1.RestartPolicyNever {
+			t.Fatalf("%+v: unexpected restart policy %q", tc.registry, podSpec.RestartPolicy)
+		}
+		if a := podSpec.AutomountServiceAccountToken; a == nil || *a {
+			t.Fatalf("%+v: service account token should not be mounted", tc.registry)
+		}
+		mounts := podSpec.Containers[idx].VolumeMounts
+		if tc.expectedMount {
+			if len(mounts) != 1 || mounts[0].MountPath != "/root/.docker" {
+				t.Fatalf("%+v: unexpected volume mounts %+v", tc.registry, mounts)
+			}
+		} else if len(mounts) != 0 || len(podSpec.Volumes) != 0 {
+			t.Fatalf("%+v: unexpected volume mounts %+v", tc.registry, mounts)
+		}
+	}
+	if _, _, err := NewBuildJobPodSpec(&crd.BuildJob{}, Helper{Image: "cbipluginhelper"}); err == nil {
+		t.Fatal("error is expected for empty HomeDir")
+	}
+	if _, _, err := NewBuildJobPodSpec(nil, helper); err == nil {
+		t.Fatal("error is expected for nil BuildJob")
+	}
+}
+
+func TestNewBuildJobPodSpecPullSecret(t *testing.T) {
+	helper := Helper{Image: "cbipluginhelper", HomeDir: "/root"}
+	pull := corev1.LocalObjectReference{Name: "pull"}
+	push := corev1.LocalObjectReference{Name: "push"}
+	testCases := []struct {
+		registry       crd.Registry
+		expectedSecret string
+		expectedMerge  bool
+	}{
+		{
+			registry:       crd.Registry{Target: "example.com/foo", PullSecretRef: pull, SecretRef: push},
+			expectedSecret: "pull",
+		},
+		{
+			registry:       crd.Registry{Target: "example.com/foo", Push: true, PullSecretRef: push, SecretRef: push},
+			expectedSecret: "push",
+		},
+		{
+			registry:      crd.Registry{Target: "example.com/foo", Push: true, PullSecretRef: pull, SecretRef: push},
+			expectedMerge: true,
+		},
+	}
+	for _, tc := range testCases {
+		bj := &crd.BuildJob{Spec: crd.BuildJobSpec{Registry: tc.registry}}
+		podSpec, idx, err := NewBuildJobPodSpec(bj, helper)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mounts := podSpec.Containers[idx].VolumeMounts
+		if len(mounts) != 1 || mounts[0].MountPath != "/root/.docker" {
+			t.Fatalf("%+v: unexpected volume mounts %+v", tc.registry, mounts)
+		}
+		var secrets []string
+		for _, v := range podSpec.Volumes {
+			if v.Secret != nil {
+				secrets = append(secrets, v.Secret.SecretName)
+			}
+		}
+		if !tc.expectedMerge {
+			if len(podSpec.InitContainers) != 0 || len(secrets) != 1 || secrets[0] != tc.expectedSecret {
+				t.Fatalf("%+v: expected secret %q, got %v", tc.registry, tc.expectedSecret, secrets)
+			}
+			continue
+		}
+		if len(podSpec.InitContainers) != 1 || len(secrets) != 2 {
+			t.Fatalf("%+v: unexpected pod spec %+v", tc.registry, podSpec)
+		}
+		expectedArgs := []string{"merge-docker-config", "/root/.docker/config.json",
+			"/cbi-registrysecrets/pull/config.json", "/cbi-registrysecrets/push/config.json"}
+		if args := podSpec.InitContainers[0].Args; !reflect.DeepEqual(args, expectedArgs) {
+			t.Fatalf("%+v: expected %v, got %v", tc.registry, expectedArgs, args)
+		}
+	}
+}
+
+func TestNewBuildJobPodSpecCredentialHelper(t *testing.T) {
+	helper := Helper{Image: "cbipluginhelper", HomeDir: "/root"}
+	testCases := []struct {
+		registry        crd.Registry
+		expectedSecrets int
+		expectedArgs    []string
+	}{
+		{
+			registry: crd.Registry{Target: "123456789012.dkr.ecr.us-east-1.amazonaws.com/foo", Push: true, CredentialHelper: "ecr-login"},
+			expectedArgs: []string{"merge-docker-config",
+				"--cred-helper", "123456789012.dkr.ecr.us-east-1.amazonaws.com=ecr-login", "/root/.docker/config.json"},
+		},
+		{
+			registry: crd.Registry{Target: "123456789012.dkr.ecr.us-east-1.amazonaws.com/foo", Push: true, CredentialHelper: "ecr-login",
+				SecretRef: corev1.LocalObjectReference{Name: "push"}, PullSecretRef: corev1.LocalObjectReference{Name: "push"}},
+			expectedSecrets: 1,
+			expectedArgs: []string{"merge-docker-config",
+				"--cred-helper", "123456789012.dkr.ecr.us-east-1.amazonaws.com=ecr-login", "/root/.docker/config.json",
+				"/cbi-registrysecrets/push/config.json"},
+		},
+	}
+	for _, tc := range testCases {
+		bj := &crd.BuildJob{Spec: crd.BuildJobSpec{Registry: tc.registry}}
+		podSpec, idx, err := NewBuildJobPodSpec(bj, helper)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if mounts := podSpec.Containers[idx].VolumeMounts; len(mounts) != 1 || mounts[0].MountPath != "/root/.docker" {
+			t.Fatalf("%+v: unexpected volume mounts %+v", tc.registry, mounts)
+		}
+		secrets := 0
+		for _, v := range podSpec.Volumes {
+			if v.Secret != nil {
+				secrets++
+			}
+		}
+		if len(podSpec.InitContainers) != 1 || secrets != tc.expectedSecrets {
+			t.Fatalf("%+v: unexpected pod spec %+v", tc.registry, podSpec)
+		}
+		if args := podSpec.InitContainers[0].Args; !reflect.DeepEqual(args, tc.expectedArgs) {
+			t.Fatalf("%+v: expected %v, got %v", tc.registry, tc.expectedArgs, args)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cbipluginhelper
+
+import (
+	"sort"
+
+	"github.com/cyphar/filepath-securejoin"
+	corev1 "k8s.io/api/core/v1"
+
+	crd "github.com/containerbuilding/cbi/pkg/apis/cbi/v1alpha1"
+	"github.com/containerbuilding/cbi/pkg/plugin/base/registryutil"
+)
+
+// InjectRegistrySecrets injects the registry credentials to $HOME/.docker/config.json of the target container:
+// Registry.SecretRef when pushing the image or the cache, and Registry.PullSecretRef.
+// When both are used, an init container merges them, and SecretRef takes precedence for the same registry.
+// Registry.CredentialHelper is also written to the config.json by the init container, as "credHelpers".
+func (h *Helper) InjectRegistrySecrets(podSpec *corev1.PodSpec, containerIdx int, registry crd.Registry) error {
+	var push, pull corev1.LocalObjectReference
+	if registry.Push || registry.CacheRef != "" {
+		push = registry.SecretRef
+	}
+	pull = registry.PullSecretRef
+	credHelpers := registryutil.CredentialHelpers(registry)
+	if len(credHelpers) == 0 {
+		switch {
+		case push.Name == "" && pull.Name == "":
+			return nil
+		case pull.Name == "" || pull.Name == push.Name:
+			return registryutil.InjectRegistrySecret(podSpec, containerIdx, h.HomeDir, push)
+		case push.Name == "":
+			return registryutil.InjectRegistrySecret(podSpec, containerIdx, h.HomeDir, pull)
+		}
+	}
+	if pull.Name == push.Name {
+		pull = corev1.LocalObjectReference{}
+	}
+	volMountPath, err := securejoin.SecureJoin(h.HomeDir, ".docker")
+	if err != nil {
+		return err
+	}
+	var (
+		// vol is an emptyDir volume for the merged config.json
+		volName           = "cbi-registrysecret"
+		secretsMountPath  = "/cbi-registrysecrets"
+		initContainerName = "cbi-registrysecret-init"
+	)
+	initContainer := corev1.Container{
+		Name:  initContainerName,
+		Image: h.Image,
+		VolumeMounts: []corev1.VolumeMount{
+			{
+				Name:      volName,
+				MountPath: volMountPath,
+			},
+		},
+	}
+	podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+		Name: volName,
+		VolumeSource: corev1.VolumeSource{
+			EmptyDir: &corev1.EmptyDirVolumeSource{},
+		},
+	})
+	args := []string{"merge-docker-config"}
+	var hosts []string
+	for host := range credHelpers {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	for _, host := range hosts {
+		args = append(args, "--cred-helper", host+"="+credHelpers[host])
+	}
+	args = append(args, volMountPath+"/config.json")
+	// the later one takes precedence
+	for _, s := range []struct {
+		name      string
+		secretRef corev1.LocalObjectReference
+	}{
+		{"pull", pull},
+		{"push", push},
+	} {
+		if s.secretRef.Name == "" {
+			continue
+		}
+		secretVolName := "cbi-registrysecret-" + s.name
+		podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+			Name: secretVolName,
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{
+					SecretName: s.secretRef.Name,
+					Items: []corev1.KeyToPath{
+						{
+							Key:  ".dockerconfigjson",
+							Path: "config.json",
+						},
+					},
+				},
+			},
+		})
+		secretVolMountPath := secretsMountPath + "/" + s.name
+		initContainer.VolumeMounts = append(initContainer.VolumeMounts, corev1.VolumeMount{
+			Name:      secretVolName,
+			MountPath: secretVolMountPath,
+			ReadOnly:  true,
+		})
+		args = append(args, secretVolMountPath+"/config.json")
+	}
+	initContainer.Args = args
+	h.configureInitContainer(&initContainer)
+	podSpec.InitContainers = append(podSpec.InitContainers, initContainer)
+	podSpec.Containers[containerIdx].VolumeMounts = append(podSpec.Containers[containerIdx].VolumeMounts,
+		corev1.VolumeMount{
+			Name:      volName,
+			MountPath: volMountPath,
+			ReadOnly:  true,
+		},
+	)
+	return nil
+}
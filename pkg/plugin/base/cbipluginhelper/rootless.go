@@ -0,0 +1,96 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cbipluginhelper
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// RootlessUID is the user ID of the build container configured by InjectRootless.
+const RootlessUID = 1000
+
+const (
+	seccompContainerAnnotationKeyPrefix  = corev1.SeccompContainerAnnotationKeyPrefix
+	apparmorContainerAnnotationKeyPrefix = "container.apparmor.security.beta.kubernetes.io/"
+	unconfinedProfile                    = "unconfined"
+	devFuseVolName                       = "cbi-devfuse"
+	devFusePath                          = "/dev/fuse"
+)
+
+// RootlessOptions are the options for InjectRootless.
+type RootlessOptions struct {
+	// DevFuse mounts /dev/fuse of the node on the target container, for the builders that use FUSE,
+	// e.g. fuse-overlayfs. The node needs to have the fuse module loaded.
+	DevFuse bool
+}
+
+// RootlessSecurityContext returns the security context for rootless builders that create user namespaces
+// without privileges, e.g. img.
+// Privilege escalation is allowed, as newuidmap and newgidmap are setuid binaries.
+// Note that the secrets mounted with mode 0400 are not readable under this security context.
+func RootlessSecurityContext() *corev1.SecurityContext {
+	privileged := false
+	runAsNonRoot := true
+	runAsUser := int64(RootlessUID)
+	allowPrivilegeEscalation := true
+	return &corev1.SecurityContext{
+		Privileged:               &privileged,
+		RunAsNonRoot:             &runAsNonRoot,
+		RunAsUser:                &runAsUser,
+		AllowPrivilegeEscalation: &allowPrivilegeEscalation,
+	}
+}
+
+// InjectRootless configures the target container of pts for rootless builders:
+// the container runs with RootlessSecurityContext, and the seccomp and AppArmor profiles are
+// unconfined via the annotations, as the default profiles block unshare(2) and mounting /proc
+// in the user namespace.
+//
+// The container runtimes mask some paths of /proc, and the kernel refuses to mount /proc in the user
+// namespace while the paths are masked. The build steps that need /proc (e.g. `RUN`) require
+// `procMount: Unmasked` (Kubernetes 1.12 and later), which is not set by InjectRootless yet.
+func InjectRootless(pts *corev1.PodTemplateSpec, containerIdx int, opts RootlessOptions) error {
+	if containerIdx < 0 || containerIdx >= len(pts.Spec.Containers) {
+		return fmt.Errorf("invalid container index %d", containerIdx)
+	}
+	c := &pts.Spec.Containers[containerIdx]
+	c.SecurityContext = RootlessSecurityContext()
+	if pts.Annotations == nil {
+		pts.Annotations = make(map[string]string)
+	}
+	pts.Annotations[seccompContainerAnnotationKeyPrefix+c.Name] = unconfinedProfile
+	pts.Annotations[apparmorContainerAnnotationKeyPrefix+c.Name] = unconfinedProfile
+	if opts.DevFuse {
+		charDevice := corev1.HostPathCharDev
+		pts.Spec.Volumes = append(pts.Spec.Volumes, corev1.Volume{
+			Name: devFuseVolName,
+			VolumeSource: corev1.VolumeSource{
+				HostPath: &corev1.HostPathVolumeSource{
+					Path: devFusePath,
+					Type: &charDevice,
+				},
+			},
+		})
+		c.VolumeMounts = append(c.VolumeMounts, corev1.VolumeMount{
+			Name:      devFuseVolName,
+			MountPath: devFusePath,
+		})
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cbipluginhelper
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestInjectRootless(t *testing.T) {
+	for _, devFuse := range []bool{false, true} {
+		privileged := true
+		pts := &corev1.PodTemplateSpec{
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{
+					{
+						Name:            "img-job",
+						SecurityContext: &corev1.SecurityContext{Privileged: &privileged},
+					},
+				},
+			},
+		}
+		if err := InjectRootless(pts, 0, RootlessOptions{DevFuse: devFuse}); err != nil {
+			t.Fatal(err)
+		}
+		sc := pts.Spec.Containers[0].SecurityContext
+		if sc == nil || sc.Privileged == nil || *sc.Privileged {
+			t.Fatalf("devFuse=%v: the container should not be privileged: %+v", devFuse, sc)
+		}
+		if sc.RunAsUser == nil || *sc.RunAsUser != RootlessUID || sc.RunAsNonRoot == nil || !*sc.RunAsNonRoot {
+			t.Fatalf("devFuse=%v: the container should run as %d: %+v", devFuse, RootlessUID, sc)
+		}
+		// newuidmap and newgidmap are setuid binaries
+		if sc.AllowPrivilegeEscalation == nil || !*sc.AllowPrivilegeEscalation {
+			t.Fatalf("devFuse=%v: privilege escalation should be allowed: %+v", devFuse, sc)
+		}
+		for _, k := range []string{
+			"container.seccomp.security.alpha.kubernetes.io/img-job",
+			"container.apparmor.security.beta.kubernetes.io/img-job",
+		} {
+			if v := pts.Annotations[k]; v != "unconfined" {
+				t.Fatalf("devFuse=%v: expected %s to be unconfined, got %q", devFuse, k, v)
+			}
+		}
+		mounts := pts.Spec.Containers[0].VolumeMounts
+		if !devFuse {
+			if len(pts.Spec.Volumes) != 0 || len(mounts) != 0 {
+				t.Fatalf("unexpected volumes: %+v", pts.Spec.Volumes)
+			}
+			continue
+		}
+		vols := pts.Spec.Volumes
+		if len(vols) != 1 || vols[0].HostPath == nil || vols[0].HostPath.Path != "/dev/fuse" ||
+			vols[0].HostPath.Type == nil || *vols[0].HostPath.Type != corev1.HostPathCharDev {
+			t.Fatalf("unexpected volumes: %+v", vols)
+		}
+		if len(mounts) != 1 || mounts[0].MountPath != "/dev/fuse" {
+			t.Fatalf("unexpected volume mounts: %+v", mounts)
+		}
+	}
+	if err := InjectRootless(&corev1.PodTemplateSpec{}, 0, RootlessOptions{}); err == nil {
+		t.Fatal("error is expected for the missing container")
+	}
+}
@@ -22,6 +22,7 @@ import (
 
 	"github.com/containerbuilding/cbi/pkg/plugin"
 	"github.com/containerbuilding/cbi/pkg/plugin/base"
+	"github.com/containerbuilding/cbi/pkg/plugin/base/cbipluginhelper"
 	"github.com/containerbuilding/cbi/pkg/plugin/base/service"
 )
 
@@ -29,18 +30,25 @@ type Opts struct {
 	FlagSet *flag.FlagSet
 	Args    []string
 	// CreateBackend is called after calling o.FlagSet.Parse(o.Args).
-	CreateBackend func() (base.Backend, error)
+	// helper is configured with the "--helper-*" flags registered by Main.
+	CreateBackend func(helper cbipluginhelper.Helper) (base.Backend, error)
 }
 
 func Main(o Opts) error {
 	var (
-		port int
+		port        int
+		helperFlags helperFlags
 	)
 	o.FlagSet.IntVar(&port, "cbi-plugin-port", plugin.DefaultPort, "Port for listening CBI Plugin gRPC API")
+	helperFlags.register(o.FlagSet)
 	if err := o.FlagSet.Parse(o.Args); err != nil {
 		return err
 	}
-	b, err := o.CreateBackend()
+	helper, err := helperFlags.helper()
+	if err != nil {
+		return err
+	}
+	b, err := o.CreateBackend(helper)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,120 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/containerbuilding/cbi/pkg/plugin/base/cbipluginhelper"
+)
+
+// helperFlags are the flags for cbipluginhelper, shared across the plugins.
+type helperFlags struct {
+	image           string
+	imagePullPolicy string
+	restricted      bool
+	allowLocal      bool
+	maxContextSize  string
+	logFormat       string
+	cpuRequest      string
+	cpuLimit        string
+	memoryRequest   string
+	memoryLimit     string
+}
+
+func (f *helperFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.image, "helper-image", "", "cbipluginhelper image")
+	fs.StringVar(&f.imagePullPolicy, "helper-image-pull-policy", "", "image pull policy for cbipluginhelper image (Always, IfNotPresent, or Never)")
+	fs.BoolVar(&f.restricted, "helper-restricted-security-context", false, "run cbipluginhelper containers as non-root without capabilities")
+	fs.BoolVar(&f.allowLocal, "helper-allow-local-context", false, "enable Local context using hostPath volumes (only for local development)")
+	fs.StringVar(&f.maxContextSize, "helper-max-context-size", "", "maximum size of the contexts populated by cbipluginhelper (e.g. 1Gi)")
+	fs.StringVar(&f.cpuRequest, "helper-cpu-request", "", "CPU request of cbipluginhelper containers (e.g. 100m)")
+	fs.StringVar(&f.cpuLimit, "helper-cpu-limit", "", "CPU limit of cbipluginhelper containers (e.g. 1)")
+	fs.StringVar(&f.memoryRequest, "helper-memory-request", "", "memory request of cbipluginhelper containers (e.g. 64Mi)")
+	fs.StringVar(&f.memoryLimit, "helper-memory-limit", "", "memory limit of cbipluginhelper containers (e.g. 512Mi)")
+	fs.StringVar(&f.logFormat, "helper-log-format", "", "log format of cbipluginhelper (text or json). The controller parses the progress from the json format")
+}
+
+// helper returns cbipluginhelper.Helper for the parsed flags.
+func (f *helperFlags) helper() (cbipluginhelper.Helper, error) {
+	h := cbipluginhelper.Helper{
+		Image:             f.image,
+		HomeDir:           "/root",
+		ImagePullPolicy:   corev1.PullPolicy(f.imagePullPolicy),
+		Env:               cbipluginhelper.ProxyEnv(),
+		LogFormat:         f.logFormat,
+		AllowLocalContext: f.allowLocal,
+	}
+	if f.image == "" {
+		return h, errors.New("no helper-image provided")
+	}
+	switch f.logFormat {
+	case "", "text", "json":
+	default:
+		return h, fmt.Errorf("invalid helper-log-format: %q", f.logFormat)
+	}
+	if f.maxContextSize != "" {
+		q, err := resource.ParseQuantity(f.maxContextSize)
+		if err != nil {
+			return h, fmt.Errorf("invalid helper-max-context-size: %v", err)
+		}
+		h.MaxContextSize = q
+	}
+	var err error
+	if h.Resources.Requests, err = resourceList("helper-cpu-request", f.cpuRequest, "helper-memory-request", f.memoryRequest); err != nil {
+		return h, err
+	}
+	if h.Resources.Limits, err = resourceList("helper-cpu-limit", f.cpuLimit, "helper-memory-limit", f.memoryLimit); err != nil {
+		return h, err
+	}
+	if f.restricted {
+		h.SecurityContext = cbipluginhelper.RestrictedSecurityContext()
+	}
+	return h, nil
+}
+
+// resourceList parses the CPU and memory quantities of the flags.
+// Nil is returned when both are empty.
+func resourceList(cpuFlag, cpu, memoryFlag, memory string) (corev1.ResourceList, error) {
+	var l corev1.ResourceList
+	for _, x := range []struct {
+		name  corev1.ResourceName
+		flag  string
+		value string
+	}{
+		{corev1.ResourceCPU, cpuFlag, cpu},
+		{corev1.ResourceMemory, memoryFlag, memory},
+	} {
+		if x.value == "" {
+			continue
+		}
+		q, err := resource.ParseQuantity(x.value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %v", x.flag, err)
+		}
+		if l == nil {
+			l = make(corev1.ResourceList)
+		}
+		l[x.name] = q
+	}
+	return l, nil
+}
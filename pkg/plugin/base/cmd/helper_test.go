@@ -0,0 +1,114 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"flag"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func parseHelperFlags(args ...string) (*helperFlags, error) {
+	var f helperFlags
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	f.register(fs)
+	return &f, fs.Parse(args)
+}
+
+func TestHelperFlags(t *testing.T) {
+	f, err := parseHelperFlags("--helper-image", "foo", "--helper-image-pull-policy", "Always",
+		"--helper-restricted-security-context", "--helper-allow-local-context", "--helper-max-context-size", "1Gi", "--helper-log-format", "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := f.helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Image != "foo" || h.HomeDir != "/root" || h.ImagePullPolicy != corev1.PullAlways || !h.AllowLocalContext {
+		t.Fatalf("unexpected helper %+v", h)
+	}
+	if h.LogFormat != "json" {
+		t.Fatalf("unexpected log format %q", h.LogFormat)
+	}
+	if h.SecurityContext == nil {
+		t.Fatal("expected the restricted security context")
+	}
+	if h.MaxContextSize.Value() != 1<<30 {
+		t.Fatalf("unexpected max context size %v", h.MaxContextSize)
+	}
+	if len(h.Resources.Requests) != 0 || len(h.Resources.Limits) != 0 {
+		t.Fatalf("unexpected resources %+v", h.Resources)
+	}
+
+	invalid := [][]string{
+		{},
+		{"--helper-image", "foo", "--helper-max-context-size", "foo"},
+		{"--helper-image", "foo", "--helper-log-format", "xml"},
+		{"--helper-image", "foo", "--helper-cpu-limit", "foo"},
+		{"--helper-image", "foo", "--helper-memory-request", "64Mx"},
+	}
+	for _, args := range invalid {
+		f, err := parseHelperFlags(args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.helper(); err == nil {
+			t.Fatalf("%v: error is expected", args)
+		}
+	}
+}
+
+func TestHelperFlagsResources(t *testing.T) {
+	f, err := parseHelperFlags("--helper-image", "foo", "--helper-cpu-request", "100m", "--helper-cpu-limit", "1",
+		"--helper-memory-request", "64Mi", "--helper-memory-limit", "512Mi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := f.helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"requests.cpu":    "100m",
+		"requests.memory": "64Mi",
+		"limits.cpu":      "1",
+		"limits.memory":   "512Mi",
+	}
+	actual := map[string]string{
+		"requests.cpu":    h.Resources.Requests.Cpu().String(),
+		"requests.memory": h.Resources.Requests.Memory().String(),
+		"limits.cpu":      h.Resources.Limits.Cpu().String(),
+		"limits.memory":   h.Resources.Limits.Memory().String(),
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("expected %v, got %v", expected, actual)
+	}
+
+	f, err = parseHelperFlags("--helper-image", "foo", "--helper-memory-limit", "512Mi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h, err = f.helper(); err != nil {
+		t.Fatal(err)
+	}
+	if h.Resources.Requests != nil || len(h.Resources.Limits) != 1 {
+		t.Fatalf("unexpected resources %+v", h.Resources)
+	}
+}
@@ -0,0 +1,85 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dockerfileutil
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/cyphar/filepath-securejoin"
+	corev1 "k8s.io/api/core/v1"
+
+	crd "github.com/containerbuilding/cbi/pkg/apis/cbi/v1alpha1"
+	"github.com/containerbuilding/cbi/pkg/plugin/base/envutil"
+)
+
+// DefaultPath is the default Dockerfile path relative to the context.
+const DefaultPath = "Dockerfile"
+
+// Path returns the path of the Dockerfile within ctxPath.
+// An error is returned when spec.Path points outside of the context.
+func Path(ctxPath string, spec crd.Dockerfile) (string, error) {
+	p := spec.Path
+	if p == "" {
+		p = DefaultPath
+	}
+	cleaned := filepath.Clean(p)
+	if filepath.IsAbs(cleaned) || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", fmt.Errorf("Spec.Language.Dockerfile.Path needs to be within the context: %q", spec.Path)
+	}
+	return securejoin.SecureJoin(ctxPath, cleaned)
+}
+
+// DockerBuildFlags returns `docker build`-compatible flags such as `-f` and `--target`.
+// The context path itself is not included.
+func DockerBuildFlags(ctxPath string, spec crd.Dockerfile) ([]string, error) {
+	p, err := Path(ctxPath, spec)
+	if err != nil {
+		return nil, err
+	}
+	flags := []string{"-f", p}
+	if spec.Target != "" {
+		flags = append(flags, "--target", spec.Target)
+	}
+	return flags, nil
+}
+
+// BuildArgEnvPrefix is the prefix of the environment variables that hold the values of BuildArgsFrom.
+const BuildArgEnvPrefix = "CBI_BUILD_ARG_"
+
+// BuildArgs returns "KEY=VALUE" strings sorted by key, so that the generated pod specs are stable.
+// BuildArgsFrom values are referenced as "KEY=$(CBI_BUILD_ARG_KEY)", which is expanded by Kubernetes
+// from the returned environment variables.
+func BuildArgs(spec crd.Dockerfile) ([]string, []corev1.EnvVar, error) {
+	vars := make([]corev1.EnvVar, 0, len(spec.BuildArgs)+len(spec.BuildArgsFrom))
+	for k, v := range spec.BuildArgs {
+		vars = append(vars, corev1.EnvVar{Name: k, Value: v})
+	}
+	for _, f := range spec.BuildArgsFrom {
+		valueFrom := f.ValueFrom
+		vars = append(vars, corev1.EnvVar{Name: f.Name, ValueFrom: &valueFrom})
+	}
+	sort.Slice(vars, func(i, j int) bool { return vars[i].Name < vars[j].Name })
+	for i := 1; i < len(vars); i++ {
+		if vars[i-1].Name == vars[i].Name {
+			return nil, nil, fmt.Errorf("duplicated build arg: %q", vars[i].Name)
+		}
+	}
+	return envutil.KeyValueArgs(BuildArgEnvPrefix, vars)
+}
@@ -0,0 +1,132 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dockerfileutil
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+
+	crd "github.com/containerbuilding/cbi/pkg/apis/cbi/v1alpha1"
+)
+
+func TestPath(t *testing.T) {
+	cases := []struct {
+		path     string
+		expected string
+		invalid  bool
+	}{
+		{
+			path:     "",
+			expected: "/ctx/Dockerfile",
+		},
+		{
+			path:     "build/Dockerfile.prod",
+			expected: "/ctx/build/Dockerfile.prod",
+		},
+		{
+			path:     "./foo/../Dockerfile.dev",
+			expected: "/ctx/Dockerfile.dev",
+		},
+		{
+			path:    "../Dockerfile",
+			invalid: true,
+		},
+		{
+			path:    "foo/../../Dockerfile",
+			invalid: true,
+		},
+		{
+			path:    "/etc/passwd",
+			invalid: true,
+		},
+	}
+	for _, c := range cases {
+		actual, err := Path("/ctx", crd.Dockerfile{Path: c.path})
+		if err != nil && !c.invalid {
+			t.Fatalf("%q: %v", c.path, err)
+		}
+		if err == nil {
+			if c.invalid {
+				t.Fatalf("%q: error is expected", c.path)
+			} else if c.expected != actual {
+				t.Fatalf("%q: expected %q, got %q", c.path, c.expected, actual)
+			}
+		}
+	}
+}
+
+func TestBuildArgs(t *testing.T) {
+	secretRef := corev1.EnvVarSource{
+		SecretKeyRef: &corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: "secret"},
+			Key:                  "token",
+		},
+	}
+	spec := crd.Dockerfile{
+		BuildArgs: map[string]string{
+			"VERSION":    "1.0",
+			"BASE_IMAGE": "alpine:3.7",
+			"MESSAGE":    "hello world",
+		},
+		BuildArgsFrom: []crd.BuildArgSource{
+			{Name: "TOKEN", ValueFrom: secretRef},
+			{Name: "A_TOKEN", ValueFrom: secretRef},
+		},
+	}
+	expectedArgs := []string{
+		"A_TOKEN=$(CBI_BUILD_ARG_A_TOKEN)",
+		"BASE_IMAGE=alpine:3.7",
+		"MESSAGE=hello world",
+		"TOKEN=$(CBI_BUILD_ARG_TOKEN)",
+		"VERSION=1.0",
+	}
+	// run several times, as map iteration order is randomized
+	for i := 0; i < 10; i++ {
+		args, env, err := BuildArgs(spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(expectedArgs, args) {
+			t.Fatalf("expected %v, got %v", expectedArgs, args)
+		}
+		if len(env) != 2 || env[0].Name != "CBI_BUILD_ARG_A_TOKEN" || env[1].Name != "CBI_BUILD_ARG_TOKEN" {
+			t.Fatalf("unexpected env: %+v", env)
+		}
+		if !reflect.DeepEqual(secretRef, *env[0].ValueFrom) {
+			t.Fatalf("unexpected valueFrom: %+v", env[0].ValueFrom)
+		}
+	}
+}
+
+func TestBuildArgsInvalid(t *testing.T) {
+	cases := []crd.Dockerfile{
+		{BuildArgs: map[string]string{"": "foo"}},
+		{BuildArgs: map[string]string{"FOO=BAR": "baz"}},
+		{BuildArgsFrom: []crd.BuildArgSource{{Name: "FOO-BAR"}}},
+		{
+			BuildArgs:     map[string]string{"FOO": "bar"},
+			BuildArgsFrom: []crd.BuildArgSource{{Name: "FOO"}},
+		},
+	}
+	for _, c := range cases {
+		if _, _, err := BuildArgs(c); err == nil {
+			t.Fatalf("%+v: error is expected", c)
+		}
+	}
+}
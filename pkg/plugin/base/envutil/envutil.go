@@ -0,0 +1,67 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package envutil provides utilities for passing environment-variable-like
+// "NAME=VALUE" pairs to builders via container args.
+package envutil
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+var envNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// KeyValueArgs converts vars into "NAME=VALUE" strings to be used in the args of a container.
+// Inline values are escaped so that Kubernetes does not expand "$(VAR)" in them.
+// Vars with ValueFrom are not inlined; they are exposed as the returned environment variables
+// named prefix+NAME, and referenced as "NAME=$(prefix+NAME)", which is expanded by Kubernetes.
+// The order of vars is preserved.
+func KeyValueArgs(prefix string, vars []corev1.EnvVar) ([]string, []corev1.EnvVar, error) {
+	args := make([]string, 0, len(vars))
+	var env []corev1.EnvVar
+	for _, v := range vars {
+		if v.ValueFrom == nil {
+			if v.Name == "" || strings.Contains(v.Name, "=") {
+				return nil, nil, fmt.Errorf("invalid name: %q", v.Name)
+			}
+			args = append(args, v.Name+"="+Escape(v.Value))
+			continue
+		}
+		if !envNameRegexp.MatchString(v.Name) {
+			return nil, nil, fmt.Errorf("invalid name: %q", v.Name)
+		}
+		if v.Value != "" {
+			return nil, nil, fmt.Errorf("%q: value and valueFrom are mutually exclusive", v.Name)
+		}
+		envName := prefix + v.Name
+		env = append(env, corev1.EnvVar{
+			Name:      envName,
+			ValueFrom: v.ValueFrom.DeepCopy(),
+		})
+		args = append(args, v.Name+"=$("+envName+")")
+	}
+	return args, env, nil
+}
+
+// Escape escapes s so that Kubernetes does not expand "$(VAR)" references in s
+// when s is used in the command or the args of a container.
+func Escape(s string) string {
+	return strings.Replace(s, "$", "$$", -1)
+}
@@ -0,0 +1,65 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package envutil
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestKeyValueArgs(t *testing.T) {
+	valueFrom := &corev1.EnvVarSource{
+		ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: "cm"},
+			Key:                  "foo",
+		},
+	}
+	vars := []corev1.EnvVar{
+		{Name: "FOO", Value: "foo bar"},
+		{Name: "BAR", ValueFrom: valueFrom},
+		{Name: "BAZ", Value: "$(FOO)"},
+	}
+	args, env, err := KeyValueArgs("PREFIX_", vars)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedArgs := []string{"FOO=foo bar", "BAR=$(PREFIX_BAR)", "BAZ=$$(FOO)"}
+	if !reflect.DeepEqual(expectedArgs, args) {
+		t.Fatalf("expected %v, got %v", expectedArgs, args)
+	}
+	expectedEnv := []corev1.EnvVar{{Name: "PREFIX_BAR", ValueFrom: valueFrom}}
+	if !reflect.DeepEqual(expectedEnv, env) {
+		t.Fatalf("expected %+v, got %+v", expectedEnv, env)
+	}
+}
+
+func TestKeyValueArgsInvalid(t *testing.T) {
+	valueFrom := &corev1.EnvVarSource{}
+	cases := []corev1.EnvVar{
+		{Name: ""},
+		{Name: "FOO=BAR"},
+		{Name: "FOO-BAR", ValueFrom: valueFrom},
+		{Name: "FOO", Value: "foo", ValueFrom: valueFrom},
+	}
+	for _, c := range cases {
+		if _, _, err := KeyValueArgs("", []corev1.EnvVar{c}); err == nil {
+			t.Fatalf("%+v: error is expected", c)
+		}
+	}
+}
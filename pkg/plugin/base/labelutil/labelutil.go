@@ -0,0 +1,130 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package labelutil provides utilities for image labels.
+package labelutil
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+
+	crd "github.com/containerbuilding/cbi/pkg/apis/cbi/v1alpha1"
+	"github.com/containerbuilding/cbi/pkg/plugin/base/envutil"
+)
+
+const (
+	// LabelRevision is the OCI image label for the source control revision.
+	LabelRevision = "org.opencontainers.image.revision"
+	// LabelSource is the OCI image label for the URL of the source.
+	LabelSource = "org.opencontainers.image.source"
+)
+
+var (
+	keyRegexp       = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9._/-]*[A-Za-z0-9])?$`)
+	commitSHARegexp = regexp.MustCompile(`^[0-9a-f]{40}$`)
+	// reservedKeyPrefixes are reserved by Docker.
+	reservedKeyPrefixes = []string{"com.docker.", "io.docker.", "org.dockerproject."}
+)
+
+// Validate validates the key and the value of a label.
+func Validate(k, v string) error {
+	if !keyRegexp.MatchString(k) {
+		return fmt.Errorf("invalid label key %q: needs to match %s", k, keyRegexp.String())
+	}
+	for _, p := range reservedKeyPrefixes {
+		if strings.HasPrefix(k, p) {
+			return fmt.Errorf("invalid label key %q: %q is reserved", k, p)
+		}
+	}
+	if strings.ContainsAny(v, "\x00\n\r") {
+		return fmt.Errorf("invalid value for label %q: must not contain NUL or newline characters", k)
+	}
+	return nil
+}
+
+// Labels returns spec.Labels with the automatic labels (e.g. LabelSource for Git context)
+// as a map. spec.Labels take precedence over the automatic labels.
+//
+// LabelRevision is set automatically only when Spec.Context.Git.Revision is a full commit SHA.
+// Plugins that can read the resolved revision at run time may set LabelRevision by themselves
+// when it is not present in the returned map.
+func Labels(spec crd.BuildJobSpec) (map[string]string, error) {
+	labels := make(map[string]string)
+	if strings.ToLower(string(spec.Context.Kind)) == strings.ToLower(string(crd.ContextKindGit)) {
+		labels[LabelSource] = redactURL(spec.Context.Git.URL)
+		if commitSHARegexp.MatchString(spec.Context.Git.Revision) {
+			labels[LabelRevision] = spec.Context.Git.Revision
+		}
+	}
+	for k, v := range spec.Labels {
+		if err := Validate(k, v); err != nil {
+			return nil, err
+		}
+		labels[k] = v
+	}
+	return labels, nil
+}
+
+// KeyValues returns "KEY=VALUE" strings sorted by key, so that the generated pod specs are stable.
+// VALUE is escaped so that it is not expanded by Kubernetes when used as a container argument.
+func KeyValues(labels map[string]string) []string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	kvs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		kvs = append(kvs, k+"="+envutil.Escape(labels[k]))
+	}
+	return kvs
+}
+
+// NeedsResolvedRevision returns true if LabelRevision needs to be read from
+// the resolved revision file (see cbipluginhelper.ContextInjector.ResolvedRevisionFile) at run time.
+func NeedsResolvedRevision(spec crd.BuildJobSpec, labels map[string]string) bool {
+	if strings.ToLower(string(spec.Context.Kind)) != strings.ToLower(string(crd.ContextKindGit)) {
+		return false
+	}
+	_, ok := labels[LabelRevision]
+	return !ok
+}
+
+// ValidateNoLabels returns an error if spec.Labels is set, for plugins that do not support labels.
+// The automatic labels are silently ignored.
+func ValidateNoLabels(spec crd.BuildJobSpec, pluginName string) error {
+	if len(spec.Labels) != 0 {
+		return fmt.Errorf("%s plugin does not support Spec.Labels", pluginName)
+	}
+	return nil
+}
+
+// redactURL removes the password from u, so that credentials are not leaked to the image.
+// SCP-like URLs such as "user@host:path" are returned as-is.
+func redactURL(u string) string {
+	parsed, err := url.Parse(u)
+	if err != nil || parsed.User == nil {
+		return u
+	}
+	if _, ok := parsed.User.Password(); !ok {
+		return u
+	}
+	parsed.User = url.User(parsed.User.Username())
+	return parsed.String()
+}
@@ -17,10 +17,94 @@ limitations under the License.
 package registryutil
 
 import (
+	"fmt"
+	"strconv"
+	"strings"
+
 	"github.com/cyphar/filepath-securejoin"
 	corev1 "k8s.io/api/core/v1"
+
+	crd "github.com/containerbuilding/cbi/pkg/apis/cbi/v1alpha1"
 )
 
+// Targets returns Target and AdditionalTargets.
+func Targets(registry crd.Registry) ([]string, error) {
+	targets := []string{registry.Target}
+	for _, t := range registry.AdditionalTargets {
+		if t == "" {
+			return nil, fmt.Errorf("Spec.Registry.AdditionalTargets must not contain an empty string")
+		}
+		targets = append(targets, t)
+	}
+	return targets, nil
+}
+
+// dockerHubConfigKey is the key of Docker Hub in the docker config.json.
+const dockerHubConfigKey = "https://index.docker.io/v1/"
+
+// RegistryHost returns the key of the registry of ref in the docker config.json,
+// e.g. "example.com:5000" for "example.com:5000/foo/bar:baz".
+// Docker Hub (e.g. "foo/bar") is "https://index.docker.io/v1/", as in the docker CLI.
+func RegistryHost(ref string) string {
+	i := strings.IndexRune(ref, '/')
+	if i < 0 {
+		return dockerHubConfigKey
+	}
+	host := ref[:i]
+	if !strings.ContainsAny(host, ".:") && host != "localhost" {
+		return dockerHubConfigKey
+	}
+	if host == "docker.io" || host == "index.docker.io" {
+		return dockerHubConfigKey
+	}
+	return host
+}
+
+// CredentialHelpers returns the "credHelpers" of the docker config.json for registry.CredentialHelper,
+// i.e. the map from the registries of the targets and CacheRef to the credential helper.
+// Nil is returned if registry.CredentialHelper is empty.
+func CredentialHelpers(registry crd.Registry) map[string]string {
+	if registry.CredentialHelper == "" {
+		return nil
+	}
+	m := make(map[string]string)
+	for _, ref := range append([]string{registry.Target, registry.CacheRef}, registry.AdditionalTargets...) {
+		if ref != "" {
+			m[RegistryHost(ref)] = registry.CredentialHelper
+		}
+	}
+	return m
+}
+
+// PushRetriesEnv returns the environment variables of docker-build-push.sh for registry.PushRetries.
+// Nil is returned if registry.PushRetries is zero.
+func PushRetriesEnv(registry crd.Registry) []corev1.EnvVar {
+	if registry.PushRetries <= 0 {
+		return nil
+	}
+	return []corev1.EnvVar{
+		{
+			Name:  "DBP_PUSH_RETRIES",
+			Value: strconv.Itoa(int(registry.PushRetries)),
+		},
+	}
+}
+
+// TargetTemplateEnv returns the environment variables of docker-build-push.sh for replacing
+// crd.RuntimeTargetVariables in registry.Target with the content of resolvedRevisionFile at run time.
+// Nil is returned if registry.Target does not contain the variables.
+func TargetTemplateEnv(registry crd.Registry, resolvedRevisionFile string) []corev1.EnvVar {
+	if !crd.IsTargetTemplate(registry.Target) {
+		return nil
+	}
+	return []corev1.EnvVar{
+		{
+			Name:  "DBP_TARGET_REVISION_FILE",
+			Value: resolvedRevisionFile,
+		},
+	}
+}
+
 // InjectRegistrySecret injects .dockerconfigjson secret to ~/.docker/config.json
 func InjectRegistrySecret(podSpec *corev1.PodSpec, containerIdx int, homeDir string, secretRef corev1.LocalObjectReference) error {
 	volMountPath, err := securejoin.SecureJoin(homeDir, ".docker")
@@ -52,3 +136,119 @@ func InjectRegistrySecret(podSpec *corev1.PodSpec, containerIdx int, homeDir str
 	)
 	return nil
 }
+
+// CASecretKey is the key of the CA certificate in Registry.CASecretRef.
+const CASecretKey = "ca.crt"
+
+const registryCASecretVolName = "cbi-registrycasecret"
+
+// InjectRegistryCASecret injects the CA certificate in the secret to dir/fileName.
+// The existing files in dir are kept, as the certificate is mounted using subPath.
+func InjectRegistryCASecret(podSpec *corev1.PodSpec, containerIdx int, dir, fileName string, secretRef corev1.LocalObjectReference) error {
+	mountPath, err := securejoin.SecureJoin(dir, fileName)
+	if err != nil {
+		return err
+	}
+	volName := registryCASecretVolName
+	vol := corev1.Volume{
+		Name: volName,
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{
+				SecretName: secretRef.Name,
+			},
+		},
+	}
+	podSpec.Volumes = append(podSpec.Volumes, vol)
+	podSpec.Containers[containerIdx].VolumeMounts = append(podSpec.Containers[containerIdx].VolumeMounts,
+		corev1.VolumeMount{
+			Name:      volName,
+			MountPath: mountPath,
+			SubPath:   CASecretKey,
+			ReadOnly:  true,
+		},
+	)
+	return nil
+}
+
+// CAMount specifies where the builder container reads the CA certificate of Registry.CASecretRef.
+type CAMount struct {
+	// Dir is the directory of the certificates, e.g. /kaniko/ssl/certs.
+	Dir string
+	// FileName is the file name of the certificate in Dir (or in the per-registry directory).
+	FileName string
+	// PerRegistry mounts the certificate on Dir/<registry>/FileName for each registry of
+	// Target and AdditionalTargets, as in /etc/docker/certs.d.
+	PerRegistry bool
+}
+
+// Predefined CAMount values.
+var (
+	// CAMountSystemCertDir is for Go-based builders that read the system certificate directory.
+	CAMountSystemCertDir = CAMount{Dir: "/etc/ssl/certs", FileName: "cbi-registry-ca.crt"}
+	// CAMountKaniko is for kaniko, which sets SSL_CERT_DIR to /kaniko/ssl/certs.
+	CAMountKaniko = CAMount{Dir: "/kaniko/ssl/certs", FileName: "cbi-registry-ca.crt"}
+	// CAMountContainersCertsD is for builders that use containers/image, e.g. Buildah.
+	// The certificate is used for pulling base images from the registries as well.
+	CAMountContainersCertsD = CAMount{Dir: "/etc/containers/certs.d", FileName: CASecretKey, PerRegistry: true}
+)
+
+// InjectRegistryCA injects the CA certificate of registry.CASecretRef as specified in m.
+// NOP if registry.CASecretRef is empty.
+func InjectRegistryCA(podSpec *corev1.PodSpec, containerIdx int, registry crd.Registry, m CAMount) error {
+	if registry.CASecretRef.Name == "" {
+		return nil
+	}
+	if !m.PerRegistry {
+		return InjectRegistryCASecret(podSpec, containerIdx, m.Dir, m.FileName, registry.CASecretRef)
+	}
+	targets, err := Targets(registry)
+	if err != nil {
+		return err
+	}
+	var hosts []string
+	seen := make(map[string]bool)
+	for _, t := range targets {
+		ref, err := crd.ParseReference(t)
+		if err != nil {
+			return err
+		}
+		if !seen[ref.Registry] {
+			seen[ref.Registry] = true
+			hosts = append(hosts, ref.Registry)
+		}
+	}
+	for i, host := range hosts {
+		dir, err := securejoin.SecureJoin(m.Dir, host)
+		if err != nil {
+			return err
+		}
+		if i == 0 {
+			if err := InjectRegistryCASecret(podSpec, containerIdx, dir, m.FileName, registry.CASecretRef); err != nil {
+				return err
+			}
+			continue
+		}
+		// reuse the volume
+		mountPath, err := securejoin.SecureJoin(dir, m.FileName)
+		if err != nil {
+			return err
+		}
+		podSpec.Containers[containerIdx].VolumeMounts = append(podSpec.Containers[containerIdx].VolumeMounts,
+			corev1.VolumeMount{
+				Name:      registryCASecretVolName,
+				MountPath: mountPath,
+				SubPath:   CASecretKey,
+				ReadOnly:  true,
+			},
+		)
+	}
+	return nil
+}
+
+// ValidateNoTLSConfig returns an error if registry contains Insecure or CASecretRef, which are unsupported by the plugin.
+func ValidateNoTLSConfig(registry crd.Registry, pluginName string) error {
+	if registry.Insecure || registry.CASecretRef.Name != "" {
+		return fmt.Errorf("%s plugin does not support Spec.Registry.Insecure and Spec.Registry.CASecretRef", pluginName)
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package registryutil
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+
+	crd "github.com/containerbuilding/cbi/pkg/apis/cbi/v1alpha1"
+)
+
+func TestTargets(t *testing.T) {
+	targets, err := Targets(crd.Registry{
+		Target:            "example.com/foo:latest",
+		AdditionalTargets: []string{"example.com/foo:v1", "example.org/foo:v1"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"example.com/foo:latest", "example.com/foo:v1", "example.org/foo:v1"}
+	if !reflect.DeepEqual(expected, targets) {
+		t.Fatalf("expected %v, got %v", expected, targets)
+	}
+	if _, err := Targets(crd.Registry{Target: "example.com/foo", AdditionalTargets: []string{""}}); err == nil {
+		t.Fatal("error is expected")
+	}
+}
+
+func TestInjectRegistryCASecret(t *testing.T) {
+	podSpec := corev1.PodSpec{
+		Containers: []corev1.Container{{Name: "job"}},
+	}
+	if err := InjectRegistryCASecret(&podSpec, 0, "/etc/ssl/certs", "cbi-registry-ca.crt", corev1.LocalObjectReference{Name: "ca"}); err != nil {
+		t.Fatal(err)
+	}
+	mounts := podSpec.Containers[0].VolumeMounts
+	if len(mounts) != 1 || mounts[0].MountPath != "/etc/ssl/certs/cbi-registry-ca.crt" || mounts[0].SubPath != CASecretKey {
+		t.Fatalf("unexpected volume mounts: %+v", mounts)
+	}
+	if len(podSpec.Volumes) != 1 || podSpec.Volumes[0].Secret.SecretName != "ca" {
+		t.Fatalf("unexpected volumes: %+v", podSpec.Volumes)
+	}
+}
+
+func TestInjectRegistryCA(t *testing.T) {
+	registry := crd.Registry{
+		Target:            "example.com:5000/foo:latest",
+		AdditionalTargets: []string{"example.com:5000/foo:v1", "example.org/foo:v1"},
+		CASecretRef:       corev1.LocalObjectReference{Name: "ca"},
+	}
+	testCases := []struct {
+		m              CAMount
+		expectedMounts []string
+	}{
+		{
+			m:              CAMountKaniko,
+			expectedMounts: []string{"/kaniko/ssl/certs/cbi-registry-ca.crt"},
+		},
+		{
+			m:              CAMountSystemCertDir,
+			expectedMounts: []string{"/etc/ssl/certs/cbi-registry-ca.crt"},
+		},
+		{
+			m: CAMountContainersCertsD,
+			expectedMounts: []string{
+				"/etc/containers/certs.d/example.com:5000/ca.crt",
+				"/etc/containers/certs.d/example.org/ca.crt",
+			},
+		},
+	}
+	for _, tc := range testCases {
+		podSpec := corev1.PodSpec{
+			Containers: []corev1.Container{{Name: "job"}},
+		}
+		if err := InjectRegistryCA(&podSpec, 0, registry, tc.m); err != nil {
+			t.Fatal(err)
+		}
+		var mounts []string
+		for _, m := range podSpec.Containers[0].VolumeMounts {
+			if m.Name != podSpec.Volumes[0].Name || m.SubPath != CASecretKey || !m.ReadOnly {
+				t.Fatalf("%+v: unexpected volume mount %+v", tc.m, m)
+			}
+			mounts = append(mounts, m.MountPath)
+		}
+		if !reflect.DeepEqual(tc.expectedMounts, mounts) {
+			t.Fatalf("%+v: expected %v, got %v", tc.m, tc.expectedMounts, mounts)
+		}
+		if len(podSpec.Volumes) != 1 || podSpec.Volumes[0].Secret.SecretName != "ca" {
+			t.Fatalf("%+v: unexpected volumes: %+v", tc.m, podSpec.Volumes)
+		}
+	}
+
+	// NOP without CASecretRef
+	podSpec := corev1.PodSpec{
+		Containers: []corev1.Container{{Name: "job"}},
+	}
+	if err := InjectRegistryCA(&podSpec, 0, crd.Registry{Target: "example.com/foo"}, CAMountContainersCertsD); err != nil {
+		t.Fatal(err)
+	}
+	if len(podSpec.Volumes) != 0 || len(podSpec.Containers[0].VolumeMounts) != 0 {
+		t.Fatalf("unexpected pod spec: %+v", podSpec)
+	}
+}
+
+func TestRegistryHost(t *testing.T) {
+	testCases := map[string]string{
+		"foo":                              "https://index.docker.io/v1/",
+		"foo/bar:baz":                      "https://index.docker.io/v1/",
+		"docker.io/foo/bar":                "https://index.docker.io/v1/",
+		"localhost/foo":                    "localhost",
+		"example.com:5000/foo/bar:baz":     "example.com:5000",
+		"gcr.io/foo/bar@sha256:deadbeef00": "gcr.io",
+	}
+	for ref, expected := range testCases {
+		if actual := RegistryHost(ref); actual != expected {
+			t.Fatalf("%q: expected %q, got %q", ref, expected, actual)
+		}
+	}
+}
+
+func TestCredentialHelpers(t *testing.T) {
+	if m := CredentialHelpers(crd.Registry{Target: "example.com/foo"}); m != nil {
+		t.Fatalf("expected nil, got %v", m)
+	}
+	m := CredentialHelpers(crd.Registry{
+		Target:            "123456789012.dkr.ecr.us-east-1.amazonaws.com/foo",
+		AdditionalTargets: []string{"123456789012.dkr.ecr.us-east-1.amazonaws.com/foo:v1", "123456789012.dkr.ecr.eu-west-1.amazonaws.com/foo"},
+		CacheRef:          "123456789012.dkr.ecr.us-east-1.amazonaws.com/foo:buildcache",
+		CredentialHelper:  "ecr-login",
+	})
+	expected := map[string]string{
+		"123456789012.dkr.ecr.us-east-1.amazonaws.com": "ecr-login",
+		"123456789012.dkr.ecr.eu-west-1.amazonaws.com": "ecr-login",
+	}
+	if !reflect.DeepEqual(expected, m) {
+		t.Fatalf("expected %v, got %v", expected, m)
+	}
+}
+
+func TestPushRetriesEnv(t *testing.T) {
+	testCases := []struct {
+		registry crd.Registry
+		expected []corev1.EnvVar
+	}{
+		{
+			registry: crd.Registry{Target: "example.com/foo", Push: true},
+		},
+		{
+			registry: crd.Registry{Target: "example.com/foo", Push: true, PushRetries: 3},
+			expected: []corev1.EnvVar{{Name: "DBP_PUSH_RETRIES", Value: "3"}},
+		},
+	}
+	for _, tc := range testCases {
+		if actual := PushRetriesEnv(tc.registry); !reflect.DeepEqual(tc.expected, actual) {
+			t.Fatalf("%+v: expected %v, got %v", tc.registry, tc.expected, actual)
+		}
+	}
+}
+
+func TestTargetTemplateEnv(t *testing.T) {
+	testCases := []struct {
+		registry crd.Registry
+		expected []corev1.EnvVar
+	}{
+		{
+			registry: crd.Registry{Target: "example.com/foo:master"},
+		},
+		{
+			registry: crd.Registry{Target: "example.com/foo:git-{{.ShortSHA}}"},
+			expected: []corev1.EnvVar{{Name: "DBP_TARGET_REVISION_FILE", Value: "/cbi-gitcontext/resolved-revision"}},
+		},
+	}
+	for _, tc := range testCases {
+		if actual := TargetTemplateEnv(tc.registry, "/cbi-gitcontext/resolved-revision"); !reflect.DeepEqual(tc.expected, actual) {
+			t.Fatalf("%+v: expected %v, got %v", tc.registry, tc.expected, actual)
+		}
+	}
+}
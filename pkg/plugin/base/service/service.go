@@ -21,13 +21,18 @@ import (
 	"encoding/json"
 	"fmt"
 	"net"
+	"strconv"
 
 	"github.com/golang/glog"
+	"github.com/pkg/errors"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
 	crd "github.com/containerbuilding/cbi/pkg/apis/cbi/v1alpha1"
 	api "github.com/containerbuilding/cbi/pkg/plugin/api"
 	"github.com/containerbuilding/cbi/pkg/plugin/base"
+	"github.com/containerbuilding/cbi/pkg/plugin/base/cbipluginhelper"
 )
 
 type Service struct {
@@ -46,7 +51,17 @@ func ServeTCP(s *Service, port int) error {
 }
 
 func (s *Service) Info(ctx context.Context, req *api.InfoRequest) (*api.InfoResponse, error) {
-	return s.Backend.Info(ctx, req)
+	res, err := s.Backend.Info(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if res.Labels == nil {
+		res.Labels = make(map[string]string)
+	}
+	if _, ok := res.Labels[api.LPluginAPIVersion]; !ok {
+		res.Labels[api.LPluginAPIVersion] = strconv.Itoa(api.APIVersion)
+	}
+	return res, nil
 }
 
 func (s *Service) Spec(ctx context.Context, req *api.SpecRequest) (*api.SpecResponse, error) {
@@ -56,7 +71,7 @@ func (s *Service) Spec(ctx context.Context, req *api.SpecRequest) (*api.SpecResp
 	}
 	sp, err := s.Backend.CreatePodTemplateSpec(ctx, buildJob)
 	if err != nil {
-		return nil, err
+		return nil, specError(err)
 	}
 	spJSON, err := json.Marshal(sp)
 	if err != nil {
@@ -67,3 +82,22 @@ func (s *Service) Spec(ctx context.Context, req *api.SpecRequest) (*api.SpecResp
 	}
 	return res, nil
 }
+
+// specError converts cbipluginhelper.InjectError to the gRPC status,
+// so that the controller can tell the reason.
+func specError(err error) error {
+	ie, ok := errors.Cause(err).(*cbipluginhelper.InjectError)
+	if !ok {
+		return err
+	}
+	code := codes.InvalidArgument
+	switch ie.Reason {
+	case cbipluginhelper.InjectErrorUnsupportedKind:
+		code = codes.Unimplemented
+	case cbipluginhelper.InjectErrorNotEnabled:
+		code = codes.FailedPrecondition
+	case cbipluginhelper.InjectErrorInvalidInjector:
+		code = codes.Internal
+	}
+	return status.Error(code, err.Error())
+}
@@ -0,0 +1,157 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package trigger
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"net/http"
+	"strings"
+)
+
+// zeroCommit is the commit SHA of the deleted refs in the push events.
+const zeroCommit = "0000000000000000000000000000000000000000"
+
+// githubPushEvent is the subset of the GitHub push event payload.
+// https://developer.github.com/v3/activity/events/types/#pushevent
+type githubPushEvent struct {
+	Ref        string `json:"ref"`
+	After      string `json:"after"`
+	Deleted    bool   `json:"deleted"`
+	Repository struct {
+		CloneURL string `json:"clone_url"`
+		SSHURL   string `json:"ssh_url"`
+		GitURL   string `json:"git_url"`
+	} `json:"repository"`
+}
+
+// gitlabPushEvent is the subset of the GitLab push and tag push event payloads.
+// https://docs.gitlab.com/ee/user/project/integrations/webhooks.html
+type gitlabPushEvent struct {
+	Ref     string `json:"ref"`
+	After   string `json:"after"`
+	Project struct {
+		GitHTTPURL string `json:"git_http_url"`
+		GitSSHURL  string `json:"git_ssh_url"`
+	} `json:"project"`
+}
+
+// verifyGitHubSignature verifies X-Hub-Signature-256 (or X-Hub-Signature for older servers),
+// the HMAC of the body with the secret.
+func verifyGitHubSignature(secret, body []byte, header http.Header) error {
+	if len(secret) == 0 {
+		return fmt.Errorf("no secret is configured")
+	}
+	var (
+		newHash func() hash.Hash
+		prefix  string
+		sig     string
+	)
+	if sig = header.Get("X-Hub-Signature-256"); sig != "" {
+		newHash, prefix = sha256.New, "sha256="
+	} else if sig = header.Get("X-Hub-Signature"); sig != "" {
+		newHash, prefix = sha1.New, "sha1="
+	} else {
+		return fmt.Errorf("missing X-Hub-Signature-256 header")
+	}
+	if !strings.HasPrefix(sig, prefix) {
+		return fmt.Errorf("unsupported signature %q", sig)
+	}
+	actual, err := hex.DecodeString(strings.TrimPrefix(sig, prefix))
+	if err != nil {
+		return fmt.Errorf("malformed signature %q", sig)
+	}
+	mac := hmac.New(newHash, secret)
+	mac.Write(body)
+	if !hmac.Equal(actual, mac.Sum(nil)) {
+		return fmt.Errorf("signature mismatch")
+	}
+	return nil
+}
+
+// verifyGitLabToken verifies X-Gitlab-Token, which is the secret itself.
+func verifyGitLabToken(secret []byte, header http.Header) error {
+	if len(secret) == 0 {
+		return fmt.Errorf("no secret is configured")
+	}
+	token := header.Get("X-Gitlab-Token")
+	if token == "" {
+		return fmt.Errorf("missing X-Gitlab-Token header")
+	}
+	if subtle.ConstantTimeCompare([]byte(token), secret) != 1 {
+		return fmt.Errorf("token mismatch")
+	}
+	return nil
+}
+
+// parseGitHubEvent parses the payload of the X-GitHub-Event event.
+// It returns nil for the events other than the pushes, and for the deletions of the refs.
+func parseGitHubEvent(event string, body []byte) (*Event, error) {
+	if event != "push" {
+		return nil, nil
+	}
+	var p githubPushEvent
+	if err := json.Unmarshal(body, &p); err != nil {
+		return nil, fmt.Errorf("failed to decode the push event: %v", err)
+	}
+	if p.Deleted || p.After == zeroCommit {
+		return nil, nil
+	}
+	ev := &Event{
+		RepoURLs: nonEmpty(p.Repository.CloneURL, p.Repository.SSHURL, p.Repository.GitURL),
+		Ref:      p.Ref,
+		Commit:   p.After,
+	}
+	return ev, ev.validate()
+}
+
+// parseGitLabEvent parses the payload of the X-Gitlab-Event event.
+// It returns nil for the events other than the pushes, and for the deletions of the refs.
+func parseGitLabEvent(event string, body []byte) (*Event, error) {
+	if event != "Push Hook" && event != "Tag Push Hook" {
+		return nil, nil
+	}
+	var p gitlabPushEvent
+	if err := json.Unmarshal(body, &p); err != nil {
+		return nil, fmt.Errorf("failed to decode the push event: %v", err)
+	}
+	if p.After == zeroCommit {
+		return nil, nil
+	}
+	ev := &Event{
+		RepoURLs: nonEmpty(p.Project.GitHTTPURL, p.Project.GitSSHURL),
+		Ref:      p.Ref,
+		Commit:   p.After,
+	}
+	return ev, ev.validate()
+}
+
+func nonEmpty(ss ...string) []string {
+	var res []string
+	for _, s := range ss {
+		if s != "" {
+			res = append(res, s)
+		}
+	}
+	return res
+}
@@ -0,0 +1,71 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package trigger
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/hex"
+	"net/http"
+	"testing"
+)
+
+func TestVerifyGitHubSignature(t *testing.T) {
+	body := []byte(githubPushPayload)
+	mac := hmac.New(sha1.New, []byte(testSecret))
+	mac.Write(body)
+	sha1Sig := "sha1=" + hex.EncodeToString(mac.Sum(nil))
+	cases := []struct {
+		secret string
+		header map[string]string
+		valid  bool
+	}{
+		{secret: testSecret, header: map[string]string{"X-Hub-Signature-256": githubSignature(githubPushPayload)}, valid: true},
+		{secret: testSecret, header: map[string]string{"X-Hub-Signature": sha1Sig}, valid: true},
+		{secret: testSecret, header: map[string]string{"X-Hub-Signature-256": githubSignature(githubPushPayload), "X-Hub-Signature": "sha1=00"}, valid: true},
+		{secret: testSecret, header: map[string]string{"X-Hub-Signature-256": sha1Sig}},
+		{secret: testSecret, header: map[string]string{"X-Hub-Signature-256": "sha256=zz"}},
+		{secret: testSecret},
+		{secret: "", header: map[string]string{"X-Hub-Signature-256": githubSignature(githubPushPayload)}},
+	}
+	for _, c := range cases {
+		header := http.Header{}
+		for k, v := range c.header {
+			header.Set(k, v)
+		}
+		err := verifyGitHubSignature([]byte(c.secret), body, header)
+		if valid := err == nil; valid != c.valid {
+			t.Fatalf("%+v: unexpected error: %v", c, err)
+		}
+	}
+}
+
+func TestParseGitLabEvent(t *testing.T) {
+	ev, err := parseGitLabEvent("Tag Push Hook", []byte(gitlabTagPushPayload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ev.Tag() != "v1.0.0" || ev.Branch() != "" || ev.Commit != testCommit || len(ev.RepoURLs) != 2 {
+		t.Fatalf("unexpected event %+v", ev)
+	}
+	if ev, err := parseGitLabEvent("Merge Request Hook", []byte(`{}`)); ev != nil || err != nil {
+		t.Fatalf("expected to be ignored, got %+v, %v", ev, err)
+	}
+	if _, err := parseGitLabEvent("Push Hook", []byte(`{"ref":"refs/heads/master","after":"`+testCommit+`"}`)); err == nil {
+		t.Fatal("error is expected for missing project")
+	}
+}
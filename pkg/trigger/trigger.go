@@ -0,0 +1,243 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package trigger creates BuildJobs from the push events of GitHub and GitLab webhooks.
+package trigger
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"text/template"
+
+	"github.com/golang/glog"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	crd "github.com/containerbuilding/cbi/pkg/apis/cbi/v1alpha1"
+	clientset "github.com/containerbuilding/cbi/pkg/client/clientset/versioned"
+)
+
+// maxRequestBytes is the limit of the request body size, same as the limit of GitHub.
+const maxRequestBytes = 25 * 1024 * 1024
+
+// Event is a push event.
+type Event struct {
+	// RepoURLs are the URLs of the repository. The first one is the HTTPS clone URL.
+	RepoURLs []string
+	// Ref is the pushed ref, e.g. "refs/heads/master".
+	Ref string
+	// Commit is the SHA of the pushed commit.
+	Commit string
+}
+
+func (ev *Event) validate() error {
+	if len(ev.RepoURLs) == 0 {
+		return fmt.Errorf("the push event has no repository URL")
+	}
+	if ev.Commit == "" {
+		return fmt.Errorf("the push event has no commit")
+	}
+	return nil
+}
+
+// Branch returns the pushed branch, e.g. "master". Empty for the tags.
+func (ev *Event) Branch() string {
+	if !strings.HasPrefix(ev.Ref, "refs/heads/") {
+		return ""
+	}
+	return strings.TrimPrefix(ev.Ref, "refs/heads/")
+}
+
+// Tag returns the pushed tag, e.g. "v1.0.0". Empty for the branches.
+func (ev *Event) Tag() string {
+	if !strings.HasPrefix(ev.Ref, "refs/tags/") {
+		return ""
+	}
+	return strings.TrimPrefix(ev.Ref, "refs/tags/")
+}
+
+// ShortCommit returns the first 7 characters of Commit.
+func (ev *Event) ShortCommit() string {
+	if len(ev.Commit) > crd.ShortSHALength {
+		return ev.Commit[:crd.ShortSHALength]
+	}
+	return ev.Commit
+}
+
+// SHA is an alias of Commit, for the same variables as crd.TargetVariables.
+func (ev *Event) SHA() string {
+	return ev.Commit
+}
+
+// ShortSHA is an alias of ShortCommit, for the same variables as crd.TargetVariables.
+func (ev *Event) ShortSHA() string {
+	return ev.ShortCommit()
+}
+
+// matchesRepo returns true if url is one of RepoURLs, ignoring the ".git" suffix.
+func (ev *Event) matchesRepo(url string) bool {
+	normalize := func(s string) string {
+		return strings.TrimSuffix(strings.TrimSuffix(s, "/"), ".git")
+	}
+	for _, u := range ev.RepoURLs {
+		if normalize(u) == normalize(url) {
+			return true
+		}
+	}
+	return false
+}
+
+// errRepoMismatch is returned by NewBuildJob when the event is not for the repository of the template.
+var errRepoMismatch = fmt.Errorf("the repository of the push event does not match the template")
+
+// NewBuildJob returns the BuildJob for the event, based on tmpl.
+//
+// The Git context of tmpl is set to the pushed commit.
+// When tmpl has Spec.Context.Git.URL, the event needs to be for the same repository,
+// and the URL of tmpl (e.g. an SSH URL for Git.SSHSecretRef) is kept.
+//
+// Spec.Registry.Target and Spec.Registry.AdditionalTargets are expanded as text/template
+// with the event, e.g. `example.com/foo:{{.ShortSHA}}`.
+// The variables of crd.TargetVariables (SHA, ShortSHA, Branch, and Tag) are available,
+// as well as Commit, ShortCommit, and Ref.
+//
+// Metadata.Name is used as the prefix of Metadata.GenerateName, as a template creates multiple BuildJobs.
+func NewBuildJob(tmpl *crd.BuildJob, ev *Event) (*crd.BuildJob, error) {
+	b := tmpl.DeepCopy()
+	if b.GenerateName == "" {
+		b.GenerateName = b.Name + "-"
+		if b.Name == "" {
+			b.GenerateName = "buildjob-"
+		}
+	}
+	b.Name = ""
+	switch b.Spec.Context.Kind {
+	case "", crd.ContextKindGit:
+		b.Spec.Context.Kind = crd.ContextKindGit
+	default:
+		return nil, fmt.Errorf("the template needs to have Git context, got %q", b.Spec.Context.Kind)
+	}
+	if url := b.Spec.Context.Git.URL; url == "" {
+		b.Spec.Context.Git.URL = ev.RepoURLs[0]
+	} else if !ev.matchesRepo(url) {
+		return nil, errRepoMismatch
+	}
+	b.Spec.Context.Git.Revision = ev.Commit
+	b.Spec.Context.Git.RevisionType = crd.GitRevisionTypeCommit
+	var err error
+	if b.Spec.Registry.Target, err = expand(b.Spec.Registry.Target, ev); err != nil {
+		return nil, err
+	}
+	for i, t := range b.Spec.Registry.AdditionalTargets {
+		if b.Spec.Registry.AdditionalTargets[i], err = expand(t, ev); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+func expand(s string, ev *Event) (string, error) {
+	t, err := template.New("").Option("missingkey=error").Parse(s)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse %q: %v", s, err)
+	}
+	var b bytes.Buffer
+	if err := t.Execute(&b, ev); err != nil {
+		return "", fmt.Errorf("failed to expand %q: %v", s, err)
+	}
+	return b.String(), nil
+}
+
+// Handler serves the push event webhooks of GitHub and GitLab, and creates a BuildJob for each push.
+type Handler struct {
+	Client clientset.Interface
+	// Template is the BuildJob template. See NewBuildJob.
+	// The BuildJobs are created in the namespace of Template, or in "default".
+	Template *crd.BuildJob
+	// Secret is the webhook secret, used for verifying the signatures (GitHub)
+	// or the tokens (GitLab).
+	Secret []byte
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestBytes))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var ev *Event
+	if e := r.Header.Get("X-GitHub-Event"); e != "" {
+		if err := verifyGitHubSignature(h.Secret, body, r.Header); err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		ev, err = parseGitHubEvent(e, body)
+	} else if e := r.Header.Get("X-Gitlab-Event"); e != "" {
+		if err := verifyGitLabToken(h.Secret, r.Header); err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		ev, err = parseGitLabEvent(e, body)
+	} else {
+		http.Error(w, "missing X-GitHub-Event or X-Gitlab-Event header", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if ev == nil {
+		// e.g. ping events
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	buildJob, err := NewBuildJob(h.Template, ev)
+	if err == errRepoMismatch {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if errs := crd.ValidateBuildJobSpec(buildJob.Spec, field.NewPath("spec")); len(errs) > 0 {
+		http.Error(w, fmt.Sprintf("the BuildJob is invalid: %v", errs.ToAggregate()), http.StatusUnprocessableEntity)
+		return
+	}
+	ns := buildJob.Namespace
+	if ns == "" {
+		ns = metav1.NamespaceDefault
+	}
+	created, err := h.Client.CbiV1alpha1().BuildJobs(ns).Create(buildJob)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to create the BuildJob: %v", err), http.StatusInternalServerError)
+		return
+	}
+	glog.Infof("Created BuildJob %s/%s for %s (%s)", ns, created.Name, ev.Ref, ev.Commit)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(created); err != nil {
+		glog.Errorf("failed to write the response: %v", err)
+	}
+}
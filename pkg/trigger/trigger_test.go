@@ -0,0 +1,273 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package trigger
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	crd "github.com/containerbuilding/cbi/pkg/apis/cbi/v1alpha1"
+	"github.com/containerbuilding/cbi/pkg/client/clientset/versioned/fake"
+)
+
+const (
+	testSecret = "s3cr3t"
+	testCommit = "0123456789abcdef0123456789abcdef01234567"
+)
+
+const githubPushPayload = `{
+  "ref": "refs/heads/master",
+  "before": "fedcba9876543210fedcba9876543210fedcba98",
+  "after": "0123456789abcdef0123456789abcdef01234567",
+  "deleted": false,
+  "repository": {
+    "full_name": "example/foo",
+    "clone_url": "https://github.com/example/foo.git",
+    "ssh_url": "git@github.com:example/foo.git",
+    "git_url": "git://github.com/example/foo.git"
+  }
+}`
+
+const githubDeletePayload = `{
+  "ref": "refs/heads/feature",
+  "after": "0000000000000000000000000000000000000000",
+  "deleted": true,
+  "repository": {
+    "clone_url": "https://github.com/example/foo.git"
+  }
+}`
+
+const gitlabTagPushPayload = `{
+  "object_kind": "tag_push",
+  "ref": "refs/tags/v1.0.0",
+  "before": "0000000000000000000000000000000000000000",
+  "after": "0123456789abcdef0123456789abcdef01234567",
+  "project": {
+    "path_with_namespace": "example/foo",
+    "git_http_url": "https://gitlab.com/example/foo.git",
+    "git_ssh_url": "git@gitlab.com:example/foo.git"
+  }
+}`
+
+func githubSignature(body string) string {
+	mac := hmac.New(sha256.New, []byte(testSecret))
+	mac.Write([]byte(body))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func testTemplate(url string) *crd.BuildJob {
+	return &crd.BuildJob{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "ns"},
+		Spec: crd.BuildJobSpec{
+			Registry: crd.Registry{
+				Target:            "example.com/foo:{{.ShortCommit}}",
+				AdditionalTargets: []string{"example.com/foo:{{or .Tag .Branch}}"},
+				Push:              true,
+			},
+			Language: crd.Language{Kind: crd.LanguageKindDockerfile},
+			Context: crd.Context{
+				Kind: crd.ContextKindGit,
+				Git:  crd.Git{URL: url, Depth: 1},
+			},
+		},
+	}
+}
+
+func TestHandler(t *testing.T) {
+	cases := []struct {
+		name         string
+		templateURL  string
+		header       map[string]string
+		body         string
+		expectedCode int
+		// expectedTargets is set when a BuildJob is expected to be created
+		expectedTargets []string
+		expectedURL     string
+	}{
+		{
+			name: "github push",
+			header: map[string]string{
+				"X-GitHub-Event":      "push",
+				"X-Hub-Signature-256": githubSignature(githubPushPayload),
+			},
+			body:            githubPushPayload,
+			expectedCode:    http.StatusCreated,
+			expectedTargets: []string{"example.com/foo:0123456", "example.com/foo:master"},
+			expectedURL:     "https://github.com/example/foo.git",
+		},
+		{
+			name:        "github push with SSH URL in the template",
+			templateURL: "git@github.com:example/foo",
+			header: map[string]string{
+				"X-GitHub-Event":      "push",
+				"X-Hub-Signature-256": githubSignature(githubPushPayload),
+			},
+			body:            githubPushPayload,
+			expectedCode:    http.StatusCreated,
+			expectedTargets: []string{"example.com/foo:0123456", "example.com/foo:master"},
+			expectedURL:     "git@github.com:example/foo",
+		},
+		{
+			name:        "github push for another repo",
+			templateURL: "https://github.com/example/bar.git",
+			header: map[string]string{
+				"X-GitHub-Event":      "push",
+				"X-Hub-Signature-256": githubSignature(githubPushPayload),
+			},
+			body:         githubPushPayload,
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name: "github push with bad signature",
+			header: map[string]string{
+				"X-GitHub-Event":      "push",
+				"X-Hub-Signature-256": githubSignature(githubPushPayload + " "),
+			},
+			body:         githubPushPayload,
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			name:         "github push without signature",
+			header:       map[string]string{"X-GitHub-Event": "push"},
+			body:         githubPushPayload,
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			name: "github branch deletion",
+			header: map[string]string{
+				"X-GitHub-Event":      "push",
+				"X-Hub-Signature-256": githubSignature(githubDeletePayload),
+			},
+			body:         githubDeletePayload,
+			expectedCode: http.StatusNoContent,
+		},
+		{
+			name: "github ping",
+			header: map[string]string{
+				"X-GitHub-Event":      "ping",
+				"X-Hub-Signature-256": githubSignature(`{"zen":"Keep it logically awesome."}`),
+			},
+			body:         `{"zen":"Keep it logically awesome."}`,
+			expectedCode: http.StatusNoContent,
+		},
+		{
+			name: "gitlab tag push",
+			header: map[string]string{
+				"X-Gitlab-Event": "Tag Push Hook",
+				"X-Gitlab-Token": testSecret,
+			},
+			body:            gitlabTagPushPayload,
+			expectedCode:    http.StatusCreated,
+			expectedTargets: []string{"example.com/foo:0123456", "example.com/foo:v1.0.0"},
+			expectedURL:     "https://gitlab.com/example/foo.git",
+		},
+		{
+			name: "gitlab tag push with bad token",
+			header: map[string]string{
+				"X-Gitlab-Event": "Tag Push Hook",
+				"X-Gitlab-Token": "wrong",
+			},
+			body:         gitlabTagPushPayload,
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			name:         "unknown webhook",
+			body:         githubPushPayload,
+			expectedCode: http.StatusBadRequest,
+		},
+	}
+	for _, c := range cases {
+		client := fake.NewSimpleClientset()
+		h := &Handler{
+			Client:   client,
+			Template: testTemplate(c.templateURL),
+			Secret:   []byte(testSecret),
+		}
+		req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader([]byte(c.body)))
+		for k, v := range c.header {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != c.expectedCode {
+			t.Fatalf("%s: expected %d, got %d: %s", c.name, c.expectedCode, rec.Code, rec.Body.String())
+		}
+		list, err := client.CbiV1alpha1().BuildJobs("ns").List(metav1.ListOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.expectedTargets == nil {
+			if len(list.Items) != 0 {
+				t.Fatalf("%s: unexpected BuildJobs %+v", c.name, list.Items)
+			}
+			continue
+		}
+		if len(list.Items) != 1 {
+			t.Fatalf("%s: expected 1 BuildJob, got %+v", c.name, list.Items)
+		}
+		b := list.Items[0]
+		if b.GenerateName != "foo-" {
+			t.Fatalf("%s: unexpected GenerateName %q", c.name, b.GenerateName)
+		}
+		targets := append([]string{b.Spec.Registry.Target}, b.Spec.Registry.AdditionalTargets...)
+		if len(targets) != len(c.expectedTargets) || targets[0] != c.expectedTargets[0] || targets[1] != c.expectedTargets[1] {
+			t.Fatalf("%s: expected targets %v, got %v", c.name, c.expectedTargets, targets)
+		}
+		git := b.Spec.Context.Git
+		if git.URL != c.expectedURL || git.Revision != testCommit || git.RevisionType != crd.GitRevisionTypeCommit || git.Depth != 1 {
+			t.Fatalf("%s: unexpected Git context %+v", c.name, git)
+		}
+	}
+}
+
+func TestNewBuildJobInvalidTemplate(t *testing.T) {
+	ev := &Event{RepoURLs: []string{"https://github.com/example/foo.git"}, Ref: "refs/heads/master", Commit: testCommit}
+	tmpl := testTemplate("")
+	tmpl.Spec.Context = crd.Context{Kind: crd.ContextKindHTTP}
+	if _, err := NewBuildJob(tmpl, ev); err == nil {
+		t.Fatal("error is expected for HTTP context")
+	}
+	tmpl = testTemplate("")
+	tmpl.Spec.Registry.Target = "example.com/foo:{{.Unknown}}"
+	if _, err := NewBuildJob(tmpl, ev); err == nil {
+		t.Fatal("error is expected for unknown template field")
+	}
+}
+
+func TestNewBuildJobTargetVariables(t *testing.T) {
+	ev := &Event{RepoURLs: []string{"https://github.com/example/foo.git"}, Ref: "refs/tags/v1.0.0", Commit: testCommit}
+	tmpl := testTemplate("")
+	tmpl.Spec.Registry.Target = "example.com/foo:{{.ShortSHA}}"
+	tmpl.Spec.Registry.AdditionalTargets = []string{"example.com/foo:{{.SHA}}", "example.com/foo:{{or .Tag .Branch}}"}
+	b, err := NewBuildJob(tmpl, ev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"example.com/foo:" + testCommit[:7], "example.com/foo:" + testCommit, "example.com/foo:v1.0.0"}
+	actual := append([]string{b.Spec.Registry.Target}, b.Spec.Registry.AdditionalTargets...)
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("expected %v, got %v", expected, actual)
+	}
+}
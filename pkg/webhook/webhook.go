@@ -0,0 +1,142 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package webhook provides the validating admission webhook for BuildJobs.
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+
+	"github.com/golang/glog"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	"github.com/containerbuilding/cbi/pkg/apis/cbi"
+	crd "github.com/containerbuilding/cbi/pkg/apis/cbi/v1alpha1"
+)
+
+// maxRequestBytes is the limit of the request body size.
+const maxRequestBytes = 4 * 1024 * 1024
+
+// ValidateBuildJob validates the BuildJob independently of the plugins.
+func ValidateBuildJob(buildJob *crd.BuildJob) field.ErrorList {
+	return crd.ValidateBuildJobSpec(buildJob.Spec, field.NewPath("spec"))
+}
+
+// Review returns the response for the admission request.
+// Only CREATE and UPDATE are validated, and UPDATE is allowed without validation when the spec is unchanged
+// (e.g. the status and finalizer updates by the controller) or the BuildJob is being deleted.
+func Review(req *AdmissionRequest) *AdmissionResponse {
+	resp := &AdmissionResponse{UID: req.UID}
+	if req.Operation != OperationCreate && req.Operation != OperationUpdate {
+		resp.Allowed = true
+		return resp
+	}
+	var buildJob crd.BuildJob
+	if err := json.Unmarshal(req.Object.Raw, &buildJob); err != nil {
+		resp.Result = &metav1.Status{
+			Status:  metav1.StatusFailure,
+			Message: fmt.Sprintf("failed to decode the object: %v", err),
+			Reason:  metav1.StatusReasonBadRequest,
+			Code:    http.StatusBadRequest,
+		}
+		return resp
+	}
+	if req.Operation == OperationUpdate {
+		if buildJob.DeletionTimestamp != nil {
+			resp.Allowed = true
+			return resp
+		}
+		var oldBuildJob crd.BuildJob
+		if err := json.Unmarshal(req.OldObject.Raw, &oldBuildJob); err == nil && reflect.DeepEqual(oldBuildJob.Spec, buildJob.Spec) {
+			resp.Allowed = true
+			return resp
+		}
+	}
+	errs := ValidateBuildJob(&buildJob)
+	if len(errs) == 0 {
+		resp.Allowed = true
+		return resp
+	}
+	name := buildJob.Name
+	if name == "" {
+		name = req.Name
+	}
+	resp.Result = invalidStatus(name, errs)
+	return resp
+}
+
+// invalidStatus converts the errors to a status, like k8s.io/apimachinery/pkg/api/errors.NewInvalid.
+func invalidStatus(name string, errs field.ErrorList) *metav1.Status {
+	causes := make([]metav1.StatusCause, 0, len(errs))
+	for _, e := range errs {
+		causes = append(causes, metav1.StatusCause{
+			Type:    metav1.CauseType(e.Type),
+			Message: e.ErrorBody(),
+			Field:   e.Field,
+		})
+	}
+	return &metav1.Status{
+		Status:  metav1.StatusFailure,
+		Message: fmt.Sprintf("BuildJob %q is invalid: %v", name, errs.ToAggregate()),
+		Reason:  metav1.StatusReasonInvalid,
+		Code:    http.StatusUnprocessableEntity,
+		Details: &metav1.StatusDetails{
+			Name:   name,
+			Group:  cbi.GroupName,
+			Kind:   "BuildJob",
+			Causes: causes,
+		},
+	}
+}
+
+// Handler serves AdmissionReview requests.
+type Handler struct{}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+		http.Error(w, fmt.Sprintf("unsupported Content-Type: %q", ct), http.StatusUnsupportedMediaType)
+		return
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestBytes))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var review AdmissionReview
+	if err := json.Unmarshal(body, &review); err != nil {
+		http.Error(w, fmt.Sprintf("failed to decode AdmissionReview: %v", err), http.StatusBadRequest)
+		return
+	}
+	if review.Request == nil {
+		http.Error(w, "AdmissionReview.Request is missing", http.StatusBadRequest)
+		return
+	}
+	review.Response = Review(review.Request)
+	review.Request = nil
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(review); err != nil {
+		glog.Errorf("failed to encode AdmissionReview: %v", err)
+	}
+}
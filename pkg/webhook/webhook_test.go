@@ -0,0 +1,229 @@
+/*
+Copyright The CBI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	crd "github.com/containerbuilding/cbi/pkg/apis/cbi/v1alpha1"
+)
+
+func TestHandler(t *testing.T) {
+	valid := crd.BuildJobSpec{
+		Registry: crd.Registry{Target: "example.com/foo:latest", Push: true},
+		Language: crd.Language{Kind: crd.LanguageKindDockerfile},
+		Context:  crd.Context{Kind: crd.ContextKindGit, Git: crd.Git{URL: "https://example.com/foo.git"}},
+	}
+	cases := []struct {
+		mutate func(*crd.BuildJobSpec)
+		fields []string
+	}{
+		{
+			mutate: func(s *crd.BuildJobSpec) {},
+		},
+		{
+			mutate: func(s *crd.BuildJobSpec) { s.Context.Git.URL = "" },
+			fields: []string{"spec.context.git.url"},
+		},
+		{
+			mutate: func(s *crd.BuildJobSpec) { s.Context.Git.StrictHostKeyChecking = true },
+			fields: []string{"spec.context.git.sshSecretRef.name"},
+		},
+		{
+			mutate: func(s *crd.BuildJobSpec) { s.Context = crd.Context{Kind: crd.ContextKindConfigMap} },
+			fields: []string{"spec.context.configMapRef.name"},
+		},
+		{
+			mutate: func(s *crd.BuildJobSpec) { s.Context = crd.Context{Kind: crd.ContextKindHTTP} },
+			fields: []string{"spec.context.http.url"},
+		},
+		{
+			mutate: func(s *crd.BuildJobSpec) {
+				s.Context = crd.Context{Kind: crd.ContextKindHTTP, HTTP: crd.HTTP{URL: "https://example.com/foo.tar",
+					Insecure: true, CASecretRef: corev1.LocalObjectReference{Name: "ca"}}}
+			},
+			fields: []string{"spec.context.http.caSecretRef"},
+		},
+		{
+			mutate: func(s *crd.BuildJobSpec) { s.Context = crd.Context{Kind: crd.ContextKindRclone} },
+			fields: []string{"spec.context.rclone.remote", "spec.context.rclone.secretRef.name"},
+		},
+		{
+			mutate: func(s *crd.BuildJobSpec) { s.Context = crd.Context{Kind: crd.ContextKindLocal} },
+			fields: []string{"spec.context.local.path"},
+		},
+		{
+			mutate: func(s *crd.BuildJobSpec) { s.Context = crd.Context{Kind: crd.ContextKindS3} },
+			fields: []string{"spec.context.s3.bucket", "spec.context.s3.key"},
+		},
+		{
+			mutate: func(s *crd.BuildJobSpec) { s.Registry.Target = "" },
+			fields: []string{"spec.registry.target"},
+		},
+		{
+			mutate: func(s *crd.BuildJobSpec) { s.Registry.Target = "example.com/Foo" },
+			fields: []string{"spec.registry.target"},
+		},
+		{
+			mutate: func(s *crd.BuildJobSpec) { s.Registry.AdditionalTargets = []string{"example.com/foo:bar", ""} },
+			fields: []string{"spec.registry.additionalTargets[1]"},
+		},
+		{
+			mutate: func(s *crd.BuildJobSpec) {
+				s.Registry.Insecure = true
+				s.Registry.CASecretRef.Name = "ca"
+			},
+			fields: []string{"spec.registry.caSecretRef"},
+		},
+		{
+			mutate: func(s *crd.BuildJobSpec) { s.Language.Kind = crd.LanguageKindCloudbuild },
+			fields: []string{"spec.registry.target"},
+		},
+	}
+	for i, c := range cases {
+		buildJob := crd.BuildJob{ObjectMeta: metav1.ObjectMeta{Name: "foo"}}
+		valid.DeepCopyInto(&buildJob.Spec)
+		c.mutate(&buildJob.Spec)
+		raw, err := json.Marshal(buildJob)
+		if err != nil {
+			t.Fatal(err)
+		}
+		review := AdmissionReview{
+			Request: &AdmissionRequest{
+				UID:       "dummy",
+				Operation: OperationCreate,
+				Object:    runtime.RawExtension{Raw: raw},
+			},
+		}
+		resp := serve(t, review)
+		if resp.UID != "dummy" {
+			t.Fatalf("%d: unexpected UID %q", i, resp.UID)
+		}
+		if resp.Allowed != (len(c.fields) == 0) {
+			t.Fatalf("%d: unexpected Allowed %v: %+v", i, resp.Allowed, resp.Result)
+		}
+		if resp.Allowed {
+			continue
+		}
+		if resp.Result.Code != http.StatusUnprocessableEntity || resp.Result.Reason != metav1.StatusReasonInvalid {
+			t.Fatalf("%d: unexpected status: %+v", i, resp.Result)
+		}
+		var fields []string
+		for _, cause := range resp.Result.Details.Causes {
+			fields = append(fields, cause.Field)
+		}
+		if !reflect.DeepEqual(fields, c.fields) {
+			t.Fatalf("%d: expected %v, got %v", i, c.fields, resp.Result.Details.Causes)
+		}
+	}
+}
+
+func TestHandlerBadObject(t *testing.T) {
+	review := AdmissionReview{
+		Request: &AdmissionRequest{
+			UID:       "dummy",
+			Operation: OperationCreate,
+			Object:    runtime.RawExtension{Raw: []byte(`{"spec":42}`)},
+		},
+	}
+	resp := serve(t, review)
+	if resp.Allowed || resp.Result.Code != http.StatusBadRequest {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+}
+
+func TestHandlerOperations(t *testing.T) {
+	invalid := crd.BuildJob{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo"},
+		Spec:       crd.BuildJobSpec{Context: crd.Context{Kind: crd.ContextKindGit}},
+	}
+	metadataChanged := invalid.DeepCopy()
+	metadataChanged.Finalizers = []string{"foo"}
+	metadataChanged.Status.Job = "foo-job"
+	deleting := invalid.DeepCopy()
+	now := metav1.Now()
+	deleting.DeletionTimestamp = &now
+	deleting.Spec.Registry.Target = "example.com/foo"
+	specChanged := invalid.DeepCopy()
+	specChanged.Spec.Registry.Target = "example.com/foo"
+	cases := []struct {
+		operation string
+		object    interface{}
+		oldObject interface{}
+		allowed   bool
+	}{
+		{operation: OperationCreate, object: invalid},
+		{operation: "DELETE", oldObject: invalid, allowed: true},
+		{operation: "CONNECT", allowed: true},
+		{operation: OperationUpdate, object: metadataChanged, oldObject: invalid, allowed: true},
+		{operation: OperationUpdate, object: deleting, oldObject: invalid, allowed: true},
+		{operation: OperationUpdate, object: specChanged, oldObject: invalid},
+		// the old object is missing
+		{operation: OperationUpdate, object: metadataChanged},
+	}
+	for i, c := range cases {
+		req := &AdmissionRequest{UID: "dummy", Operation: c.operation}
+		for _, x := range []struct {
+			obj interface{}
+			raw *runtime.RawExtension
+		}{{c.object, &req.Object}, {c.oldObject, &req.OldObject}} {
+			if x.obj == nil {
+				continue
+			}
+			raw, err := json.Marshal(x.obj)
+			if err != nil {
+				t.Fatal(err)
+			}
+			x.raw.Raw = raw
+		}
+		resp := serve(t, AdmissionReview{Request: req})
+		if resp.Allowed != c.allowed {
+			t.Fatalf("%d: unexpected Allowed %v: %+v", i, resp.Allowed, resp.Result)
+		}
+	}
+}
+
+func serve(t *testing.T, review AdmissionReview) *AdmissionResponse {
+	body, err := json.Marshal(review)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	(&Handler{}).ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected HTTP status %d: %s", rec.Code, rec.Body.String())
+	}
+	var res AdmissionReview
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	if res.Response == nil {
+		t.Fatalf("no response: %s", rec.Body.String())
+	}
+	return res.Response
+}